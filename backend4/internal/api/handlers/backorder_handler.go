@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BackorderHandler struct {
+	backorders *services.Backorders
+}
+
+func NewBackorderHandler(backorders *services.Backorders) *BackorderHandler {
+	return &BackorderHandler{backorders: backorders}
+}
+
+type BackorderPolicyRequest struct {
+	Mode        string     `json:"mode" binding:"required"`
+	Cap         int        `json:"cap"`
+	ReleaseDate *time.Time `json:"release_date"`
+}
+
+// ListPolicies lists the products sold beyond their stock
+func (h *BackorderHandler) ListPolicies(c *gin.Context) {
+	policies, err := h.backorders.Policies(c.Request.Context())
+	if err != nil {
+		log.Printf("Error listing backorder policies: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list policies"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policies": policies})
+}
+
+// SetPolicy lets a product be pre-ordered or backordered, up to cap units
+// waiting for stock
+func (h *BackorderHandler) SetPolicy(c *gin.Context) {
+	templateID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+	var req BackorderPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy := &models.BackorderPolicy{
+		TemplateID:  templateID,
+		Mode:        req.Mode,
+		Cap:         req.Cap,
+		ReleaseDate: req.ReleaseDate,
+	}
+	err = h.backorders.SetPolicy(c.Request.Context(), policy)
+	switch {
+	case errors.Is(err, services.ErrInvalidBackorderMode), errors.Is(err, services.ErrInvalidBackorderCap):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Error saving backorder policy of product %d: %v", templateID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save policy"})
+	default:
+		c.JSON(http.StatusOK, policy)
+	}
+}
+
+// DeletePolicy stops a product selling beyond its stock
+func (h *BackorderHandler) DeletePolicy(c *gin.Context) {
+	templateID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+	err = h.backorders.DeletePolicy(c.Request.Context(), templateID)
+	switch {
+	case errors.Is(err, services.ErrPolicyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Error deleting backorder policy of product %d: %v", templateID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete policy"})
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
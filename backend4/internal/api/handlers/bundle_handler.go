@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"ecommerce/pkg/odoo"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BundleHandler struct {
+	bundles *services.Bundles
+}
+
+func NewBundleHandler(bundles *services.Bundles) *BundleHandler {
+	return &BundleHandler{bundles: bundles}
+}
+
+type BundlePricingRequest struct {
+	Mode            string  `json:"mode" binding:"required"`
+	Price           float64 `json:"price"`
+	DiscountPercent float64 `json:"discount_percent"`
+}
+
+// GetBundle returns what a bundle variant holds and what it costs
+func (h *BundleHandler) GetBundle(c *gin.Context) {
+	variantID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid variant ID"})
+		return
+	}
+
+	bundle, err := h.bundles.GetBundle(c.Request.Context(), uint(variantID))
+	switch {
+	case errors.Is(err, services.ErrNotABundle), errors.Is(err, odoo.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": services.ErrNotABundle.Error()})
+	case err != nil:
+		log.Printf("Error fetching bundle %d: %v", variantID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get bundle"})
+	default:
+		c.JSON(http.StatusOK, bundle)
+	}
+}
+
+// ListPricings lists the bundles priced apart from their Odoo price
+func (h *BundleHandler) ListPricings(c *gin.Context) {
+	pricings, err := h.bundles.Pricings(c.Request.Context())
+	if err != nil {
+		log.Printf("Error listing bundle pricings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list pricings"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pricings": pricings})
+}
+
+// SetPricing prices a bundle product at a fixed price or at a discount on
+// its components
+func (h *BundleHandler) SetPricing(c *gin.Context) {
+	templateID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+	var req BundlePricingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pricing := &models.BundlePricing{
+		TemplateID:      templateID,
+		Mode:            req.Mode,
+		Price:           req.Price,
+		DiscountPercent: req.DiscountPercent,
+	}
+	err = h.bundles.SetPricing(c.Request.Context(), pricing)
+	switch {
+	case errors.Is(err, services.ErrInvalidBundleMode), errors.Is(err, services.ErrInvalidBundlePrice), errors.Is(err, services.ErrInvalidBundleDiscount):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Error saving bundle pricing of product %d: %v", templateID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save pricing"})
+	default:
+		c.JSON(http.StatusOK, pricing)
+	}
+}
+
+// DeletePricing prices a bundle product at its Odoo price again
+func (h *BundleHandler) DeletePricing(c *gin.Context) {
+	templateID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+	err = h.bundles.DeletePricing(c.Request.Context(), templateID)
+	switch {
+	case errors.Is(err, services.ErrPricingNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Error deleting bundle pricing of product %d: %v", templateID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete pricing"})
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
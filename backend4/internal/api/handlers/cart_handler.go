@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"ecommerce/internal/services"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -62,7 +64,7 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 	}
 
 	if err := h.cartService.AddToCart(c.Request.Context(), cartID, req.ProductID, req.VariantID, req.Quantity); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondCartError(c, err, req.VariantID)
 		return
 	}
 
@@ -86,7 +88,7 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
 	}
 
 	if err := h.cartService.UpdateCartItem(c.Request.Context(), cartID, req.ProductID, req.VariantID, req.Quantity); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondCartError(c, err, req.VariantID)
 		return
 	}
 
@@ -99,3 +101,16 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
 
 	c.JSON(http.StatusOK, cart)
 }
+
+// respondCartError rejects a cart change. Out of stock, it points the shopper
+// to the restock subscription of the variant.
+func respondCartError(c *gin.Context, err error, variantID uint) {
+	if errors.Is(err, services.ErrInsufficientStock) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":                err.Error(),
+			"restock_subscription": fmt.Sprintf("/api/variants/%d/restock-subscriptions", variantID),
+		})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
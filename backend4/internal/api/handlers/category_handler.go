@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CategoryHandler struct {
+	categoryService *services.CategoryService
+}
+
+func NewCategoryHandler(categoryService *services.CategoryService) *CategoryHandler {
+	return &CategoryHandler{categoryService: categoryService}
+}
+
+// GetCategories returns a category tree, the website's unless kind=internal
+func (h *CategoryHandler) GetCategories(c *gin.Context) {
+	tree, err := h.categoryService.GetTree(c.Request.Context(), c.DefaultQuery("kind", models.CategoryKindPublic))
+	if errors.Is(err, services.ErrCategoryKind) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching categories: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get categories"})
+		return
+	}
+	if tree == nil {
+		tree = []models.Category{}
+	}
+	c.JSON(http.StatusOK, tree)
+}
+
+// GetCategory returns a category, the website's unless kind=internal, with
+// its subcategories. Slugs a category had before it was renamed answer with
+// a permanent redirect to the current one.
+func (h *CategoryHandler) GetCategory(c *gin.Context) {
+	slug := c.Param("slug")
+	kind := c.DefaultQuery("kind", models.CategoryKindPublic)
+	category, err := h.categoryService.ResolveSlug(c.Request.Context(), kind, slug)
+	switch {
+	case errors.Is(err, services.ErrCategoryKind):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrCategoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+		return
+	case err != nil:
+		log.Printf("Error resolving category %s: %v", slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get category"})
+		return
+	}
+	if category.Slug != slug {
+		location := "/api/categories/" + url.PathEscape(category.Slug)
+		if query := c.Request.URL.RawQuery; query != "" {
+			location += "?" + query
+		}
+		c.Redirect(http.StatusMovedPermanently, location)
+		return
+	}
+
+	if category.Children, err = h.categoryService.Children(c.Request.Context(), category); err != nil {
+		log.Printf("Error fetching subcategories of %s: %v", slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get category"})
+		return
+	}
+	c.JSON(http.StatusOK, category)
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"ecommerce/internal/models"
 	"ecommerce/internal/services"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -54,6 +55,10 @@ func (h *CheckoutHandler) CompleteCheckout(c *gin.Context) {
 	}
 
 	if err := h.checkoutService.CompleteCheckout(c.Request.Context(), checkoutID, paymentData); err != nil {
+		if errors.Is(err, services.ErrPaymentNotCompleted) {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
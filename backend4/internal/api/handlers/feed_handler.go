@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"ecommerce/internal/services"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Content types of the feed formats by file extension
+var feedContentTypes = map[string]string{
+	".xml": "application/xml; charset=utf-8",
+	".tsv": "text/tab-separated-values; charset=utf-8",
+	".csv": "text/csv; charset=utf-8",
+}
+
+type FeedHandler struct {
+	feedService *services.FeedService
+}
+
+func NewFeedHandler(feedService *services.FeedService) *FeedHandler {
+	return &FeedHandler{feedService: feedService}
+}
+
+// GetFeed serves the last generated product feed: google.xml, google.tsv or
+// meta.csv
+func (h *FeedHandler) GetFeed(c *gin.Context) {
+	name := c.Param("file")
+	path, err := h.feedService.FeedPath(name)
+	if errors.Is(err, services.ErrFeedNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "feed not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error locating feed %s: %v", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get feed"})
+		return
+	}
+	c.Header("Content-Type", feedContentTypes[filepath.Ext(name)])
+	c.File(path)
+}
@@ -1,8 +1,21 @@
 package handlers
 
 type Handlers struct {
-	Product  ProductHandler
-	Order    OrderHandler
-	Checkout CheckoutHandler
-	Cart     CartHandler
+	Product   ProductHandler
+	Category  CategoryHandler
+	Search    SearchHandler
+	SEO       SEOHandler
+	Feed      FeedHandler
+	Stock     StockHandler
+	Restock   RestockHandler
+	Backorder BackorderHandler
+	Bundle    BundleHandler
+	Live      LiveHandler
+	Order     OrderHandler
+	Checkout  CheckoutHandler
+	Cart      CartHandler
+	Health    HealthHandler
+	Webhook   WebhookHandler
+
+	Reconciliation ReconciliationHandler
 }
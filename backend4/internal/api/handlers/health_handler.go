@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"ecommerce/pkg/odoo"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	odooClient *odoo.Client
+}
+
+func NewHealthHandler(odooClient *odoo.Client) *HealthHandler {
+	return &HealthHandler{
+		odooClient: odooClient,
+	}
+}
+
+// Health reports whether the service and its Odoo login are usable.
+// A rejected Odoo login answers 503 so load balancers and alerts notice.
+func (h *HealthHandler) Health(c *gin.Context) {
+	odooStatus := h.odooClient.AuthStatus()
+
+	status := "ok"
+	code := http.StatusOK
+	if !odooStatus.Authenticated {
+		status = "degraded"
+		code = http.StatusServiceUnavailable
+	}
+
+	c.JSON(code, gin.H{
+		"status":       status,
+		"odoo":         odooStatus,
+		"odooBreakers": h.odooClient.BreakerStates(),
+	})
+}
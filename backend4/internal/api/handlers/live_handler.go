@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"ecommerce/internal/api/middleware"
+	"ecommerce/internal/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxLiveProducts bounds how many products one stream watches
+const maxLiveProducts = 100
+
+type LiveHandler struct {
+	liveUpdates *services.LiveUpdates
+	tickets     *services.StreamTickets
+	heartbeat   time.Duration
+}
+
+func NewLiveHandler(liveUpdates *services.LiveUpdates, tickets *services.StreamTickets, heartbeat time.Duration) *LiveHandler {
+	if heartbeat <= 0 {
+		heartbeat = 15 * time.Second
+	}
+	return &LiveHandler{liveUpdates: liveUpdates, tickets: tickets, heartbeat: heartbeat}
+}
+
+// IssueTicket gives the signed-in shopper a ticket that opens one stream
+// with their orders, for browsers that cannot send their token with it
+func (h *LiveHandler) IssueTicket(c *gin.Context) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	expiresAt, _ := middleware.TokenExpiry(c)
+	ticket, err := h.tickets.Issue(c.Request.Context(), userID, expiresAt)
+	if err != nil {
+		log.Printf("Error issuing stream ticket: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue ticket"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"ticket": ticket})
+}
+
+// Stream sends Server-Sent Events: "stock" with the availability of the
+// products listed in the products parameter, and "order" with the status of
+// the signed-in shopper's orders. A reconnecting client gets what it missed
+// after its Last-Event-ID. When the shopper's token expires the stream ends
+// with an "expired" event, so the client can reconnect with a new one.
+func (h *LiveHandler) Stream(c *gin.Context) {
+	var productIDs []int64
+	if raw := c.Query("products"); raw != "" {
+		for _, part := range strings.Split(raw, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+			if err != nil || id <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+				return
+			}
+			productIDs = append(productIDs, id)
+		}
+	}
+	if len(productIDs) > maxLiveProducts {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d products", maxLiveProducts)})
+		return
+	}
+	userID, _ := middleware.UserID(c)
+	if userID == 0 && len(productIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no products to watch"})
+		return
+	}
+
+	// EventSource polyfills that cannot set headers send it as a parameter
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+	since, _ := strconv.ParseInt(lastEventID, 10, 64)
+
+	ctx := c.Request.Context()
+	sub, backlog, err := h.liveUpdates.Subscribe(ctx, userID, productIDs, since)
+	if errors.Is(err, services.ErrLiveClosed) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "server is shutting down"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening live stream: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to open stream"})
+		return
+	}
+	defer h.liveUpdates.Unsubscribe(sub)
+
+	var expired <-chan time.Time
+	if expiresAt, ok := middleware.TokenExpiry(c); ok {
+		timer := time.NewTimer(time.Until(expiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Keep nginx from buffering the stream
+	c.Status(http.StatusOK)
+
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", time.Second.Milliseconds())
+	for _, event := range backlog {
+		if err := writeLiveEvent(c.Writer, event); err != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				// Fell behind or the server is shutting down; the client
+				// reconnects and catches up
+				return
+			}
+			if err := writeLiveEvent(c.Writer, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-expired:
+			io.WriteString(c.Writer, "event: expired\ndata: {}\n\n")
+			c.Writer.Flush()
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+func writeLiveEvent(w io.Writer, event services.LiveEvent) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Event, data)
+	return err
+}
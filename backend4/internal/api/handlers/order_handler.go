@@ -1,32 +1,46 @@
 package handlers
 
 import (
+	"ecommerce/internal/api/middleware"
 	"ecommerce/internal/models"
 	"ecommerce/internal/services"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type OrderHandler struct {
-	orderService *services.OrderService
+	orderService   *services.OrderService
+	invoiceService *services.InvoiceService
 }
 
-func NewOrderHandler(orderService *services.OrderService) *OrderHandler {
+func NewOrderHandler(orderService *services.OrderService, invoiceService *services.InvoiceService) *OrderHandler {
 	return &OrderHandler{
-		orderService: orderService,
+		orderService:   orderService,
+		invoiceService: invoiceService,
 	}
 }
 
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
 	var order models.Order
 	if err := c.ShouldBindJSON(&order); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	order.UserID = userID
 
-	createdOrder, err := h.orderService.CreateOrder(&order)
+	createdOrder, err := h.orderService.CreateOrder(c.Request.Context(), &order)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -35,7 +49,58 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	c.JSON(http.StatusCreated, createdOrder)
 }
 
+// ListOrders returns the current user's order history.
+// Query parameters: page, limit, status (comma separated), from and to (YYYY-MM-DD or RFC 3339).
+func (h *OrderHandler) ListOrders(c *gin.Context) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	filter := models.OrderFilter{}
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if status := c.Query("status"); status != "" {
+		for _, s := range strings.Split(status, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				filter.Statuses = append(filter.Statuses, s)
+			}
+		}
+	}
+
+	var err error
+	if filter.From, err = parseDateParam(c.Query("from"), false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.To, err = parseDateParam(c.Query("to"), true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orders, total, err := h.orderService.ListOrders(c.Request.Context(), userID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"orders": orders,
+		"total":  total,
+		"page":   filter.Page,
+		"limit":  filter.Limit,
+	})
+}
+
 func (h *OrderHandler) GetOrder(c *gin.Context) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
 	// Get order ID from URL parameter
 	orderID := c.Param("id")
 	id, err := strconv.ParseUint(orderID, 10, 64)
@@ -47,13 +112,66 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 	}
 
 	// Get order from service
-	order, err := h.orderService.GetOrder(c.Request.Context(), uint(id))
+	order, err := h.orderService.GetOrderDetail(c.Request.Context(), userID, uint(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Order not found",
-		})
+		if errors.Is(err, services.ErrOrderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order"})
 		return
 	}
 
 	c.JSON(http.StatusOK, order)
 }
+
+// DownloadInvoice streams the Odoo invoice PDF of one of the user's orders
+func (h *OrderHandler) DownloadInvoice(c *gin.Context) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID format"})
+		return
+	}
+
+	pdf, filename, err := h.invoiceService.GetInvoicePDF(c.Request.Context(), userID, uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		case errors.Is(err, services.ErrInvoiceNotAvailable):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not available yet"})
+		default:
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch invoice"})
+		}
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Cache-Control", "private, no-store")
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// parseDateParam accepts a date or an RFC 3339 timestamp. A bare date used as
+// an upper bound includes the whole day.
+func parseDateParam(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
@@ -1,66 +1,264 @@
 package handlers
 
 import (
+	"ecommerce/internal/models"
 	"ecommerce/internal/services"
-	"fmt"
+	"ecommerce/pkg/odoo"
+	"errors"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 type ProductHandler struct {
-	productService *services.ProductService
+	productService  *services.ProductService
+	imageService    *services.ImageService
+	categoryService *services.CategoryService
+	seoService      *services.SEOService
 }
 
-func NewProductHandler(productService *services.ProductService) *ProductHandler {
+func NewProductHandler(productService *services.ProductService, imageService *services.ImageService, categoryService *services.CategoryService, seoService *services.SEOService) *ProductHandler {
 	return &ProductHandler{
-		productService: productService,
+		productService:  productService,
+		imageService:    imageService,
+		categoryService: categoryService,
+		seoService:      seoService,
 	}
 }
 
+// GetProducts lists products. With category=<slug> only products in that
+// category or below it are listed; category_kind=internal picks the slug
+// from Odoo's internal tree instead of the website's.
 func (h *ProductHandler) GetProducts(c *gin.Context) {
-	products, err := h.productService.GetProducts()
+	var categoryIDs []int64
+	kind := c.DefaultQuery("category_kind", models.CategoryKindPublic)
+	if slug := c.Query("category"); slug != "" {
+		var err error
+		categoryIDs, err = h.categoryService.Subtree(c.Request.Context(), kind, slug)
+		switch {
+		case errors.Is(err, services.ErrCategoryKind):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, services.ErrCategoryNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+			return
+		case err != nil:
+			log.Printf("Error resolving category %s: %v", slug, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get products"})
+			return
+		}
+	}
+
+	products, err := h.productService.GetProducts(c.Request.Context())
+	if odoo.IsUnavailable(err) {
+		catalogUnavailable(c)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if categoryIDs != nil {
+		products = services.FilterProductsByCategory(products, kind, categoryIDs)
+	}
 	c.JSON(http.StatusOK, products)
 }
 
 func (h *ProductHandler) GetProduct(c *gin.Context) {
-	id := c.Param("id")
-	product, err := h.productService.GetProduct(id)
+	h.respondProduct(c, c.Param("id"))
+}
+
+// GetProductBySlug returns the product with a slug. Slugs a product had
+// before it was renamed answer with a permanent redirect to the current one.
+func (h *ProductHandler) GetProductBySlug(c *gin.Context) {
+	slug := c.Param("slug")
+	templateID, current, err := h.seoService.ResolveProductSlug(c.Request.Context(), slug)
+	if errors.Is(err, services.ErrPageNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error resolving product slug %s: %v", slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get product"})
+		return
+	}
+	if current != slug {
+		location := "/api/products/slug/" + url.PathEscape(current)
+		if query := c.Request.URL.RawQuery; query != "" {
+			location += "?" + query
+		}
+		c.Redirect(http.StatusMovedPermanently, location)
+		return
+	}
+	h.respondProduct(c, strconv.FormatInt(templateID, 10))
+}
+
+// respondProduct answers with the product, its breadcrumbs and its page
+// metadata
+func (h *ProductHandler) respondProduct(c *gin.Context, id string) {
+	product, err := h.productService.GetProduct(c.Request.Context(), id)
+	if odoo.IsUnavailable(err) {
+		catalogUnavailable(c)
+		return
+	}
 	if err != nil {
 		log.Printf("Error fetching product ID %s: %v", id, err) //debug
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
+
+	if product.Breadcrumbs, err = h.categoryService.Breadcrumbs(c.Request.Context(), product); err != nil {
+		log.Printf("Error fetching breadcrumbs of product %s: %v", id, err)
+	}
+	product.SEO, err = h.seoService.ProductPage(c.Request.Context(), product.OdooID)
+	if err != nil && !errors.Is(err, services.ErrPageNotFound) {
+		log.Printf("Error fetching page of product %s: %v", id, err)
+	}
 	c.JSON(http.StatusOK, product)
 }
 
-// In your handler file
+// GetProductImage serves a product's main image. The optional width and
+// format query parameters pick the rendition; without format it is negotiated
+// from the Accept header. Unchanged images answer If-None-Match with 304.
 func (h *ProductHandler) GetProductImage(c *gin.Context) {
-	productID := c.Param("id")
-	//TODO add productID validation
-	if productID == "" {
+	productID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+	h.serveImage(c, productID, services.ImageRef{Kind: models.ProductImageTemplate, ID: productID})
+}
+
+// GetProductGalleryImage serves one of a product's extra images
+func (h *ProductHandler) GetProductGalleryImage(c *gin.Context) {
+	productID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+	imageID, err := strconv.ParseInt(c.Param("imageID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image ID"})
+		return
+	}
+	h.serveImage(c, productID, services.ImageRef{Kind: models.ProductImageExtra, ID: imageID})
+}
+
+// GetVariantImage serves the image of one product variant
+func (h *ProductHandler) GetVariantImage(c *gin.Context) {
+	productID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
 		return
 	}
+	variantID, err := strconv.ParseInt(c.Param("variantID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid variant ID"})
+		return
+	}
+	h.serveImage(c, productID, services.ImageRef{Kind: models.ProductImageVariant, ID: variantID})
+}
 
-	// Get image bytes from service
-	imageBytes, err := h.productService.GetProductImage(productID)
+// serveImage answers an image request. Gallery URLs carry the image version
+// in v, so those responses never change and may be cached for good; requests
+// for an outdated version are redirected to the current one.
+func (h *ProductHandler) serveImage(c *gin.Context, productID int64, ref services.ImageRef) {
+	var err error
+	req := services.ImageRequest{
+		Format: strings.ToLower(c.Query("format")),
+		Accept: c.GetHeader("Accept"),
+	}
+	if req.Format == "jpg" {
+		req.Format = services.ImageFormatJPEG
+	}
+	if width := c.Query("width"); width != "" {
+		if req.Width, err = strconv.Atoi(width); err != nil || req.Width == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidImageWidth.Error()})
+			return
+		}
+	}
+	if version := c.Query("v"); version != "" {
+		if ref.Version, err = strconv.ParseInt(version, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image version"})
+			return
+		}
+	}
+
+	img, err := h.imageService.GetImage(c.Request.Context(), productID, ref, req)
+	var moved *services.ImageMovedError
+	switch {
+	case errors.As(err, &moved):
+		redirectImage(c, moved.URL)
+		return
+	case errors.Is(err, services.ErrInvalidImageWidth), errors.Is(err, services.ErrImageFormat):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrImageNotAcceptable):
+		c.JSON(http.StatusNotAcceptable, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, odoo.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "image not found"})
+		return
+	case odoo.IsUnavailable(err):
+		catalogUnavailable(c)
+		return
+	case err != nil:
+		log.Printf("Image fetch error for product %d %s image %d: %v", productID, ref.Kind, ref.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get product image"})
+		return
+	}
+
+	c.Header("ETag", img.ETag)
+	if ref.Version != 0 {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "public, max-age=3600")
+	}
+	c.Header("Vary", "Accept")
+	if etagMatches(c.GetHeader("If-None-Match"), img.ETag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, img.ContentType, img.Data)
+}
+
+// redirectImage sends a request for an outdated image version to the current
+// one, keeping the requested width and format
+func redirectImage(c *gin.Context, location string) {
+	target, err := url.Parse(location)
 	if err != nil {
-		fmt.Printf("Image fetch error: %v\n", err) // Add debug logging
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get product image"})
 		return
 	}
+	query := target.Query()
+	for key, values := range c.Request.URL.Query() {
+		if key != "v" {
+			query[key] = values
+		}
+	}
+	target.RawQuery = query.Encode()
 
-	fmt.Printf("Image bytes length: %d\n", len(imageBytes)) // Add debug logging
-	// Set content type header
-	c.Header("Content-Type", "image/jpeg")
-	c.Header("Cache-Control", "public, max-age=3600")
+	c.Header("Cache-Control", "no-cache")
+	c.Redirect(http.StatusFound, target.String())
+}
+
+// etagMatches reports whether an If-None-Match header lists etag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
 
-	// Write image bytes to response
-	c.Data(http.StatusOK, "image/jpeg", imageBytes)
+// catalogUnavailable answers 503 when Odoo is down and nothing was cached yet
+func catalogUnavailable(c *gin.Context) {
+	c.Header("Retry-After", "30")
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "catalog temporarily unavailable"})
 }
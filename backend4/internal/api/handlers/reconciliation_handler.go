@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReconciliationHandler struct {
+	reconciliationService *services.ReconciliationService
+}
+
+func NewReconciliationHandler(reconciliationService *services.ReconciliationService) *ReconciliationHandler {
+	return &ReconciliationHandler{
+		reconciliationService: reconciliationService,
+	}
+}
+
+type ResolveDiscrepancyRequest struct {
+	Resolution string `json:"resolution" binding:"required"`
+}
+
+// UploadReport ingests a settlement detail report sent as the "file" form field
+func (h *ReconciliationHandler) UploadReport(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "settlement report file is required"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	summary, err := h.reconciliationService.IngestReport(c.Request.Context(), fileHeader.Filename, file)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+func (h *ReconciliationHandler) ListDiscrepancies(c *gin.Context) {
+	status := c.DefaultQuery("status", models.DiscrepancyStatusOpen)
+	if status == "all" {
+		status = ""
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	discrepancies, total, err := h.reconciliationService.ListDiscrepancies(
+		c.Request.Context(), status, c.Query("kind"), page, limit,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"discrepancies": discrepancies,
+		"total":         total,
+		"page":          page,
+	})
+}
+
+func (h *ReconciliationHandler) ResolveDiscrepancy(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid discrepancy ID format"})
+		return
+	}
+
+	var req ResolveDiscrepancyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	discrepancy, err := h.reconciliationService.ResolveDiscrepancy(c.Request.Context(), uint(id), req.Resolution)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, discrepancy)
+}
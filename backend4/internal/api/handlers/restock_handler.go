@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"ecommerce/internal/api/middleware"
+	"ecommerce/internal/services"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RestockHandler struct {
+	stockAlerts *services.StockAlerts
+}
+
+func NewRestockHandler(stockAlerts *services.StockAlerts) *RestockHandler {
+	return &RestockHandler{stockAlerts: stockAlerts}
+}
+
+type RestockSubscriptionRequest struct {
+	Quantity int    `json:"quantity"`
+	Locale   string `json:"locale"`
+}
+
+// Subscribe asks for an email to the signed-in shopper when an out-of-stock
+// variant is back. The response's token cancels the subscription.
+func (h *RestockHandler) Subscribe(c *gin.Context) {
+	variantID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid variant ID"})
+		return
+	}
+	var req RestockSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	subscription, err := h.stockAlerts.Subscribe(c.Request.Context(), variantID, userID, c.GetString("email"), req.Locale, req.Quantity)
+	switch {
+	case errors.Is(err, services.ErrInvalidEmail), errors.Is(err, services.ErrInvalidQuantity):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrVariantNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrVariantInStock):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Error subscribing to restock of variant %d: %v", variantID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to subscribe"})
+	default:
+		c.JSON(http.StatusCreated, subscription)
+	}
+}
+
+// Unsubscribe cancels a restock subscription that has not been notified yet
+func (h *RestockHandler) Unsubscribe(c *gin.Context) {
+	err := h.stockAlerts.Unsubscribe(c.Request.Context(), c.Param("token"))
+	switch {
+	case errors.Is(err, services.ErrSubscriptionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Error cancelling restock subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unsubscribe"})
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"ecommerce/internal/services"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SearchHandler struct {
+	searchService *services.SearchService
+}
+
+func NewSearchHandler(searchService *services.SearchService) *SearchHandler {
+	return &SearchHandler{searchService: searchService}
+}
+
+// Search finds products. Query parameters: q, category (slug),
+// category_kind, min_price, max_price, attr (attribute value ID, repeatable),
+// in_stock, sort (relevance, price_asc, price_desc or name), page and limit.
+func (h *SearchHandler) Search(c *gin.Context) {
+	req := services.SearchRequest{
+		Query:        c.Query("q"),
+		Category:     c.Query("category"),
+		CategoryKind: c.Query("category_kind"),
+		Sort:         c.Query("sort"),
+	}
+
+	var err error
+	parseFloat := func(name string) *float64 {
+		value := c.Query(name)
+		if value == "" || err != nil {
+			return nil
+		}
+		var parsed float64
+		if parsed, err = strconv.ParseFloat(value, 64); err != nil {
+			return nil
+		}
+		return &parsed
+	}
+	req.MinPrice = parseFloat("min_price")
+	req.MaxPrice = parseFloat("max_price")
+	for _, value := range c.QueryArray("attr") {
+		id, parseErr := strconv.ParseInt(value, 10, 64)
+		if parseErr != nil {
+			err = parseErr
+			break
+		}
+		req.AttributeValueIDs = append(req.AttributeValueIDs, id)
+	}
+	if value := c.Query("in_stock"); value != "" && err == nil {
+		var inStock bool
+		if inStock, err = strconv.ParseBool(value); err == nil {
+			req.InStock = &inStock
+		}
+	}
+	if value := c.Query("page"); value != "" && err == nil {
+		req.Page, err = strconv.Atoi(value)
+	}
+	if value := c.Query("limit"); value != "" && err == nil {
+		req.Limit, err = strconv.Atoi(value)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid search parameters"})
+		return
+	}
+
+	result, err := h.searchService.Search(c.Request.Context(), req)
+	switch {
+	case errors.Is(err, services.ErrSearchSort), errors.Is(err, services.ErrCategoryKind):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrCategoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+		return
+	case err != nil:
+		log.Printf("Search for %q failed: %v", req.Query, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// Suggest completes the partly typed search in q
+func (h *SearchHandler) Suggest(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	suggestions, err := h.searchService.Suggest(c.Request.Context(), c.Query("q"), limit)
+	if err != nil {
+		log.Printf("Suggestions for %q failed: %v", c.Query("q"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get suggestions"})
+		return
+	}
+	c.JSON(http.StatusOK, suggestions)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"ecommerce/internal/services"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const sitemapContentType = "application/xml; charset=utf-8"
+
+type SEOHandler struct {
+	seoService *services.SEOService
+}
+
+func NewSEOHandler(seoService *services.SEOService) *SEOHandler {
+	return &SEOHandler{seoService: seoService}
+}
+
+// GetSitemapIndex serves sitemap.xml, the index of the catalog sitemaps
+func (h *SEOHandler) GetSitemapIndex(c *gin.Context) {
+	writeSitemap(c, "sitemap index", h.seoService.WriteSitemapIndex)
+}
+
+// GetSitemap serves one sitemap of the index: categories.xml or
+// products-<n>.xml
+func (h *SEOHandler) GetSitemap(c *gin.Context) {
+	file := c.Param("file")
+	if file == "categories.xml" {
+		writeSitemap(c, "category sitemap", h.seoService.WriteCategorySitemap)
+		return
+	}
+
+	name, isProducts := strings.CutPrefix(file, "products-")
+	name, isXML := strings.CutSuffix(name, ".xml")
+	page, err := strconv.Atoi(name)
+	if err != nil || !isProducts || !isXML {
+		c.JSON(http.StatusNotFound, gin.H{"error": "sitemap not found"})
+		return
+	}
+	writeSitemap(c, fmt.Sprintf("product sitemap %d", page), func(ctx context.Context, w io.Writer) error {
+		return h.seoService.WriteProductSitemap(ctx, w, page)
+	})
+}
+
+// writeSitemap streams a sitemap. Headers go out with the first URL, so
+// errors after that can only be logged.
+func writeSitemap(c *gin.Context, name string, write func(ctx context.Context, w io.Writer) error) {
+	c.Header("Content-Type", sitemapContentType)
+	err := write(c.Request.Context(), c.Writer)
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrPageNotFound):
+		c.Writer.Header().Del("Content-Type")
+		c.JSON(http.StatusNotFound, gin.H{"error": "sitemap not found"})
+	case !c.Writer.Written():
+		log.Printf("Error writing %s: %v", name, err)
+		c.Writer.Header().Del("Content-Type")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to write sitemap"})
+	default:
+		log.Printf("Error writing %s: %v", name, err)
+	}
+}
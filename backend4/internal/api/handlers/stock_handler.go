@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type StockHandler struct {
+	stockService *services.StockService
+}
+
+func NewStockHandler(stockService *services.StockService) *StockHandler {
+	return &StockHandler{stockService: stockService}
+}
+
+// GetProductAvailability reports the stock of a product's variants per
+// warehouse. country limits it to warehouses shipping there; quantity is how
+// many the shopper wants, 1 by default.
+func (h *StockHandler) GetProductAvailability(c *gin.Context) {
+	productID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+	quantity, ok := availabilityQuantity(c)
+	if !ok {
+		return
+	}
+
+	availability, err := h.stockService.ProductAvailability(c.Request.Context(), productID, c.Query("country"), quantity)
+	if err != nil {
+		log.Printf("Error fetching availability of product %d: %v", productID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get availability"})
+		return
+	}
+	c.JSON(http.StatusOK, availability)
+}
+
+// GetVariantAvailability reports the stock of one variant per warehouse,
+// with the same parameters as GetProductAvailability
+func (h *StockHandler) GetVariantAvailability(c *gin.Context) {
+	variantID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid variant ID"})
+		return
+	}
+	quantity, ok := availabilityQuantity(c)
+	if !ok {
+		return
+	}
+
+	availability, err := h.stockService.Availability(c.Request.Context(), []int64{variantID}, c.Query("country"), quantity)
+	if err != nil {
+		log.Printf("Error fetching availability of variant %d: %v", variantID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get availability"})
+		return
+	}
+	var result models.Availability
+	if len(availability) > 0 {
+		result = availability[0]
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// availabilityQuantity parses the quantity parameter, answering 400 when it
+// is invalid
+func availabilityQuantity(c *gin.Context) (float64, bool) {
+	raw := c.Query("quantity")
+	if raw == "" {
+		return 1, true
+	}
+	quantity, err := strconv.ParseFloat(raw, 64)
+	if err != nil || quantity <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid quantity"})
+		return 0, false
+	}
+	return quantity, true
+}
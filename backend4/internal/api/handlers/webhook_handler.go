@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"ecommerce/internal/services"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/adyen/adyen-go-api-library/v5/src/hmacvalidator"
+	"github.com/adyen/adyen-go-api-library/v5/src/notification"
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookHandler struct {
+	inventoryEvents *services.InventoryEvents
+	paymentCaptures *services.PaymentCaptures
+	adyenHmacKey    string
+}
+
+func NewWebhookHandler(inventoryEvents *services.InventoryEvents, paymentCaptures *services.PaymentCaptures, adyenHmacKey string) *WebhookHandler {
+	return &WebhookHandler{
+		inventoryEvents: inventoryEvents,
+		paymentCaptures: paymentCaptures,
+		adyenHmacKey:    adyenHmacKey,
+	}
+}
+
+// OdooChangeRequest names the changed records, as sent by the signing Odoo
+// module described at middleware.WebhookSignature
+type OdooChangeRequest struct {
+	Model string  `json:"model"`
+	IDs   []int64 `json:"ids"`
+}
+
+// OdooChange queues the changed products for the mirror and caches
+func (h *WebhookHandler) OdooChange(c *gin.Context) {
+	var req OdooChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Model == "" || len(req.IDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "model and ids are required"})
+		return
+	}
+
+	if err := h.inventoryEvents.PublishChange(c.Request.Context(), req.Model, req.IDs); err != nil {
+		if errors.Is(err, services.ErrUnsupportedModel) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error publishing %s change: %v", req.Model, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process change"})
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// AdyenNotification takes Adyen's standard notifications. Items with a bad
+// signature are skipped; Adyen retries until it gets [accepted], so only
+// failures to store an item answer with an error.
+// An empty HMAC key disables the route entirely rather than leaving it open.
+func (h *WebhookHandler) AdyenNotification(c *gin.Context) {
+	if h.adyenHmacKey == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Adyen notifications are not configured"})
+		return
+	}
+
+	var req notification.Notification
+	if err := c.ShouldBindJSON(&req); err != nil || req.NotificationItems == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid notification"})
+		return
+	}
+
+	for _, item := range req.GetNotificationItems() {
+		if !hmacvalidator.ValidateHmac(*item, h.adyenHmacKey) {
+			log.Printf("Dropping Adyen %s notification %s with invalid signature", item.EventCode, item.PspReference)
+			continue
+		}
+		if err := h.paymentCaptures.HandleNotification(c.Request.Context(), *item); err != nil {
+			log.Printf("Error handling Adyen %s notification %s: %v", item.EventCode, item.PspReference, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process notification"})
+			return
+		}
+	}
+	c.String(http.StatusOK, "[accepted]")
+}
@@ -2,21 +2,50 @@ package routes
 
 import (
 	"ecommerce/internal/api/handlers"
+	"ecommerce/internal/api/middleware"
+	"ecommerce/internal/config"
+	"ecommerce/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func SetupRoutes(r *gin.Engine, handlers *handlers.Handlers) {
+func SetupRoutes(r *gin.Engine, handlers *handlers.Handlers, streamTickets *services.StreamTickets, cfg *config.Config) {
+	r.GET("/health", handlers.Health.Health)
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// Sitemaps for search engines
+	r.GET("/sitemap.xml", handlers.SEO.GetSitemapIndex)
+	r.GET("/sitemaps/:file", handlers.SEO.GetSitemap)
+
+	// Product feeds for shopping channels
+	r.GET("/feeds/:file", handlers.Feed.GetFeed)
+
 	api := r.Group("/api")
 	{
 		// Product routes
 		api.GET("/products", handlers.Product.GetProducts)
 		api.GET("/products/:id", handlers.Product.GetProduct)
+		api.GET("/products/slug/:slug", handlers.Product.GetProductBySlug)
 		api.GET("/products/:id/image", handlers.Product.GetProductImage)
+		api.GET("/products/:id/images/:imageID", handlers.Product.GetProductGalleryImage)
+		api.GET("/products/:id/variants/:variantID/image", handlers.Product.GetVariantImage)
 
-		// Order routes
-		api.POST("/orders", handlers.Order.CreateOrder)
-		api.GET("/orders/:id", handlers.Order.GetOrder)
+		// Stock routes
+		api.GET("/products/:id/availability", handlers.Stock.GetProductAvailability)
+		api.GET("/variants/:id/availability", handlers.Stock.GetVariantAvailability)
+		api.DELETE("/restock-subscriptions/:token", handlers.Restock.Unsubscribe)
+
+		// Bundles, from Odoo kits
+		api.GET("/variants/:id/bundle", handlers.Bundle.GetBundle)
+
+		// Category routes
+		api.GET("/categories", handlers.Category.GetCategories)
+		api.GET("/categories/:slug", handlers.Category.GetCategory)
+
+		// Search routes
+		api.GET("/search", handlers.Search.Search)
+		api.GET("/search/suggest", handlers.Search.Suggest)
 
 		// Checkout routes
 		api.POST("/checkout", handlers.Checkout.InitiateCheckout)
@@ -28,4 +57,50 @@ func SetupRoutes(r *gin.Engine, handlers *handlers.Handlers) {
 		api.POST("/carts/:id/items", handlers.Cart.AddToCart)
 		api.PUT("/carts/:id/items", handlers.Cart.UpdateCartItem)
 	}
+
+	// Routes for signed-in shoppers
+	authorized := api.Group("", middleware.Auth(cfg.Auth.JWTSecret))
+	{
+		// Order routes
+		authorized.GET("/orders", handlers.Order.ListOrders)
+		authorized.POST("/orders", handlers.Order.CreateOrder)
+		authorized.GET("/orders/:id", handlers.Order.GetOrder)
+		authorized.GET("/orders/:id/invoice", handlers.Order.DownloadInvoice)
+
+		// Restock emails go to the shopper's own address
+		authorized.POST("/variants/:id/restock-subscriptions", handlers.Restock.Subscribe)
+
+		// Tickets opening a live stream with the shopper's orders
+		authorized.POST("/live/tickets", handlers.Live.IssueTicket)
+	}
+
+	// Live stock and order updates, for shoppers signed in or not
+	api.GET("/live", middleware.StreamAuth(cfg.Auth.JWTSecret, streamTickets), handlers.Live.Stream)
+
+	// Change notifications from Odoo automated actions
+	webhooks := api.Group("/webhooks", middleware.WebhookSignature(cfg.Odoo.WebhookSecret))
+	{
+		webhooks.POST("/odoo", handlers.Webhook.OdooChange)
+	}
+
+	// Adyen signs each notification item instead
+	api.POST("/webhooks/adyen", handlers.Webhook.AdyenNotification)
+
+	admin := api.Group("/admin", middleware.AdminAuth(cfg.Server.AdminToken))
+	{
+		// Payment reconciliation routes
+		admin.POST("/reconciliation/reports", handlers.Reconciliation.UploadReport)
+		admin.GET("/reconciliation/discrepancies", handlers.Reconciliation.ListDiscrepancies)
+		admin.POST("/reconciliation/discrepancies/:id/resolve", handlers.Reconciliation.ResolveDiscrepancy)
+
+		// Pre-order and backorder policies, by Odoo product template
+		admin.GET("/backorder-policies", handlers.Backorder.ListPolicies)
+		admin.PUT("/products/:id/backorder-policy", handlers.Backorder.SetPolicy)
+		admin.DELETE("/products/:id/backorder-policy", handlers.Backorder.DeletePolicy)
+
+		// Bundle pricing, by Odoo product template
+		admin.GET("/bundle-pricing", handlers.Bundle.ListPricings)
+		admin.PUT("/products/:id/bundle-pricing", handlers.Bundle.SetPricing)
+		admin.DELETE("/products/:id/bundle-pricing", handlers.Bundle.DeletePricing)
+	}
 }
@@ -13,10 +13,12 @@ import (
 	"ecommerce/internal/api/routes"
 	"ecommerce/internal/config"
 	"ecommerce/internal/database"
+	"ecommerce/internal/notifications"
 	"ecommerce/internal/scheduler"
 	"ecommerce/internal/services"
 	"ecommerce/internal/sync"
 	"ecommerce/pkg/adyen"
+	"ecommerce/pkg/cache"
 	"ecommerce/pkg/odoo"
 	"ecommerce/pkg/queue"
 	"ecommerce/pkg/redis"
@@ -60,6 +62,9 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
+	if err := database.Migrate(db); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
 
 	// Initialize Odoo client
 	odooClient, err := odoo.NewClient(odoo.Config{
@@ -67,26 +72,101 @@ func main() {
 		Database:      cfg.Odoo.Database,
 		Username:      cfg.Odoo.Username,
 		Password:      cfg.Odoo.Password,
+		APIKey:        cfg.Odoo.APIKey,
 		MaxRetries:    10,
 		RetryInterval: 5 * time.Second,
+		CallTimeout:   cfg.Odoo.CallTimeout,
+		Protocol:      cfg.Odoo.Protocol,
+		Resilience: odoo.ResilienceConfig{
+			MaxConcurrentReads:   cfg.Odoo.Resilience.MaxConcurrentReads,
+			MaxConcurrentWrites:  cfg.Odoo.Resilience.MaxConcurrentWrites,
+			MaxConcurrentReports: cfg.Odoo.Resilience.MaxConcurrentReports,
+			BulkheadWait:         cfg.Odoo.Resilience.BulkheadWait,
+			ReadRetries:          cfg.Odoo.Resilience.ReadRetries,
+			RetryBaseDelay:       cfg.Odoo.Resilience.RetryBaseDelay,
+			BreakerFailures:      cfg.Odoo.Resilience.BreakerFailures,
+			BreakerOpenFor:       cfg.Odoo.Resilience.BreakerOpenFor,
+		},
 	})
 	if err != nil {
 		log.Fatalf("Failed to create Odoo client: %v", err)
 	}
 	defer odooClient.Close()
 
-	// Initialize Adyen client
+	// Initialize Adyen client. Manual captures need the PSP references only
+	// the notification webhook delivers.
+	if cfg.Adyen.ManualCaptureMerchantID != "" && cfg.Adyen.HmacKey == "" {
+		log.Fatalf("adyen.manualCaptureMerchantID requires adyen.hmacKey for the notification webhook")
+	}
 	adyenClient, err := adyen.NewClient(&adyen.Config{
 		ApiKey:      cfg.Adyen.ApiKey,
 		Environment: cfg.Adyen.Environment,
+		MerchantID:  cfg.Adyen.MerchantID,
+
+		ManualCaptureMerchantID: cfg.Adyen.ManualCaptureMerchantID,
 	})
 	if err != nil {
 		log.Fatalf("Failed to create Adyen client: %v", err)
 	}
 
 	// Initialize services
-	productService := services.NewProductService(odooClient)
-	cartService := services.NewCartService(redisClient, productService)
+	stockHolds := services.NewStockHolds(redisClient)
+	catalogCache, err := cache.NewTiered(cache.Config{
+		Name:      "catalog",
+		LocalSize: cfg.ProductCache.LocalSize,
+		FreshFor:  cfg.ProductCache.CatalogFreshFor,
+		StaleFor:  cfg.ProductCache.CatalogStaleFor,
+	}, redisClient)
+	if err != nil {
+		log.Fatalf("Failed to create catalog cache: %v", err)
+	}
+	stockCache, err := cache.NewTiered(cache.Config{
+		Name:      "stock",
+		LocalSize: cfg.ProductCache.LocalSize,
+		FreshFor:  cfg.ProductCache.StockFreshFor,
+		StaleFor:  cfg.ProductCache.StockStaleFor,
+	}, redisClient)
+	if err != nil {
+		log.Fatalf("Failed to create stock cache: %v", err)
+	}
+
+	// Drop local copies when another replica invalidates them
+	cacheCtx, stopCaches := context.WithCancel(context.Background())
+	defer stopCaches()
+	for _, c := range []*cache.Tiered{catalogCache, stockCache} {
+		if err := c.Listen(cacheCtx); err != nil {
+			log.Fatalf("Failed to listen for cache invalidations: %v", err)
+		}
+	}
+
+	productService := services.NewProductService(odooClient, catalogCache, stockCache)
+	imageService, err := services.NewImageService(productService, cfg.Images.CacheDir, cfg.Images.JPEGQuality)
+	if err != nil {
+		log.Fatalf("Failed to create image service: %v", err)
+	}
+	categoryService := services.NewCategoryService(db)
+	searchService := services.NewSearchService(
+		db,
+		odooClient,
+		categoryService,
+		cfg.Search.Language,
+		cfg.Search.MinSimilarity,
+		cfg.Search.PriceBuckets,
+	)
+	seoService := services.NewSEOService(db, odooClient, cfg.SEO.SiteURL, cfg.Server.BaseURL, cfg.SEO.SitemapSize)
+	feedService, err := services.NewFeedService(db, odooClient, cfg.Feeds.Dir, cfg.SEO.SiteURL, cfg.Server.BaseURL, cfg.Feeds.Brand)
+	if err != nil {
+		log.Fatalf("Failed to create feed service: %v", err)
+	}
+	shipsTo := make(map[string][]string, len(cfg.Warehouses))
+	for _, warehouse := range cfg.Warehouses {
+		shipsTo[warehouse.Code] = warehouse.Countries
+	}
+	stockService := services.NewStockService(db, stockHolds, shipsTo)
+	backorders := services.NewBackorders(db, stockService, cfg.Adyen.ManualCaptureMerchantID != "")
+	paymentCaptures := services.NewPaymentCaptures(db, redisClient, queueClient, adyenClient)
+	bundles := services.NewBundles(db, productService)
+	cartService := services.NewCartService(redisClient, productService, stockHolds, stockService, backorders, bundles)
 	orderService := services.NewOrderService(queueClient, odooClient, db)
 	checkoutService := services.NewCheckoutService(
 		cartService,
@@ -95,25 +175,139 @@ func main() {
 		odooClient,
 		queueClient,
 		adyenClient,
+		stockHolds,
+		stockService,
+		backorders,
+		paymentCaptures,
 		cfg.Server.BaseURL,
 	)
+	reconciliationService := services.NewReconciliationService(
+		db,
+		odooClient,
+		queueClient,
+		cfg.Reconciliation.AmountTolerance,
+		cfg.Reconciliation.OdooJournalID,
+	)
+	invoiceService := services.NewInvoiceService(
+		db,
+		odooClient,
+		redisClient,
+		queueClient,
+		cfg.Invoicing.PaymentJournalID,
+		cfg.Invoicing.PDFCacheTTL,
+	)
+
+	// Initialize notification worker
+	notificationRenderer, err := notifications.NewRenderer()
+	if err != nil {
+		log.Fatalf("Failed to load notification templates: %v", err)
+	}
+	notificationTransport, err := notifications.NewTransport(cfg.Notifications)
+	if err != nil {
+		log.Fatalf("Failed to create notification transport: %v", err)
+	}
+	notificationWorker := notifications.NewWorker(
+		db,
+		notificationRenderer,
+		notificationTransport,
+		cfg.Notifications.From,
+		cfg.Notifications.StoreURL,
+	)
+	if err := queueClient.Consume("notifications", notificationWorker.Handle); err != nil {
+		log.Fatalf("Failed to consume notifications: %v", err)
+	}
+
+	// Invoice paid orders in Odoo
+	if cfg.Invoicing.Enabled {
+		if err := queueClient.Consume("orders", invoiceService.HandleOrderEvent); err != nil {
+			log.Fatalf("Failed to consume orders: %v", err)
+		}
+	}
+
+	inventoryEvents := services.NewInventoryEvents(odooClient, queueClient)
+	stockAlerts := services.NewStockAlerts(db, odooClient, queueClient, stockService, cfg.StockAlerts.MinStock, cfg.StockAlerts.Email)
+
+	// Stream stock and order changes to browsers; every replica gets them all
+	liveUpdates := services.NewLiveUpdates(db, stockService, cfg.Live.ReplaySize)
+	streamTickets := services.NewStreamTickets(redisClient)
+	if err := queueClient.Subscribe("inventory", liveUpdates.HandleInventoryEvent); err != nil {
+		log.Fatalf("Failed to subscribe to inventory: %v", err)
+	}
+	if err := queueClient.Subscribe("orders", liveUpdates.HandleOrderEvent); err != nil {
+		log.Fatalf("Failed to subscribe to orders: %v", err)
+	}
 
 	// Initialize handlers
 	handlers := &handlers.Handlers{
-		Product:  *handlers.NewProductHandler(productService),
-		Cart:     *handlers.NewCartHandler(cartService),
-		Checkout: *handlers.NewCheckoutHandler(checkoutService),
-		Order:    *handlers.NewOrderHandler(orderService),
+		Product:   *handlers.NewProductHandler(productService, imageService, categoryService, seoService),
+		Category:  *handlers.NewCategoryHandler(categoryService),
+		Search:    *handlers.NewSearchHandler(searchService),
+		SEO:       *handlers.NewSEOHandler(seoService),
+		Feed:      *handlers.NewFeedHandler(feedService),
+		Stock:     *handlers.NewStockHandler(stockService),
+		Restock:   *handlers.NewRestockHandler(stockAlerts),
+		Backorder: *handlers.NewBackorderHandler(backorders),
+		Bundle:    *handlers.NewBundleHandler(bundles),
+		Live:      *handlers.NewLiveHandler(liveUpdates, streamTickets, cfg.Live.Heartbeat),
+		Cart:      *handlers.NewCartHandler(cartService),
+		Checkout:  *handlers.NewCheckoutHandler(checkoutService),
+		Order:     *handlers.NewOrderHandler(orderService, invoiceService),
+		Health:    *handlers.NewHealthHandler(odooClient),
+		Webhook:   *handlers.NewWebhookHandler(inventoryEvents, paymentCaptures, cfg.Adyen.HmacKey),
+
+		Reconciliation: *handlers.NewReconciliationHandler(reconciliationService),
 	}
 
 	// Initialize sync service
-	odooSync := sync.NewOdooSync(db, odooClient)
+	odooSync := sync.NewOdooSync(db, odooClient, queueClient, productService, stockAlerts, searchService, seoService)
+
+	// Apply changes Odoo announces right away, not at the next sync
+	if err := queueClient.Consume("inventory", odooSync.HandleInventoryEvent); err != nil {
+		log.Fatalf("Failed to consume inventory: %v", err)
+	}
+	if cfg.Odoo.Bus.Enabled {
+		busCtx, stopBus := context.WithCancel(context.Background())
+		defer stopBus()
+		go inventoryEvents.ListenBus(busCtx, cfg.Odoo.Bus.Channel, cfg.Odoo.Bus.PollInterval)
+	}
 
 	// Initialize and start scheduler
 	syncScheduler := scheduler.NewSyncScheduler(odooSync)
 	syncScheduler.Start()
 	defer syncScheduler.Stop()
 
+	feedScheduler := scheduler.NewFeedScheduler(feedService, cfg.Feeds.Interval)
+	feedScheduler.Start()
+	defer feedScheduler.Stop()
+
+	imageCachePruner := scheduler.NewImageCachePruner(imageService, cfg.Images.CacheMaxAge)
+	imageCachePruner.Start()
+	defer imageCachePruner.Stop()
+
+	checkoutSweeper := scheduler.NewCheckoutSweeper(checkoutService)
+	checkoutSweeper.Start()
+	defer checkoutSweeper.Stop()
+
+	reconciliationScheduler := scheduler.NewReconciliationScheduler(
+		reconciliationService,
+		cfg.Reconciliation.SettlementDir,
+		cfg.Reconciliation.Interval,
+	)
+	reconciliationScheduler.Start()
+	defer reconciliationScheduler.Stop()
+
+	if cfg.Invoicing.Enabled {
+		invoiceScheduler := scheduler.NewInvoiceScheduler(invoiceService, cfg.Invoicing.RetryInterval)
+		invoiceScheduler.Start()
+		defer invoiceScheduler.Stop()
+	}
+
+	if cfg.Adyen.ManualCaptureMerchantID != "" {
+		captureScheduler := scheduler.NewCaptureScheduler(paymentCaptures, cfg.Adyen.CaptureInterval)
+		captureScheduler.Start()
+		defer captureScheduler.Stop()
+	}
+
 	// Initialize Gin router
 	r := gin.Default()
 
@@ -125,13 +319,15 @@ func main() {
 	r.Use(cors.New(corsConfig))
 
 	// Setup routes
-	routes.SetupRoutes(r, handlers)
+	routes.SetupRoutes(r, handlers, streamTickets, cfg)
 
 	// Start server with graceful shutdown
 	srv := &http.Server{
 		Addr:    ":" + cfg.Server.Port,
 		Handler: r,
 	}
+	// Shutdown waits for requests to finish, which streams never do on their own
+	srv.RegisterOnShutdown(liveUpdates.Close)
 
 	// Graceful shutdown
 	go func() {
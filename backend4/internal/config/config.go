@@ -1,21 +1,42 @@
 package config
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/spf13/viper"
 )
 
 type Config struct {
 	Server   ServerConfig
+	Auth     AuthConfig
 	Database DatabaseConfig
 	Redis    RedisConfig
 	RabbitMQ RabbitMQConfig
 	Odoo     OdooConfig
 	Adyen    AdyenConfig
+
+	Reconciliation ReconciliationConfig
+	Notifications  NotificationsConfig
+	Invoicing      InvoicingConfig
+	ProductCache   ProductCacheConfig
+	Images         ImagesConfig
+	Search         SearchConfig
+	SEO            SEOConfig
+	Feeds          FeedsConfig
+	Warehouses     []WarehouseConfig
+	Live           LiveConfig
+	StockAlerts    StockAlertsConfig
 }
 
 type ServerConfig struct {
-	Port    string
-	BaseURL string
+	Port       string
+	BaseURL    string
+	AdminToken string
+}
+
+type AuthConfig struct {
+	JWTSecret string
 }
 
 type DatabaseConfig struct {
@@ -38,16 +59,76 @@ type RabbitMQConfig struct {
 }
 
 type OdooConfig struct {
-	URL      string
-	Database string
-	Username string
-	Password string
+	URL         string
+	Database    string
+	Username    string
+	Password    string
+	APIKey      string        // Odoo API key, used instead of the password for RPC
+	CallTimeout time.Duration // Per-call deadline when the caller sets none
+	Protocol    string        // "xmlrpc" or "jsonrpc"
+	Resilience  OdooResilienceConfig
+
+	WebhookSecret string // Signs change notifications from Odoo automated actions; empty disables the webhook
+	Bus           OdooBusConfig
+}
+
+// OdooBusConfig is the Odoo bus channel automated actions announce product
+// and stock changes on. Polling it needs the password, not an API key.
+type OdooBusConfig struct {
+	Enabled      bool
+	Channel      string
+	PollInterval time.Duration
+}
+
+// OdooResilienceConfig bounds how hard we lean on Odoo; zero values use the client defaults
+type OdooResilienceConfig struct {
+	MaxConcurrentReads   int
+	MaxConcurrentWrites  int
+	MaxConcurrentReports int
+	BulkheadWait         time.Duration
+	ReadRetries          int
+	RetryBaseDelay       time.Duration
+	BreakerFailures      int
+	BreakerOpenFor       time.Duration
 }
 
 type AdyenConfig struct {
 	ApiKey      string
 	Environment string
 	MerchantID  string
+
+	ManualCaptureMerchantID string        // Account capturing manually, for pre-orders and backorders; empty disables them
+	HmacKey                 string        // Validates standard notifications; empty disables the webhook
+	CaptureInterval         time.Duration // How often shipped pre-orders and backorders are captured
+}
+
+type ReconciliationConfig struct {
+	SettlementDir   string
+	Interval        time.Duration
+	AmountTolerance float64
+	OdooJournalID   int64
+}
+
+type InvoicingConfig struct {
+	Enabled          bool
+	PaymentJournalID int64         // Journal for registered Adyen payments; 0 lets Odoo pick
+	PDFCacheTTL      time.Duration // How long rendered invoice PDFs are kept in Redis
+	RetryInterval    time.Duration
+}
+
+type NotificationsConfig struct {
+	Transport string // "smtp", "file" or "memory"
+	From      string
+	StoreURL  string
+	OutboxDir string
+	SMTP      SMTPConfig
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
 }
 
 func LoadConfig() (*Config, error) {
@@ -63,6 +144,76 @@ func LoadConfig() (*Config, error) {
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, err
 	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
 
 	return &config, nil
 }
+
+// placeholderSecret is the value the sample configuration used to ship secrets
+// with. It is public, so a config still carrying it is refused.
+const placeholderSecret = "change-me"
+
+// validate refuses configurations that would start with a publicly known secret
+func (c *Config) validate() error {
+	if c.Auth.JWTSecret == "" || c.Auth.JWTSecret == placeholderSecret {
+		return fmt.Errorf("auth.jwtSecret must be set to a random secret")
+	}
+	if c.Server.AdminToken == placeholderSecret {
+		return fmt.Errorf("server.adminToken is set to the %q placeholder: set a random token, or leave it empty to disable the admin routes", placeholderSecret)
+	}
+	return nil
+}
+
+// ProductCacheConfig sets how long product data is served from cache. Past
+// FreshFor an entry is still served for StaleFor while it is refreshed.
+type ProductCacheConfig struct {
+	LocalSize       int // Entries per cache kept in each process
+	CatalogFreshFor time.Duration
+	CatalogStaleFor time.Duration
+	StockFreshFor   time.Duration
+	StockStaleFor   time.Duration
+}
+
+type SearchConfig struct {
+	Language      string    // Postgres text search configuration; changing it needs a reindex
+	MinSimilarity float64   // Trigram word similarity a misspelled query needs, 0 to 1
+	PriceBuckets  []float64 // Upper bounds of the price facet buckets
+}
+
+type SEOConfig struct {
+	SiteURL     string // Storefront origin that canonical and sitemap URLs point at
+	SitemapSize int    // URLs per product sitemap, at most 50000
+}
+
+type FeedsConfig struct {
+	Dir      string        // Where generated feeds are kept
+	Interval time.Duration // How often feeds are regenerated
+	Brand    string        // Brand of our products, also the feed title
+}
+
+// LiveConfig tunes the stream of stock and order updates to browsers
+type LiveConfig struct {
+	Heartbeat  time.Duration // Idle time before a comment keeps proxies from closing the stream
+	ReplaySize int           // Recent events kept for clients that reconnect
+}
+
+// StockAlertsConfig sets when operations hear of low stock. Variants with an
+// Odoo reordering rule are held to its minimum instead of MinStock.
+type StockAlertsConfig struct {
+	MinStock float64 // Available units below which a variant is low; 0 for no default
+	Email    string  // Recipient of low-stock alerts; empty disables them
+}
+
+// WarehouseConfig sets where an Odoo warehouse, named by its code, ships to
+type WarehouseConfig struct {
+	Code      string
+	Countries []string // Destination countries as shipping addresses give them; none ships anywhere
+}
+
+type ImagesConfig struct {
+	CacheDir    string        // Where resized and re-encoded images are kept
+	CacheMaxAge time.Duration // Derived images not served for this long are pruned
+	JPEGQuality int
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"ecommerce/internal/models"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Migrate creates or updates the tables owned by this service
+func Migrate(db *gorm.DB) error {
+	err := db.AutoMigrate(
+		&models.Order{},
+		&models.OrderItem{},
+		&models.ShippingInfo{},
+		&models.Shipment{},
+		&models.OrderStatusEvent{},
+		&models.SettlementRecord{},
+		&models.PaymentDiscrepancy{},
+		&models.NotificationDelivery{},
+		&models.Category{},
+		&models.ProductSearchDocument{},
+		&models.ProductSearchFacet{},
+		&models.ProductPage{},
+		&models.SlugRedirect{},
+		&models.Warehouse{},
+		&models.StockLevel{},
+		&models.RestockSubscription{},
+		&models.MadeToOrder{},
+		&models.BomComponent{},
+		&models.ManufacturingOrder{},
+		&models.BackorderPolicy{},
+		&models.Backorder{},
+		&models.BackorderReservation{},
+		&models.StockReceipt{},
+		&models.Kit{},
+		&models.KitComponent{},
+		&models.BundlePricing{},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	// Search indexes AutoMigrate cannot declare
+	for _, statement := range []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_product_search_document ON product_search_documents USING GIN (document)",
+		"CREATE INDEX IF NOT EXISTS idx_product_search_text ON product_search_documents USING GIN (search_text gin_trgm_ops)",
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to create search indexes: %w", err)
+		}
+	}
+	return nil
+}
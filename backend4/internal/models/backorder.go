@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// Ways a product sells beyond its stock
+const (
+	BackorderModePreorder  = "preorder"  // Not released yet
+	BackorderModeBackorder = "backorder" // Out of stock, more on the way
+)
+
+// Backorder states
+const (
+	BackorderWaiting   = "waiting"
+	BackorderAllocated = "allocated" // Has its units, not reserved in Odoo yet
+	BackorderReleased  = "released"  // Odoo was asked to reserve its units
+	BackorderCancelled = "cancelled"
+)
+
+// BackorderPolicy lets a product be ordered beyond its stock. Cap bounds the
+// units waiting for stock at once; 0 leaves it unbounded.
+type BackorderPolicy struct {
+	TemplateID  int64      `json:"product_id" gorm:"primaryKey;autoIncrement:false"` // Odoo product.template
+	Mode        string     `json:"mode"`
+	Cap         int        `json:"cap"`
+	ReleaseDate *time.Time `json:"release_date,omitempty"` // When pre-ordered units are expected to ship
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Backorder is the part of an order line that waits for stock. Incoming
+// stock is allocated to waiting backorders oldest first.
+type Backorder struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	OrderID     uint       `json:"order_id" gorm:"index"`
+	VariantID   int64      `json:"variant_id" gorm:"index:idx_backorder_waiting,priority:1"` // Odoo product.product
+	TemplateID  int64      `json:"product_id" gorm:"index"`
+	Mode        string     `json:"mode"`
+	Quantity    float64    `json:"quantity"`
+	Allocated   float64    `json:"allocated"`
+	Status      string     `json:"status" gorm:"index:idx_backorder_waiting,priority:2"`
+	AllocatedAt *time.Time `json:"allocated_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// BackorderReservation counts the units a checkout plans to order beyond
+// stock against their product's cap until the order records them as
+// backorders or the checkout lapses
+type BackorderReservation struct {
+	CheckoutID string `gorm:"primaryKey"`
+	TemplateID int64  `gorm:"primaryKey;autoIncrement:false"`
+	Quantity   float64
+	ExpiresAt  time.Time `gorm:"index"`
+}
+
+// StockReceipt is an incoming Odoo picking whose stock was allocated to
+// backorders, so it is only allocated once
+type StockReceipt struct {
+	OdooPickingID int64 `gorm:"primaryKey;autoIncrement:false"`
+	Reference     string
+	CreatedAt     time.Time
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// How a bundle is priced
+const (
+	BundlePriceFixed    = "fixed"    // Price, whatever its components cost
+	BundlePriceDiscount = "discount" // The components' prices less DiscountPercent
+)
+
+// Kit is a variant Odoo sells as a bundle of other products, from a phantom
+// bill of materials. Odoo delivers its components in its place.
+type Kit struct {
+	VariantID  int64          `gorm:"primaryKey;autoIncrement:false"` // Odoo product.product
+	TemplateID int64          `gorm:"index"`
+	Components []KitComponent `gorm:"foreignKey:KitID"`
+	UpdatedAt  time.Time
+}
+
+// KitComponent is what one kit holds of a product
+type KitComponent struct {
+	KitID       int64   `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	ComponentID int64   `json:"variant_id" gorm:"primaryKey;autoIncrement:false"` // Odoo product.product
+	TemplateID  int64   `json:"product_id"`
+	Name        string  `json:"name"`
+	SKU         string  `json:"sku,omitempty"`
+	Quantity    float64 `json:"quantity"` // Per kit
+}
+
+// BundlePricing prices a bundle product from its components instead of its
+// own Odoo price
+type BundlePricing struct {
+	TemplateID      int64     `json:"product_id" gorm:"primaryKey;autoIncrement:false"` // Odoo product.template
+	Mode            string    `json:"mode"`
+	Price           float64   `json:"price,omitempty"`
+	DiscountPercent float64   `json:"discount_percent,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Bundle is a kit variant as shoppers see it, with its price
+type Bundle struct {
+	VariantID  int64          `json:"variant_id"`
+	ProductID  int64          `json:"product_id"`
+	Price      float64        `json:"price"`
+	Components []KitComponent `json:"components"`
+}
@@ -24,6 +24,17 @@ type CartItem struct {
 	Subtotal  float64 `json:"subtotal"`
 	Name      string  `json:"name"` // Denormalized from product
 	SKU       string  `json:"sku"`  // Denormalized from product
+
+	// What a bundle holds, per unit of the bundle
+	Components []CartComponent `json:"components,omitempty"`
+}
+
+// CartComponent is a product that comes in a bundle
+type CartComponent struct {
+	VariantID uint    `json:"variant_id"`
+	Name      string  `json:"name"`
+	SKU       string  `json:"sku,omitempty"`
+	Quantity  float64 `json:"quantity"`
 }
 
 // Calculate updates the cart totals
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Category trees mirrored from Odoo
+const (
+	CategoryKindPublic   = "public"   // product.public.category, the website navigation
+	CategoryKindInternal = "internal" // product.category, used by Odoo for accounting and logistics
+)
+
+// Category is a product category mirrored from Odoo. Path is Odoo's
+// parent_path, the Odoo IDs from the root down to the category such as
+// "1/4/9/", so a subtree is every category whose path starts with its root's.
+type Category struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Kind      string     `json:"kind" gorm:"uniqueIndex:idx_category_odoo;index:idx_category_slug"`
+	OdooID    int64      `json:"odoo_id" gorm:"uniqueIndex:idx_category_odoo"`
+	ParentID  *uint      `json:"parent_id,omitempty" gorm:"index"`
+	Name      string     `json:"name"`
+	Slug      string     `json:"slug" gorm:"index:idx_category_slug"` // Unique within a kind
+	Path      string     `json:"-" gorm:"index"`
+	Level     int        `json:"level"` // 0 for roots
+	Sequence  int        `json:"sequence"`
+	WriteDate time.Time  `json:"last_modified"` // In Odoo
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Children  []Category `json:"children,omitempty" gorm:"-"`
+}
+
+// Breadcrumb is one step on the way from a category root down to a product
+type Breadcrumb struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
@@ -14,9 +14,16 @@ type CheckoutSession struct {
 	Currency     string       `json:"currency"`
 	PaymentData  PaymentData  `json:"paymentData"`
 	ShippingInfo ShippingInfo `json:"shipping_info"`
-	CreatedAt    time.Time    `json:"created_at"`
-	UpdatedAt    time.Time    `json:"updated_at"`
-	ExpiresAt    time.Time    `json:"expires_at"`
+	Email        string       `json:"email,omitempty"`
+	Locale       string       `json:"locale,omitempty"`
+	// Units beyond stock by variant, ordered under a pre-order or backorder
+	// policy. Their payment is only authorised, through the manual capture
+	// account.
+	Backordered   map[uint]int `json:"backordered,omitempty"`
+	ManualCapture bool         `json:"manual_capture,omitempty"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+	ExpiresAt     time.Time    `json:"expires_at"`
 }
 
 type CheckoutRequest struct {
@@ -24,4 +31,20 @@ type CheckoutRequest struct {
 	ShippingInfo  ShippingInfo `json:"shipping_info" binding:"required"`
 	PaymentMethod string       `json:"payment_method" binding:"required"`
 	Currency      string       `json:"currency" binding:"required"`
+	Email         string       `json:"email" binding:"omitempty,email"`
+	Locale        string       `json:"locale"`
+}
+
+// AbandonedCartEvent is published when a checkout session expires without being paid
+type AbandonedCartEvent struct {
+	CheckoutID   string       `json:"checkout_id"`
+	CartID       string       `json:"cart_id"`
+	UserID       *uint        `json:"user_id,omitempty"`
+	Items        []CartItem   `json:"items"`
+	Total        float64      `json:"total"`
+	Currency     string       `json:"currency"`
+	ShippingInfo ShippingInfo `json:"shipping_info"`
+	Email        string       `json:"email,omitempty"`
+	Locale       string       `json:"locale,omitempty"`
+	AbandonedAt  time.Time    `json:"abandoned_at"`
 }
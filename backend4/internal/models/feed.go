@@ -0,0 +1,35 @@
+package models
+
+// Availability of a feed item, in Google's spelling
+const (
+	FeedInStock    = "in_stock"
+	FeedOutOfStock = "out_of_stock"
+)
+
+// Feed is the catalog as listed on shopping channels
+type Feed struct {
+	Title string
+	Link  string
+	Items []FeedItem
+}
+
+// FeedItem is one product variant as shopping channels list it. Prices are in
+// Currency; SalePrice is zero unless the variant is discounted, in which case
+// Price is the price before the discount.
+type FeedItem struct {
+	ID           string // Odoo product.product ID
+	ItemGroupID  string // Odoo product.template ID, set for templates with several variants
+	Title        string
+	Description  string
+	Link         string
+	ImageLink    string
+	Availability string
+	Price        float64
+	SalePrice    float64
+	Currency     string
+	Brand        string
+	GTIN         string // From the Odoo barcode, when it is a valid GTIN
+	MPN          string // From the Odoo internal reference
+	ProductType  string // Internal category path, like "All > Office > Chairs"
+	Condition    string
+}
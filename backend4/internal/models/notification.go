@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Notification delivery states
+const (
+	DeliveryStatusSent    = "sent"
+	DeliveryStatusFailed  = "failed"
+	DeliveryStatusSkipped = "skipped"
+)
+
+// NotificationDelivery is the delivery log entry for one notification event
+type NotificationDelivery struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	EventID   string     `json:"event_id" gorm:"uniqueIndex"`
+	EventType string     `json:"event_type" gorm:"index"`
+	Recipient string     `json:"recipient"`
+	Subject   string     `json:"subject"`
+	Locale    string     `json:"locale"`
+	Transport string     `json:"transport"`
+	Status    string     `json:"status"`
+	Attempts  int        `json:"attempts"`
+	Error     string     `json:"error,omitempty"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func (NotificationDelivery) TableName() string {
+	return "notification_deliveries"
+}
@@ -3,21 +3,69 @@ package models
 import "time"
 
 type Order struct {
-	ID           uint         `json:"id" gorm:"primaryKey"`
-	UserID       uint         `json:"user_id"`
-	Status       string       `json:"status"`
-	Total        float64      `json:"total"`
-	PaymentID    string       `json:"payment_id"`
-	Items        []OrderItem  `json:"items"`
-	ShippingInfo ShippingInfo `json:"shipping_info"`
-	CreatedAt    time.Time    `json:"created_at"`
-	UpdatedAt    time.Time    `json:"updated_at"`
+	ID               uint         `json:"id" gorm:"primaryKey"`
+	OdooID           *int64       `json:"odoo_id,omitempty" gorm:"index"`
+	UserID           uint         `json:"user_id"`
+	Status           string       `json:"status"`
+	Total            float64      `json:"total"`
+	Currency         string       `json:"currency"`
+	PaymentID        string       `json:"payment_id" gorm:"index"`
+	PaymentReference string       `json:"payment_reference" gorm:"index"` // Merchant reference sent to Adyen
+	PspReference     string       `json:"-" gorm:"index"`                 // Adyen authorisation, from its notification
+	CaptureStatus    string       `json:"capture_status,omitempty"`       // Empty when Adyen captured at once
+	CustomerEmail    string       `json:"customer_email"`
+	Locale           string       `json:"locale"`
+	Items            []OrderItem  `json:"items"`
+	ShippingInfo     ShippingInfo `json:"shipping_info"`
+	WarehouseID      *int64       `json:"warehouse_id,omitempty"` // Odoo stock.warehouse fulfilling the order
+
+	// Estimated when checked out, counting in made-to-order items
+	EstimatedShipDate *time.Time `json:"estimated_ship_date,omitempty"`
+
+	// Fulfillment, filled from Odoo stock.picking
+	FulfillmentStatus string     `json:"fulfillment_status" gorm:"default:pending"`
+	TrackingNumber    string     `json:"tracking_number,omitempty"` // Most recent shipment
+	TrackingURL       string     `json:"tracking_url,omitempty"`
+	Shipments         []Shipment `json:"shipments,omitempty" gorm:"foreignKey:OrderID"`
+
+	// Made-to-order items, filled from Odoo mrp.production
+	ManufacturingOrders []ManufacturingOrder `json:"manufacturing_orders,omitempty" gorm:"foreignKey:OrderID"`
+
+	// Units waiting for stock, of pre-ordered or backordered items
+	Backorders []Backorder `json:"backorders,omitempty" gorm:"foreignKey:OrderID"`
+
+	// Invoicing, filled once the Odoo invoice is posted and paid
+	InvoiceStatus string     `json:"invoice_status,omitempty"`
+	OdooInvoiceID *int64     `json:"-"`
+	InvoicedAt    *time.Time `json:"invoiced_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// Invoice states of an order
+const (
+	InvoiceStatusPosted = "posted" // Invoice posted, payment not registered yet
+	InvoiceStatusPaid   = "paid"   // Adyen payment registered against the invoice
+	InvoiceStatusFailed = "failed" // Last attempt failed, retried by the invoice scheduler
+)
+
+// Capture states of orders whose payment was only authorised, because they
+// wait for stock. The payment is captured once the order ships.
+const (
+	CaptureStatusAuthorised = "authorised"
+	CaptureStatusRequested  = "requested" // Sent to Adyen, outcome notified later
+	CaptureStatusCaptured   = "captured"
+	CaptureStatusFailed     = "failed"
+)
+
 type OrderItem struct {
 	ID        uint    `json:"id" gorm:"primaryKey"`
 	OrderID   uint    `json:"order_id"`
 	ProductID uint    `json:"product_id"`
+	VariantID uint    `json:"variant_id"`
+	Name      string  `json:"name"`
+	SKU       string  `json:"sku"`
 	Quantity  int     `json:"quantity"`
 	Price     float64 `json:"price"`
 }
@@ -31,3 +79,81 @@ type ShippingInfo struct {
 	Country  string `json:"country"`
 	PostCode string `json:"post_code"`
 }
+
+// Order fulfillment states
+const (
+	FulfillmentPending          = "pending"
+	FulfillmentInProduction     = "in_production" // Made-to-order items are being manufactured
+	FulfillmentPartiallyShipped = "partially_shipped"
+	FulfillmentShipped          = "shipped"
+	FulfillmentCancelled        = "cancelled"
+)
+
+// Shipment is one outgoing Odoo delivery (stock.picking) of an order.
+// Orders shipped in several packages have one shipment per picking.
+type Shipment struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	OrderID        uint       `json:"order_id" gorm:"index"`
+	OdooPickingID  int64      `json:"odoo_picking_id" gorm:"uniqueIndex"`
+	Reference      string     `json:"reference"` // Picking name, e.g. WH/OUT/00012
+	State          string     `json:"state"`     // Odoo picking state: draft, waiting, confirmed, assigned, done, cancel
+	Carrier        string     `json:"carrier,omitempty"`
+	TrackingNumber string     `json:"tracking_number,omitempty"`
+	TrackingURL    string     `json:"tracking_url,omitempty"`
+	ShippedAt      *time.Time `json:"shipped_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+func (Shipment) TableName() string {
+	return "shipments"
+}
+
+// Sources of order status changes
+const (
+	StatusSourceCheckout    = "checkout"
+	StatusSourceOdoo        = "odoo"
+	StatusSourceFulfillment = "fulfillment"
+	StatusSourcePayment     = "payment"
+)
+
+// OrderStatusEvent is one entry in an order's status history
+type OrderStatusEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	OrderID   uint      `json:"order_id" gorm:"index"`
+	Status    string    `json:"status"`
+	Source    string    `json:"source"` // Where the change came from: checkout, odoo, fulfillment, payment
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (OrderStatusEvent) TableName() string {
+	return "order_status_events"
+}
+
+// OrderFilter narrows a customer's order history
+type OrderFilter struct {
+	Statuses []string
+	From     *time.Time
+	To       *time.Time
+	Page     int
+	Limit    int
+}
+
+// OrderPayment is the customer-facing view of a settled payment or refund
+type OrderPayment struct {
+	Type          string    `json:"type"`
+	Amount        float64   `json:"amount"`
+	Currency      string    `json:"currency"`
+	PaymentMethod string    `json:"payment_method"`
+	Reference     string    `json:"reference"`
+	Date          time.Time `json:"date"`
+}
+
+// OrderDetail is an order with everything shown on the order detail page
+type OrderDetail struct {
+	Order
+	Payments         []OrderPayment     `json:"payments"`
+	StatusHistory    []OrderStatusEvent `json:"status_history"`
+	InvoiceAvailable bool               `json:"invoice_available"`
+}
@@ -18,9 +18,31 @@ type Product struct {
 	Variants    []ProductVariant   `json:"variants" gorm:"foreignKey:ProductID"`
 	Attributes  []ProductAttribute `json:"attributes" gorm:"many2many:product_attributes"`
 
-	Image1920 string `xmlrpc:"image_1920"`
-	Image1024 string `xmlrpc:"image_1024"`
-	Image128  string `xmlrpc:"image_128"`
+	CategoryID        int64        `json:"category_id,omitempty" gorm:"-"`         // Odoo product.category
+	PublicCategoryIDs []int64      `json:"public_category_ids,omitempty" gorm:"-"` // Odoo product.public.category
+	Breadcrumbs       []Breadcrumb `json:"breadcrumbs,omitempty" gorm:"-"`
+	SEO               *ProductPage `json:"seo,omitempty" gorm:"-"`
+
+	Gallery []ProductImage `json:"gallery,omitempty" gorm:"-"`
+}
+
+// Kinds of product images
+const (
+	ProductImageTemplate = "template" // The template's main image
+	ProductImageExtra    = "extra"    // Extra media from website_sale's product.image
+	ProductImageVariant  = "variant"  // A variant's own image
+)
+
+// ProductImage is one entry of a product's gallery. URL points at the image
+// endpoint and changes whenever the image changes in Odoo.
+type ProductImage struct {
+	Kind      string `json:"kind"`
+	ImageID   int64  `json:"image_id,omitempty"`   // product.image ID for extra media
+	VariantID int64  `json:"variant_id,omitempty"` // Set for images of a single variant
+	URL       string `json:"url"`
+	Alt       string `json:"alt"`
+	Position  int    `json:"position"`
+	IsPrimary bool   `json:"is_primary"`
 }
 
 // ProductVariant represents a specific variant of a product
@@ -58,6 +80,13 @@ type ProductAttributeValue struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// ProductChange is the payload of the product.changed and stock.changed
+// events on the inventory queue, naming the Odoo records that changed.
+type ProductChange struct {
+	TemplateIDs []int64 `json:"template_ids"`
+	VariantIDs  []int64 `json:"variant_ids"`
+}
+
 // TableName sets the table name for GORM
 func (Product) TableName() string {
 	return "products"
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// MadeToOrder is a variant that can be sold without stock, because Odoo
+// manufactures or buys it for each order. ProduceDays is how long making one
+// takes; ReplenishDays is how long it takes to get when it is bought instead.
+type MadeToOrder struct {
+	VariantID     int64 `gorm:"primaryKey;autoIncrement:false"` // Odoo product.product
+	TemplateID    int64 `gorm:"index"`
+	Manufactured  bool
+	ProduceDays   int
+	ReplenishDays int
+	UpdatedAt     time.Time
+}
+
+// BomComponent is what making one unit of a made-to-order variant takes of a
+// component, from its Odoo bill of materials. ReplenishDays is how long the
+// component takes to get when it is out of stock.
+type BomComponent struct {
+	VariantID     int64   `gorm:"primaryKey;autoIncrement:false"`
+	ComponentID   int64   `gorm:"primaryKey;autoIncrement:false"` // Odoo product.product
+	Quantity      float64 // Per unit of the variant
+	ReplenishDays int
+}
+
+// ManufacturingOrder is an Odoo mrp.production made for an order
+type ManufacturingOrder struct {
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	OrderID          uint       `json:"order_id" gorm:"index"`
+	OdooProductionID int64      `json:"odoo_production_id" gorm:"uniqueIndex"`
+	Reference        string     `json:"reference"` // Production name, e.g. WH/MO/00007
+	Product          string     `json:"product"`
+	State            string     `json:"state"` // Odoo production state: draft, confirmed, progress, to_close, done, cancel
+	Quantity         float64    `json:"quantity"`
+	QuantityProduced float64    `json:"quantity_produced"`
+	ComponentsState  string     `json:"components_state,omitempty"` // available, expected or late
+	PlannedFinish    *time.Time `json:"planned_finish,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
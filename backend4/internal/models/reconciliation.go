@@ -0,0 +1,95 @@
+package models
+
+import "time"
+
+// Settlement record types as they appear in the Adyen settlement detail report
+const (
+	SettlementTypeSettled            = "Settled"
+	SettlementTypeRefunded           = "Refunded"
+	SettlementTypeChargeback         = "Chargeback"
+	SettlementTypeSecondChargeback   = "SecondChargeback"
+	SettlementTypeChargebackReversed = "ChargebackReversed"
+)
+
+// Settlement record reconciliation states
+const (
+	SettlementStatusMatched     = "matched"
+	SettlementStatusPosted      = "posted"
+	SettlementStatusDiscrepancy = "discrepancy"
+	SettlementStatusIgnored     = "ignored"
+)
+
+// Discrepancy kinds raised while reconciling settlements against orders
+const (
+	DiscrepancyAmountMismatch       = "amount_mismatch"
+	DiscrepancyMissingOrder         = "missing_order"
+	DiscrepancyDuplicateCapture     = "duplicate_capture"
+	DiscrepancyUnexpectedChargeback = "unexpected_chargeback"
+)
+
+// Discrepancy states
+const (
+	DiscrepancyStatusOpen     = "open"
+	DiscrepancyStatusResolved = "resolved"
+)
+
+// SettlementRecord is a single row of an Adyen settlement detail report
+type SettlementRecord struct {
+	ID                    uint      `json:"id" gorm:"primaryKey"`
+	ReportName            string    `json:"report_name" gorm:"index"`
+	PspReference          string    `json:"psp_reference" gorm:"uniqueIndex:idx_settlement_row"`
+	MerchantReference     string    `json:"merchant_reference" gorm:"index"`
+	ModificationReference string    `json:"modification_reference" gorm:"uniqueIndex:idx_settlement_row"`
+	Type                  string    `json:"type" gorm:"uniqueIndex:idx_settlement_row"`
+	PaymentMethod         string    `json:"payment_method"`
+	Currency              string    `json:"currency"`
+	GrossAmount           float64   `json:"gross_amount"` // Credit minus debit, in gross currency
+	NetAmount             float64   `json:"net_amount"`   // Credit minus debit, in net currency
+	Commission            float64   `json:"commission"`
+	BookedAt              time.Time `json:"booked_at"`
+	BatchNumber           string    `json:"batch_number"`
+	OrderID               *uint     `json:"order_id,omitempty" gorm:"index"`
+	Status                string    `json:"status"`
+	OdooPaymentID         *int64    `json:"odoo_payment_id,omitempty"`
+	PostError             string    `json:"post_error,omitempty"` // Last failure to book a matched row in Odoo
+	CreatedAt             time.Time `json:"created_at"`
+	UpdatedAt             time.Time `json:"updated_at"`
+}
+
+// PaymentDiscrepancy records a settlement row that does not agree with our orders
+type PaymentDiscrepancy struct {
+	ID                 uint       `json:"id" gorm:"primaryKey"`
+	Kind               string     `json:"kind" gorm:"index"`
+	Status             string     `json:"status" gorm:"index;default:open"`
+	SettlementRecordID uint       `json:"settlement_record_id"`
+	OrderID            *uint      `json:"order_id,omitempty"`
+	PspReference       string     `json:"psp_reference"`
+	MerchantReference  string     `json:"merchant_reference"`
+	Currency           string     `json:"currency"`
+	Expected           float64    `json:"expected"`
+	Actual             float64    `json:"actual"`
+	Details            string     `json:"details"`
+	Resolution         string     `json:"resolution,omitempty"`
+	ResolvedAt         *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// ReconciliationSummary describes the outcome of ingesting one settlement report
+type ReconciliationSummary struct {
+	ReportName    string `json:"report_name"`
+	Rows          int    `json:"rows"`
+	Skipped       int    `json:"skipped"` // Already ingested from an earlier report
+	Matched       int    `json:"matched"`
+	Posted        int    `json:"posted"`
+	Ignored       int    `json:"ignored"`
+	Discrepancies int    `json:"discrepancies"`
+}
+
+func (SettlementRecord) TableName() string {
+	return "settlement_records"
+}
+
+func (PaymentDiscrepancy) TableName() string {
+	return "payment_discrepancies"
+}
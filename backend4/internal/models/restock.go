@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Restock subscription states
+const (
+	RestockPending   = "pending"
+	RestockNotified  = "notified"
+	RestockCancelled = "cancelled"
+)
+
+// RestockSubscription asks for an email when an out-of-stock variant is back.
+// Token lets the subscriber cancel without an account.
+type RestockSubscription struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Token      string     `json:"token" gorm:"uniqueIndex"`
+	VariantID  int64      `json:"variant_id" gorm:"index:idx_restock_waiting,priority:1"` // Odoo product.product
+	TemplateID int64      `json:"product_id"`
+	UserID     *uint      `json:"user_id,omitempty"`
+	Email      string     `json:"email"`
+	Locale     string     `json:"locale,omitempty"`
+	Quantity   int        `json:"quantity"` // How many the shopper wants
+	Status     string     `json:"status" gorm:"index:idx_restock_waiting,priority:2"`
+	NotifiedAt *time.Time `json:"notified_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// RestockNotification is published when a subscribed variant is back in stock
+type RestockNotification struct {
+	SubscriptionID uint   `json:"subscription_id"`
+	Email          string `json:"email"`
+	Locale         string `json:"locale,omitempty"`
+	VariantID      int64  `json:"variant_id"`
+	ProductID      int64  `json:"product_id"`
+	Name           string `json:"name"`
+	Path           string `json:"path,omitempty"` // Product page on the storefront
+	Quantity       int    `json:"quantity"`
+}
+
+// LowStockAlert tells operations which variants fell below their threshold
+type LowStockAlert struct {
+	Email    string         `json:"email"`
+	Items    []LowStockItem `json:"items"`
+	RaisedAt time.Time      `json:"raised_at"`
+}
+
+// LowStockItem is a variant whose stock fell below a reordering rule's
+// minimum at a warehouse, or below the shop's minimum stock overall
+type LowStockItem struct {
+	VariantID   int64   `json:"variant_id"`
+	TemplateID  int64   `json:"product_id"`
+	Name        string  `json:"name"`
+	SKU         string  `json:"sku,omitempty"`
+	WarehouseID int64   `json:"warehouse_id,omitempty"` // 0 when counted over all warehouses
+	Warehouse   string  `json:"warehouse,omitempty"`
+	Available   float64 `json:"available"`
+	Threshold   float64 `json:"threshold"`
+}
@@ -0,0 +1,109 @@
+package models
+
+import "time"
+
+// Facets a product is indexed under
+const (
+	SearchFacetPublicCategory   = "category:public"
+	SearchFacetInternalCategory = "category:internal"
+	SearchFacetAttribute        = "attribute"
+)
+
+// ProductSearchDocument is a product template as the search index holds it.
+// Document is a weighted tsvector the indexer builds in SQL; SearchText keeps
+// the same words as plain text for trigram matching of misspelled queries.
+type ProductSearchDocument struct {
+	TemplateID int64   `gorm:"primaryKey;autoIncrement:false"`
+	Name       string  `gorm:"not null"`
+	SearchText string  `gorm:"not null"`
+	Price      float64 `gorm:"index"`
+	InStock    bool    `gorm:"index"`
+	Document   string  `gorm:"type:tsvector"`
+	UpdatedAt  time.Time
+}
+
+// ProductSearchFacet files a product under a category or an attribute value.
+// Products are filed under the ancestors of their categories too, so
+// filtering by a category includes everything below it.
+type ProductSearchFacet struct {
+	TemplateID int64  `gorm:"primaryKey;autoIncrement:false"`
+	Facet      string `gorm:"primaryKey;index:idx_search_facet_value"`
+	ValueID    int64  `gorm:"primaryKey;autoIncrement:false;index:idx_search_facet_value"` // Odoo category or product.attribute.value ID
+	Attribute  string // Attribute name, for attribute facets
+	Label      string // Value name, for attribute facets
+}
+
+func (ProductSearchDocument) TableName() string {
+	return "product_search_documents"
+}
+
+func (ProductSearchFacet) TableName() string {
+	return "product_search_facets"
+}
+
+// SearchResult is one page of product search results with the facet counts
+// of everything that matched
+type SearchResult struct {
+	Query  string       `json:"query"`
+	Fuzzy  bool         `json:"fuzzy"` // No exact match, results come from typo-tolerant matching
+	Total  int64        `json:"total"`
+	Page   int          `json:"page"`
+	Limit  int          `json:"limit"`
+	Items  []SearchHit  `json:"items"`
+	Facets SearchFacets `json:"facets"`
+}
+
+// SearchHit is a product matching a search
+type SearchHit struct {
+	OdooID   int64   `json:"odoo_id"`
+	Name     string  `json:"name"`
+	Price    float64 `json:"price"`
+	InStock  bool    `json:"in_stock"`
+	Score    float64 `json:"score"`
+	ImageURL string  `json:"image_url"`
+}
+
+type SearchFacets struct {
+	Categories []CategoryFacet  `json:"categories"`
+	Prices     []PriceFacet     `json:"prices"`
+	Attributes []AttributeFacet `json:"attributes"`
+	InStock    int64            `json:"in_stock"`
+	OutOfStock int64            `json:"out_of_stock"`
+}
+
+type CategoryFacet struct {
+	Slug  string `json:"slug"`
+	Name  string `json:"name"`
+	Level int    `json:"level"`
+	Count int64  `json:"count"`
+}
+
+// PriceFacet counts products priced from Min up to, but not including, Max.
+// The last bucket has no Max.
+type PriceFacet struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max,omitempty"`
+	Count int64    `json:"count"`
+}
+
+type AttributeFacet struct {
+	Name   string                `json:"name"`
+	Values []AttributeValueFacet `json:"values"`
+}
+
+type AttributeValueFacet struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// Suggestions complete a partly typed search
+type Suggestions struct {
+	Products   []ProductSuggestion `json:"products"`
+	Categories []Breadcrumb        `json:"categories"`
+}
+
+type ProductSuggestion struct {
+	OdooID int64  `json:"odoo_id"`
+	Name   string `json:"name"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// SlugKindProduct marks product slugs in SlugRedirect; category slugs use
+// their category kind
+const SlugKindProduct = "product"
+
+// ProductPage holds what search engines see of a product template: its slug
+// and metadata. LastModified is the template's write_date in Odoo.
+type ProductPage struct {
+	TemplateID      int64     `json:"odoo_id" gorm:"primaryKey;autoIncrement:false"`
+	Slug            string    `json:"slug" gorm:"uniqueIndex"`
+	SlugSource      string    `json:"-"` // The name the slug was made from
+	MetaTitle       string    `json:"meta_title"`
+	MetaDescription string    `json:"meta_description"`
+	MetaKeywords    string    `json:"meta_keywords,omitempty"`
+	Published       bool      `json:"-" gorm:"index"` // Listed in the sitemap
+	LastModified    time.Time `json:"last_modified"`
+	UpdatedAt       time.Time `json:"-"`
+	CanonicalURL    string    `json:"canonical_url" gorm:"-"`
+}
+
+// SlugRedirect remembers a slug a product or category no longer has, so old
+// links can be redirected to the current one
+type SlugRedirect struct {
+	Kind      string `gorm:"primaryKey"`
+	Slug      string `gorm:"primaryKey"`
+	OdooID    int64
+	CreatedAt time.Time
+}
@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// Warehouse is an Odoo stock.warehouse. LeadDays is how long its delivery
+// route takes to ship, the sum of the delays of the route's rules.
+type Warehouse struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	OdooID     int64     `json:"odoo_id" gorm:"uniqueIndex"`
+	Name       string    `json:"name"`
+	Code       string    `json:"code"`
+	LocationID int64     `json:"-"` // Odoo lot_stock_id, the root of its stock locations
+	LeadDays   int       `json:"lead_days"`
+	Sequence   int       `json:"-"`
+	CreatedAt  time.Time `json:"-"`
+	UpdatedAt  time.Time `json:"-"`
+}
+
+// StockLevel is the stock of a variant at one internal location, summed over
+// the stock.quant records there
+type StockLevel struct {
+	VariantID   int64   `gorm:"primaryKey;autoIncrement:false"` // Odoo product.product
+	LocationID  int64   `gorm:"primaryKey;autoIncrement:false"` // Odoo stock.location
+	TemplateID  int64   `gorm:"index"`
+	WarehouseID int64   `gorm:"index"` // Odoo stock.warehouse, 0 for locations outside warehouses
+	Quantity    float64 // On hand
+	Reserved    float64 // Reserved for deliveries
+	UpdatedAt   time.Time
+}
+
+// Availability is where a variant is in stock and how soon it can ship.
+// Quantity leaves out stock reserved in Odoo and stock held by checkouts.
+// Made-to-order variants short of stock ship once made or bought, which
+// takes ProductionDays.
+type Availability struct {
+	VariantID        int64                   `json:"variant_id"`
+	Quantity         float64                 `json:"quantity"`
+	InStock          bool                    `json:"in_stock"`
+	MadeToOrder      bool                    `json:"made_to_order"`
+	ProductionDays   int                     `json:"production_days,omitempty"`
+	EarliestShipDate *time.Time              `json:"earliest_ship_date,omitempty"`
+	Warehouses       []WarehouseAvailability `json:"warehouses"`
+}
+
+// WarehouseAvailability is a variant's stock at one warehouse. ShipDate is
+// when an order placed now would ship from it.
+type WarehouseAvailability struct {
+	WarehouseID int64     `json:"warehouse_id"` // Odoo stock.warehouse
+	Code        string    `json:"code"`
+	Name        string    `json:"name"`
+	Quantity    float64   `json:"quantity"`
+	LeadDays    int       `json:"lead_days"`
+	ShipDate    time.Time `json:"ship_date"`
+}
+
+// StockChange is a variant's stock at one warehouse, on hand less reserved,
+// before and after a stock sync
+type StockChange struct {
+	VariantID   int64
+	TemplateID  int64
+	WarehouseID int64 // 0 for locations outside warehouses
+	Before      float64
+	After       float64
+}
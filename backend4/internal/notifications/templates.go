@@ -0,0 +1,139 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// DefaultLocale is used when an event carries no locale or an unsupported one
+const DefaultLocale = "en"
+
+//go:embed templates
+var templateFS embed.FS
+
+var templateFuncs = map[string]interface{}{
+	"money": func(amount float64, currency string) string {
+		return strings.TrimSpace(fmt.Sprintf("%.2f %s", amount, currency))
+	},
+	"mul": func(price float64, quantity int) float64 {
+		return price * float64(quantity)
+	},
+}
+
+type eventTemplates struct {
+	text *texttemplate.Template // Defines "subject" and the text body
+	html *htmltemplate.Template
+}
+
+// Renderer renders notification templates per event type and locale.
+// Templates live in templates/<locale>/<event>.txt and .html, where the event
+// type has its dots replaced by underscores (order.created -> order_created).
+type Renderer struct {
+	templates map[string]map[string]*eventTemplates
+}
+
+func NewRenderer() (*Renderer, error) {
+	r := &Renderer{templates: make(map[string]map[string]*eventTemplates)}
+
+	locales, err := fs.ReadDir(templateFS, "templates")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates: %w", err)
+	}
+
+	for _, locale := range locales {
+		if !locale.IsDir() {
+			continue
+		}
+		dir := path.Join("templates", locale.Name())
+		files, err := fs.Glob(templateFS, path.Join(dir, "*.txt"))
+		if err != nil {
+			return nil, err
+		}
+
+		r.templates[locale.Name()] = make(map[string]*eventTemplates)
+		for _, file := range files {
+			name := strings.TrimSuffix(path.Base(file), ".txt")
+
+			text, err := texttemplate.New(path.Base(file)).Funcs(templateFuncs).ParseFS(templateFS, file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+			}
+			if text.Lookup("subject") == nil {
+				return nil, fmt.Errorf("template %s does not define a subject", file)
+			}
+
+			htmlFile := path.Join(dir, name+".html")
+			html, err := htmltemplate.New(path.Base(htmlFile)).Funcs(templateFuncs).ParseFS(templateFS, htmlFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", htmlFile, err)
+			}
+
+			r.templates[locale.Name()][name] = &eventTemplates{text: text, html: html}
+		}
+	}
+
+	if _, ok := r.templates[DefaultLocale]; !ok {
+		return nil, fmt.Errorf("templates for default locale %q are missing", DefaultLocale)
+	}
+
+	return r, nil
+}
+
+// Supports reports whether there is a template for the event type
+func (r *Renderer) Supports(eventType string) bool {
+	_, ok := r.templates[DefaultLocale][templateName(eventType)]
+	return ok
+}
+
+// Render produces the subject, text and HTML bodies for an event.
+// Locales such as "de-DE" fall back to "de", then to the default locale.
+func (r *Renderer) Render(eventType, locale string, data interface{}) (*Email, error) {
+	name := templateName(eventType)
+	tmpl := r.lookup(name, locale)
+	if tmpl == nil {
+		return nil, fmt.Errorf("no template for event %s", eventType)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to render subject for %s: %w", eventType, err)
+	}
+	if err := tmpl.text.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("failed to render text for %s: %w", eventType, err)
+	}
+	if err := tmpl.html.Execute(&html, data); err != nil {
+		return nil, fmt.Errorf("failed to render html for %s: %w", eventType, err)
+	}
+
+	return &Email{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
+
+func (r *Renderer) lookup(name, locale string) *eventTemplates {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	candidates := []string{locale}
+	if i := strings.Index(locale, "-"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	candidates = append(candidates, DefaultLocale)
+
+	for _, candidate := range candidates {
+		if tmpl, ok := r.templates[candidate][name]; ok {
+			return tmpl
+		}
+	}
+	return nil
+}
+
+func templateName(eventType string) string {
+	return strings.ReplaceAll(eventType, ".", "_")
+}
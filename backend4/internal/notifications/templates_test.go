@@ -0,0 +1,157 @@
+package notifications_test
+
+import (
+	"context"
+	"ecommerce/internal/config"
+	"ecommerce/internal/models"
+	"ecommerce/internal/notifications"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderer(t *testing.T) {
+	renderer, err := notifications.NewRenderer()
+	require.NoError(t, err)
+
+	order := &models.Order{
+		ID:       42,
+		Total:    59.90,
+		Currency: "EUR",
+		Items: []models.OrderItem{
+			{Name: "Walnut Desk", SKU: "DESK-01", Quantity: 2, Price: 29.95},
+		},
+	}
+	data := map[string]interface{}{"StoreURL": "https://shop.example", "Order": order}
+
+	t.Run("renders every supported event", func(t *testing.T) {
+		for _, event := range []string{
+			notifications.EventOrderCreated,
+			notifications.EventOrderPaid,
+			notifications.EventOrderShipped,
+			notifications.EventOrderRefunded,
+		} {
+			assert.True(t, renderer.Supports(event), event)
+			email, err := renderer.Render(event, "en", data)
+			require.NoError(t, err, event)
+			assert.Contains(t, email.Subject, "#42", event)
+			assert.Contains(t, email.HTML, "https://shop.example/orders/42", event)
+		}
+	})
+
+	t.Run("order lines", func(t *testing.T) {
+		email, err := renderer.Render(notifications.EventOrderCreated, "en", data)
+		require.NoError(t, err)
+		assert.Contains(t, email.Text, "2 x Walnut Desk (DESK-01): 59.90 EUR")
+		assert.Contains(t, email.Text, "Total: 59.90 EUR")
+	})
+
+	t.Run("shipped packages with tracking", func(t *testing.T) {
+		shipped := *order
+		shipped.Shipments = []models.Shipment{
+			{Reference: "WH/OUT/00012", State: "done", Carrier: "DHL", TrackingNumber: "JD0123"},
+			{Reference: "WH/OUT/00013", State: "assigned"},
+		}
+		email, err := renderer.Render(notifications.EventOrderShipped, "en", map[string]interface{}{
+			"StoreURL": "https://shop.example",
+			"Order":    &shipped,
+		})
+		require.NoError(t, err)
+		assert.Contains(t, email.Text, "Package WH/OUT/00012 with DHL, tracking number JD0123")
+		assert.NotContains(t, email.Text, "WH/OUT/00013")
+	})
+
+	t.Run("falls back from region to language", func(t *testing.T) {
+		email, err := renderer.Render(notifications.EventOrderCreated, "de-AT", data)
+		require.NoError(t, err)
+		assert.Contains(t, email.Subject, "Bestellung")
+	})
+
+	t.Run("falls back to default locale", func(t *testing.T) {
+		email, err := renderer.Render(notifications.EventOrderCreated, "xx", data)
+		require.NoError(t, err)
+		assert.Contains(t, email.Subject, "Thank you")
+	})
+
+	t.Run("abandoned cart", func(t *testing.T) {
+		cart := &models.AbandonedCartEvent{
+			CartID:   "cart-1",
+			Currency: "EUR",
+			Total:    10,
+			Items:    []models.CartItem{{Name: "Mug", Quantity: 1, Subtotal: 10}},
+		}
+		email, err := renderer.Render(notifications.EventCartAbandoned, "en", map[string]interface{}{
+			"StoreURL": "https://shop.example",
+			"Cart":     cart,
+		})
+		require.NoError(t, err)
+		assert.Contains(t, email.Text, "https://shop.example/cart/cart-1")
+	})
+
+	t.Run("back in stock", func(t *testing.T) {
+		email, err := renderer.Render(notifications.EventStockRestocked, "de", map[string]interface{}{
+			"StoreURL": "https://shop.example",
+			"Restock":  &models.RestockNotification{Name: "Walnut Desk", Path: "/product/walnut-desk"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "Wieder verfügbar: Walnut Desk", email.Subject)
+		assert.Contains(t, email.HTML, "https://shop.example/product/walnut-desk")
+	})
+
+	t.Run("low stock", func(t *testing.T) {
+		email, err := renderer.Render(notifications.EventStockLow, "en", map[string]interface{}{
+			"LowStock": &models.LowStockAlert{Items: []models.LowStockItem{
+				{Name: "Walnut Desk", SKU: "DESK-01", Warehouse: "Berlin", Available: 2, Threshold: 5},
+			}},
+		})
+		require.NoError(t, err)
+		assert.Contains(t, email.Text, "- Walnut Desk (DESK-01) at Berlin: 2 available, minimum 5")
+	})
+
+	t.Run("unknown event", func(t *testing.T) {
+		assert.False(t, renderer.Supports("user.deleted"))
+		_, err := renderer.Render("user.deleted", "en", data)
+		assert.Error(t, err)
+	})
+}
+
+func TestMemoryTransport(t *testing.T) {
+	transport := notifications.NewMemoryTransport()
+	require.NoError(t, transport.Send(context.Background(), notifications.Email{To: "a@example.com"}))
+	require.NoError(t, transport.Send(context.Background(), notifications.Email{To: "b@example.com"}))
+
+	sent := transport.Sent()
+	require.Len(t, sent, 2)
+	assert.Equal(t, "b@example.com", sent[1].To)
+}
+
+func TestSMTPTransport(t *testing.T) {
+	// A relay that accepts connections but never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		<-done
+		conn.Close()
+	}()
+
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+	transport := notifications.NewSMTPTransport(config.SMTPConfig{Host: host, Port: port})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = transport.Send(ctx, notifications.Email{From: "shop@example.com", To: "a@example.com", Subject: "Hi", Text: "Hi"})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second, "a stalled relay must not outlive the context")
+}
@@ -0,0 +1,264 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"ecommerce/internal/config"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Email is a rendered message ready to hand to a transport
+type Email struct {
+	From    string
+	To      string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Transport delivers rendered emails
+type Transport interface {
+	Name() string
+	Send(ctx context.Context, email Email) error
+}
+
+// NewTransport builds the transport selected in configuration
+func NewTransport(cfg config.NotificationsConfig) (Transport, error) {
+	switch cfg.Transport {
+	case "smtp":
+		if cfg.SMTP.Host == "" {
+			return nil, fmt.Errorf("smtp transport requires a host")
+		}
+		return NewSMTPTransport(cfg.SMTP), nil
+	case "file", "":
+		dir := cfg.OutboxDir
+		if dir == "" {
+			dir = "outbox"
+		}
+		return NewFileTransport(dir)
+	case "memory":
+		return NewMemoryTransport(), nil
+	default:
+		return nil, fmt.Errorf("unknown notification transport %q", cfg.Transport)
+	}
+}
+
+// smtpTimeout bounds a whole SMTP conversation when the caller sets no deadline
+const smtpTimeout = 30 * time.Second
+
+// SMTPTransport sends through an SMTP relay, upgrading to TLS when offered
+type SMTPTransport struct {
+	host string
+	addr string
+	auth smtp.Auth
+}
+
+func NewSMTPTransport(cfg config.SMTPConfig) *SMTPTransport {
+	port := cfg.Port
+	if port == "" {
+		port = "587"
+	}
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+
+	return &SMTPTransport{
+		host: cfg.Host,
+		addr: net.JoinHostPort(cfg.Host, port),
+		auth: auth,
+	}
+}
+
+func (t *SMTPTransport) Name() string {
+	return "smtp"
+}
+
+func (t *SMTPTransport) Send(ctx context.Context, email Email) error {
+	msg, err := buildMessage(email)
+	if err != nil {
+		return err
+	}
+
+	if err := t.send(ctx, envelopeAddress(email.From), email.To, msg); err != nil {
+		return fmt.Errorf("failed to send email to %s: %w", email.To, err)
+	}
+	return nil
+}
+
+// send does what smtp.SendMail does, over a connection dialed with ctx and
+// given its deadline, so a stalled relay cannot hold the worker
+func (t *SMTPTransport) send(ctx context.Context, from, to string, msg []byte) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, t.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: t.host}); err != nil {
+			return err
+		}
+	}
+	if t.auth != nil {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(t.auth); err != nil {
+				return err
+			}
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// FileTransport writes each email as an .eml file, for local development
+type FileTransport struct {
+	dir string
+}
+
+func NewFileTransport(dir string) (*FileTransport, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+	return &FileTransport{dir: dir}, nil
+}
+
+func (t *FileTransport) Name() string {
+	return "file"
+}
+
+func (t *FileTransport) Send(ctx context.Context, email Email) error {
+	msg, err := buildMessage(email)
+	if err != nil {
+		return err
+	}
+
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(email.To)
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), recipient)
+	if err := os.WriteFile(filepath.Join(t.dir, name), msg, 0o644); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	return nil
+}
+
+// MemoryTransport keeps sent emails in memory, for tests
+type MemoryTransport struct {
+	mu   sync.Mutex
+	sent []Email
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{}
+}
+
+func (t *MemoryTransport) Name() string {
+	return "memory"
+}
+
+func (t *MemoryTransport) Send(ctx context.Context, email Email) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sent = append(t.sent, email)
+	return nil
+}
+
+// Sent returns a copy of every email sent so far
+func (t *MemoryTransport) Sent() []Email {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Email(nil), t.sent...)
+}
+
+// buildMessage renders a multipart/alternative MIME message with text and HTML parts
+func buildMessage(email Email) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=UTF-8", email.Text},
+		{"text/html; charset=UTF-8", email.HTML},
+	}
+	for _, part := range parts {
+		if part.content == "" {
+			continue
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "8bit")
+		w, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build email: %w", err)
+		}
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return nil, fmt.Errorf("failed to build email: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build email: %w", err)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", email.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", email.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// envelopeAddress extracts the bare address from a "Name <address>" header value
+func envelopeAddress(from string) string {
+	if addr, err := mail.ParseAddress(from); err == nil {
+		return addr.Address
+	}
+	return from
+}
@@ -0,0 +1,208 @@
+package notifications
+
+import (
+	"context"
+	"crypto/sha256"
+	"ecommerce/internal/models"
+	"ecommerce/pkg/queue"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Event types handled by the worker
+const (
+	EventOrderCreated   = "order.created"
+	EventOrderPaid      = "order.paid"
+	EventOrderShipped   = "order.shipped"
+	EventOrderRefunded  = "order.refunded"
+	EventCartAbandoned  = "cart.abandoned"
+	EventStockRestocked = "stock.restocked"
+	EventStockLow       = "stock.low"
+)
+
+// maxAttempts bounds redeliveries of an event whose transport keeps failing
+const maxAttempts = 5
+
+const sendTimeout = 30 * time.Second
+
+// templateData is what every notification template receives
+type templateData struct {
+	StoreURL string
+	Order    *models.Order
+	Cart     *models.AbandonedCartEvent
+	Restock  *models.RestockNotification
+	LowStock *models.LowStockAlert
+}
+
+// Worker consumes the notifications queue and sends one email per event
+type Worker struct {
+	db        *gorm.DB
+	renderer  *Renderer
+	transport Transport
+	from      string
+	storeURL  string
+}
+
+func NewWorker(db *gorm.DB, renderer *Renderer, transport Transport, from, storeURL string) *Worker {
+	return &Worker{
+		db:        db,
+		renderer:  renderer,
+		transport: transport,
+		from:      from,
+		storeURL:  storeURL,
+	}
+}
+
+// Handle is a queue.ConsumerFunc. Returning an error requeues the message,
+// so only transient failures are returned; bad events are logged and dropped.
+func (w *Worker) Handle(msg queue.Message) error {
+	if !w.renderer.Supports(msg.Type) {
+		log.Printf("Ignoring notification event of unknown type %q", msg.Type)
+		return nil
+	}
+
+	eventID := msg.ID
+	if eventID == "" {
+		eventID = fallbackEventID(msg)
+	}
+
+	var delivery models.NotificationDelivery
+	err := w.db.Where("event_id = ?", eventID).First(&delivery).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to read delivery log: %w", err)
+	}
+	if delivery.Status == models.DeliveryStatusSent || delivery.Status == models.DeliveryStatusSkipped {
+		return nil // Already handled, this is a redelivery
+	}
+	if delivery.Attempts >= maxAttempts {
+		log.Printf("Giving up on notification %s after %d attempts", eventID, delivery.Attempts)
+		return nil
+	}
+
+	delivery.EventID = eventID
+	delivery.EventType = msg.Type
+	delivery.Transport = w.transport.Name()
+
+	data, recipient, locale, err := w.eventData(msg)
+	if err != nil {
+		log.Printf("Dropping notification %s: %v", eventID, err)
+		delivery.Status = models.DeliveryStatusSkipped
+		delivery.Error = err.Error()
+		return w.save(&delivery)
+	}
+	delivery.Recipient = recipient
+	delivery.Locale = locale
+
+	email, err := w.renderer.Render(msg.Type, locale, data)
+	if err != nil {
+		log.Printf("Dropping notification %s: %v", eventID, err)
+		delivery.Status = models.DeliveryStatusSkipped
+		delivery.Error = err.Error()
+		return w.save(&delivery)
+	}
+	email.From = w.from
+	email.To = recipient
+	delivery.Subject = email.Subject
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	delivery.Attempts++
+	if err := w.transport.Send(ctx, *email); err != nil {
+		delivery.Status = models.DeliveryStatusFailed
+		delivery.Error = err.Error()
+		if saveErr := w.save(&delivery); saveErr != nil {
+			log.Printf("Failed to record failed delivery %s: %v", eventID, saveErr)
+		}
+		return err
+	}
+
+	now := time.Now()
+	delivery.Status = models.DeliveryStatusSent
+	delivery.Error = ""
+	delivery.SentAt = &now
+	return w.save(&delivery)
+}
+
+// eventData decodes the payload into template data and works out who to send to
+func (w *Worker) eventData(msg queue.Message) (*templateData, string, string, error) {
+	data := &templateData{StoreURL: w.storeURL}
+
+	switch msg.Type {
+	case EventCartAbandoned:
+		var cart models.AbandonedCartEvent
+		if err := decodePayload(msg.Payload, &cart); err != nil {
+			return nil, "", "", err
+		}
+		if cart.Email == "" {
+			return nil, "", "", fmt.Errorf("abandoned cart %s has no email address", cart.CartID)
+		}
+		if len(cart.Items) == 0 {
+			return nil, "", "", fmt.Errorf("abandoned cart %s is empty", cart.CartID)
+		}
+		data.Cart = &cart
+		return data, cart.Email, cart.Locale, nil
+	case EventStockRestocked:
+		var restock models.RestockNotification
+		if err := decodePayload(msg.Payload, &restock); err != nil {
+			return nil, "", "", err
+		}
+		if restock.Email == "" {
+			return nil, "", "", fmt.Errorf("restock subscription %d has no email address", restock.SubscriptionID)
+		}
+		data.Restock = &restock
+		return data, restock.Email, restock.Locale, nil
+	case EventStockLow:
+		var alert models.LowStockAlert
+		if err := decodePayload(msg.Payload, &alert); err != nil {
+			return nil, "", "", err
+		}
+		if alert.Email == "" || len(alert.Items) == 0 {
+			return nil, "", "", fmt.Errorf("low-stock alert has no recipient or items")
+		}
+		data.LowStock = &alert
+		return data, alert.Email, DefaultLocale, nil
+	default:
+		var order models.Order
+		if err := decodePayload(msg.Payload, &order); err != nil {
+			return nil, "", "", err
+		}
+		if order.CustomerEmail == "" {
+			return nil, "", "", fmt.Errorf("order %d has no customer email", order.ID)
+		}
+		data.Order = &order
+		return data, order.CustomerEmail, order.Locale, nil
+	}
+}
+
+func (w *Worker) save(delivery *models.NotificationDelivery) error {
+	if err := w.db.Save(delivery).Error; err != nil {
+		return fmt.Errorf("failed to write delivery log: %w", err)
+	}
+	return nil
+}
+
+// decodePayload converts the generic JSON payload of a queue message into dest
+func decodePayload(payload interface{}, dest interface{}) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+	if err := json.Unmarshal(raw, dest); err != nil {
+		return fmt.Errorf("failed to decode payload: %w", err)
+	}
+	return nil
+}
+
+// fallbackEventID derives a stable ID for messages published without one
+func fallbackEventID(msg queue.Message) string {
+	raw, _ := json.Marshal(msg)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"context"
+	"ecommerce/internal/services"
+	"log"
+	"time"
+)
+
+// CaptureScheduler captures the payments of pre-orders and backorders that shipped
+type CaptureScheduler struct {
+	paymentCaptures *services.PaymentCaptures
+	interval        time.Duration
+	stop            chan struct{}
+}
+
+func NewCaptureScheduler(paymentCaptures *services.PaymentCaptures, interval time.Duration) *CaptureScheduler {
+	if interval == 0 {
+		interval = 10 * time.Minute
+	}
+	return &CaptureScheduler{
+		paymentCaptures: paymentCaptures,
+		interval:        interval,
+		stop:            make(chan struct{}),
+	}
+}
+
+func (s *CaptureScheduler) Start() {
+	ticker := time.NewTicker(s.interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				captured, err := s.paymentCaptures.CaptureShipped(context.Background())
+				if err != nil {
+					log.Printf("Payment capture failed: %v", err)
+					continue
+				}
+				if captured > 0 {
+					log.Printf("Payment capture: %d orders requested", captured)
+				}
+			case <-s.stop:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (s *CaptureScheduler) Stop() {
+	close(s.stop)
+}
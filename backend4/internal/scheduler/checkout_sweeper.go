@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"context"
+	"ecommerce/internal/services"
+	"log"
+	"time"
+)
+
+// CheckoutSweeper periodically settles checkout sessions that expired unfinished
+type CheckoutSweeper struct {
+	checkoutService *services.CheckoutService
+	stop            chan struct{}
+}
+
+func NewCheckoutSweeper(checkoutService *services.CheckoutService) *CheckoutSweeper {
+	return &CheckoutSweeper{
+		checkoutService: checkoutService,
+		stop:            make(chan struct{}),
+	}
+}
+
+func (s *CheckoutSweeper) Start() {
+	ticker := time.NewTicker(time.Minute)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				outcomes, err := s.checkoutService.SweepExpiredSessions(context.Background())
+				if err != nil {
+					log.Printf("Checkout sweep failed: %v", err)
+					continue
+				}
+				if len(outcomes) > 0 {
+					log.Printf("Checkout sweep: %d recovered, %d abandoned",
+						outcomes[services.SweepRecovered], outcomes[services.SweepAbandoned])
+				}
+			case <-s.stop:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (s *CheckoutSweeper) Stop() {
+	close(s.stop)
+}
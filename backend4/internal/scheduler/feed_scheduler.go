@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"context"
+	"ecommerce/internal/services"
+	"log"
+	"time"
+)
+
+// FeedScheduler regenerates the product feeds for shopping channels
+type FeedScheduler struct {
+	feedService *services.FeedService
+	interval    time.Duration
+	stop        chan struct{}
+}
+
+func NewFeedScheduler(feedService *services.FeedService, interval time.Duration) *FeedScheduler {
+	return &FeedScheduler{
+		feedService: feedService,
+		interval:    interval,
+		stop:        make(chan struct{}),
+	}
+}
+
+// Start generates the feeds right away, so the feed URLs work soon after
+// deploys, then every interval
+func (s *FeedScheduler) Start() {
+	ticker := time.NewTicker(s.interval)
+	go func() {
+		s.generate()
+		for {
+			select {
+			case <-ticker.C:
+				s.generate()
+			case <-s.stop:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (s *FeedScheduler) generate() {
+	started := time.Now()
+	if err := s.feedService.Generate(context.Background()); err != nil {
+		log.Printf("Product feed generation failed: %v", err)
+		return
+	}
+	log.Printf("Product feeds generated in %s", time.Since(started).Round(time.Millisecond))
+}
+
+func (s *FeedScheduler) Stop() {
+	close(s.stop)
+}
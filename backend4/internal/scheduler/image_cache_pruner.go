@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"ecommerce/internal/services"
+	"log"
+	"time"
+)
+
+// ImageCachePruner periodically removes derived product images nobody asked for lately
+type ImageCachePruner struct {
+	imageService *services.ImageService
+	maxAge       time.Duration
+	stop         chan struct{}
+}
+
+func NewImageCachePruner(imageService *services.ImageService, maxAge time.Duration) *ImageCachePruner {
+	return &ImageCachePruner{
+		imageService: imageService,
+		maxAge:       maxAge,
+		stop:         make(chan struct{}),
+	}
+}
+
+func (s *ImageCachePruner) Start() {
+	ticker := time.NewTicker(time.Hour)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				removed, err := s.imageService.PruneCache(s.maxAge)
+				if err != nil {
+					log.Printf("Image cache prune failed: %v", err)
+					continue
+				}
+				if removed > 0 {
+					log.Printf("Image cache prune: %d images removed", removed)
+				}
+			case <-s.stop:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (s *ImageCachePruner) Stop() {
+	close(s.stop)
+}
@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"context"
+	"ecommerce/internal/services"
+	"log"
+	"time"
+)
+
+// InvoiceScheduler retries invoicing of paid orders whose invoice could not be created
+type InvoiceScheduler struct {
+	invoiceService *services.InvoiceService
+	interval       time.Duration
+	stop           chan struct{}
+}
+
+func NewInvoiceScheduler(invoiceService *services.InvoiceService, interval time.Duration) *InvoiceScheduler {
+	if interval == 0 {
+		interval = 10 * time.Minute
+	}
+	return &InvoiceScheduler{
+		invoiceService: invoiceService,
+		interval:       interval,
+		stop:           make(chan struct{}),
+	}
+}
+
+func (s *InvoiceScheduler) Start() {
+	ticker := time.NewTicker(s.interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				invoiced, err := s.invoiceService.RetryFailed(context.Background())
+				if err != nil {
+					log.Printf("Invoice retry failed: %v", err)
+					continue
+				}
+				if invoiced > 0 {
+					log.Printf("Invoice retry: %d orders invoiced", invoiced)
+				}
+			case <-s.stop:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (s *InvoiceScheduler) Stop() {
+	close(s.stop)
+}
@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"context"
+	"ecommerce/internal/services"
+	"log"
+	"time"
+)
+
+type ReconciliationScheduler struct {
+	reconciliationService *services.ReconciliationService
+	settlementDir         string
+	interval              time.Duration
+	stop                  chan struct{}
+}
+
+func NewReconciliationScheduler(reconciliationService *services.ReconciliationService, settlementDir string, interval time.Duration) *ReconciliationScheduler {
+	if interval == 0 {
+		interval = time.Hour
+	}
+	return &ReconciliationScheduler{
+		reconciliationService: reconciliationService,
+		settlementDir:         settlementDir,
+		interval:              interval,
+		stop:                  make(chan struct{}),
+	}
+}
+
+func (s *ReconciliationScheduler) Start() {
+	if s.settlementDir == "" {
+		log.Printf("Settlement directory not configured, reconciliation runs on upload only")
+	}
+
+	ticker := time.NewTicker(s.interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				s.run()
+			case <-s.stop:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (s *ReconciliationScheduler) run() {
+	ctx := context.Background()
+	if s.settlementDir != "" {
+		summaries, err := s.reconciliationService.IngestDirectory(ctx, s.settlementDir)
+		if err != nil {
+			log.Printf("Settlement reconciliation failed: %v", err)
+		}
+		for _, summary := range summaries {
+			log.Printf("Reconciled %s: %d rows, %d matched, %d discrepancies",
+				summary.ReportName, summary.Rows, summary.Matched, summary.Discrepancies)
+		}
+	}
+
+	// Matched rows Odoo failed to book, from reports and uploads alike
+	posted, err := s.reconciliationService.RetryUnposted(ctx)
+	if err != nil {
+		log.Printf("Failed to retry settlement postings: %v", err)
+	}
+	if posted > 0 {
+		log.Printf("Posted %d settlements to Odoo on retry", posted)
+	}
+}
+
+func (s *ReconciliationScheduler) Stop() {
+	close(s.stop)
+}
@@ -1,7 +1,9 @@
 package scheduler
 
 import (
+	"context"
 	"ecommerce/internal/sync"
+	"log"
 	"time"
 )
 
@@ -23,11 +25,36 @@ func (s *SyncScheduler) Start() {
 		for {
 			select {
 			case <-ticker.C:
-				if err := s.odooSync.SyncProducts(); err != nil {
-					// Log error
+				ctx := context.Background()
+				if err := s.odooSync.SyncCategories(ctx); err != nil {
+					log.Printf("Category sync failed: %v", err)
 				}
-				if err := s.odooSync.SyncOrders(); err != nil {
-					// Log error
+				if err := s.odooSync.SyncProducts(ctx); err != nil {
+					log.Printf("Product sync failed: %v", err)
+				}
+				if err := s.odooSync.SyncWarehouses(ctx); err != nil {
+					log.Printf("Warehouse sync failed: %v", err)
+				}
+				if err := s.odooSync.SyncStock(ctx); err != nil {
+					log.Printf("Stock sync failed: %v", err)
+				}
+				if err := s.odooSync.SyncReceipts(ctx); err != nil {
+					log.Printf("Receipt sync failed: %v", err)
+				}
+				if err := s.odooSync.SyncKits(ctx); err != nil {
+					log.Printf("Kit sync failed: %v", err)
+				}
+				if err := s.odooSync.SyncMadeToOrder(ctx); err != nil {
+					log.Printf("Made-to-order sync failed: %v", err)
+				}
+				if err := s.odooSync.SyncOrders(ctx); err != nil {
+					log.Printf("Order sync failed: %v", err)
+				}
+				if err := s.odooSync.SyncShipments(ctx); err != nil {
+					log.Printf("Shipment sync failed: %v", err)
+				}
+				if err := s.odooSync.SyncProductions(ctx); err != nil {
+					log.Printf("Production sync failed: %v", err)
 				}
 			case <-s.stop:
 				ticker.Stop()
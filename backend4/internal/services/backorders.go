@@ -0,0 +1,316 @@
+package services
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrBackorderCapReached rejects items beyond the units a pre-order or
+	// backorder policy lets wait for stock
+	ErrBackorderCapReached = fmt.Errorf("%w: pre-order limit reached", ErrInsufficientStock)
+	// ErrBackordersDisabled rejects items beyond stock when payments cannot
+	// be authorised without capturing them
+	ErrBackordersDisabled   = fmt.Errorf("%w: pre-orders are not available", ErrInsufficientStock)
+	ErrInvalidBackorderMode = errors.New("mode must be preorder or backorder")
+	ErrInvalidBackorderCap  = errors.New("cap must not be negative")
+	ErrPolicyNotFound       = errors.New("backorder policy not found")
+)
+
+// Backorders sells products beyond their stock where a pre-order or
+// backorder policy allows it. The units ordered beyond stock wait on the
+// order until the stock sync allocates incoming stock to them. Their payment
+// is only authorised, so without a manual capture account nothing is sold
+// beyond stock.
+type Backorders struct {
+	db            *gorm.DB
+	stockService  *StockService
+	manualCapture bool
+}
+
+func NewBackorders(db *gorm.DB, stockService *StockService, manualCapture bool) *Backorders {
+	return &Backorders{db: db, stockService: stockService, manualCapture: manualCapture}
+}
+
+// Policies lists the products with a pre-order or backorder policy
+func (b *Backorders) Policies(ctx context.Context) ([]models.BackorderPolicy, error) {
+	var policies []models.BackorderPolicy
+	if err := b.db.WithContext(ctx).Order("template_id").Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch backorder policies: %w", err)
+	}
+	return policies, nil
+}
+
+// SetPolicy creates or replaces the policy of a product
+func (b *Backorders) SetPolicy(ctx context.Context, policy *models.BackorderPolicy) error {
+	if policy.Mode != models.BackorderModePreorder && policy.Mode != models.BackorderModeBackorder {
+		return ErrInvalidBackorderMode
+	}
+	if policy.Cap < 0 {
+		return ErrInvalidBackorderCap
+	}
+	err := b.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "template_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"mode", "cap", "release_date", "updated_at"}),
+	}).Create(policy).Error
+	if err != nil {
+		return fmt.Errorf("failed to save backorder policy: %w", err)
+	}
+	return nil
+}
+
+// DeletePolicy stops a product selling beyond its stock. Orders already
+// waiting keep waiting.
+func (b *Backorders) DeletePolicy(ctx context.Context, templateID int64) error {
+	result := b.db.WithContext(ctx).Delete(&models.BackorderPolicy{}, "template_id = ?", templateID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete backorder policy: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrPolicyNotFound
+	}
+	return nil
+}
+
+// Allow checks that shortfall units of a product may be ordered beyond its
+// stock: it needs a policy, and the units must fit under its cap
+func (b *Backorders) Allow(ctx context.Context, templateID int64, shortfall int) error {
+	policy, err := b.policy(ctx, templateID)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		return ErrInsufficientStock
+	}
+	if !b.manualCapture {
+		return ErrBackordersDisabled
+	}
+	if policy.Cap == 0 {
+		return nil
+	}
+	waiting, err := b.waiting(b.db.WithContext(ctx), templateID)
+	if err != nil {
+		return err
+	}
+	if waiting+float64(shortfall) > float64(policy.Cap) {
+		return ErrBackorderCapReached
+	}
+	return nil
+}
+
+// Plan works out how many units of each cart item are ordered beyond the
+// stock, by variant. Only items with a policy count; made-to-order variants
+// never wait for stock. Without a manual capture account such items fail
+// with ErrBackordersDisabled. The planned units are reserved for the
+// checkout under their policy's cap until Release or ttl passes, so
+// concurrent checkouts cannot overrun it.
+func (b *Backorders) Plan(ctx context.Context, checkoutID string, items []models.CartItem, ttl time.Duration) (map[uint]int, error) {
+	demand := make(map[uint]int, len(items))
+	templates := make(map[uint]int64, len(items))
+	var variantIDs []int64
+	for _, item := range items {
+		if item.VariantID == 0 {
+			continue
+		}
+		if _, ok := demand[item.VariantID]; !ok {
+			variantIDs = append(variantIDs, int64(item.VariantID))
+		}
+		demand[item.VariantID] += item.Quantity
+		templates[item.VariantID] = int64(item.ProductID)
+	}
+	if len(variantIDs) == 0 {
+		return nil, nil
+	}
+
+	availability, err := b.stockService.Availability(ctx, variantIDs, "", 1)
+	if err != nil {
+		return nil, err
+	}
+	backordered := make(map[uint]int)
+	shortfalls := make(map[int64]int)
+	for _, entry := range availability {
+		variantID := uint(entry.VariantID)
+		shortfall := demand[variantID] - int(math.Floor(entry.Quantity))
+		if shortfall <= 0 || entry.MadeToOrder {
+			continue
+		}
+		policy, err := b.policy(ctx, templates[variantID])
+		if err != nil {
+			return nil, err
+		}
+		if policy == nil {
+			continue
+		}
+		if !b.manualCapture {
+			return nil, ErrBackordersDisabled
+		}
+		backordered[variantID] = shortfall
+		shortfalls[templates[variantID]] += shortfall
+	}
+	if len(shortfalls) == 0 {
+		return backordered, nil
+	}
+	if err := b.reserve(ctx, checkoutID, shortfalls, time.Now().Add(ttl)); err != nil {
+		return nil, err
+	}
+	return backordered, nil
+}
+
+// reserve checks the shortfall of each product against its cap and reserves
+// it for the checkout. The policies stay locked until the reservations are
+// saved, so checkouts of the same product are checked one at a time.
+func (b *Backorders) reserve(ctx context.Context, checkoutID string, shortfalls map[int64]int, expiresAt time.Time) error {
+	templateIDs := make([]int64, 0, len(shortfalls))
+	for templateID := range shortfalls {
+		templateIDs = append(templateIDs, templateID)
+	}
+	sort.Slice(templateIDs, func(i, j int) bool { return templateIDs[i] < templateIDs[j] })
+	return b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locked in one order, so checkouts of several products cannot deadlock
+		var policies []models.BackorderPolicy
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("template_id IN ?", templateIDs).
+			Order("template_id").
+			Find(&policies).Error
+		if err != nil {
+			return fmt.Errorf("failed to lock backorder policies: %w", err)
+		}
+		if err := tx.Where("expires_at <= ?", time.Now()).Delete(&models.BackorderReservation{}).Error; err != nil {
+			return fmt.Errorf("failed to drop lapsed backorder reservations: %w", err)
+		}
+
+		// A policy removed since the plan leaves its units uncapped, as Lines does
+		for _, policy := range policies {
+			if policy.Cap == 0 {
+				continue
+			}
+			waiting, err := b.waiting(tx, policy.TemplateID)
+			if err != nil {
+				return err
+			}
+			if waiting+float64(shortfalls[policy.TemplateID]) > float64(policy.Cap) {
+				return ErrBackorderCapReached
+			}
+		}
+
+		reservations := make([]models.BackorderReservation, 0, len(shortfalls))
+		for _, templateID := range templateIDs {
+			reservations = append(reservations, models.BackorderReservation{
+				CheckoutID: checkoutID,
+				TemplateID: templateID,
+				Quantity:   float64(shortfalls[templateID]),
+				ExpiresAt:  expiresAt,
+			})
+		}
+		if err := tx.Create(&reservations).Error; err != nil {
+			return fmt.Errorf("failed to reserve backorders: %w", err)
+		}
+		return nil
+	})
+}
+
+// Release drops the units a checkout reserved under the caps, once its order
+// records them or it ends without one. Releasing twice is a no-op.
+func (b *Backorders) Release(ctx context.Context, checkoutID string) error {
+	if err := b.db.WithContext(ctx).Delete(&models.BackorderReservation{}, "checkout_id = ?", checkoutID).Error; err != nil {
+		return fmt.Errorf("failed to release backorder reservations: %w", err)
+	}
+	return nil
+}
+
+// Lines turns the units of an order planned beyond stock into its waiting
+// backorders, and returns the latest release date of pre-ordered items
+func (b *Backorders) Lines(ctx context.Context, items []models.OrderItem, backordered map[uint]int) ([]models.Backorder, *time.Time, error) {
+	var lines []models.Backorder
+	var release *time.Time
+	for _, item := range items {
+		quantity := backordered[item.VariantID]
+		if quantity <= 0 {
+			continue
+		}
+		policy, err := b.policy(ctx, int64(item.ProductID))
+		if err != nil {
+			return nil, nil, err
+		}
+		// A policy removed since checkout started still honours the order
+		mode := models.BackorderModeBackorder
+		if policy != nil {
+			mode = policy.Mode
+			if policy.ReleaseDate != nil && (release == nil || policy.ReleaseDate.After(*release)) {
+				release = policy.ReleaseDate
+			}
+		}
+		lines = append(lines, models.Backorder{
+			VariantID:  int64(item.VariantID),
+			TemplateID: int64(item.ProductID),
+			Mode:       mode,
+			Quantity:   float64(min(quantity, item.Quantity)),
+			Status:     models.BackorderWaiting,
+		})
+	}
+	return lines, release, nil
+}
+
+// AllocateBackorders gives received units to waiting backorders in the
+// order given, oldest first, and returns the units left over. A backorder
+// is allocated once it has all its units.
+func AllocateBackorders(waiting []models.Backorder, received float64, now time.Time) float64 {
+	for i := range waiting {
+		if received <= 0 {
+			break
+		}
+		backorder := &waiting[i]
+		if backorder.Status != models.BackorderWaiting {
+			continue
+		}
+		units := min(backorder.Quantity-backorder.Allocated, received)
+		backorder.Allocated += units
+		received -= units
+		if backorder.Allocated >= backorder.Quantity {
+			backorder.Status = models.BackorderAllocated
+			backorder.AllocatedAt = &now
+		}
+	}
+	return received
+}
+
+func (b *Backorders) policy(ctx context.Context, templateID int64) (*models.BackorderPolicy, error) {
+	var policy models.BackorderPolicy
+	err := b.db.WithContext(ctx).First(&policy, "template_id = ?", templateID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch backorder policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// waiting counts the units of a product still waiting for stock, along with
+// those reserved by checkouts in progress
+func (b *Backorders) waiting(db *gorm.DB, templateID int64) (float64, error) {
+	var waiting, reserved float64
+	err := db.Model(&models.Backorder{}).
+		Select("COALESCE(SUM(quantity - allocated), 0)").
+		Where("template_id = ? AND status = ?", templateID, models.BackorderWaiting).
+		Scan(&waiting).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count waiting backorders: %w", err)
+	}
+	err = db.Model(&models.BackorderReservation{}).
+		Select("COALESCE(SUM(quantity), 0)").
+		Where("template_id = ? AND expires_at > ?", templateID, time.Now()).
+		Scan(&reserved).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count reserved backorders: %w", err)
+	}
+	return waiting + reserved, nil
+}
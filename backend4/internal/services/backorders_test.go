@@ -0,0 +1,138 @@
+package services_test
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"ecommerce/internal/testutils/mocks"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocateBackorders(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	waitingFor := func(quantities ...float64) []models.Backorder {
+		backorders := make([]models.Backorder, len(quantities))
+		for i, quantity := range quantities {
+			backorders[i] = models.Backorder{OrderID: uint(i + 1), Quantity: quantity, Status: models.BackorderWaiting}
+		}
+		return backorders
+	}
+
+	t.Run("oldest first", func(t *testing.T) {
+		waiting := waitingFor(2, 3, 1)
+		left := services.AllocateBackorders(waiting, 4, now)
+		assert.Zero(t, left)
+		assert.Equal(t, models.BackorderAllocated, waiting[0].Status)
+		assert.Equal(t, &now, waiting[0].AllocatedAt)
+		assert.Equal(t, 2.0, waiting[1].Allocated)
+		assert.Equal(t, models.BackorderWaiting, waiting[1].Status)
+		assert.Zero(t, waiting[2].Allocated)
+	})
+
+	t.Run("completes partly allocated backorders", func(t *testing.T) {
+		waiting := waitingFor(3)
+		waiting[0].Allocated = 2
+		left := services.AllocateBackorders(waiting, 5, now)
+		assert.Equal(t, 4.0, left)
+		assert.Equal(t, 3.0, waiting[0].Allocated)
+		assert.Equal(t, models.BackorderAllocated, waiting[0].Status)
+	})
+
+	t.Run("skips backorders no longer waiting", func(t *testing.T) {
+		waiting := waitingFor(2, 2)
+		waiting[0].Status = models.BackorderCancelled
+		services.AllocateBackorders(waiting, 2, now)
+		assert.Zero(t, waiting[0].Allocated)
+		assert.Equal(t, models.BackorderAllocated, waiting[1].Status)
+	})
+}
+
+func newBackorders(t *testing.T) (*services.Backorders, sqlmock.Sqlmock) {
+	db, sqlMock := mocks.NewDB(t)
+	redisClient, _ := mocks.NewRedis(t)
+	stockService := services.NewStockService(db, services.NewStockHolds(redisClient), nil)
+	return services.NewBackorders(db, stockService, true), sqlMock
+}
+
+// expectStock expects the availability of variant 10, with the given units
+// left at warehouse 1 and allocated to backorders not released yet
+func expectStock(sqlMock sqlmock.Sqlmock, available, allocated float64) {
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "warehouses"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"odoo_id", "code"}).AddRow(1, "WH"))
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "kit_components"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"kit_id", "component_id"}))
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT warehouse_id, variant_id, sum(quantity - reserved) AS available FROM "stock_levels"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"warehouse_id", "variant_id", "available"}).AddRow(1, 10, available))
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "made_to_orders"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"variant_id"}))
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT variant_id, sum(allocated) AS allocated FROM "backorders"`)).
+		WithArgs(10, models.BackorderWaiting, models.BackorderAllocated).
+		WillReturnRows(sqlmock.NewRows([]string{"variant_id", "allocated"}).AddRow(10, allocated))
+}
+
+func TestPlan(t *testing.T) {
+	ctx := context.Background()
+	items := []models.CartItem{{ProductID: 1, VariantID: 10, Quantity: 3}}
+
+	// expectCapCheck expects the plan to lock the policy of product 1 and
+	// find the given units already waiting or reserved
+	expectCapCheck := func(sqlMock sqlmock.Sqlmock, waiting float64) {
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "backorder_policies" WHERE template_id = $1`)).
+			WillReturnRows(sqlmock.NewRows([]string{"template_id", "mode", "cap"}).AddRow(1, models.BackorderModePreorder, 5))
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "backorder_policies" WHERE template_id IN ($1) ORDER BY template_id FOR UPDATE`)).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"template_id", "mode", "cap"}).AddRow(1, models.BackorderModePreorder, 5))
+		sqlMock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "backorder_reservations" WHERE expires_at <= $1`)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(SUM(quantity - allocated), 0) FROM "backorders"`)).
+			WithArgs(1, models.BackorderWaiting).
+			WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(waiting - 1))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(SUM(quantity), 0) FROM "backorder_reservations"`)).
+			WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(1))
+	}
+
+	t.Run("reserves the units beyond stock", func(t *testing.T) {
+		backorders, sqlMock := newBackorders(t)
+		expectStock(sqlMock, 1, 0)
+		expectCapCheck(sqlMock, 3)
+		sqlMock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "backorder_reservations"`)).
+			WithArgs("checkout-1", 1, 2.0, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectCommit()
+
+		backordered, err := backorders.Plan(ctx, "checkout-1", items, time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, map[uint]int{10: 2}, backordered)
+	})
+
+	t.Run("units allocated to backorders are not in stock", func(t *testing.T) {
+		backorders, sqlMock := newBackorders(t)
+		expectStock(sqlMock, 3, 2)
+		expectCapCheck(sqlMock, 3)
+		sqlMock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "backorder_reservations"`)).
+			WithArgs("checkout-1", 1, 2.0, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectCommit()
+
+		backordered, err := backorders.Plan(ctx, "checkout-1", items, time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, map[uint]int{10: 2}, backordered)
+	})
+
+	t.Run("units waiting or reserved elsewhere count against the cap", func(t *testing.T) {
+		backorders, sqlMock := newBackorders(t)
+		expectStock(sqlMock, 1, 0)
+		expectCapCheck(sqlMock, 4)
+		sqlMock.ExpectRollback()
+
+		_, err := backorders.Plan(ctx, "checkout-1", items, time.Hour)
+		assert.ErrorIs(t, err, services.ErrBackorderCapReached)
+	})
+}
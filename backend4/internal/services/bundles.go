@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"errors"
+	"fmt"
+	"math"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidBundleMode     = errors.New("mode must be fixed or discount")
+	ErrInvalidBundlePrice    = errors.New("fixed bundles need a positive price")
+	ErrInvalidBundleDiscount = errors.New("discount must be between 0 and 100 percent")
+	ErrPricingNotFound       = errors.New("bundle pricing not found")
+	ErrNotABundle            = errors.New("variant is not a bundle")
+)
+
+// Bundles sells the kits the sync mirrors from Odoo phantom bills of
+// materials. A bundle costs its Odoo price unless a bundle pricing sets a
+// fixed price or a discount on what its components cost on their own.
+type Bundles struct {
+	db             *gorm.DB
+	productService *ProductService
+}
+
+func NewBundles(db *gorm.DB, productService *ProductService) *Bundles {
+	return &Bundles{db: db, productService: productService}
+}
+
+// Pricings lists the products with a bundle pricing
+func (b *Bundles) Pricings(ctx context.Context) ([]models.BundlePricing, error) {
+	var pricings []models.BundlePricing
+	if err := b.db.WithContext(ctx).Order("template_id").Find(&pricings).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch bundle pricings: %w", err)
+	}
+	return pricings, nil
+}
+
+// SetPricing creates or replaces the pricing of a bundle product
+func (b *Bundles) SetPricing(ctx context.Context, pricing *models.BundlePricing) error {
+	switch pricing.Mode {
+	case models.BundlePriceFixed:
+		if pricing.Price <= 0 {
+			return ErrInvalidBundlePrice
+		}
+		pricing.DiscountPercent = 0
+	case models.BundlePriceDiscount:
+		if pricing.DiscountPercent < 0 || pricing.DiscountPercent > 100 {
+			return ErrInvalidBundleDiscount
+		}
+		pricing.Price = 0
+	default:
+		return ErrInvalidBundleMode
+	}
+	err := b.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "template_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"mode", "price", "discount_percent", "updated_at"}),
+	}).Create(pricing).Error
+	if err != nil {
+		return fmt.Errorf("failed to save bundle pricing: %w", err)
+	}
+	return nil
+}
+
+// DeletePricing prices a bundle product at its Odoo price again
+func (b *Bundles) DeletePricing(ctx context.Context, templateID int64) error {
+	result := b.db.WithContext(ctx).Delete(&models.BundlePricing{}, "template_id = ?", templateID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete bundle pricing: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrPricingNotFound
+	}
+	return nil
+}
+
+// GetBundle returns a kit variant with its components and price
+func (b *Bundles) GetBundle(ctx context.Context, variantID uint) (*models.Bundle, error) {
+	components, err := b.components(ctx, int64(variantID))
+	if err != nil {
+		return nil, err
+	}
+	if len(components) == 0 {
+		return nil, ErrNotABundle
+	}
+	variant, err := b.productService.GetVariant(ctx, variantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variant: %w", err)
+	}
+	price, err := b.price(ctx, variant, components)
+	if err != nil {
+		return nil, err
+	}
+	return &models.Bundle{
+		VariantID:  int64(variantID),
+		ProductID:  int64(variant.ProductID),
+		Price:      price,
+		Components: components,
+	}, nil
+}
+
+// Line prices a variant for the cart and lists what it holds when it is a
+// bundle. Other variants keep their own price.
+func (b *Bundles) Line(ctx context.Context, variant *models.ProductVariant) (float64, []models.CartComponent, error) {
+	components, err := b.components(ctx, int64(variant.ID))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(components) == 0 {
+		return variant.Price, nil, nil
+	}
+	price, err := b.price(ctx, variant, components)
+	if err != nil {
+		return 0, nil, err
+	}
+	lines := make([]models.CartComponent, 0, len(components))
+	for _, component := range components {
+		lines = append(lines, models.CartComponent{
+			VariantID: uint(component.ComponentID),
+			Name:      component.Name,
+			SKU:       component.SKU,
+			Quantity:  component.Quantity,
+		})
+	}
+	return price, lines, nil
+}
+
+// BundlePrice is what a bundle costs under its pricing: a fixed price, or
+// the components' total less the discount. Without a pricing it is the
+// bundle's own list price.
+func BundlePrice(pricing *models.BundlePricing, listPrice, componentsTotal float64) float64 {
+	if pricing == nil {
+		return listPrice
+	}
+	switch pricing.Mode {
+	case models.BundlePriceFixed:
+		return pricing.Price
+	case models.BundlePriceDiscount:
+		return math.Round(componentsTotal*(100-pricing.DiscountPercent)) / 100
+	}
+	return listPrice
+}
+
+func (b *Bundles) price(ctx context.Context, variant *models.ProductVariant, components []models.KitComponent) (float64, error) {
+	var pricing models.BundlePricing
+	err := b.db.WithContext(ctx).First(&pricing, "template_id = ?", variant.ProductID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return variant.Price, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch bundle pricing: %w", err)
+	}
+
+	var total float64
+	if pricing.Mode == models.BundlePriceDiscount {
+		for _, component := range components {
+			componentVariant, err := b.productService.GetVariant(ctx, uint(component.ComponentID))
+			if err != nil {
+				return 0, fmt.Errorf("failed to price bundle component %d: %w", component.ComponentID, err)
+			}
+			total += componentVariant.Price * component.Quantity
+		}
+	}
+	return BundlePrice(&pricing, variant.Price, total), nil
+}
+
+func (b *Bundles) components(ctx context.Context, variantID int64) ([]models.KitComponent, error) {
+	var components []models.KitComponent
+	if err := b.db.WithContext(ctx).Where("kit_id = ?", variantID).Order("component_id").Find(&components).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch bundle components: %w", err)
+	}
+	return components, nil
+}
@@ -0,0 +1,26 @@
+package services_test
+
+import (
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundlePrice(t *testing.T) {
+	t.Run("own list price without pricing", func(t *testing.T) {
+		assert.Equal(t, 49.0, services.BundlePrice(nil, 49, 60))
+	})
+
+	t.Run("fixed", func(t *testing.T) {
+		pricing := &models.BundlePricing{Mode: models.BundlePriceFixed, Price: 45}
+		assert.Equal(t, 45.0, services.BundlePrice(pricing, 49, 60))
+	})
+
+	t.Run("discount on the components", func(t *testing.T) {
+		pricing := &models.BundlePricing{Mode: models.BundlePriceDiscount, DiscountPercent: 15}
+		assert.Equal(t, 51.0, services.BundlePrice(pricing, 49, 60))
+		assert.Equal(t, 16.99, services.BundlePrice(pricing, 49, 19.99))
+	})
+}
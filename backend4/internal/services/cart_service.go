@@ -3,22 +3,37 @@ package services
 import (
 	"context"
 	"ecommerce/internal/models"
+	"ecommerce/pkg/odoo"
 	"ecommerce/pkg/redis"
+	"errors"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// ErrInsufficientStock rejects items beyond the available stock. Shoppers
+// can then subscribe to be told when the variant is back.
+var ErrInsufficientStock = errors.New("insufficient stock available")
+
 type CartService struct {
 	redisClient    *redis.Client
 	productService *ProductService
+	stockHolds     *StockHolds
+	stockService   *StockService
+	backorders     *Backorders
+	bundles        *Bundles
 }
 
-func NewCartService(redisClient *redis.Client, productService *ProductService) *CartService {
+func NewCartService(redisClient *redis.Client, productService *ProductService, stockHolds *StockHolds, stockService *StockService, backorders *Backorders, bundles *Bundles) *CartService {
 	return &CartService{
 		redisClient:    redisClient,
 		productService: productService,
+		stockHolds:     stockHolds,
+		stockService:   stockService,
+		backorders:     backorders,
+		bundles:        bundles,
 	}
 }
 
@@ -60,37 +75,32 @@ func (s *CartService) AddToCart(ctx context.Context, cartID string, productID ui
 		return err
 	}
 
-	// Get product details
-	product, err := s.productService.GetProduct(fmt.Sprint(productID))
+	// Get the variant's price and stock
+	variant, err := s.getVariant(ctx, productID, variantID)
 	if err != nil {
-		return fmt.Errorf("failed to get product: %w", err)
+		return err
 	}
 
-	// Find the specific variant
-	var variant *models.ProductVariant
-	for _, v := range product.Variants {
-		if v.ID == variantID {
-			variant = &v
-			break
-		}
-	}
-	if variant == nil {
-		return fmt.Errorf("variant not found")
+	// Check stock availability
+	if err := s.checkStock(ctx, variant, quantity); err != nil {
+		return err
 	}
 
-	// Check stock availability
-	if variant.Stock < float64(quantity) {
-		return fmt.Errorf("insufficient stock available")
+	// Bundles are priced from their pricing and list what they hold
+	price, components, err := s.bundles.Line(ctx, variant)
+	if err != nil {
+		return err
 	}
 
 	// Create cart item
 	item := models.CartItem{
-		ProductID: productID,
-		VariantID: variantID, // Add this field to CartItem model
-		Quantity:  quantity,
-		Price:     variant.Price,
-		Name:      product.Name,
-		SKU:       variant.SKU, // Use variant SKU instead of product SKU
+		ProductID:  productID,
+		VariantID:  variantID, // Add this field to CartItem model
+		Quantity:   quantity,
+		Price:      price,
+		Name:       variant.Name,
+		SKU:        variant.SKU, // Use variant SKU instead of product SKU
+		Components: components,
 	}
 
 	// Add to cart
@@ -110,24 +120,14 @@ func (s *CartService) UpdateCartItem(ctx context.Context, cartID string, product
 
 	if quantity > 0 {
 		// Check stock availability
-		product, err := s.productService.GetProduct(fmt.Sprint(productID))
+		variant, err := s.getVariant(ctx, productID, variantID)
 		if err != nil {
-			return fmt.Errorf("failed to get product: %w", err)
-		}
-		var variant *models.ProductVariant
-		for _, v := range product.Variants {
-			if v.ID == variantID {
-				variant = &v
-				break
-			}
-		}
-		if variant == nil {
-			return fmt.Errorf("variant not found")
+			return err
 		}
 
 		// Check stock availability
-		if variant.Stock < float64(quantity) {
-			return fmt.Errorf("insufficient stock available")
+		if err := s.checkStock(ctx, variant, quantity); err != nil {
+			return err
 		}
 	}
 
@@ -138,6 +138,74 @@ func (s *CartService) UpdateCartItem(ctx context.Context, cartID string, product
 	return s.saveCart(ctx, cart)
 }
 
+// getVariant loads a variant and checks it belongs to the product
+func (s *CartService) getVariant(ctx context.Context, productID, variantID uint) (*models.ProductVariant, error) {
+	variant, err := s.productService.GetVariant(ctx, variantID)
+	if errors.Is(err, odoo.ErrNotFound) {
+		return nil, fmt.Errorf("variant not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+	if variant.ProductID != productID {
+		return nil, fmt.Errorf("variant not found")
+	}
+	return variant, nil
+}
+
+// checkStock verifies the quantity is available once stock held by open
+// checkouts is deducted. Made-to-order variants sell without stock, and
+// pre-order and backorder policies let others sell beyond it.
+func (s *CartService) checkStock(ctx context.Context, variant *models.ProductVariant, quantity int) error {
+	available, err := s.available(ctx, variant)
+	if err != nil {
+		return err
+	}
+	if available >= float64(quantity) {
+		return nil
+	}
+	madeToOrder, err := s.stockService.MadeToOrder(ctx, int64(variant.ID))
+	if err != nil {
+		return err
+	}
+	if madeToOrder {
+		return nil
+	}
+	shortfall := quantity - int(math.Max(math.Floor(available), 0))
+	return s.backorders.Allow(ctx, int64(variant.ProductID), shortfall)
+}
+
+// available is the stock of a variant not held by open checkouts. Checkouts
+// hold the components of bundles, so a bundle has what its components'
+// unheld stock makes up.
+func (s *CartService) available(ctx context.Context, variant *models.ProductVariant) (float64, error) {
+	components, err := s.bundles.components(ctx, int64(variant.ID))
+	if err != nil {
+		return 0, err
+	}
+	if len(components) == 0 {
+		held, err := s.stockHolds.Held(ctx, variant.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check stock holds: %w", err)
+		}
+		return variant.Stock - held, nil
+	}
+
+	stock := make(map[int64]float64, len(components))
+	for _, component := range components {
+		componentVariant, err := s.productService.GetVariant(ctx, uint(component.ComponentID))
+		if err != nil {
+			return 0, fmt.Errorf("failed to get bundle component %d: %w", component.ComponentID, err)
+		}
+		held, err := s.stockHolds.Held(ctx, uint(component.ComponentID))
+		if err != nil {
+			return 0, fmt.Errorf("failed to check stock holds: %w", err)
+		}
+		stock[component.ComponentID] = componentVariant.Stock - held
+	}
+	return KitAvailable(components, stock), nil
+}
+
 func (s *CartService) saveCart(ctx context.Context, cart *models.Cart) error {
 	cart.UpdatedAt = time.Now()
 	return s.redisClient.Set(ctx, fmt.Sprintf("cart:%s", cart.ID), cart, 24*time.Hour)
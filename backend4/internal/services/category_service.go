@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCategoryKind     = errors.New("unknown category kind")
+	ErrCategoryNotFound = errors.New("category not found")
+)
+
+// CategoryService serves the category trees the sync mirrors from Odoo
+type CategoryService struct {
+	db *gorm.DB
+}
+
+func NewCategoryService(db *gorm.DB) *CategoryService {
+	return &CategoryService{db: db}
+}
+
+// GetTree returns the roots of a category tree with their descendants nested,
+// siblings ordered as on the website
+func (s *CategoryService) GetTree(ctx context.Context, kind string) ([]models.Category, error) {
+	if err := checkCategoryKind(kind); err != nil {
+		return nil, err
+	}
+
+	var categories []models.Category
+	err := s.db.WithContext(ctx).
+		Where("kind = ?", kind).
+		Order("level, sequence, name, id").
+		Find(&categories).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch categories: %w", err)
+	}
+	return BuildCategoryTree(categories), nil
+}
+
+// BuildCategoryTree nests categories under their parents, keeping their order.
+// Categories whose parent is missing become roots.
+func BuildCategoryTree(categories []models.Category) []models.Category {
+	present := make(map[uint]bool, len(categories))
+	for _, category := range categories {
+		present[category.ID] = true
+	}
+
+	children := make(map[uint][]models.Category)
+	var roots []models.Category
+	for _, category := range categories {
+		if category.ParentID != nil && present[*category.ParentID] {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		} else {
+			roots = append(roots, category)
+		}
+	}
+
+	var attach func(nodes []models.Category) []models.Category
+	attach = func(nodes []models.Category) []models.Category {
+		for i := range nodes {
+			nodes[i].Children = attach(children[nodes[i].ID])
+		}
+		return nodes
+	}
+	return attach(roots)
+}
+
+// BySlug returns the category of a tree with slug
+func (s *CategoryService) BySlug(ctx context.Context, kind, slug string) (*models.Category, error) {
+	if err := checkCategoryKind(kind); err != nil {
+		return nil, err
+	}
+
+	var category models.Category
+	err := s.db.WithContext(ctx).Where("kind = ? AND slug = ?", kind, slug).First(&category).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%s category %q: %w", kind, slug, ErrCategoryNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch category: %w", err)
+	}
+	return &category, nil
+}
+
+// ResolveSlug returns the category of a tree with slug, or the category that
+// had slug before it was renamed. Callers redirect when the slugs differ.
+func (s *CategoryService) ResolveSlug(ctx context.Context, kind, slug string) (*models.Category, error) {
+	category, err := s.BySlug(ctx, kind, slug)
+	if !errors.Is(err, ErrCategoryNotFound) {
+		return category, err
+	}
+
+	var redirect models.SlugRedirect
+	err = s.db.WithContext(ctx).First(&redirect, "kind = ? AND slug = ?", kind, slug).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%s category %q: %w", kind, slug, ErrCategoryNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch slug redirect: %w", err)
+	}
+
+	var current models.Category
+	err = s.db.WithContext(ctx).Where("kind = ? AND odoo_id = ?", kind, redirect.OdooID).First(&current).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%s category %q: %w", kind, slug, ErrCategoryNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch category: %w", err)
+	}
+	return &current, nil
+}
+
+// Subtree returns the Odoo IDs of the category with slug and of all its
+// descendants
+func (s *CategoryService) Subtree(ctx context.Context, kind, slug string) ([]int64, error) {
+	root, err := s.BySlug(ctx, kind, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []int64{root.OdooID}
+	if root.Path == "" {
+		return ids, nil
+	}
+	var descendants []int64
+	err = s.db.WithContext(ctx).Model(&models.Category{}).
+		Where("kind = ? AND path LIKE ? AND id <> ?", kind, root.Path+"%", root.ID).
+		Pluck("odoo_id", &descendants).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch subcategories: %w", err)
+	}
+	return append(ids, descendants...), nil
+}
+
+// Children returns the subcategories of a category with their descendants
+// nested, ordered as in GetTree
+func (s *CategoryService) Children(ctx context.Context, category *models.Category) ([]models.Category, error) {
+	if category.Path == "" {
+		return nil, nil
+	}
+	var descendants []models.Category
+	err := s.db.WithContext(ctx).
+		Where("kind = ? AND path LIKE ? AND id <> ?", category.Kind, category.Path+"%", category.ID).
+		Order("level, sequence, name, id").
+		Find(&descendants).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch subcategories: %w", err)
+	}
+
+	var children []models.Category
+	for _, node := range BuildCategoryTree(append([]models.Category{*category}, descendants...)) {
+		if node.ID == category.ID {
+			children = node.Children
+		}
+	}
+	return children, nil
+}
+
+// Breadcrumbs returns the path from the root of the product's category tree
+// down to its category. The first website category is used when the product
+// has one, its internal category otherwise.
+func (s *CategoryService) Breadcrumbs(ctx context.Context, product *models.Product) ([]models.Breadcrumb, error) {
+	kind, odooID := models.CategoryKindInternal, product.CategoryID
+	if len(product.PublicCategoryIDs) > 0 {
+		kind, odooID = models.CategoryKindPublic, product.PublicCategoryIDs[0]
+	}
+	if odooID == 0 {
+		return nil, nil
+	}
+
+	var category models.Category
+	err := s.db.WithContext(ctx).Where("kind = ? AND odoo_id = ?", kind, odooID).First(&category).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Not synced yet
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch category: %w", err)
+	}
+
+	ancestorIDs := []int64{category.OdooID}
+	for _, part := range strings.Split(strings.Trim(category.Path, "/"), "/") {
+		if id, err := strconv.ParseInt(part, 10, 64); err == nil && id != category.OdooID {
+			ancestorIDs = append(ancestorIDs, id)
+		}
+	}
+
+	var path []models.Category
+	err = s.db.WithContext(ctx).
+		Where("kind = ? AND odoo_id IN ?", kind, ancestorIDs).
+		Order("level").
+		Find(&path).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch parent categories: %w", err)
+	}
+
+	breadcrumbs := make([]models.Breadcrumb, len(path))
+	for i, step := range path {
+		breadcrumbs[i] = models.Breadcrumb{ID: step.ID, Name: step.Name, Slug: step.Slug}
+	}
+	return breadcrumbs, nil
+}
+
+// FilterProductsByCategory keeps the products in any of the given Odoo
+// categories of a tree
+func FilterProductsByCategory(products []models.Product, kind string, categoryIDs []int64) []models.Product {
+	wanted := make(map[int64]bool, len(categoryIDs))
+	for _, id := range categoryIDs {
+		wanted[id] = true
+	}
+
+	filtered := make([]models.Product, 0, len(products))
+	for _, product := range products {
+		ids := product.PublicCategoryIDs
+		if kind == models.CategoryKindInternal {
+			ids = []int64{product.CategoryID}
+		}
+		for _, id := range ids {
+			if wanted[id] {
+				filtered = append(filtered, product)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+func checkCategoryKind(kind string) error {
+	if kind != models.CategoryKindPublic && kind != models.CategoryKindInternal {
+		return fmt.Errorf("%w %q", ErrCategoryKind, kind)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package services_test
+
+import (
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildCategoryTree(t *testing.T) {
+	parent := func(id uint) *uint { return &id }
+	tree := services.BuildCategoryTree([]models.Category{
+		{ID: 1, Name: "Furniture"},
+		{ID: 2, Name: "Lighting"},
+		{ID: 3, Name: "Chairs", ParentID: parent(1)},
+		{ID: 4, Name: "Tables", ParentID: parent(1)},
+		{ID: 5, Name: "Office Chairs", ParentID: parent(3)},
+		{ID: 6, Name: "Orphan", ParentID: parent(99)},
+	})
+
+	require.Len(t, tree, 3)
+	assert.Equal(t, "Furniture", tree[0].Name)
+	assert.Equal(t, "Orphan", tree[2].Name)
+	require.Len(t, tree[0].Children, 2)
+	assert.Equal(t, "Chairs", tree[0].Children[0].Name)
+	require.Len(t, tree[0].Children[0].Children, 1)
+	assert.Equal(t, "Office Chairs", tree[0].Children[0].Children[0].Name)
+	assert.Empty(t, tree[1].Children)
+}
+
+func TestFilterProductsByCategory(t *testing.T) {
+	products := []models.Product{
+		{OdooID: 1, CategoryID: 10, PublicCategoryIDs: []int64{3}},
+		{OdooID: 2, CategoryID: 11, PublicCategoryIDs: []int64{4, 5}},
+		{OdooID: 3, CategoryID: 10},
+	}
+
+	public := services.FilterProductsByCategory(products, models.CategoryKindPublic, []int64{5, 6})
+	require.Len(t, public, 1)
+	assert.Equal(t, int64(2), public[0].OdooID)
+
+	internal := services.FilterProductsByCategory(products, models.CategoryKindInternal, []int64{10})
+	require.Len(t, internal, 2)
+	assert.Equal(t, int64(3), internal[1].OdooID)
+}
@@ -6,7 +6,9 @@ import (
 	"ecommerce/pkg/odoo"
 	"ecommerce/pkg/queue"
 	"ecommerce/pkg/redis"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"ecommerce/pkg/adyen"
@@ -15,6 +17,22 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	checkoutSessionTTL = 30 * time.Minute
+	// Sessions stay in Redis past their expiry so the sweeper can settle them
+	checkoutRetention = 2 * time.Hour
+	checkoutSweepLock = 5 * time.Minute
+)
+
+// ErrPaymentNotCompleted rejects completing a checkout Adyen has not been paid for
+var ErrPaymentNotCompleted = errors.New("payment has not been completed")
+
+// Outcomes of sweeping an expired checkout session
+const (
+	SweepRecovered = "recovered" // Paid late, order created
+	SweepAbandoned = "abandoned" // Never paid, cart.abandoned published
+)
+
 type CheckoutService struct {
 	cartService  *CartService
 	orderService *OrderService
@@ -22,6 +40,10 @@ type CheckoutService struct {
 	odooClient   *odoo.Client
 	queueClient  *queue.Client
 	adyenClient  *adyen.Client
+	stockHolds   *StockHolds
+	stockService *StockService
+	backorders   *Backorders
+	captures     *PaymentCaptures
 	baseURL      string
 }
 
@@ -32,6 +54,10 @@ func NewCheckoutService(
 	odooClient *odoo.Client,
 	queueClient *queue.Client,
 	adyenClient *adyen.Client,
+	stockHolds *StockHolds,
+	stockService *StockService,
+	backorders *Backorders,
+	captures *PaymentCaptures,
 	baseURL string,
 ) *CheckoutService {
 	return &CheckoutService{
@@ -41,6 +67,10 @@ func NewCheckoutService(
 		odooClient:   odooClient,
 		queueClient:  queueClient,
 		adyenClient:  adyenClient,
+		stockHolds:   stockHolds,
+		stockService: stockService,
+		backorders:   backorders,
+		captures:     captures,
 		baseURL:      baseURL,
 	}
 }
@@ -60,6 +90,13 @@ func (s *CheckoutService) InitiateCheckout(ctx context.Context, req *models.Chec
 	// Create unique checkout ID
 	checkoutID := uuid.New().String()
 
+	// Units beyond stock are pre-ordered or backordered. Their payment is
+	// only authorised, to be captured when the order ships.
+	backordered, err := s.backorders.Plan(ctx, checkoutID, cart.Items, checkoutSessionTTL+checkoutRetention)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check stock: %w", err)
+	}
+
 	// Create payment session with Adyen
 	paymentReq := &adyen.PaymentRequest{
 		Amount:      cart.Total,
@@ -71,21 +108,26 @@ func (s *CheckoutService) InitiateCheckout(ctx context.Context, req *models.Chec
 
 	paymentSession, err := s.adyenClient.CreatePaymentSession(paymentReq)
 	if err != nil {
+		s.releaseBackorders(ctx, checkoutID)
 		return nil, fmt.Errorf("failed to create payment session: %w", err)
 	}
 
-	// Create checkout session
+	// Create checkout session under the reference Adyen knows the payment by
 	session := &models.CheckoutSession{
-		ID:           uuid.New().String(),
-		CartID:       cart.ID,
-		UserID:       cart.UserID,
-		Status:       "pending",
-		Total:        cart.Total,
-		Currency:     req.Currency,
-		ShippingInfo: req.ShippingInfo,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
-		ExpiresAt:    time.Now().Add(30 * time.Minute),
+		ID:            checkoutID,
+		CartID:        cart.ID,
+		UserID:        cart.UserID,
+		Status:        "pending",
+		Total:         cart.Total,
+		Currency:      req.Currency,
+		ShippingInfo:  req.ShippingInfo,
+		Email:         req.Email,
+		Locale:        req.Locale,
+		Backordered:   backordered,
+		ManualCapture: len(backordered) > 0,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+		ExpiresAt:     time.Now().Add(checkoutSessionTTL),
 		PaymentData: models.PaymentData{
 			SessionData: paymentSession.SessionData,
 			ClientKey:   paymentSession.ClientKey,
@@ -94,14 +136,43 @@ func (s *CheckoutService) InitiateCheckout(ctx context.Context, req *models.Chec
 	}
 
 	// Save checkout session
-	err = s.redisClient.Set(ctx, fmt.Sprintf("checkout:%s", session.ID), session, 30*time.Minute)
+	err = s.redisClient.Set(ctx, fmt.Sprintf("checkout:%s", session.ID), session, checkoutSessionTTL+checkoutRetention)
 	if err != nil {
+		s.releaseBackorders(ctx, checkoutID)
 		return nil, fmt.Errorf("failed to save checkout session: %w", err)
 	}
 
+	// Hold the stock until the session completes or is swept; units
+	// beyond stock have none to hold
+	unheld := make(map[uint]int, len(backordered))
+	for variantID, quantity := range backordered {
+		unheld[variantID] = quantity
+	}
+	held := make([]models.CartItem, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		shortfall := min(unheld[item.VariantID], item.Quantity)
+		unheld[item.VariantID] -= shortfall
+		item.Quantity -= shortfall
+		if item.Quantity > 0 {
+			held = append(held, item)
+		}
+	}
+	if err := s.stockHolds.Place(ctx, session.ID, held, checkoutSessionTTL+checkoutRetention); err != nil {
+		s.releaseBackorders(ctx, checkoutID)
+		return nil, fmt.Errorf("failed to hold stock: %w", err)
+	}
+
 	return session, nil
 }
 
+// releaseBackorders drops the backorder reservations of a checkout that ended.
+// Those that cannot be dropped lapse on their own.
+func (s *CheckoutService) releaseBackorders(ctx context.Context, checkoutID string) {
+	if err := s.backorders.Release(ctx, checkoutID); err != nil {
+		log.Printf("Failed to release backorders for checkout %s: %v", checkoutID, err)
+	}
+}
+
 func (s *CheckoutService) CreatePaymentSession(ctx context.Context, checkoutID string) (*checkout.PaymentLinkResource, error) {
 	// Get checkout session
 	var session models.CheckoutSession
@@ -122,6 +193,9 @@ func (s *CheckoutService) CreatePaymentSession(ctx context.Context, checkoutID s
 		Description: fmt.Sprintf("Order %s", checkoutID),
 		ReturnUrl:   fmt.Sprintf("%s/api/checkout/%s/complete", s.baseURL, checkoutID),
 	}
+	if session.ManualCapture {
+		req.MerchantAccount = s.adyenClient.ManualCaptureAccount()
+	}
 
 	resp, httpResp, err := s.adyenClient.ReturnCheckout().PaymentLinks(req)
 	if err != nil {
@@ -135,7 +209,7 @@ func (s *CheckoutService) CreatePaymentSession(ctx context.Context, checkoutID s
 	session.PaymentID = resp.Id
 	session.Status = "processing"
 
-	err = s.redisClient.Set(ctx, fmt.Sprintf("checkout:%s", session.ID), session, 30*time.Minute)
+	err = s.redisClient.Set(ctx, fmt.Sprintf("checkout:%s", session.ID), session, time.Until(session.ExpiresAt)+checkoutRetention)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update checkout session: %w", err)
 	}
@@ -150,45 +224,129 @@ func (s *CheckoutService) CompleteCheckout(ctx context.Context, checkoutID strin
 	if err != nil {
 		return fmt.Errorf("failed to get checkout session: %w", err)
 	}
+	if session.ID == "" {
+		return fmt.Errorf("checkout session not found")
+	}
+
+	// The return URL proves nothing, so Adyen is asked whether the link was
+	// paid, or whether it notified an authorisation for the sessions flow
+	paid := false
+	if session.PaymentID != "" {
+		link, err := s.adyenClient.GetPaymentLink(session.PaymentID)
+		if err != nil {
+			return fmt.Errorf("failed to verify payment: %w", err)
+		}
+		paid = paymentLinkPaid(link.Status)
+	}
+	if !paid {
+		if paid, err = s.authorised(ctx, session.ID); err != nil {
+			return fmt.Errorf("failed to verify payment: %w", err)
+		}
+	}
+	if !paid {
+		return ErrPaymentNotCompleted
+	}
+
+	// Shares the sweeper's lock so a late completion cannot race it into a second order
+	locked, err := s.redisClient.SetNX(ctx, fmt.Sprintf("checkout_sweep:%s", session.ID), true, checkoutSweepLock)
+	if err != nil {
+		return fmt.Errorf("failed to lock checkout session: %w", err)
+	}
+	if !locked {
+		return fmt.Errorf("checkout is already being processed")
+	}
 
+	if _, err := s.finalizeOrder(ctx, &session); err != nil {
+		// Let the shopper retry, or the sweeper settle the session, at once
+		if unlockErr := s.redisClient.Delete(ctx, fmt.Sprintf("checkout_sweep:%s", session.ID)); unlockErr != nil {
+			log.Printf("Failed to unlock checkout session %s: %v", session.ID, unlockErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// finalizeOrder turns a paid checkout session into an order and cleans up after it
+func (s *CheckoutService) finalizeOrder(ctx context.Context, session *models.CheckoutSession) (*models.Order, error) {
 	// Get cart
 	cart, err := s.cartService.GetCart(ctx, session.CartID)
 	if err != nil {
-		return fmt.Errorf("failed to get cart: %w", err)
+		return nil, fmt.Errorf("failed to get cart: %w", err)
 	}
 
 	// Check if UserID is nil
 	if session.UserID == nil {
-		return fmt.Errorf("user ID is required")
+		return nil, fmt.Errorf("user ID is required")
 	}
 
 	// Create order
 	order := &models.Order{
-		UserID:       *session.UserID,
-		Status:       "pending",
-		Total:        session.Total,
-		PaymentID:    session.PaymentID,
-		ShippingInfo: session.ShippingInfo,
-		Items:        make([]models.OrderItem, len(cart.Items)),
+		UserID:           *session.UserID,
+		Status:           "pending",
+		Total:            session.Total,
+		Currency:         session.Currency,
+		PaymentID:        session.PaymentID,
+		PaymentReference: session.ID,
+		CustomerEmail:    session.Email,
+		Locale:           session.Locale,
+		ShippingInfo:     session.ShippingInfo,
+		Items:            make([]models.OrderItem, len(cart.Items)),
 	}
 
 	// Convert cart items to order items
 	for i, item := range cart.Items {
 		order.Items[i] = models.OrderItem{
 			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Name:      item.Name,
+			SKU:       item.SKU,
 			Quantity:  item.Quantity,
 			Price:     item.Price,
 		}
 	}
 
+	// Ship from the warehouse that best serves the destination; without one
+	// Odoo uses its default warehouse
+	warehouse, err := s.stockService.ChooseWarehouse(ctx, cart.Items, session.ShippingInfo.Country)
+	if err != nil {
+		log.Printf("Failed to choose warehouse for checkout %s: %v", session.ID, err)
+	} else if warehouse != nil {
+		order.WarehouseID = &warehouse.OdooID
+	}
+	shipDate, err := s.stockService.EstimateShipDate(ctx, cart.Items, session.ShippingInfo.Country)
+	if err != nil {
+		log.Printf("Failed to estimate ship date for checkout %s: %v", session.ID, err)
+	} else {
+		order.EstimatedShipDate = shipDate
+	}
+
+	// Units beyond stock wait on the order for incoming stock
+	backorders, release, err := s.backorders.Lines(ctx, order.Items, session.Backordered)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record backorders: %w", err)
+	}
+	order.Backorders = backorders
+	if release != nil && (order.EstimatedShipDate == nil || release.After(*order.EstimatedShipDate)) {
+		order.EstimatedShipDate = release
+	}
+	if session.ManualCapture {
+		order.CaptureStatus = models.CaptureStatusAuthorised
+		// Also saved on the order if Adyen notifies it later
+		order.PspReference, err = s.captures.PspReference(ctx, session.ID)
+		if err != nil {
+			log.Printf("Failed to get PSP reference for checkout %s: %v", session.ID, err)
+		}
+	}
+
 	// Create order in database and Odoo
-	order, err = s.orderService.CreateOrder(order)
+	order, err = s.orderService.CreateOrder(ctx, order)
 	if err != nil {
-		return fmt.Errorf("failed to create order: %w", err)
+		return nil, fmt.Errorf("failed to create order: %w", err)
 	}
 
 	// Publish order created event
 	err = s.queueClient.Publish(ctx, "orders", queue.Message{
+		ID:      fmt.Sprintf("order.created:%d", order.ID),
 		Type:    "order.created",
 		Payload: order,
 	})
@@ -196,10 +354,150 @@ func (s *CheckoutService) CompleteCheckout(ctx context.Context, checkoutID strin
 		// Log error but don't fail the checkout
 		fmt.Printf("failed to publish order created event: %v\n", err)
 	}
+	err = s.queueClient.Publish(ctx, "notifications", queue.Message{
+		ID:      fmt.Sprintf("order.created:%d", order.ID),
+		Type:    "order.created",
+		Payload: order,
+	})
+	if err != nil {
+		log.Printf("Failed to publish order confirmation: %v", err)
+	}
+
+	// The order now accounts for the stock and its backorders, so the hold
+	// and the reservations can go
+	if err := s.stockHolds.Release(ctx, session.ID); err != nil {
+		log.Printf("Failed to release stock hold for checkout %s: %v", session.ID, err)
+	}
+	s.releaseBackorders(ctx, session.ID)
 
 	// Clean up cart and checkout session
 	s.redisClient.Delete(ctx, fmt.Sprintf("cart:%s", session.CartID))
 	s.redisClient.Delete(ctx, fmt.Sprintf("checkout:%s", session.ID))
 
-	return nil
+	return order, nil
+}
+
+// SweepExpiredSessions settles checkout sessions that expired without completing.
+// Sessions paid after the shopper left become orders; the rest are abandoned.
+func (s *CheckoutService) SweepExpiredSessions(ctx context.Context) (map[string]int, error) {
+	keys, err := s.redisClient.Scan(ctx, "checkout:*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list checkout sessions: %w", err)
+	}
+
+	outcomes := make(map[string]int)
+	for _, key := range keys {
+		var session models.CheckoutSession
+		if err := s.redisClient.Get(ctx, key, &session); err != nil {
+			log.Printf("Failed to read checkout session %s: %v", key, err)
+			continue
+		}
+		// Key expired between SCAN and GET, or session is still live
+		if session.ID == "" || time.Now().Before(session.ExpiresAt) {
+			continue
+		}
+
+		// Only one replica may settle a session
+		locked, err := s.redisClient.SetNX(ctx, fmt.Sprintf("checkout_sweep:%s", session.ID), true, checkoutSweepLock)
+		if err != nil || !locked {
+			continue
+		}
+
+		outcome, err := s.sweepSession(ctx, &session)
+		if err != nil {
+			log.Printf("Failed to sweep checkout session %s: %v", session.ID, err)
+			continue
+		}
+		outcomes[outcome]++
+	}
+
+	return outcomes, nil
+}
+
+func (s *CheckoutService) sweepSession(ctx context.Context, session *models.CheckoutSession) (string, error) {
+	linkStatus := ""
+	if session.PaymentID != "" {
+		link, err := s.adyenClient.GetPaymentLink(session.PaymentID)
+		if err != nil {
+			return "", err
+		}
+		linkStatus = link.Status
+	}
+
+	// Sessions-flow payments have no link; Adyen notifies their authorisation
+	paid := paymentLinkPaid(linkStatus)
+	if !paid {
+		var err error
+		if paid, err = s.authorised(ctx, session.ID); err != nil {
+			return "", err
+		}
+	}
+	if paid {
+		if _, err := s.finalizeOrder(ctx, session); err != nil {
+			// The shopper paid, so the session is kept until a later sweep
+			// turns it into an order instead of expiring with the payment
+			if keepErr := s.redisClient.Set(ctx, fmt.Sprintf("checkout:%s", session.ID), session, 0); keepErr != nil {
+				log.Printf("Failed to keep paid checkout session %s: %v", session.ID, keepErr)
+			}
+			return "", fmt.Errorf("checkout %s was paid but order creation failed: %w", session.ID, err)
+		}
+		return SweepRecovered, nil
+	}
+
+	if linkStatus == "active" {
+		if err := s.adyenClient.ExpirePaymentLink(session.PaymentID); err != nil {
+			return "", err
+		}
+	}
+
+	if err := s.stockHolds.Release(ctx, session.ID); err != nil {
+		return "", err
+	}
+	s.releaseBackorders(ctx, session.ID)
+
+	event := models.AbandonedCartEvent{
+		CheckoutID:   session.ID,
+		CartID:       session.CartID,
+		UserID:       session.UserID,
+		Total:        session.Total,
+		Currency:     session.Currency,
+		ShippingInfo: session.ShippingInfo,
+		Email:        session.Email,
+		Locale:       session.Locale,
+		AbandonedAt:  session.ExpiresAt,
+	}
+	// The cart outlives the session, so recovery emails can link back to it
+	if cart, err := s.cartService.GetCart(ctx, session.CartID); err == nil {
+		event.Items = cart.Items
+	}
+
+	err := s.queueClient.Publish(ctx, "notifications", queue.Message{
+		ID:      fmt.Sprintf("cart.abandoned:%s", session.ID),
+		Type:    "cart.abandoned",
+		Payload: event,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to publish cart abandoned event: %w", err)
+	}
+
+	if err := s.redisClient.Delete(ctx, fmt.Sprintf("checkout:%s", session.ID)); err != nil {
+		return "", err
+	}
+
+	return SweepAbandoned, nil
+}
+
+// authorised tells whether Adyen notified a successful authorisation for the
+// checkout, which is how payments made through the sessions flow show up
+func (s *CheckoutService) authorised(ctx context.Context, checkoutID string) (bool, error) {
+	pspReference, err := s.captures.PspReference(ctx, checkoutID)
+	if err != nil {
+		return false, err
+	}
+	return pspReference != "", nil
+}
+
+// paymentLinkPaid tells whether a payment link status means the shopper paid
+func paymentLinkPaid(status string) bool {
+	return status == "completed" || status == "paid"
 }
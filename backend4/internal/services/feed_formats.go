@@ -0,0 +1,146 @@
+package services
+
+import (
+	"bufio"
+	"ecommerce/internal/models"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const googleNamespace = "http://base.google.com/ns/1.0"
+
+// googleItem is an <item> of a Google Merchant RSS feed
+type googleItem struct {
+	XMLName          xml.Name `xml:"item"`
+	ID               string   `xml:"g:id"`
+	ItemGroupID      string   `xml:"g:item_group_id,omitempty"`
+	Title            string   `xml:"g:title"`
+	Description      string   `xml:"g:description"`
+	Link             string   `xml:"g:link"`
+	ImageLink        string   `xml:"g:image_link"`
+	Availability     string   `xml:"g:availability"`
+	Price            string   `xml:"g:price"`
+	SalePrice        string   `xml:"g:sale_price,omitempty"`
+	Brand            string   `xml:"g:brand,omitempty"`
+	GTIN             string   `xml:"g:gtin,omitempty"`
+	MPN              string   `xml:"g:mpn,omitempty"`
+	IdentifierExists string   `xml:"g:identifier_exists,omitempty"`
+	ProductType      string   `xml:"g:product_type,omitempty"`
+	Condition        string   `xml:"g:condition"`
+}
+
+// Columns of the tab separated Google feed, in the order written
+var googleColumns = []string{
+	"id", "item_group_id", "title", "description", "link", "image_link", "availability",
+	"price", "sale_price", "brand", "gtin", "mpn", "identifier_exists", "product_type", "condition",
+}
+
+// Columns of the Meta catalog feed, in the order written
+var metaColumns = []string{
+	"id", "item_group_id", "title", "description", "availability", "condition",
+	"price", "sale_price", "link", "image_link", "brand", "gtin", "mpn", "product_type",
+}
+
+// WriteGoogleFeedXML writes a feed as a Google Merchant Center RSS 2.0 feed
+func WriteGoogleFeedXML(w io.Writer, feed models.Feed) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "%s<rss version=\"2.0\" xmlns:g=%q>\n<channel>\n", xml.Header, googleNamespace)
+	writeXMLElement(out, "title", feed.Title)
+	writeXMLElement(out, "link", feed.Link)
+	writeXMLElement(out, "description", feed.Title+" products")
+
+	encoder := xml.NewEncoder(out)
+	for _, item := range feed.Items {
+		if err := encoder.Encode(googleItem{
+			ID:               item.ID,
+			ItemGroupID:      item.ItemGroupID,
+			Title:            item.Title,
+			Description:      item.Description,
+			Link:             item.Link,
+			ImageLink:        item.ImageLink,
+			Availability:     item.Availability,
+			Price:            feedPrice(item.Price, item.Currency),
+			SalePrice:        feedPrice(item.SalePrice, item.Currency),
+			Brand:            item.Brand,
+			GTIN:             item.GTIN,
+			MPN:              item.MPN,
+			IdentifierExists: identifierExists(item),
+			ProductType:      item.ProductType,
+			Condition:        item.Condition,
+		}); err != nil {
+			return err
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString("</channel>\n</rss>\n")
+	return out.Flush()
+}
+
+// WriteGoogleFeedTSV writes a feed as a tab separated Google Merchant Center
+// file. Tabs and line breaks inside values become spaces.
+func WriteGoogleFeedTSV(w io.Writer, feed models.Feed) error {
+	out := bufio.NewWriter(w)
+	out.WriteString(strings.Join(googleColumns, "\t") + "\n")
+	for _, item := range feed.Items {
+		row := []string{
+			item.ID, item.ItemGroupID, item.Title, item.Description, item.Link, item.ImageLink, item.Availability,
+			feedPrice(item.Price, item.Currency), feedPrice(item.SalePrice, item.Currency),
+			item.Brand, item.GTIN, item.MPN, identifierExists(item), item.ProductType, item.Condition,
+		}
+		for i, value := range row {
+			row[i] = strings.Join(strings.Fields(value), " ")
+		}
+		out.WriteString(strings.Join(row, "\t") + "\n")
+	}
+	return out.Flush()
+}
+
+// WriteMetaFeedCSV writes a feed as a Meta commerce catalog CSV file
+func WriteMetaFeedCSV(w io.Writer, feed models.Feed) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(metaColumns); err != nil {
+		return err
+	}
+	for _, item := range feed.Items {
+		err := out.Write([]string{
+			item.ID, item.ItemGroupID, item.Title, item.Description,
+			// Meta spells availability with a space
+			strings.ReplaceAll(item.Availability, "_", " "),
+			item.Condition,
+			feedPrice(item.Price, item.Currency), feedPrice(item.SalePrice, item.Currency),
+			item.Link, item.ImageLink, item.Brand, item.GTIN, item.MPN, item.ProductType,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// feedPrice formats a price the way both channels read it, "12.50 EUR".
+// Zero prices are left empty, for optional sale prices.
+func feedPrice(amount float64, currency string) string {
+	if amount == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.2f %s", amount, currency)
+}
+
+// identifierExists tells Google a product has no GTIN and no brand with MPN,
+// so it is not flagged for missing identifiers
+func identifierExists(item models.FeedItem) string {
+	if item.GTIN == "" && (item.Brand == "" || item.MPN == "") {
+		return "no"
+	}
+	return ""
+}
+
+func writeXMLElement(w *bufio.Writer, name, text string) {
+	fmt.Fprintf(w, "<%s>", name)
+	xml.EscapeText(w, []byte(text))
+	fmt.Fprintf(w, "</%s>\n", name)
+}
@@ -0,0 +1,316 @@
+package services
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/pkg/odoo"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Feed files by name, each with the writer producing it
+var feedFormats = map[string]func(io.Writer, models.Feed) error{
+	"google.xml": WriteGoogleFeedXML,
+	"google.tsv": WriteGoogleFeedTSV,
+	"meta.csv":   WriteMetaFeedCSV,
+}
+
+var ErrFeedNotFound = errors.New("feed not found")
+
+// feedVariant is the part of a product.product a feed item is made from.
+// compare_list_price is website_sale's price before discount.
+type feedVariant struct {
+	ID           int64          `xmlrpc:"id"`
+	Template     odoo.Many2One  `xmlrpc:"product_tmpl_id"`
+	Name         string         `xmlrpc:"display_name"`
+	Description  string         `xmlrpc:"description_sale"`
+	DefaultCode  string         `xmlrpc:"default_code"`
+	Barcode      string         `xmlrpc:"barcode"`
+	Price        float64        `xmlrpc:"lst_price"`
+	ComparePrice float64        `xmlrpc:"compare_list_price"`
+	QtyAvailable float64        `xmlrpc:"qty_available"`
+	Currency     odoo.Many2One  `xmlrpc:"currency_id"`
+	Category     *odoo.Many2One `xmlrpc:"categ_id"`
+	VariantCount int            `xmlrpc:"product_variant_count"`
+}
+
+// FeedService exports the catalog as product feeds for shopping channels.
+// Feeds are regenerated in full on a schedule into files that are swapped in
+// atomically, so the feed URLs always serve a complete feed.
+type FeedService struct {
+	db         *gorm.DB
+	odooClient odoo.OdooClient
+
+	dir        string // Where generated feeds are kept
+	siteURL    string // Storefront, for product links
+	apiBaseURL string // This API, for image links
+	brand      string
+
+	fieldsMu     sync.Mutex
+	hasCompare   bool // Whether Odoo has compare_list_price
+	fieldsLoaded bool
+}
+
+func NewFeedService(db *gorm.DB, odooClient odoo.OdooClient, dir, siteURL, apiBaseURL, brand string) (*FeedService, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create feed directory: %w", err)
+	}
+	return &FeedService{
+		db:         db,
+		odooClient: odooClient,
+		dir:        dir,
+		siteURL:    strings.TrimRight(siteURL, "/"),
+		apiBaseURL: strings.TrimRight(apiBaseURL, "/"),
+		brand:      brand,
+	}, nil
+}
+
+// FeedPath returns the file of a generated feed
+func (s *FeedService) FeedPath(name string) (string, error) {
+	if _, ok := feedFormats[name]; !ok {
+		return "", fmt.Errorf("feed %q: %w", name, ErrFeedNotFound)
+	}
+	path := filepath.Join(s.dir, name)
+	if _, err := os.Stat(path); err != nil {
+		// Not generated yet
+		return "", fmt.Errorf("feed %q: %w", name, ErrFeedNotFound)
+	}
+	return path, nil
+}
+
+// Generate rebuilds every feed from Odoo
+func (s *FeedService) Generate(ctx context.Context) error {
+	items, err := s.feedItems(ctx)
+	if err != nil {
+		return err
+	}
+	feed := models.Feed{Title: s.brand, Link: s.siteURL, Items: items}
+	for name, write := range feedFormats {
+		if err := s.writeFeed(name, write, feed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFeed writes a feed next to the current one and renames it over it
+func (s *FeedService) writeFeed(name string, write func(io.Writer, models.Feed) error, feed models.Feed) error {
+	tmp, err := os.CreateTemp(s.dir, name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create feed %s: %w", name, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp, feed); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write feed %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write feed %s: %w", name, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to write feed %s: %w", name, err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, name)); err != nil {
+		return fmt.Errorf("failed to replace feed %s: %w", name, err)
+	}
+	return nil
+}
+
+// feedItems lists every saleable variant of a published product. Variants
+// without any image are left out, as the channels reject them.
+func (s *FeedService) feedItems(ctx context.Context) ([]models.FeedItem, error) {
+	hasCompare, err := s.compareAvailable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fields := []string{"id", "product_tmpl_id", "display_name", "description_sale", "default_code", "barcode",
+		"lst_price", "qty_available", "currency_id", "categ_id", "product_variant_count"}
+	if hasCompare {
+		fields = append(fields, "compare_list_price")
+	}
+
+	ids, err := s.odooClient.Search(ctx, "product.product", s.odooClient.NewCriteria().Add("sale_ok", "=", true), nil)
+	if err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return nil, fmt.Errorf("failed to list products for feeds: %w", err)
+	}
+
+	var items []models.FeedItem
+	skipped := 0
+	for start := 0; start < len(ids); start += searchBatchSize {
+		end := start + searchBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch, withoutImage, err := s.feedBatch(ctx, ids[start:end], fields)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, batch...)
+		skipped += withoutImage
+	}
+	if skipped > 0 {
+		log.Printf("Product feeds: %d variants without an image left out", skipped)
+	}
+	return items, nil
+}
+
+func (s *FeedService) feedBatch(ctx context.Context, ids []int64, fields []string) ([]models.FeedItem, int, error) {
+	var variants []feedVariant
+	options := s.odooClient.NewOptions().FetchFields(fields...)
+	if err := s.odooClient.Read(ctx, "product.product", ids, options, &variants); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return nil, 0, fmt.Errorf("failed to fetch products for feeds: %w", err)
+	}
+	templateIDs := make([]int64, 0, len(variants))
+	for _, variant := range variants {
+		templateIDs = append(templateIDs, variant.Template.ID)
+	}
+	templateIDs = uniqueIDs(templateIDs)
+
+	var pages []models.ProductPage
+	if err := s.db.WithContext(ctx).Where("template_id IN ?", templateIDs).Find(&pages).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch product pages: %w", err)
+	}
+	pagesByTemplate := make(map[int64]models.ProductPage, len(pages))
+	for _, page := range pages {
+		pagesByTemplate[page.TemplateID] = page
+	}
+
+	// Image versions come from write_date, like the gallery's, so feed image
+	// links change when the image does
+	var templates []imageOwner
+	criteria := s.odooClient.NewCriteria().
+		Add("id", "in", templateIDs).
+		Add("image_1920", "!=", false)
+	if err := s.odooClient.SearchRead(ctx, "product.template", criteria, s.odooClient.NewOptions().FetchFields("id", "write_date"), &templates); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return nil, 0, fmt.Errorf("failed to fetch product images: %w", err)
+	}
+	var ownImages []imageOwner
+	criteria = s.odooClient.NewCriteria().
+		Add("id", "in", ids).
+		Add("image_variant_1920", "!=", false)
+	if err := s.odooClient.SearchRead(ctx, "product.product", criteria, s.odooClient.NewOptions().FetchFields("id", "write_date"), &ownImages); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return nil, 0, fmt.Errorf("failed to fetch variant images: %w", err)
+	}
+	templateImages := make(map[int64]time.Time, len(templates))
+	for _, template := range templates {
+		templateImages[template.ID] = template.WriteDate
+	}
+	variantImages := make(map[int64]time.Time, len(ownImages))
+	for _, variant := range ownImages {
+		variantImages[variant.ID] = variant.WriteDate
+	}
+
+	items := make([]models.FeedItem, 0, len(variants))
+	withoutImage := 0
+	for _, variant := range variants {
+		templateID := variant.Template.ID
+		page, hasPage := pagesByTemplate[templateID]
+		if hasPage && !page.Published {
+			continue
+		}
+
+		var image ImageRef
+		if written, ok := variantImages[variant.ID]; ok {
+			image = ImageRef{Kind: models.ProductImageVariant, ID: variant.ID, Version: written.Unix()}
+		} else if written, ok := templateImages[templateID]; ok {
+			image = ImageRef{Kind: models.ProductImageTemplate, ID: templateID, Version: written.Unix()}
+		} else {
+			withoutImage++
+			continue
+		}
+
+		// Pages not built yet are linked by ID
+		link := s.siteURL + productPagePath + strconv.FormatInt(templateID, 10)
+		if hasPage {
+			link = s.siteURL + productPagePath + page.Slug
+		}
+		item := models.FeedItem{
+			ID:           strconv.FormatInt(variant.ID, 10),
+			Title:        variant.Name,
+			Description:  firstNonEmpty(variant.Description, page.MetaDescription, variant.Name),
+			Link:         link,
+			ImageLink:    s.apiBaseURL + imageURL(templateID, image),
+			Availability: models.FeedOutOfStock,
+			Price:        variant.Price,
+			Currency:     variant.Currency.Name,
+			Brand:        s.brand,
+			MPN:          variant.DefaultCode,
+			Condition:    "new",
+		}
+		if variant.VariantCount > 1 {
+			item.ItemGroupID = strconv.FormatInt(templateID, 10)
+			item.Link += "?variant=" + item.ID
+		}
+		if variant.QtyAvailable > 0 {
+			item.Availability = models.FeedInStock
+		}
+		if variant.ComparePrice > variant.Price {
+			item.Price, item.SalePrice = variant.ComparePrice, variant.Price
+		}
+		if ValidGTIN(variant.Barcode) {
+			item.GTIN = variant.Barcode
+		}
+		if variant.Category != nil {
+			// Odoo names categories by their full path, "All / Office / Chairs"
+			item.ProductType = strings.ReplaceAll(variant.Category.Name, " / ", " > ")
+		}
+		items = append(items, item)
+	}
+	return items, withoutImage, nil
+}
+
+// compareAvailable asks Odoo once whether it has website_sale's
+// compare_list_price
+func (s *FeedService) compareAvailable(ctx context.Context) (bool, error) {
+	s.fieldsMu.Lock()
+	defer s.fieldsMu.Unlock()
+	if s.fieldsLoaded {
+		return s.hasCompare, nil
+	}
+
+	fields, err := s.odooClient.FieldsGet(ctx, "product.product", "compare_list_price")
+	if err != nil {
+		return false, fmt.Errorf("failed to describe product fields: %w", err)
+	}
+	_, s.hasCompare = fields["compare_list_price"]
+	s.fieldsLoaded = true
+	return s.hasCompare, nil
+}
+
+// ValidGTIN reports whether code is a GTIN-8, -12, -13 or -14 with a correct
+// check digit. Odoo barcodes may hold internal codes that are not.
+func ValidGTIN(code string) bool {
+	switch len(code) {
+	case 8, 12, 13, 14:
+	default:
+		return false
+	}
+	sum := 0
+	for i := len(code) - 1; i >= 0; i-- {
+		if code[i] < '0' || code[i] > '9' {
+			return false
+		}
+		digit := int(code[i] - '0')
+		if i == len(code)-1 {
+			continue
+		}
+		// Digits alternate weights 3 and 1, starting next to the check digit
+		if (len(code)-1-i)%2 == 1 {
+			sum += 3 * digit
+		} else {
+			sum += digit
+		}
+	}
+	return (10-sum%10)%10 == int(code[len(code)-1]-'0')
+}
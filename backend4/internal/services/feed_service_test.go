@@ -0,0 +1,108 @@
+package services_test
+
+import (
+	"bytes"
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"encoding/csv"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFeed = models.Feed{
+	Title: "Our Store",
+	Link:  "https://shop.example.com",
+	Items: []models.FeedItem{{
+		ID:           "42",
+		ItemGroupID:  "7",
+		Title:        "Desk Chair (Red)",
+		Description:  "Tall\tback, <b>padded</b> & comfy",
+		Link:         "https://shop.example.com/product/desk-chair?variant=42",
+		ImageLink:    "https://api.example.com/api/products/7/variants/42/image?v=1",
+		Availability: models.FeedInStock,
+		Price:        120,
+		SalePrice:    99.5,
+		Currency:     "EUR",
+		Brand:        "Our Store",
+		GTIN:         "4006381333931",
+		MPN:          "CHAIR-RED",
+		ProductType:  "All > Office > Chairs",
+		Condition:    "new",
+	}},
+}
+
+func TestValidGTIN(t *testing.T) {
+	assert.True(t, services.ValidGTIN("4006381333931"))
+	assert.True(t, services.ValidGTIN("96385074"))
+	assert.True(t, services.ValidGTIN("036000291452"))
+	assert.False(t, services.ValidGTIN("4006381333932"))
+	assert.False(t, services.ValidGTIN("CHAIR-RED"))
+	assert.False(t, services.ValidGTIN(""))
+}
+
+func TestWriteGoogleFeedXML(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, services.WriteGoogleFeedXML(&out, testFeed))
+
+	var rss struct {
+		Channel struct {
+			Title string `xml:"title"`
+			Items []struct {
+				ID          string `xml:"id"`
+				Description string `xml:"description"`
+				Price       string `xml:"price"`
+				SalePrice   string `xml:"sale_price"`
+				GTIN        string `xml:"gtin"`
+				ItemGroupID string `xml:"item_group_id"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	require.NoError(t, xml.Unmarshal(out.Bytes(), &rss), out.String())
+	assert.Equal(t, "Our Store", rss.Channel.Title)
+	require.Len(t, rss.Channel.Items, 1)
+	item := rss.Channel.Items[0]
+	assert.Equal(t, "42", item.ID)
+	assert.Equal(t, "Tall\tback, <b>padded</b> & comfy", item.Description)
+	assert.Equal(t, "120.00 EUR", item.Price)
+	assert.Equal(t, "99.50 EUR", item.SalePrice)
+	assert.Equal(t, "4006381333931", item.GTIN)
+	assert.Equal(t, "7", item.ItemGroupID)
+	assert.Contains(t, out.String(), `xmlns:g="http://base.google.com/ns/1.0"`)
+}
+
+func TestWriteGoogleFeedTSV(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, services.WriteGoogleFeedTSV(&out, testFeed))
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	header, row := strings.Split(lines[0], "\t"), strings.Split(lines[1], "\t")
+	require.Len(t, row, len(header))
+	values := make(map[string]string, len(header))
+	for i, column := range header {
+		values[column] = row[i]
+	}
+	assert.Equal(t, "Tall back, <b>padded</b> & comfy", values["description"])
+	assert.Equal(t, "in_stock", values["availability"])
+	assert.Equal(t, "", values["identifier_exists"])
+}
+
+func TestWriteMetaFeedCSV(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, services.WriteMetaFeedCSV(&out, testFeed))
+
+	records, err := csv.NewReader(&out).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	values := make(map[string]string, len(records[0]))
+	for i, column := range records[0] {
+		values[column] = records[1][i]
+	}
+	assert.Equal(t, "in stock", values["availability"])
+	assert.Equal(t, "99.50 EUR", values["sale_price"])
+	assert.Equal(t, "CHAIR-RED", values["mpn"])
+}
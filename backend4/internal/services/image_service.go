@@ -0,0 +1,353 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"ecommerce/pkg/odoo"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "image/gif"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Output formats of the image endpoint
+const (
+	ImageFormatWebP = "webp"
+	ImageFormatJPEG = "jpeg"
+	ImageFormatPNG  = "png"
+)
+
+var imageContentTypes = map[string]string{
+	ImageFormatWebP: "image/webp",
+	ImageFormatJPEG: "image/jpeg",
+	ImageFormatPNG:  "image/png",
+}
+
+var (
+	ErrInvalidImageWidth  = errors.New("image width must be between 1 and 1920")
+	ErrImageFormat        = errors.New("unsupported image format")
+	ErrImageNotAcceptable = errors.New("no acceptable image format")
+)
+
+// ImageMovedError reports that an image changed since its URL was issued.
+// URL is where the image is served now.
+type ImageMovedError struct {
+	URL string
+}
+
+func (e *ImageMovedError) Error() string {
+	return fmt.Sprintf("image has moved to %s", e.URL)
+}
+
+// ImageRequest describes the rendition a client asked for
+type ImageRequest struct {
+	Width  int    // 0 keeps the largest size Odoo has
+	Format string // Explicit format; empty negotiates from Accept
+	Accept string // The request's Accept header
+}
+
+// Image is an encoded rendition ready to serve
+type Image struct {
+	Data        []byte
+	ContentType string
+	ETag        string // Strong, quoted
+}
+
+// ImageService serves product images in the size and format a client asks
+// for. It starts from the closest size Odoo keeps, resizes and re-encodes
+// when needed, and keeps derived images on disk keyed by their ETag.
+//
+// WebP is only served as Odoo stores it: the standard library and x/image
+// decode WebP but cannot encode it, so resized images fall back to PNG or JPEG.
+type ImageService struct {
+	productService *ProductService
+	cacheDir       string
+	jpegQuality    int
+}
+
+func NewImageService(productService *ProductService, cacheDir string, jpegQuality int) (*ImageService, error) {
+	if jpegQuality == 0 {
+		jpegQuality = 85
+	}
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create image cache: %w", err)
+	}
+	return &ImageService{
+		productService: productService,
+		cacheDir:       cacheDir,
+		jpegQuality:    jpegQuality,
+	}, nil
+}
+
+// GetImage returns the rendition for req of one of a product's images. An
+// image that is not part of the product's gallery is reported as not found,
+// one whose version is not the current one as an ImageMovedError.
+func (s *ImageService) GetImage(ctx context.Context, productID int64, ref ImageRef, req ImageRequest) (*Image, error) {
+	maxSize := ImageSizes[len(ImageSizes)-1]
+	if req.Width < 0 || req.Width > maxSize {
+		return nil, ErrInvalidImageWidth
+	}
+	if req.Format != "" {
+		if _, ok := imageContentTypes[req.Format]; !ok {
+			return nil, ErrImageFormat
+		}
+	}
+
+	if ref.Version != 0 {
+		// Versioned responses are cached for good, so the version must be the current one
+		current, err := s.productService.ImageURL(ctx, productID, ref)
+		if err != nil {
+			return nil, err
+		}
+		if current != imageURL(productID, ref) {
+			return nil, &ImageMovedError{URL: current}
+		}
+	} else {
+		ok, err := s.productService.HasImage(ctx, productID, ref)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("product %d has no %s image %d: %w", productID, ref.Kind, ref.ID, odoo.ErrNotFound)
+		}
+	}
+
+	source, err := s.productService.GetImageSource(ctx, ref, sourceSize(req.Width))
+	if err != nil {
+		return nil, err
+	}
+
+	sourceFormat, ok := sniffImageFormat(source)
+	if !ok {
+		return nil, fmt.Errorf("product %d image has unsupported type %s", productID, http.DetectContentType(source))
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read product %d image: %w", productID, err)
+	}
+	resize := req.Width > 0 && req.Width < config.Width
+
+	format, err := negotiateImageFormat(req, sourceFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	// Odoo's own rendition is served untouched when it already fits. WebP
+	// cannot be re-encoded, so the closest size Odoo keeps has to do.
+	if format == sourceFormat && (!resize || format == ImageFormatWebP) {
+		return &Image{Data: source, ContentType: imageContentTypes[format], ETag: imageETag(source, 0, format, 0)}, nil
+	}
+
+	width := config.Width
+	if resize {
+		width = req.Width
+	}
+	etag := imageETag(source, width, format, s.jpegQuality)
+	path := filepath.Join(s.cacheDir, strings.Trim(etag, `"`)+"."+format)
+
+	if data, err := os.ReadFile(path); err == nil {
+		// Keeps the file from being pruned while it is in use
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return &Image{Data: data, ContentType: imageContentTypes[format], ETag: etag}, nil
+	}
+
+	data, err := s.render(source, width, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render product %d image: %w", productID, err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return nil, fmt.Errorf("failed to cache product %d image: %w", productID, err)
+	}
+	return &Image{Data: data, ContentType: imageContentTypes[format], ETag: etag}, nil
+}
+
+// PruneCache removes derived images not served for maxAge
+func (s *ImageService) PruneCache(maxAge time.Duration) (int, error) {
+	entries, err := os.ReadDir(s.cacheDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list image cache: %w", err)
+	}
+
+	removed := 0
+	cutoff := time.Now().Add(-maxAge)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.cacheDir, entry.Name())); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// render decodes source, scales it to width and encodes it as format
+func (s *ImageService) render(source []byte, width int, format string) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(source))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	height := (bounds.Dy()*width + bounds.Dx()/2) / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	// JPEG has no alpha channel, so transparent areas become white
+	if format == ImageFormatJPEG {
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	switch format {
+	case ImageFormatJPEG:
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: s.jpegQuality})
+	case ImageFormatPNG:
+		err = png.Encode(&buf, dst)
+	default:
+		err = ErrImageFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sourceSize picks the smallest Odoo size at least width wide
+func sourceSize(width int) int {
+	for _, size := range ImageSizes {
+		if width > 0 && size >= width {
+			return size
+		}
+	}
+	return ImageSizes[len(ImageSizes)-1]
+}
+
+// sniffImageFormat detects the real format of an image Odoo returned
+func sniffImageFormat(data []byte) (string, bool) {
+	switch http.DetectContentType(data) {
+	case "image/webp":
+		return ImageFormatWebP, true
+	case "image/png":
+		return ImageFormatPNG, true
+	case "image/gif":
+		// Never served as is; re-encoded as PNG, which keeps transparency
+		return "gif", true
+	case "image/jpeg":
+		return ImageFormatJPEG, true
+	}
+	return "", false
+}
+
+// negotiateImageFormat picks the output format. An explicit format must be
+// one we can produce; otherwise WebP is preferred when Odoo has it, then PNG
+// for images that may be transparent, then JPEG.
+func negotiateImageFormat(req ImageRequest, sourceFormat string) (string, error) {
+	canProduce := func(format string) bool {
+		return format != ImageFormatWebP || sourceFormat == ImageFormatWebP
+	}
+
+	if req.Format != "" {
+		if !canProduce(req.Format) {
+			return "", ErrImageNotAcceptable
+		}
+		return req.Format, nil
+	}
+
+	candidates := []string{ImageFormatJPEG, ImageFormatPNG}
+	if sourceFormat != ImageFormatJPEG {
+		candidates = []string{ImageFormatWebP, ImageFormatPNG, ImageFormatJPEG}
+	}
+	for _, format := range candidates {
+		if canProduce(format) && acceptsType(req.Accept, imageContentTypes[format]) {
+			return format, nil
+		}
+	}
+	return "", ErrImageNotAcceptable
+}
+
+// acceptsType reports whether an Accept header allows contentType. A missing
+// header accepts anything, the most specific matching entry decides and
+// entries with q=0 are refusals.
+func acceptsType(accept, contentType string) bool {
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+
+	major := strings.SplitN(contentType, "/", 2)[0] + "/*"
+	specificity, allowed := -1, false
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		var match int
+		switch strings.TrimSpace(params[0]) {
+		case contentType:
+			match = 2
+		case major:
+			match = 1
+		case "*/*":
+			match = 0
+		default:
+			continue
+		}
+		if match <= specificity {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		specificity, allowed = match, q > 0
+	}
+	return allowed
+}
+
+// imageETag identifies a rendition by its source bytes and the parameters
+// that shaped it, so any change in Odoo yields a new tag
+func imageETag(source []byte, width int, format string, quality int) string {
+	hash := sha256.New()
+	hash.Write(source)
+	fmt.Fprintf(hash, "|%d|%s|%d", width, format, quality)
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".image-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
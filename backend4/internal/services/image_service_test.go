@@ -0,0 +1,177 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"ecommerce/internal/testutils/mocks"
+	"ecommerce/pkg/odoo"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+
+	go_odoo "github.com/skilld-labs/go-odoo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var mainImage = services.ImageRef{Kind: models.ProductImageTemplate, ID: 1}
+
+// newImageService serves a 256px wide PNG as the image_256 of product 1
+func newImageService(t *testing.T) (*services.ImageService, *mocks.MockOdooClient) {
+	source := image.NewNRGBA(image.Rect(0, 0, 256, 128))
+	for x := 0; x < 256; x++ {
+		source.Set(x, 64, color.NRGBA{R: 200, A: 255})
+	}
+	var encoded bytes.Buffer
+	require.NoError(t, png.Encode(&encoded, source))
+
+	mockClient := new(mocks.MockOdooClient)
+	mockClient.On("NewOptions").Return(go_odoo.NewOptions())
+	mockClient.On("Read", "product.template", []int64{1}, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			records := args.Get(3).(*[]interface{})
+			*records = []interface{}{map[string]interface{}{
+				"id":        int64(1),
+				"image_256": base64.StdEncoding.EncodeToString(encoded.Bytes()),
+			}}
+		}).
+		Return(nil)
+
+	imageService, err := services.NewImageService(newProductService(t, mockClient), t.TempDir(), 0)
+	require.NoError(t, err)
+	return imageService, mockClient
+}
+
+func TestGetImageResizesAndNegotiates(t *testing.T) {
+	imageService, mockClient := newImageService(t)
+	ctx := context.Background()
+
+	// WebP is preferred but cannot be produced from a PNG, so PNG keeps the alpha channel
+	img, err := imageService.GetImage(ctx, 1, mainImage, services.ImageRequest{Width: 200, Accept: "image/webp,image/*"})
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", img.ContentType)
+	config, format, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	require.NoError(t, err)
+	assert.Equal(t, "png", format)
+	assert.Equal(t, 200, config.Width)
+	assert.Equal(t, 100, config.Height)
+
+	again, err := imageService.GetImage(ctx, 1, mainImage, services.ImageRequest{Width: 200, Accept: "image/webp,image/*"})
+	require.NoError(t, err)
+	assert.Equal(t, img.ETag, again.ETag)
+	mockClient.AssertNumberOfCalls(t, "Read", 1)
+
+	jpeg, err := imageService.GetImage(ctx, 1, mainImage, services.ImageRequest{Width: 200, Accept: "image/jpeg"})
+	require.NoError(t, err)
+	assert.Equal(t, "image/jpeg", jpeg.ContentType)
+	assert.NotEqual(t, img.ETag, jpeg.ETag)
+}
+
+func TestGetImageRejectsFormatsItCannotProduce(t *testing.T) {
+	imageService, _ := newImageService(t)
+
+	_, err := imageService.GetImage(context.Background(), 1, mainImage, services.ImageRequest{Width: 200, Format: services.ImageFormatWebP})
+	assert.ErrorIs(t, err, services.ErrImageNotAcceptable)
+
+	_, err = imageService.GetImage(context.Background(), 1, mainImage, services.ImageRequest{Width: 200, Accept: "image/png;q=0, image/jpeg;q=0"})
+	assert.ErrorIs(t, err, services.ErrImageNotAcceptable)
+
+	_, err = imageService.GetImage(context.Background(), 1, mainImage, services.ImageRequest{Width: 4000})
+	assert.ErrorIs(t, err, services.ErrInvalidImageWidth)
+}
+
+func TestGetImageRejectsImagesOfOtherProducts(t *testing.T) {
+	imageService, mockClient := newImageService(t)
+	mockClient.On("NewCriteria").Return(nil)
+	mockClient.On("SearchRead", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	mockClient.On("SearchCount", "product.template", mock.Anything).Return(int64(1), nil)
+
+	_, err := imageService.GetImage(context.Background(), 1, services.ImageRef{Kind: models.ProductImageExtra, ID: 9}, services.ImageRequest{})
+	assert.ErrorIs(t, err, odoo.ErrNotFound)
+	mockClient.AssertNotCalled(t, "Read", "product.image", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetImageChecksVersions(t *testing.T) {
+	imageService, mockClient := newImageService(t)
+	written := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mockClient.On("NewCriteria").Return(nil)
+	mockClient.On("SearchRead", "product.template", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			data, _ := json.Marshal([]map[string]interface{}{{"id": 1, "name": "Chair", "writedate": written}})
+			json.Unmarshal(data, args.Get(3))
+		}).
+		Return(nil)
+	mockClient.On("SearchRead", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	mockClient.On("SearchCount", "product.template", mock.Anything).Return(int64(1), nil)
+	ctx := context.Background()
+
+	current := services.ImageRef{Kind: models.ProductImageTemplate, ID: 1, Version: written.Unix()}
+	_, err := imageService.GetImage(ctx, 1, current, services.ImageRequest{Width: 200})
+	require.NoError(t, err)
+
+	outdated := services.ImageRef{Kind: models.ProductImageTemplate, ID: 1, Version: written.Unix() - 60}
+	_, err = imageService.GetImage(ctx, 1, outdated, services.ImageRequest{Width: 200})
+	var moved *services.ImageMovedError
+	require.ErrorAs(t, err, &moved)
+	assert.Equal(t, fmt.Sprintf("/api/products/1/image?v=%d", written.Unix()), moved.URL)
+
+	// Any version shares one cached source, so only the first request read it
+	mockClient.AssertNumberOfCalls(t, "Read", 1)
+}
+
+func TestGetGalleryOrdersImages(t *testing.T) {
+	mockClient := new(mocks.MockOdooClient)
+	service := newProductService(t, mockClient)
+	written := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// fill hands records to the service's own record types through JSON
+	fill := func(records interface{}) func(mock.Arguments) {
+		return func(args mock.Arguments) {
+			data, _ := json.Marshal(records)
+			json.Unmarshal(data, args.Get(3))
+		}
+	}
+	domain := func(field string) interface{} {
+		return mock.MatchedBy(func(criteria *go_odoo.Criteria) bool {
+			return (*criteria)[0].([]interface{})[0] == field
+		})
+	}
+
+	mockClient.On("NewCriteria").Return(nil)
+	mockClient.On("NewOptions").Return(nil)
+	mockClient.On("SearchRead", "product.template", mock.Anything, mock.Anything, mock.Anything).
+		Run(fill([]map[string]interface{}{{"id": 1, "name": "Chair", "writedate": written}})).Return(nil)
+	mockClient.On("SearchCount", "product.template", mock.Anything).Return(int64(1), nil)
+	mockClient.On("SearchRead", "product.image", domain("product_tmpl_id"), mock.Anything, mock.Anything).
+		Run(fill([]odoo.OdooProductImage{
+			{ID: 11, Name: "Back", Sequence: 20, WriteDate: written},
+			{ID: 12, Sequence: 10, WriteDate: written},
+		})).Return(nil)
+	mockClient.On("SearchRead", "product.image", domain("product_variant_id.product_tmpl_id"), mock.Anything, mock.Anything).
+		Run(fill([]odoo.OdooProductImage{
+			{ID: 13, Variant: &odoo.Many2One{ID: 5, Name: "Chair (Red)"}, WriteDate: written},
+		})).Return(nil)
+	mockClient.On("SearchRead", "product.product", mock.Anything, mock.Anything, mock.Anything).
+		Run(fill([]map[string]interface{}{{"id": 5, "displayname": "Chair (Red)", "writedate": written}})).Return(nil)
+
+	gallery, err := service.GetGallery(context.Background(), 1)
+	require.NoError(t, err)
+	require.Len(t, gallery, 5)
+
+	version := written.Unix()
+	assert.Equal(t, models.ProductImage{Kind: models.ProductImageTemplate, URL: fmt.Sprintf("/api/products/1/image?v=%d", version), Alt: "Chair", IsPrimary: true}, gallery[0])
+	assert.Equal(t, int64(12), gallery[1].ImageID)
+	assert.Equal(t, "Chair", gallery[1].Alt)
+	assert.Equal(t, int64(11), gallery[2].ImageID)
+	assert.Equal(t, "Back", gallery[2].Alt)
+	assert.Equal(t, models.ProductImage{Kind: models.ProductImageVariant, VariantID: 5, URL: fmt.Sprintf("/api/products/1/variants/5/image?v=%d", version), Alt: "Chair (Red)", Position: 3}, gallery[3])
+	assert.Equal(t, models.ProductImage{Kind: models.ProductImageExtra, ImageID: 13, VariantID: 5, URL: fmt.Sprintf("/api/products/1/images/13?v=%d", version), Alt: "Chair (Red)", Position: 4}, gallery[4])
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/pkg/odoo"
+	"ecommerce/pkg/queue"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Events on the inventory queue. Odoo's changes arrive as product.changed
+// and stock.changed; stock.updated follows once the stock levels mirrored
+// here have caught up.
+const (
+	EventProductChanged = "product.changed"
+	EventStockChanged   = "stock.changed"
+	EventStockUpdated   = "stock.updated"
+)
+
+var ErrUnsupportedModel = errors.New("unsupported model")
+
+// changedRecord is the product of a changed product.product or stock.quant
+type changedRecord struct {
+	ID       int64          `xmlrpc:"id"`
+	Variant  *odoo.Many2One `xmlrpc:"product_id"`
+	Template *odoo.Many2One `xmlrpc:"product_tmpl_id"`
+}
+
+// InventoryEvents brings changes made in Odoo onto the inventory queue as
+// soon as Odoo reports them, through the webhook or the Odoo bus, so the
+// local mirror and caches need not wait for the next sync
+type InventoryEvents struct {
+	odooClient  *odoo.Client
+	queueClient *queue.Client
+}
+
+func NewInventoryEvents(odooClient *odoo.Client, queueClient *queue.Client) *InventoryEvents {
+	return &InventoryEvents{odooClient: odooClient, queueClient: queueClient}
+}
+
+// PublishChange announces that records of an Odoo model changed
+func (e *InventoryEvents) PublishChange(ctx context.Context, model string, ids []int64) error {
+	eventType, change, err := ResolveChange(ctx, e.odooClient, model, ids)
+	if err != nil {
+		return err
+	}
+	return e.publish(ctx, eventType, change)
+}
+
+func (e *InventoryEvents) publish(ctx context.Context, eventType string, change *models.ProductChange) error {
+	if len(change.TemplateIDs) == 0 && len(change.VariantIDs) == 0 {
+		return nil
+	}
+	if err := e.queueClient.Publish(ctx, "inventory", queue.Message{Type: eventType, Payload: change}); err != nil {
+		return fmt.Errorf("failed to publish %s: %w", eventType, err)
+	}
+	return nil
+}
+
+// ResolveChange turns changed records of product.template, product.product
+// or stock.quant into the products they concern. Records deleted meanwhile
+// are skipped.
+func ResolveChange(ctx context.Context, odooClient odoo.OdooClient, model string, ids []int64) (string, *models.ProductChange, error) {
+	change := &models.ProductChange{}
+	switch model {
+	case "product.template":
+		change.TemplateIDs = uniqueIDs(ids)
+		return EventProductChanged, change, nil
+	case "product.product", "stock.quant":
+	default:
+		return "", nil, fmt.Errorf("%w %q", ErrUnsupportedModel, model)
+	}
+
+	fields := []string{"id", "product_tmpl_id"}
+	if model == "stock.quant" {
+		fields = append(fields, "product_id")
+	}
+	var records []changedRecord
+	options := odooClient.NewOptions().FetchFields(fields...)
+	if err := odooClient.Read(ctx, model, uniqueIDs(ids), options, &records); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return "", nil, fmt.Errorf("failed to read changed %s: %w", model, err)
+	}
+	for _, record := range records {
+		if model == "product.product" {
+			change.VariantIDs = append(change.VariantIDs, record.ID)
+		} else if record.Variant != nil {
+			change.VariantIDs = append(change.VariantIDs, record.Variant.ID)
+		}
+		if record.Template != nil {
+			change.TemplateIDs = append(change.TemplateIDs, record.Template.ID)
+		}
+	}
+	change.VariantIDs = uniqueIDs(change.VariantIDs)
+	change.TemplateIDs = uniqueIDs(change.TemplateIDs)
+
+	if model == "stock.quant" {
+		return EventStockChanged, change, nil
+	}
+	return EventProductChanged, change, nil
+}
+
+// ListenBus polls an Odoo bus channel until ctx ends and publishes what
+// Odoo sends there. Notifications are product.changed or stock.changed
+// events whose payload lists template_ids and variant_ids, as sent by an
+// automated action:
+//
+//	env['bus.bus']._sendone('ecommerce_inventory', 'stock.changed',
+//	    {'variant_ids': records.product_id.ids, 'template_ids': records.product_tmpl_id.ids})
+func (e *InventoryEvents) ListenBus(ctx context.Context, channel string, interval time.Duration) {
+	var last int64
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		notifications, err := e.odooClient.PollBus(ctx, []string{channel}, last)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Odoo bus poll failed: %v", err)
+		}
+		for _, notification := range notifications {
+			last = max(last, notification.ID)
+			if notification.Type != EventProductChanged && notification.Type != EventStockChanged {
+				continue
+			}
+			var change models.ProductChange
+			if err := json.Unmarshal(notification.Payload, &change); err != nil {
+				log.Printf("Dropping malformed %s bus notification: %v", notification.Type, err)
+				continue
+			}
+			if err := e.publish(ctx, notification.Type, &change); err != nil {
+				log.Printf("Failed to forward bus notification %d: %v", notification.ID, err)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
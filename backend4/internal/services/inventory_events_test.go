@@ -0,0 +1,55 @@
+package services_test
+
+import (
+	"context"
+	"ecommerce/internal/services"
+	"ecommerce/internal/testutils/mocks"
+	"ecommerce/pkg/odoo"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveChange(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("templates need no lookup", func(t *testing.T) {
+		eventType, change, err := services.ResolveChange(ctx, new(mocks.MockOdooClient), "product.template", []int64{3, 3, 4})
+		require.NoError(t, err)
+		assert.Equal(t, services.EventProductChanged, eventType)
+		assert.Equal(t, []int64{3, 4}, change.TemplateIDs)
+		assert.Empty(t, change.VariantIDs)
+	})
+
+	t.Run("quants resolve to their variants", func(t *testing.T) {
+		mockClient := new(mocks.MockOdooClient)
+		mockClient.On("NewOptions").Return(nil)
+		mockClient.On("Read", "stock.quant", []int64{7, 8}, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				// Fill the caller's slice with two quants of the same variant
+				records := reflect.ValueOf(args.Get(3)).Elem()
+				for _, id := range []int64{7, 8} {
+					record := reflect.New(records.Type().Elem()).Elem()
+					record.FieldByName("ID").SetInt(id)
+					record.FieldByName("Variant").Set(reflect.ValueOf(&odoo.Many2One{ID: 21}))
+					record.FieldByName("Template").Set(reflect.ValueOf(&odoo.Many2One{ID: 20}))
+					records.Set(reflect.Append(records, record))
+				}
+			}).
+			Return(nil)
+
+		eventType, change, err := services.ResolveChange(ctx, mockClient, "stock.quant", []int64{7, 8})
+		require.NoError(t, err)
+		assert.Equal(t, services.EventStockChanged, eventType)
+		assert.Equal(t, []int64{21}, change.VariantIDs)
+		assert.Equal(t, []int64{20}, change.TemplateIDs)
+	})
+
+	t.Run("other models are refused", func(t *testing.T) {
+		_, _, err := services.ResolveChange(ctx, new(mocks.MockOdooClient), "sale.order", []int64{1})
+		assert.ErrorIs(t, err, services.ErrUnsupportedModel)
+	})
+}
@@ -0,0 +1,412 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"ecommerce/internal/models"
+	"ecommerce/pkg/odoo"
+	"ecommerce/pkg/queue"
+	"ecommerce/pkg/redis"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvoiceNotAvailable is returned when Odoo has no posted invoice for an order yet
+var ErrInvoiceNotAvailable = errors.New("invoice not available")
+
+// Odoo payment states in which no further payment should be registered
+var settledPaymentStates = map[string]bool{
+	"paid":       true,
+	"in_payment": true,
+	"reversed":   true,
+}
+
+const invoiceReport = "account.report_invoice"
+
+// InvoiceService turns paid orders into posted, paid Odoo invoices and serves their PDFs
+type InvoiceService struct {
+	db          *gorm.DB
+	odooClient  odoo.OdooClient
+	redisClient *redis.Client
+	queueClient queue.Publisher
+	journalID   int64
+	pdfCacheTTL time.Duration
+}
+
+func NewInvoiceService(db *gorm.DB, odooClient odoo.OdooClient, redisClient *redis.Client, queueClient queue.Publisher, journalID int64, pdfCacheTTL time.Duration) *InvoiceService {
+	if pdfCacheTTL <= 0 {
+		pdfCacheTTL = 24 * time.Hour
+	}
+	return &InvoiceService{
+		db:          db,
+		odooClient:  odooClient,
+		redisClient: redisClient,
+		queueClient: queueClient,
+		journalID:   journalID,
+		pdfCacheTTL: pdfCacheTTL,
+	}
+}
+
+// HandleOrderEvent is a queue.ConsumerFunc for the orders queue. Checkouts only
+// become orders once Adyen reports their payment link as paid, whether the shopper
+// returns or the sweeper finds it, so order.created starts invoicing; orders whose
+// payment was only authorised wait for order.captured instead.
+// Failures are recorded on the order and retried by the invoice scheduler instead
+// of requeueing, which would spin on errors Odoo keeps returning.
+func (s *InvoiceService) HandleOrderEvent(msg queue.Message) error {
+	if msg.Type != "order.created" && msg.Type != EventOrderCaptured {
+		return nil
+	}
+
+	raw, err := json.Marshal(msg.Payload)
+	if err != nil {
+		return nil
+	}
+	var event models.Order
+	if err := json.Unmarshal(raw, &event); err != nil || event.ID == 0 {
+		log.Printf("Dropping order event without order: %v", err)
+		return nil
+	}
+
+	var order models.Order
+	if err := s.db.First(&order, event.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Dropping invoicing for unknown order %d", event.ID)
+			return nil
+		}
+		return fmt.Errorf("failed to fetch order: %w", err)
+	}
+	if order.CaptureStatus != "" && order.CaptureStatus != models.CaptureStatusCaptured {
+		return nil
+	}
+
+	s.invoice(context.Background(), &order)
+	return nil
+}
+
+// RetryFailed invoices orders whose previous attempt failed
+func (s *InvoiceService) RetryFailed(ctx context.Context) (int, error) {
+	var orders []models.Order
+	err := s.db.WithContext(ctx).Where("invoice_status = ?", models.InvoiceStatusFailed).Find(&orders).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch orders to invoice: %w", err)
+	}
+
+	invoiced := 0
+	for i := range orders {
+		if s.invoice(ctx, &orders[i]) {
+			invoiced++
+		}
+	}
+	return invoiced, nil
+}
+
+// invoice runs InvoiceOrder and records a failure for the retry sweep
+func (s *InvoiceService) invoice(ctx context.Context, order *models.Order) bool {
+	err := s.InvoiceOrder(ctx, order)
+	if err == nil {
+		return true
+	}
+
+	log.Printf("Failed to invoice order %d: %v", order.ID, err)
+	if err := s.db.Model(order).Update("invoice_status", models.InvoiceStatusFailed).Error; err != nil {
+		log.Printf("Failed to mark order %d for invoice retry: %v", order.ID, err)
+	}
+	return false
+}
+
+// InvoiceOrder confirms the order's sale.order if needed, creates and posts its
+// customer invoice and registers the Adyen payment against it. Every step checks
+// the current Odoo state first, so running it again after a failure is safe.
+func (s *InvoiceService) InvoiceOrder(ctx context.Context, order *models.Order) error {
+	if order.InvoiceStatus == models.InvoiceStatusPaid {
+		return nil
+	}
+	if order.OdooID == nil {
+		return fmt.Errorf("order %d has no Odoo sale order", order.ID)
+	}
+	saleOrderID := *order.OdooID
+
+	saleOrder, err := s.saleOrder(ctx, saleOrderID)
+	if err != nil {
+		return err
+	}
+
+	switch saleOrder.State {
+	case "cancel":
+		return fmt.Errorf("sale order %s is cancelled", saleOrder.Name)
+	case "draft", "sent":
+		if err := s.odooClient.ExecuteKw(ctx, "action_confirm", "sale.order", []interface{}{[]int64{saleOrderID}}, nil, nil); err != nil {
+			return fmt.Errorf("failed to confirm sale order %s: %w", saleOrder.Name, err)
+		}
+	}
+
+	invoice, err := s.customerInvoice(ctx, saleOrder)
+	if err != nil {
+		return err
+	}
+	if invoice == nil {
+		if err := s.createInvoice(ctx, saleOrderID); err != nil {
+			return err
+		}
+		if saleOrder, err = s.saleOrder(ctx, saleOrderID); err != nil {
+			return err
+		}
+		if invoice, err = s.customerInvoice(ctx, saleOrder); err != nil {
+			return err
+		}
+		if invoice == nil {
+			return fmt.Errorf("odoo created no invoice for sale order %s", saleOrder.Name)
+		}
+	}
+
+	if invoice.State == "draft" {
+		if err := s.odooClient.ExecuteKw(ctx, "action_post", "account.move", []interface{}{[]int64{invoice.ID}}, nil, nil); err != nil {
+			return fmt.Errorf("failed to post invoice %d: %w", invoice.ID, err)
+		}
+	}
+
+	err = s.db.WithContext(ctx).Model(order).Updates(map[string]interface{}{
+		"invoice_status":  models.InvoiceStatusPosted,
+		"odoo_invoice_id": invoice.ID,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update order invoice: %w", err)
+	}
+	order.InvoiceStatus = models.InvoiceStatusPosted
+	order.OdooInvoiceID = &invoice.ID
+
+	if !settledPaymentStates[invoice.PaymentState] {
+		if err := s.registerPayment(ctx, order, invoice); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(order).Updates(map[string]interface{}{
+			"invoice_status": models.InvoiceStatusPaid,
+			"invoiced_at":    now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return RecordOrderStatus(tx, order.ID, "paid", models.StatusSourcePayment, invoice.Name)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark order paid: %w", err)
+	}
+	order.InvoiceStatus = models.InvoiceStatusPaid
+	order.InvoicedAt = &now
+
+	s.publishPaid(ctx, order)
+	return nil
+}
+
+// GetInvoicePDF renders the posted customer invoices of the user's order as one PDF.
+// Rendered PDFs are cached per invoice and payment state, so a payment or a new
+// invoice changes the cache key while repeated downloads skip Odoo's renderer.
+func (s *InvoiceService) GetInvoicePDF(ctx context.Context, userID, orderID uint) ([]byte, string, error) {
+	var order models.Order
+	if err := s.db.WithContext(ctx).First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", ErrOrderNotFound
+		}
+		return nil, "", fmt.Errorf("failed to fetch order: %w", err)
+	}
+	if order.UserID != userID {
+		return nil, "", ErrOrderNotFound
+	}
+	if order.OdooID == nil {
+		return nil, "", ErrInvoiceNotAvailable
+	}
+
+	saleOrder, err := s.saleOrder(ctx, *order.OdooID)
+	if err != nil {
+		return nil, "", err
+	}
+	invoices, err := s.postedInvoices(ctx, saleOrder)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(invoices) == 0 {
+		return nil, "", ErrInvoiceNotAvailable
+	}
+
+	filename := fmt.Sprintf("invoice-%s.pdf", saleOrder.Name)
+	cacheKey := invoiceCacheKey(invoices)
+
+	var pdf []byte
+	if err := s.redisClient.Get(ctx, cacheKey, &pdf); err != nil {
+		log.Printf("Failed to read cached invoice for order %d: %v", order.ID, err)
+	}
+	if len(pdf) > 0 {
+		return pdf, filename, nil
+	}
+
+	ids := make([]int64, len(invoices))
+	for i, invoice := range invoices {
+		ids[i] = invoice.ID
+	}
+	pdf, err = s.odooClient.RenderReportPDF(ctx, invoiceReport, ids)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to render invoice: %w", err)
+	}
+
+	if err := s.redisClient.Set(ctx, cacheKey, pdf, s.pdfCacheTTL); err != nil {
+		log.Printf("Failed to cache invoice for order %d: %v", order.ID, err)
+	}
+
+	return pdf, filename, nil
+}
+
+// createInvoice runs the "Create invoice" wizard of the sale order. The
+// sale.order _create_invoices method is private and cannot be called over
+// RPC; the sale.advance.payment.inv wizard is the public way to reach it.
+func (s *InvoiceService) createInvoice(ctx context.Context, saleOrderID int64) error {
+	wizardContext := map[string]interface{}{
+		"active_model": "sale.order",
+		"active_id":    saleOrderID,
+		"active_ids":   []int64{saleOrderID},
+	}
+
+	values := map[string]interface{}{
+		"advance_payment_method": "delivered",
+		"sale_order_ids":         []interface{}{[]interface{}{6, 0, []int64{saleOrderID}}},
+	}
+	wizardID, err := s.createWizard(ctx, "sale.advance.payment.inv", values, wizardContext)
+	if err != nil {
+		return err
+	}
+
+	options := s.odooClient.NewOptions().Add("context", wizardContext)
+	if err := s.odooClient.ExecuteKw(ctx, "create_invoices", "sale.advance.payment.inv", []interface{}{[]int64{wizardID}}, options, nil); err != nil {
+		return fmt.Errorf("failed to create invoice for sale order %d: %w", saleOrderID, err)
+	}
+	return nil
+}
+
+// registerPayment records the Adyen payment on the invoice through the
+// account.payment.register wizard, which also reconciles it with the invoice.
+func (s *InvoiceService) registerPayment(ctx context.Context, order *models.Order, invoice *odoo.OdooInvoice) error {
+	wizardContext := map[string]interface{}{
+		"active_model": "account.move",
+		"active_id":    invoice.ID,
+		"active_ids":   []int64{invoice.ID},
+	}
+
+	values := map[string]interface{}{
+		"amount":        invoice.AmountTotal,
+		"payment_date":  order.CreatedAt.Format("2006-01-02"),
+		"communication": fmt.Sprintf("Adyen %s", order.PaymentID),
+	}
+	if s.journalID > 0 {
+		values["journal_id"] = s.journalID
+	}
+
+	wizardID, err := s.createWizard(ctx, "account.payment.register", values, wizardContext)
+	if err != nil {
+		return err
+	}
+
+	options := s.odooClient.NewOptions().Add("context", wizardContext)
+	if err := s.odooClient.ExecuteKw(ctx, "action_create_payments", "account.payment.register", []interface{}{[]int64{wizardID}}, options, nil); err != nil {
+		return fmt.Errorf("failed to register payment on invoice %s: %w", invoice.Name, err)
+	}
+	return nil
+}
+
+func (s *InvoiceService) createWizard(ctx context.Context, model string, values, wizardContext map[string]interface{}) (int64, error) {
+	options := s.odooClient.NewOptions().Add("context", wizardContext)
+	ids, err := s.odooClient.Create(ctx, model, []interface{}{values}, options)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", model, err)
+	}
+	if len(ids) != 1 {
+		return 0, fmt.Errorf("odoo returned %d %s records", len(ids), model)
+	}
+	return ids[0], nil
+}
+
+func (s *InvoiceService) saleOrder(ctx context.Context, saleOrderID int64) (*odoo.OdooSaleOrder, error) {
+	options := s.odooClient.NewOptions().FetchFields("id", "name", "state", "amount_total", "invoice_ids")
+
+	var orders []odoo.OdooSaleOrder
+	if err := s.odooClient.Read(ctx, "sale.order", []int64{saleOrderID}, options, &orders); err != nil {
+		return nil, fmt.Errorf("failed to fetch sale order %d: %w", saleOrderID, err)
+	}
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("sale order %d not found in Odoo", saleOrderID)
+	}
+	return &orders[0], nil
+}
+
+// customerInvoice returns the sale order's live customer invoice, if any
+func (s *InvoiceService) customerInvoice(ctx context.Context, saleOrder *odoo.OdooSaleOrder) (*odoo.OdooInvoice, error) {
+	invoices, err := s.invoices(ctx, saleOrder, "state", "!=", "cancel")
+	if err != nil || len(invoices) == 0 {
+		return nil, err
+	}
+	return &invoices[0], nil
+}
+
+func (s *InvoiceService) postedInvoices(ctx context.Context, saleOrder *odoo.OdooSaleOrder) ([]odoo.OdooInvoice, error) {
+	return s.invoices(ctx, saleOrder, "state", "=", "posted")
+}
+
+func (s *InvoiceService) invoices(ctx context.Context, saleOrder *odoo.OdooSaleOrder, field, operator string, value interface{}) ([]odoo.OdooInvoice, error) {
+	if len(saleOrder.InvoiceIDs) == 0 {
+		return nil, nil
+	}
+
+	criteria := s.odooClient.NewCriteria().
+		Add("id", "in", saleOrder.InvoiceIDs).
+		Add("move_type", "=", "out_invoice").
+		Add(field, operator, value)
+	options := s.odooClient.NewOptions().
+		FetchFields("id", "name", "state", "move_type", "payment_state", "amount_total", "invoice_date").
+		Add("order", "id")
+
+	var invoices []odoo.OdooInvoice
+	if err := s.odooClient.SearchRead(ctx, "account.move", criteria, options, &invoices); err != nil {
+		if errors.Is(err, odoo.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to fetch invoices of %s: %w", saleOrder.Name, err)
+	}
+	return invoices, nil
+}
+
+func (s *InvoiceService) publishPaid(ctx context.Context, order *models.Order) {
+	var payload models.Order
+	if err := s.db.WithContext(ctx).Preload("Items").First(&payload, order.ID).Error; err != nil {
+		log.Printf("Failed to load order %d for paid event: %v", order.ID, err)
+		return
+	}
+
+	msg := queue.Message{
+		ID:      fmt.Sprintf("order.paid:%d", order.ID),
+		Type:    "order.paid",
+		Payload: payload,
+	}
+	if err := s.queueClient.Publish(ctx, "orders", msg); err != nil {
+		log.Printf("Failed to publish order paid event for order %d: %v", order.ID, err)
+	}
+	if err := s.queueClient.Publish(ctx, "notifications", msg); err != nil {
+		log.Printf("Failed to publish payment notification for order %d: %v", order.ID, err)
+	}
+}
+
+func invoiceCacheKey(invoices []odoo.OdooInvoice) string {
+	hash := sha256.New()
+	for _, invoice := range invoices {
+		fmt.Fprintf(hash, "%d:%s:%s;", invoice.ID, invoice.State, invoice.PaymentState)
+	}
+	return "invoice_pdf:" + hex.EncodeToString(hash.Sum(nil))[:32]
+}
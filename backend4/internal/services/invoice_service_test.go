@@ -0,0 +1,127 @@
+package services_test
+
+import (
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"ecommerce/internal/testutils/mocks"
+	"ecommerce/pkg/odoo"
+	"ecommerce/pkg/queue"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var orderColumns = []string{"id", "odoo_id", "user_id", "status", "total", "currency", "payment_id", "capture_status", "invoice_status", "created_at"}
+
+func orderRow(captureStatus, invoiceStatus string) *sqlmock.Rows {
+	return sqlmock.NewRows(orderColumns).
+		AddRow(7, 5, 1, "pending", 99.0, "EUR", "PL123", captureStatus, invoiceStatus, time.Now())
+}
+
+func expectOrder(sqlMock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "orders" WHERE "orders"."id" = $1`)).
+		WithArgs(7, 1).
+		WillReturnRows(rows)
+}
+
+func newInvoiceService(t *testing.T) (*services.InvoiceService, sqlmock.Sqlmock, *mocks.MockOdooClient, *mocks.MockPublisher) {
+	db, sqlMock := mocks.NewDB(t)
+	odooClient := new(mocks.MockOdooClient)
+	odooClient.On("NewOptions").Return(nil).Maybe()
+	odooClient.On("NewCriteria").Return(nil).Maybe()
+	publisher := new(mocks.MockPublisher)
+	t.Cleanup(func() {
+		odooClient.AssertExpectations(t)
+		publisher.AssertExpectations(t)
+	})
+	return services.NewInvoiceService(db, odooClient, nil, publisher, 0, 0), sqlMock, odooClient, publisher
+}
+
+func TestHandleOrderEvent(t *testing.T) {
+	event := func(eventType string) queue.Message {
+		return queue.Message{Type: eventType, Payload: models.Order{ID: 7}}
+	}
+
+	t.Run("authorised order waits for its capture", func(t *testing.T) {
+		service, sqlMock, odooClient, _ := newInvoiceService(t)
+		expectOrder(sqlMock, orderRow(models.CaptureStatusAuthorised, ""))
+
+		require.NoError(t, service.HandleOrderEvent(event("order.created")))
+		odooClient.AssertNotCalled(t, "Read", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("order already paid is not invoiced again", func(t *testing.T) {
+		service, sqlMock, odooClient, _ := newInvoiceService(t)
+		expectOrder(sqlMock, orderRow(models.CaptureStatusCaptured, models.InvoiceStatusPaid))
+
+		require.NoError(t, service.HandleOrderEvent(event(services.EventOrderCaptured)))
+		odooClient.AssertNotCalled(t, "Read", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("other events are ignored", func(t *testing.T) {
+		service, _, _, _ := newInvoiceService(t)
+		require.NoError(t, service.HandleOrderEvent(event("order.allocated")))
+	})
+
+	t.Run("captured order is invoiced and paid", func(t *testing.T) {
+		service, sqlMock, odooClient, publisher := newInvoiceService(t)
+		expectOrder(sqlMock, orderRow(models.CaptureStatusCaptured, ""))
+
+		odooClient.On("Read", "sale.order", []int64{5}, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				*args.Get(3).(*[]odoo.OdooSaleOrder) = []odoo.OdooSaleOrder{{ID: 5, Name: "S00005", State: "sale", InvoiceIDs: []int64{9}}}
+			}).Return(nil)
+		odooClient.On("SearchRead", "account.move", mock.Anything, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				*args.Get(3).(*[]odoo.OdooInvoice) = []odoo.OdooInvoice{{ID: 9, Name: "INV/9", State: "posted", PaymentState: "not_paid", AmountTotal: 99}}
+			}).Return(nil)
+		odooClient.On("Create", "account.payment.register", mock.MatchedBy(func(values []interface{}) bool {
+			return values[0].(map[string]interface{})["amount"] == 99.0
+		}), mock.Anything).Return([]int64{3}, nil)
+		odooClient.On("ExecuteKw", "action_create_payments", "account.payment.register", []interface{}{[]int64{3}}, mock.Anything, mock.Anything).Return(nil)
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(regexp.QuoteMeta(`UPDATE "orders" SET "invoice_status"=$1,"odoo_invoice_id"=$2`)).
+			WithArgs(models.InvoiceStatusPosted, 9, sqlmock.AnyArg(), 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectCommit()
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(regexp.QuoteMeta(`UPDATE "orders" SET "invoice_status"=$1,"invoiced_at"=$2`)).
+			WithArgs(models.InvoiceStatusPaid, sqlmock.AnyArg(), sqlmock.AnyArg(), 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "order_status_events"`)).
+			WithArgs(7, "paid", models.StatusSourcePayment, "INV/9", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		sqlMock.ExpectCommit()
+		expectOrder(sqlMock, orderRow(models.CaptureStatusCaptured, models.InvoiceStatusPaid))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "order_items" WHERE "order_items"."order_id" = $1`)).
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}))
+
+		paid := mock.MatchedBy(func(msg queue.Message) bool { return msg.Type == "order.paid" })
+		publisher.On("Publish", "orders", paid).Return(nil)
+		publisher.On("Publish", "notifications", paid).Return(nil)
+
+		require.NoError(t, service.HandleOrderEvent(event(services.EventOrderCaptured)))
+	})
+
+	t.Run("failure is left for the retry sweep", func(t *testing.T) {
+		service, sqlMock, odooClient, _ := newInvoiceService(t)
+		expectOrder(sqlMock, orderRow("", ""))
+
+		odooClient.On("Read", "sale.order", []int64{5}, mock.Anything, mock.Anything).Return(errors.New("odoo is down"))
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(regexp.QuoteMeta(`UPDATE "orders" SET "invoice_status"=$1`)).
+			WithArgs(models.InvoiceStatusFailed, sqlmock.AnyArg(), 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectCommit()
+
+		require.NoError(t, service.HandleOrderEvent(event("order.created")))
+		odooClient.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
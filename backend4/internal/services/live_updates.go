@@ -0,0 +1,331 @@
+package services
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/pkg/queue"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Names of the events streamed to browsers
+const (
+	LiveEventStock = "stock"
+	LiveEventOrder = "order"
+)
+
+// liveBuffer is how many events a subscriber may fall behind before it is
+// dropped; it then reconnects and catches up from the replay
+const liveBuffer = 64
+
+// maxCatchUps bounds how many streams rebuild what they missed from the
+// database at once. Anyone may open a stream, so the rest wait their turn.
+const maxCatchUps = 4
+
+var ErrLiveClosed = errors.New("live updates are shutting down")
+
+// LiveEvent is an update streamed to browsers. IDs are milliseconds since the
+// Unix epoch, made unique per replica. Every replica sees every update, so a
+// client that reconnects to another replica can still say how far it got.
+type LiveEvent struct {
+	ID        int64
+	Event     string
+	ProductID int64 // Product template of a stock event
+	UserID    uint  // Owner of the order of an order event
+	Data      interface{}
+}
+
+// StockUpdate is the availability of a product's variants after a change
+type StockUpdate struct {
+	ProductID int64                 `json:"product_id"`
+	Variants  []models.Availability `json:"variants"`
+}
+
+// OrderUpdate is the status of an order after a change, with the progress
+// of its made-to-order items and of units waiting for stock
+type OrderUpdate struct {
+	OrderID             uint                        `json:"order_id"`
+	Status              string                      `json:"status"`
+	FulfillmentStatus   string                      `json:"fulfillment_status"`
+	InvoiceStatus       string                      `json:"invoice_status,omitempty"`
+	TrackingNumber      string                      `json:"tracking_number,omitempty"`
+	TrackingURL         string                      `json:"tracking_url,omitempty"`
+	EstimatedShipDate   *time.Time                  `json:"estimated_ship_date,omitempty"`
+	ManufacturingOrders []models.ManufacturingOrder `json:"manufacturing_orders,omitempty"`
+	Backorders          []models.Backorder          `json:"backorders,omitempty"`
+	UpdatedAt           time.Time                   `json:"updated_at"`
+}
+
+// LiveSubscription is one client's stream. Events is closed when the client
+// fell too far behind.
+type LiveSubscription struct {
+	userID   uint
+	products map[int64]bool
+	events   chan LiveEvent
+}
+
+func (s *LiveSubscription) Events() <-chan LiveEvent {
+	return s.events
+}
+
+func (s *LiveSubscription) wants(event LiveEvent) bool {
+	if event.ProductID != 0 {
+		return s.products[event.ProductID]
+	}
+	return event.UserID != 0 && event.UserID == s.userID
+}
+
+// LiveUpdates fans the inventory and orders queues out to browsers: the stock
+// of products they watch and the status of their own orders
+type LiveUpdates struct {
+	db           *gorm.DB
+	stockService *StockService
+	replaySize   int
+
+	catchUps chan struct{} // One token per catch-up in progress
+
+	mu            sync.Mutex
+	closed        bool
+	lastID        int64
+	replayFrom    int64 // Events after this ID are all in recent
+	recent        []LiveEvent
+	subscriptions map[*LiveSubscription]bool
+}
+
+func NewLiveUpdates(db *gorm.DB, stockService *StockService, replaySize int) *LiveUpdates {
+	if replaySize <= 0 {
+		replaySize = 1000
+	}
+	now := time.Now().UnixMilli()
+	return &LiveUpdates{
+		db:            db,
+		stockService:  stockService,
+		replaySize:    replaySize,
+		catchUps:      make(chan struct{}, maxCatchUps),
+		lastID:        now,
+		replayFrom:    now,
+		subscriptions: make(map[*LiveSubscription]bool),
+	}
+}
+
+// Subscribe opens a stream of the stock of products and, for a signed-in
+// user, of the status of their orders. It returns the events the client
+// missed after lastEventID, 0 for a new client: those still in memory, or
+// else the current stock of the products and the orders changed since.
+func (l *LiveUpdates) Subscribe(ctx context.Context, userID uint, productIDs []int64, lastEventID int64) (*LiveSubscription, []LiveEvent, error) {
+	sub := &LiveSubscription{
+		userID:   userID,
+		products: make(map[int64]bool, len(productIDs)),
+		events:   make(chan LiveEvent, liveBuffer),
+	}
+	for _, id := range productIDs {
+		sub.products[id] = true
+	}
+
+	// Registering and taking the backlog at once loses and repeats nothing
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, nil, ErrLiveClosed
+	}
+	l.subscriptions[sub] = true
+	var backlog []LiveEvent
+	replayed := lastEventID == 0 || lastEventID >= l.replayFrom
+	if lastEventID != 0 && replayed {
+		for _, event := range l.recent {
+			if event.ID > lastEventID && sub.wants(event) {
+				backlog = append(backlog, event)
+			}
+		}
+	}
+	caughtUpTo := l.lastID
+	l.mu.Unlock()
+	if replayed {
+		return sub, backlog, nil
+	}
+
+	backlog, err := l.catchUp(ctx, sub, lastEventID, caughtUpTo)
+	if err != nil {
+		l.Unsubscribe(sub)
+		return nil, nil, err
+	}
+	return sub, backlog, nil
+}
+
+// catchUp rebuilds what a client missed from the database, for gaps older
+// than the replay. The events all carry the ID the stream resumes from.
+func (l *LiveUpdates) catchUp(ctx context.Context, sub *LiveSubscription, lastEventID, id int64) ([]LiveEvent, error) {
+	select {
+	case l.catchUps <- struct{}{}:
+		defer func() { <-l.catchUps }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	var events []LiveEvent
+	for productID := range sub.products {
+		update, err := l.stockUpdate(ctx, productID)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, LiveEvent{ID: id, Event: LiveEventStock, ProductID: productID, Data: update})
+	}
+
+	if sub.userID != 0 {
+		var orders []models.Order
+		err := l.db.WithContext(ctx).
+			Where("user_id = ? AND updated_at > ?", sub.userID, time.UnixMilli(lastEventID)).
+			Preload("ManufacturingOrders").Preload("Backorders").
+			Order("updated_at").Find(&orders).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch changed orders: %w", err)
+		}
+		for i := range orders {
+			events = append(events, LiveEvent{ID: id, Event: LiveEventOrder, UserID: sub.userID, Data: orderUpdate(&orders[i])})
+		}
+	}
+	return events, nil
+}
+
+// Unsubscribe ends a stream
+func (l *LiveUpdates) Unsubscribe(sub *LiveSubscription) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.subscriptions[sub] {
+		delete(l.subscriptions, sub)
+		close(sub.events)
+	}
+}
+
+// Close ends every stream and refuses new ones, so that open streams do not
+// hold up a graceful shutdown
+func (l *LiveUpdates) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	for sub := range l.subscriptions {
+		delete(l.subscriptions, sub)
+		close(sub.events)
+	}
+}
+
+// HandleInventoryEvent subscribes to the inventory queue and streams the new
+// availability of watched products once their stock levels are updated
+func (l *LiveUpdates) HandleInventoryEvent(msg queue.Message) error {
+	if msg.Type != EventStockUpdated {
+		return nil
+	}
+	var change models.ProductChange
+	if err := decodePayload(msg.Payload, &change); err != nil {
+		log.Printf("Dropping malformed %s event: %v", msg.Type, err)
+		return nil
+	}
+
+	ctx := context.Background()
+	for _, productID := range l.watched(change.TemplateIDs) {
+		update, err := l.stockUpdate(ctx, productID)
+		if err != nil {
+			return err
+		}
+		l.publish(LiveEvent{Event: LiveEventStock, ProductID: productID, Data: update})
+	}
+	return nil
+}
+
+// HandleOrderEvent subscribes to the orders queue and streams the status of
+// every order that changed to its owner
+func (l *LiveUpdates) HandleOrderEvent(msg queue.Message) error {
+	var order models.Order
+	if err := decodePayload(msg.Payload, &order); err != nil {
+		log.Printf("Dropping malformed %s event: %v", msg.Type, err)
+		return nil
+	}
+	if order.ID == 0 || order.UserID == 0 {
+		return nil
+	}
+	l.publish(LiveEvent{Event: LiveEventOrder, UserID: order.UserID, Data: orderUpdate(&order)})
+	return nil
+}
+
+// watched returns the products some subscriber watches
+func (l *LiveUpdates) watched(productIDs []int64) []int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var watched []int64
+	for _, id := range uniqueIDs(productIDs) {
+		for sub := range l.subscriptions {
+			if sub.products[id] {
+				watched = append(watched, id)
+				break
+			}
+		}
+	}
+	return watched
+}
+
+// publish numbers an event, keeps it for replay and sends it to the
+// subscribers it concerns. Subscribers too far behind are dropped rather
+// than holding up the rest.
+func (l *LiveUpdates) publish(event LiveEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	event.ID = max(time.Now().UnixMilli(), l.lastID+1)
+	l.lastID = event.ID
+	if len(l.recent) == l.replaySize {
+		l.replayFrom = l.recent[0].ID
+		l.recent = append(l.recent[:0], l.recent[1:]...)
+	}
+	l.recent = append(l.recent, event)
+
+	for sub := range l.subscriptions {
+		if !sub.wants(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			delete(l.subscriptions, sub)
+			close(sub.events)
+		}
+	}
+}
+
+func (l *LiveUpdates) stockUpdate(ctx context.Context, productID int64) (StockUpdate, error) {
+	variants, err := l.stockService.ProductAvailability(ctx, productID, "", 1)
+	if err != nil {
+		return StockUpdate{}, err
+	}
+	return StockUpdate{ProductID: productID, Variants: variants}, nil
+}
+
+func orderUpdate(order *models.Order) OrderUpdate {
+	return OrderUpdate{
+		OrderID:             order.ID,
+		Status:              order.Status,
+		FulfillmentStatus:   order.FulfillmentStatus,
+		InvoiceStatus:       order.InvoiceStatus,
+		TrackingNumber:      order.TrackingNumber,
+		TrackingURL:         order.TrackingURL,
+		EstimatedShipDate:   order.EstimatedShipDate,
+		ManufacturingOrders: order.ManufacturingOrders,
+		Backorders:          order.Backorders,
+		UpdatedAt:           order.UpdatedAt,
+	}
+}
+
+// decodePayload converts a queue message payload, decoded as generic JSON,
+// into v
+func decodePayload(payload interface{}, v interface{}) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
@@ -0,0 +1,89 @@
+package services_test
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"ecommerce/internal/testutils/mocks"
+	"ecommerce/pkg/queue"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiveUpdatesOrders(t *testing.T) {
+	ctx := context.Background()
+	live := services.NewLiveUpdates(nil, nil, 10)
+	orderEvent := func(id, userID uint, status string) queue.Message {
+		return queue.Message{Type: "order.paid", Payload: models.Order{ID: id, UserID: userID, Status: status}}
+	}
+
+	sub, backlog, err := live.Subscribe(ctx, 7, nil, 0)
+	require.NoError(t, err)
+	assert.Empty(t, backlog)
+
+	require.NoError(t, live.HandleOrderEvent(orderEvent(1, 8, "paid")))
+	require.NoError(t, live.HandleOrderEvent(orderEvent(2, 7, "paid")))
+	first := <-sub.Events()
+	assert.Equal(t, services.LiveEventOrder, first.Event)
+	assert.Equal(t, uint(2), first.Data.(services.OrderUpdate).OrderID)
+	assert.Empty(t, sub.Events(), "orders of other shoppers are not sent")
+
+	t.Run("reconnecting replays what was missed", func(t *testing.T) {
+		require.NoError(t, live.HandleOrderEvent(orderEvent(2, 7, "shipped")))
+		second := <-sub.Events()
+		assert.Greater(t, second.ID, first.ID)
+
+		resumed, backlog, err := live.Subscribe(ctx, 7, nil, first.ID)
+		require.NoError(t, err)
+		defer live.Unsubscribe(resumed)
+		require.Len(t, backlog, 1)
+		assert.Equal(t, second.ID, backlog[0].ID)
+		assert.Equal(t, "shipped", backlog[0].Data.(services.OrderUpdate).Status)
+	})
+
+	t.Run("unsubscribing closes the stream", func(t *testing.T) {
+		live.Unsubscribe(sub)
+		_, open := <-sub.Events()
+		assert.False(t, open)
+	})
+}
+
+func TestLiveUpdatesClose(t *testing.T) {
+	ctx := context.Background()
+	live := services.NewLiveUpdates(nil, nil, 10)
+	sub, _, err := live.Subscribe(ctx, 7, nil, 0)
+	require.NoError(t, err)
+
+	live.Close()
+	_, open := <-sub.Events()
+	assert.False(t, open, "open streams end")
+	_, _, err = live.Subscribe(ctx, 7, nil, 0)
+	assert.ErrorIs(t, err, services.ErrLiveClosed)
+	live.Unsubscribe(sub)
+}
+
+func TestStreamTickets(t *testing.T) {
+	ctx := context.Background()
+	redisClient, server := mocks.NewRedis(t)
+	tickets := services.NewStreamTickets(redisClient)
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	ticket, err := tickets.Issue(ctx, 7, expiresAt)
+	require.NoError(t, err)
+	redeemed, err := tickets.Redeem(ctx, ticket)
+	require.NoError(t, err)
+	assert.Equal(t, uint(7), redeemed.UserID)
+	assert.True(t, expiresAt.Equal(redeemed.ExpiresAt))
+
+	_, err = tickets.Redeem(ctx, ticket)
+	assert.ErrorIs(t, err, services.ErrInvalidTicket, "tickets open one stream")
+
+	unused, err := tickets.Issue(ctx, 7, expiresAt)
+	require.NoError(t, err)
+	server.FastForward(time.Minute)
+	_, err = tickets.Redeem(ctx, unused)
+	assert.ErrorIs(t, err, services.ErrInvalidTicket, "tickets expire")
+}
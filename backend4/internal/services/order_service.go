@@ -6,19 +6,38 @@ import (
 	"ecommerce/pkg/odoo"
 	"ecommerce/pkg/queue"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/streadway/amqp"
 	"gorm.io/gorm"
 )
 
+// ErrOrderNotFound is returned for orders that do not exist or belong to someone else
+var ErrOrderNotFound = errors.New("order not found")
+
+// Order history page sizes
+const (
+	defaultOrderPageSize = 20
+	maxOrderPageSize     = 100
+)
+
+// odooOrderStates maps sale.order states to local order statuses.
+// Draft and sent quotations leave the local status untouched.
+var odooOrderStates = map[string]string{
+	"sale":   "confirmed",
+	"done":   "completed",
+	"cancel": "cancelled",
+}
+
 type OrderService struct {
 	rabbitmqConn *amqp.Connection
-	odooClient   *odoo.Client
+	odooClient   odoo.OdooClient
 	db           *gorm.DB // Added missing db field
 }
 
-func NewOrderService(queueClient *queue.Client, odooClient *odoo.Client, db *gorm.DB) *OrderService {
+func NewOrderService(queueClient *queue.Client, odooClient odoo.OdooClient, db *gorm.DB) *OrderService {
 	return &OrderService{
 		rabbitmqConn: queueClient.ReturnConnection(),
 		odooClient:   odooClient,
@@ -26,19 +45,26 @@ func NewOrderService(queueClient *queue.Client, odooClient *odoo.Client, db *gor
 	}
 }
 
-func (s *OrderService) CreateOrder(order *models.Order) (*models.Order, error) {
-	// Create order in Odoo
-	orderData := []interface{}{
-		map[string]interface{}{
-			"partner_id":   order.UserID,
-			"state":        "draft",
-			"amount_total": order.Total,
-		},
+func (s *OrderService) CreateOrder(ctx context.Context, order *models.Order) (*models.Order, error) {
+	// Create order in Odoo, with its lines so it can be invoiced later
+	values := map[string]interface{}{
+		"partner_id":   order.UserID,
+		"state":        "draft",
+		"amount_total": order.Total,
+		"order_line":   orderLines(order.Items),
+	}
+	if order.WarehouseID != nil {
+		values["warehouse_id"] = *order.WarehouseID
 	}
+	if order.EstimatedShipDate != nil {
+		// Odoo schedules deliveries, and manufacturing for them, from it
+		values["commitment_date"] = odoo.FormatDateTime(*order.EstimatedShipDate)
+	}
+	orderData := []interface{}{values}
 
 	options := s.odooClient.NewOptions()
 
-	odooOrderIDs, err := s.odooClient.Create("sale.order", orderData, options)
+	odooOrderIDs, err := s.odooClient.Create(ctx, "sale.order", orderData, options)
 	if err != nil {
 		return nil, err
 	}
@@ -69,48 +95,218 @@ func (s *OrderService) CreateOrder(order *models.Order) (*models.Order, error) {
 		return nil, err
 	}
 
-	// Assuming models.Order has ID field of type uint
 	if len(odooOrderIDs) > 0 {
-		order.ID = uint(odooOrderIDs[0]) // Store the Odoo ID separately
-		order.ID = uint(1)               // You might want to generate this differently
+		order.OdooID = &odooOrderIDs[0]
+	}
+
+	// Persist locally so payments and status lookups can find the order
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		return RecordOrderStatus(tx, order.ID, order.Status, models.StatusSourceCheckout, "")
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save order: %w", err)
 	}
 
 	return order, nil
 }
 
+// ListOrders returns a page of the user's orders, newest first, with the total count
+func (s *OrderService) ListOrders(ctx context.Context, userID uint, filter models.OrderFilter) ([]models.Order, int64, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultOrderPageSize
+	}
+	if filter.Limit > maxOrderPageSize {
+		filter.Limit = maxOrderPageSize
+	}
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.Order{}).Where("user_id = ?", userID)
+	if len(filter.Statuses) > 0 {
+		query = query.Where("status IN ?", filter.Statuses)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count orders: %w", err)
+	}
+
+	var orders []models.Order
+	err := query.Preload("Items").
+		Order("created_at DESC").
+		Offset((filter.Page - 1) * filter.Limit).
+		Limit(filter.Limit).
+		Find(&orders).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch orders: %w", err)
+	}
+
+	return orders, total, nil
+}
+
+// GetOrderDetail returns the user's order with payments, shipments and status history.
+// Orders of other users are reported as not found so their IDs cannot be probed.
+func (s *OrderService) GetOrderDetail(ctx context.Context, userID, orderID uint) (*models.OrderDetail, error) {
+	// Scoped to the user before Odoo is asked about it or its status is touched
+	order, err := s.findOrder(ctx, s.db.Where("id = ? AND user_id = ?", orderID, userID))
+	if err != nil {
+		return nil, err
+	}
+	saleOrder := s.refreshOrder(ctx, order)
+
+	detail := &models.OrderDetail{Order: *order}
+
+	var records []models.SettlementRecord
+	err = s.db.WithContext(ctx).
+		Where("order_id = ? AND status IN ?", order.ID,
+			[]string{models.SettlementStatusMatched, models.SettlementStatusPosted}).
+		Order("booked_at").
+		Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payments: %w", err)
+	}
+	detail.Payments = make([]models.OrderPayment, 0, len(records))
+	for _, record := range records {
+		detail.Payments = append(detail.Payments, models.OrderPayment{
+			Type:          paymentType(record.Type),
+			Amount:        record.GrossAmount,
+			Currency:      record.Currency,
+			PaymentMethod: record.PaymentMethod,
+			Reference:     record.PspReference,
+			Date:          record.BookedAt,
+		})
+	}
+
+	err = s.db.WithContext(ctx).
+		Where("order_id = ?", order.ID).
+		Order("created_at, id").
+		Find(&detail.StatusHistory).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch status history: %w", err)
+	}
+
+	detail.InvoiceAvailable = saleOrder != nil && len(saleOrder.InvoiceIDs) > 0
+
+	return detail, nil
+}
+
+// orderLines builds the one2many create commands for sale.order.line.
+// Variant IDs are Odoo product.product IDs. Bundles go as the kit product,
+// at the bundle price; Odoo explodes its phantom bill of materials into the
+// component moves of the delivery.
+func orderLines(items []models.OrderItem) []interface{} {
+	lines := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if item.VariantID == 0 {
+			continue
+		}
+		lines = append(lines, []interface{}{0, 0, map[string]interface{}{
+			"product_id":      item.VariantID,
+			"product_uom_qty": item.Quantity,
+			"price_unit":      item.Price,
+		}})
+	}
+	return lines
+}
+
+// RecordOrderStatus appends an entry to the order's status history
+func RecordOrderStatus(db *gorm.DB, orderID uint, status, source, note string) error {
+	event := models.OrderStatusEvent{
+		OrderID:   orderID,
+		Status:    status,
+		Source:    source,
+		Note:      note,
+		CreatedAt: time.Now(),
+	}
+	if err := db.Create(&event).Error; err != nil {
+		return fmt.Errorf("failed to record order status: %w", err)
+	}
+	return nil
+}
+
+// paymentType turns an Adyen settlement record type into a customer-facing label
+func paymentType(recordType string) string {
+	switch recordType {
+	case models.SettlementTypeSettled:
+		return "payment"
+	case models.SettlementTypeRefunded:
+		return "refund"
+	case models.SettlementTypeChargeback, models.SettlementTypeSecondChargeback:
+		return "chargeback"
+	case models.SettlementTypeChargebackReversed:
+		return "chargeback_reversed"
+	default:
+		return recordType
+	}
+}
+
 func (s *OrderService) GetOrder(ctx context.Context, orderID uint) (*models.Order, error) {
-	// First try to get from local database
+	order, err := s.findOrder(ctx, s.db.Where("id = ?", orderID))
+	if err != nil {
+		return nil, err
+	}
+	s.refreshOrder(ctx, order)
+	return order, nil
+}
+
+// findOrder reads the local order matched by query, with its lines and fulfillment
+func (s *OrderService) findOrder(ctx context.Context, query *gorm.DB) (*models.Order, error) {
 	var order models.Order
-	result := s.db.Preload("Items").First(&order, orderID)
+	result := query.WithContext(ctx).Preload("Items").Preload("Shipments").Preload("ManufacturingOrders").Preload("Backorders").First(&order)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("order not found")
+			return nil, ErrOrderNotFound
 		}
 		return nil, fmt.Errorf("failed to fetch order: %w", result.Error)
 	}
+	return &order, nil
+}
+
+// refreshOrder updates the order's status from Odoo and returns its sale order,
+// nil when the order is not in Odoo or Odoo could not be reached
+func (s *OrderService) refreshOrder(ctx context.Context, order *models.Order) *odoo.OdooSaleOrder {
+	if order.OdooID == nil {
+		return nil
+	}
 
 	// If order has Odoo ID, fetch latest status from Odoo
-	if order.ID > 0 {
-		odooOrders, err := s.getOdooOrder(int64(order.ID))
-		if err != nil {
-			// Log the error but don't fail the request
-			// We can still return the local order data
-			fmt.Printf("failed to fetch order from Odoo: %v\n", err)
-		} else {
-			// Update local order status if it differs
-			if odooOrders[0].Status != order.Status {
-				order.Status = odooOrders[0].Status
-				s.db.Save(&order)
-			}
+	saleOrder, err := s.getOdooOrder(ctx, *order.OdooID)
+	if err != nil {
+		// Log the error but don't fail the request
+		// We can still return the local order data
+		fmt.Printf("failed to fetch order from Odoo: %v\n", err)
+		return nil
+	}
 
+	// Update local order status if it differs
+	if status, ok := odooOrderStates[saleOrder.State]; ok && status != order.Status {
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(order).Update("status", status).Error; err != nil {
+				return err
+			}
+			return RecordOrderStatus(tx, order.ID, status, models.StatusSourceOdoo, "")
+		})
+		if err != nil {
+			fmt.Printf("failed to update order status: %v\n", err)
 		}
+		order.Status = status
 	}
 
-	return &order, nil
+	return saleOrder
 }
 
 // Helper method to fetch order from Odoo
-func (s *OrderService) getOdooOrder(odooID int64) ([]models.Order, error) {
+func (s *OrderService) getOdooOrder(ctx context.Context, odooID int64) (*odoo.OdooSaleOrder, error) {
 	criteria := s.odooClient.NewCriteria().Add("id", "=", odooID)
 
 	options := s.odooClient.NewOptions().
@@ -118,19 +314,18 @@ func (s *OrderService) getOdooOrder(odooID int64) ([]models.Order, error) {
 			"name",
 			"state",
 			"amount_total",
-			"date_order",
-			"partner_id",
+			"invoice_ids",
 		)
 
-	var order []models.Order
-	err := s.odooClient.SearchRead("sale.order", criteria, options, &order)
+	var orders []odoo.OdooSaleOrder
+	err := s.odooClient.SearchRead(ctx, "sale.order", criteria, options, &orders)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch order from Odoo: %w", err)
 	}
 
-	if len(order) == 0 {
+	if len(orders) == 0 {
 		return nil, fmt.Errorf("order not found in Odoo")
 	}
 
-	return order, nil
+	return &orders[0], nil
 }
@@ -0,0 +1,75 @@
+package services_test
+
+import (
+	"context"
+	"ecommerce/internal/services"
+	"ecommerce/internal/testutils/mocks"
+	"ecommerce/pkg/odoo"
+	"ecommerce/pkg/queue"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newOrderService(t *testing.T) (*services.OrderService, sqlmock.Sqlmock, *mocks.MockOdooClient) {
+	db, sqlMock := mocks.NewDB(t)
+	odooClient := new(mocks.MockOdooClient)
+	odooClient.On("NewOptions").Return(nil).Maybe()
+	odooClient.On("NewCriteria").Return(nil).Maybe()
+	t.Cleanup(func() { odooClient.AssertExpectations(t) })
+	return services.NewOrderService(new(queue.Client), odooClient, db), sqlMock, odooClient
+}
+
+// expectUserOrder expects user 1's order 7 to be looked up, returning rows
+func expectUserOrder(sqlMock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "orders" WHERE id = $1 AND user_id = $2`)).
+		WithArgs(7, 1, 1).
+		WillReturnRows(rows)
+}
+
+func TestGetOrderDetail(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("order of another user is not found", func(t *testing.T) {
+		service, sqlMock, odooClient := newOrderService(t)
+		expectUserOrder(sqlMock, sqlmock.NewRows(orderColumns))
+
+		_, err := service.GetOrderDetail(ctx, 1, 7)
+		assert.ErrorIs(t, err, services.ErrOrderNotFound)
+		odooClient.AssertNotCalled(t, "SearchRead", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("own order is refreshed from Odoo", func(t *testing.T) {
+		service, sqlMock, odooClient := newOrderService(t)
+		expectUserOrder(sqlMock, orderRow("", ""))
+		for _, table := range []string{"backorders", "order_items", "manufacturing_orders", "shipments"} {
+			sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "` + table + `"`)).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		}
+		odooClient.On("SearchRead", "sale.order", mock.Anything, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				*args.Get(3).(*[]odoo.OdooSaleOrder) = []odoo.OdooSaleOrder{{ID: 5, State: "sale", InvoiceIDs: []int64{9}}}
+			}).
+			Return(nil).Once()
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectExec(regexp.QuoteMeta(`UPDATE "orders" SET "status"=$1`)).
+			WithArgs("confirmed", sqlmock.AnyArg(), 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "order_status_events"`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		sqlMock.ExpectCommit()
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "settlement_records"`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "order_status_events"`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		detail, err := service.GetOrderDetail(ctx, 1, 7)
+		require.NoError(t, err)
+		assert.Equal(t, "confirmed", detail.Status)
+		assert.True(t, detail.InvoiceAvailable)
+	})
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/pkg/adyen"
+	"ecommerce/pkg/queue"
+	"ecommerce/pkg/redis"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/adyen/adyen-go-api-library/v5/src/notification"
+	"gorm.io/gorm"
+)
+
+// EventOrderCaptured is published on the orders queue once the payment of
+// an order that was only authorised is captured
+const EventOrderCaptured = "order.captured"
+
+// Adyen may notify the authorisation before the checkout completes, so its
+// PSP reference waits in Redis for the order
+const pspReferenceTTL = 24 * time.Hour
+
+// PaymentCaptures captures the authorised payments of orders that waited for
+// stock once they ship, following the outcome through Adyen notifications
+type PaymentCaptures struct {
+	db          *gorm.DB
+	redisClient *redis.Client
+	queueClient queue.Publisher
+	adyenClient adyen.Capturer
+}
+
+func NewPaymentCaptures(db *gorm.DB, redisClient *redis.Client, queueClient queue.Publisher, adyenClient adyen.Capturer) *PaymentCaptures {
+	return &PaymentCaptures{
+		db:          db,
+		redisClient: redisClient,
+		queueClient: queueClient,
+		adyenClient: adyenClient,
+	}
+}
+
+// HandleNotification applies an Adyen notification: authorisations give
+// orders the PSP reference to capture with, captures settle them
+func (p *PaymentCaptures) HandleNotification(ctx context.Context, item notification.NotificationRequestItem) error {
+	switch item.EventCode {
+	case notification.EventCodeAuthorisation:
+		if item.Success != "true" || item.MerchantReference == "" {
+			return nil
+		}
+		if err := p.redisClient.Set(ctx, pspReferenceKey(item.MerchantReference), item.PspReference, pspReferenceTTL); err != nil {
+			return fmt.Errorf("failed to save PSP reference: %w", err)
+		}
+		err := p.db.WithContext(ctx).Model(&models.Order{}).
+			Where("payment_reference = ? AND psp_reference = ''", item.MerchantReference).
+			Update("psp_reference", item.PspReference).Error
+		if err != nil {
+			return fmt.Errorf("failed to save PSP reference: %w", err)
+		}
+	case notification.EventCodeCapture:
+		return p.settle(ctx, item.OriginalReference, item.Success == "true", item.Reason)
+	case notification.EventCodeCaptureFailed:
+		return p.settle(ctx, item.OriginalReference, false, item.Reason)
+	}
+	return nil
+}
+
+// PspReference returns the PSP reference Adyen notified for a checkout,
+// empty when the notification has not come yet
+func (p *PaymentCaptures) PspReference(ctx context.Context, merchantReference string) (string, error) {
+	var pspReference string
+	if err := p.redisClient.Get(ctx, pspReferenceKey(merchantReference), &pspReference); err != nil {
+		return "", fmt.Errorf("failed to get PSP reference: %w", err)
+	}
+	return pspReference, nil
+}
+
+// CaptureShipped captures the payments of authorised orders that shipped,
+// returning how many captures were requested
+func (p *PaymentCaptures) CaptureShipped(ctx context.Context) (int, error) {
+	var orders []models.Order
+	err := p.db.WithContext(ctx).
+		Where("capture_status = ? AND fulfillment_status = ?", models.CaptureStatusAuthorised, models.FulfillmentShipped).
+		Find(&orders).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch orders to capture: %w", err)
+	}
+
+	requested := 0
+	for i := range orders {
+		order := &orders[i]
+		if order.PspReference == "" {
+			log.Printf("Cannot capture order %d: no authorisation notified by Adyen", order.ID)
+			continue
+		}
+		if err := p.adyenClient.Capture(order.PspReference, order.Total, order.Currency, order.PaymentReference); err != nil {
+			log.Printf("Failed to capture order %d: %v", order.ID, err)
+			continue
+		}
+		err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(order).Update("capture_status", models.CaptureStatusRequested).Error; err != nil {
+				return err
+			}
+			return RecordOrderStatus(tx, order.ID, order.Status, models.StatusSourcePayment, "Payment capture requested")
+		})
+		if err != nil {
+			// Adyen ignores a second capture of the same authorisation
+			log.Printf("Failed to record capture of order %d: %v", order.ID, err)
+			continue
+		}
+		requested++
+	}
+	return requested, nil
+}
+
+// settle records the outcome of capturing the payment with pspReference
+func (p *PaymentCaptures) settle(ctx context.Context, pspReference string, success bool, reason string) error {
+	var order models.Order
+	err := p.db.WithContext(ctx).
+		Where("psp_reference = ? AND capture_status IN ?", pspReference,
+			[]string{models.CaptureStatusAuthorised, models.CaptureStatusRequested}).
+		First(&order).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Payments captured at once notify captures too
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch order: %w", err)
+	}
+
+	status, note := models.CaptureStatusCaptured, "Payment captured"
+	if !success {
+		status, note = models.CaptureStatusFailed, fmt.Sprintf("Payment capture failed: %s", reason)
+	}
+	err = p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&order).Update("capture_status", status).Error; err != nil {
+			return err
+		}
+		return RecordOrderStatus(tx, order.ID, order.Status, models.StatusSourcePayment, note)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record capture: %w", err)
+	}
+	if !success {
+		log.Printf("Capture of order %d failed: %s", order.ID, reason)
+		return nil
+	}
+
+	// Invoicing waits for the money
+	if err := p.queueClient.Publish(ctx, "orders", queue.Message{Type: EventOrderCaptured, Payload: order}); err != nil {
+		log.Printf("Failed to publish capture of order %d: %v", order.ID, err)
+	}
+	return nil
+}
+
+func pspReferenceKey(merchantReference string) string {
+	return fmt.Sprintf("adyen_psp:%s", merchantReference)
+}
@@ -0,0 +1,133 @@
+package services_test
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"ecommerce/internal/testutils/mocks"
+	"ecommerce/pkg/queue"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/adyen/adyen-go-api-library/v5/src/notification"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var captureColumns = []string{"id", "status", "total", "currency", "payment_reference", "psp_reference", "capture_status", "fulfillment_status"}
+
+func newPaymentCaptures(t *testing.T) (*services.PaymentCaptures, sqlmock.Sqlmock, *mocks.MockPublisher, *mocks.MockCapturer) {
+	db, sqlMock := mocks.NewDB(t)
+	redisClient, _ := mocks.NewRedis(t)
+	publisher := new(mocks.MockPublisher)
+	capturer := new(mocks.MockCapturer)
+	t.Cleanup(func() {
+		publisher.AssertExpectations(t)
+		capturer.AssertExpectations(t)
+	})
+	return services.NewPaymentCaptures(db, redisClient, publisher, capturer), sqlMock, publisher, capturer
+}
+
+// expectCapture expects order 7 to move to captureStatus with a status event
+func expectCapture(sqlMock sqlmock.Sqlmock, captureStatus, note string) {
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(regexp.QuoteMeta(`UPDATE "orders" SET "capture_status"=$1`)).
+		WithArgs(captureStatus, sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "order_status_events"`)).
+		WithArgs(7, "processing", models.StatusSourcePayment, note, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	sqlMock.ExpectCommit()
+}
+
+func TestHandleCaptureNotification(t *testing.T) {
+	capture := func(eventCode, success string) notification.NotificationRequestItem {
+		return notification.NotificationRequestItem{
+			EventCode:         eventCode,
+			Success:           success,
+			OriginalReference: "PSP7",
+			Reason:            "Insufficient balance",
+		}
+	}
+	expectAwaiting := func(sqlMock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "orders" WHERE psp_reference = $1 AND capture_status IN ($2,$3)`)).
+			WithArgs("PSP7", models.CaptureStatusAuthorised, models.CaptureStatusRequested, 1).
+			WillReturnRows(rows)
+	}
+	requested := func() *sqlmock.Rows {
+		return sqlmock.NewRows(captureColumns).
+			AddRow(7, "processing", 99.0, "EUR", "CO-7", "PSP7", models.CaptureStatusRequested, models.FulfillmentShipped)
+	}
+
+	t.Run("captured payment is announced for invoicing", func(t *testing.T) {
+		captures, sqlMock, publisher, _ := newPaymentCaptures(t)
+		expectAwaiting(sqlMock, requested())
+		expectCapture(sqlMock, models.CaptureStatusCaptured, "Payment captured")
+		publisher.On("Publish", "orders", mock.MatchedBy(func(msg queue.Message) bool {
+			order, ok := msg.Payload.(models.Order)
+			return msg.Type == services.EventOrderCaptured && ok && order.ID == 7
+		})).Return(nil).Once()
+
+		require.NoError(t, captures.HandleNotification(context.Background(), capture(notification.EventCodeCapture, "true")))
+	})
+
+	t.Run("failed capture is recorded without invoicing", func(t *testing.T) {
+		captures, sqlMock, publisher, _ := newPaymentCaptures(t)
+		expectAwaiting(sqlMock, requested())
+		expectCapture(sqlMock, models.CaptureStatusFailed, "Payment capture failed: Insufficient balance")
+
+		require.NoError(t, captures.HandleNotification(context.Background(), capture(notification.EventCodeCaptureFailed, "true")))
+		publisher.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unsuccessful capture is a failure", func(t *testing.T) {
+		captures, sqlMock, publisher, _ := newPaymentCaptures(t)
+		expectAwaiting(sqlMock, requested())
+		expectCapture(sqlMock, models.CaptureStatusFailed, "Payment capture failed: Insufficient balance")
+
+		require.NoError(t, captures.HandleNotification(context.Background(), capture(notification.EventCodeCapture, "false")))
+		publisher.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+	})
+
+	t.Run("payment captured at once is left alone", func(t *testing.T) {
+		captures, sqlMock, publisher, _ := newPaymentCaptures(t)
+		expectAwaiting(sqlMock, sqlmock.NewRows(captureColumns))
+
+		require.NoError(t, captures.HandleNotification(context.Background(), capture(notification.EventCodeCapture, "true")))
+		publisher.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+	})
+}
+
+func TestCaptureShipped(t *testing.T) {
+	expectShipped := func(sqlMock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "orders" WHERE capture_status = $1 AND fulfillment_status = $2`)).
+			WithArgs(models.CaptureStatusAuthorised, models.FulfillmentShipped).
+			WillReturnRows(rows)
+	}
+
+	t.Run("shipped orders are captured", func(t *testing.T) {
+		captures, sqlMock, _, capturer := newPaymentCaptures(t)
+		expectShipped(sqlMock, sqlmock.NewRows(captureColumns).
+			AddRow(7, "processing", 99.0, "EUR", "CO-7", "PSP7", models.CaptureStatusAuthorised, models.FulfillmentShipped))
+		capturer.On("Capture", "PSP7", 99.0, "EUR", "CO-7").Return(nil).Once()
+		expectCapture(sqlMock, models.CaptureStatusRequested, "Payment capture requested")
+
+		requested, err := captures.CaptureShipped(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, requested)
+	})
+
+	t.Run("orders without authorisation or refused by Adyen stay authorised", func(t *testing.T) {
+		captures, sqlMock, _, capturer := newPaymentCaptures(t)
+		expectShipped(sqlMock, sqlmock.NewRows(captureColumns).
+			AddRow(7, "processing", 99.0, "EUR", "CO-7", "", models.CaptureStatusAuthorised, models.FulfillmentShipped).
+			AddRow(8, "processing", 45.5, "EUR", "CO-8", "PSP8", models.CaptureStatusAuthorised, models.FulfillmentShipped))
+		capturer.On("Capture", "PSP8", 45.5, "EUR", "CO-8").Return(errors.New("capture of payment PSP8 not received")).Once()
+
+		requested, err := captures.CaptureShipped(context.Background())
+		require.NoError(t, err)
+		require.Zero(t, requested)
+	})
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/pkg/odoo"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	go_odoo "github.com/skilld-labs/go-odoo"
+)
+
+// imageModels maps each kind of product image to the Odoo model storing it
+var imageModels = map[string]string{
+	models.ProductImageTemplate: "product.template",
+	models.ProductImageExtra:    "product.image",
+	models.ProductImageVariant:  "product.product",
+}
+
+// ImageRef names one stored product image. Version is the record's
+// write_date as a Unix time, so a changed image gets a new URL.
+type ImageRef struct {
+	Kind    string
+	ID      int64
+	Version int64
+}
+
+// imageField is the Odoo field holding an image kind at one size. A variant's
+// image_<size> falls back to the template image, image_variant_<size> does not.
+func imageField(kind string, size int) string {
+	if kind == models.ProductImageVariant {
+		return fmt.Sprintf("image_variant_%d", size)
+	}
+	return fmt.Sprintf("image_%d", size)
+}
+
+// imageURL is the image endpoint address of ref within a template's gallery
+func imageURL(templateID int64, ref ImageRef) string {
+	switch ref.Kind {
+	case models.ProductImageExtra:
+		return fmt.Sprintf("/api/products/%d/images/%d?v=%d", templateID, ref.ID, ref.Version)
+	case models.ProductImageVariant:
+		return fmt.Sprintf("/api/products/%d/variants/%d/image?v=%d", templateID, ref.ID, ref.Version)
+	default:
+		return fmt.Sprintf("/api/products/%d/image?v=%d", templateID, ref.Version)
+	}
+}
+
+// imageOwner is the part of a product.template or product.product the
+// gallery needs to describe its main image
+type imageOwner struct {
+	ID          int64     `xmlrpc:"id"`
+	Name        string    `xmlrpc:"name"`
+	DisplayName string    `xmlrpc:"display_name"`
+	WriteDate   time.Time `xmlrpc:"write_date"`
+}
+
+// GetGallery returns every image of a product template in display order:
+// the main image, the template's extra media, then each variant's own image
+// followed by that variant's extra media.
+func (s *ProductService) GetGallery(ctx context.Context, templateID int64) ([]models.ProductImage, error) {
+	var gallery []models.ProductImage
+	err := s.catalog.Get(ctx, galleryKey(templateID), &gallery, func(ctx context.Context) (interface{}, error) {
+		return s.loadGallery(ctx, templateID)
+	})
+	if err != nil {
+		if cached, ok := s.fallback(galleryKey(templateID), err); ok {
+			return cached.([]models.ProductImage), nil
+		}
+		return nil, err
+	}
+	return gallery, nil
+}
+
+// HasImage reports whether ref is one of the template's images, whatever its version
+func (s *ProductService) HasImage(ctx context.Context, templateID int64, ref ImageRef) (bool, error) {
+	if ref.Kind == models.ProductImageTemplate {
+		return ref.ID == templateID, nil
+	}
+
+	_, err := s.ImageURL(ctx, templateID, ref)
+	if errors.Is(err, odoo.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ImageURL returns the URL ref's image is served at now, with its current
+// version, whatever version ref carries. ErrNotFound means ref is not one of
+// the template's images.
+func (s *ProductService) ImageURL(ctx context.Context, templateID int64, ref ImageRef) (string, error) {
+	gallery, err := s.GetGallery(ctx, templateID)
+	if err != nil {
+		return "", err
+	}
+	for _, image := range gallery {
+		if image.Kind != ref.Kind {
+			continue
+		}
+		if (ref.Kind == models.ProductImageTemplate && ref.ID == templateID) ||
+			(ref.Kind == models.ProductImageExtra && image.ImageID == ref.ID) ||
+			(ref.Kind == models.ProductImageVariant && image.VariantID == ref.ID) {
+			return image.URL, nil
+		}
+	}
+	return "", fmt.Errorf("product %d has no %s image %d: %w", templateID, ref.Kind, ref.ID, odoo.ErrNotFound)
+}
+
+func (s *ProductService) loadGallery(ctx context.Context, templateID int64) ([]models.ProductImage, error) {
+	var templates []imageOwner
+	criteria := s.odooClient.NewCriteria().Add("id", "=", templateID)
+	if err := s.searchGallery(ctx, "product.template", criteria, []string{"name", "write_date"}, &templates); err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("product %d: %w", templateID, odoo.ErrNotFound)
+	}
+	template := templates[0]
+
+	// Image fields are only compared with False, so no image data is transferred
+	hasMain, err := s.odooClient.SearchCount(ctx, "product.template", s.odooClient.NewCriteria().
+		Add("id", "=", templateID).
+		Add("image_1920", "!=", false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check product image: %w", err)
+	}
+
+	var extras, variantExtras []odoo.OdooProductImage
+	var variants []imageOwner
+	criteria = s.odooClient.NewCriteria().
+		Add("product_tmpl_id", "=", templateID).
+		Add("image_1920", "!=", false)
+	if err := s.searchGallery(ctx, "product.image", criteria, []string{"name", "sequence", "write_date"}, &extras); err != nil {
+		return nil, err
+	}
+	criteria = s.odooClient.NewCriteria().
+		Add("product_variant_id.product_tmpl_id", "=", templateID).
+		Add("image_1920", "!=", false)
+	if err := s.searchGallery(ctx, "product.image", criteria, []string{"name", "sequence", "product_variant_id", "write_date"}, &variantExtras); err != nil {
+		return nil, err
+	}
+	criteria = s.odooClient.NewCriteria().
+		Add("product_tmpl_id", "=", templateID).
+		Add("image_variant_1920", "!=", false)
+	if err := s.searchGallery(ctx, "product.product", criteria, []string{"display_name", "write_date"}, &variants); err != nil {
+		return nil, err
+	}
+
+	var gallery []models.ProductImage
+	add := func(kind string, id int64, written time.Time, variantID int64, alt string) {
+		ref := ImageRef{Kind: kind, ID: id, Version: written.Unix()}
+		image := models.ProductImage{
+			Kind:      kind,
+			VariantID: variantID,
+			URL:       imageURL(templateID, ref),
+			Alt:       alt,
+			Position:  len(gallery),
+			IsPrimary: len(gallery) == 0,
+		}
+		if kind == models.ProductImageExtra {
+			image.ImageID = id
+		}
+		gallery = append(gallery, image)
+	}
+	altOr := func(name, fallback string) string {
+		if name != "" {
+			return name
+		}
+		return fallback
+	}
+
+	if hasMain > 0 {
+		add(models.ProductImageTemplate, template.ID, template.WriteDate, 0, template.Name)
+	}
+	sortBySequence(extras)
+	for _, extra := range extras {
+		add(models.ProductImageExtra, extra.ID, extra.WriteDate, 0, altOr(extra.Name, template.Name))
+	}
+
+	sortBySequence(variantExtras)
+	sort.Slice(variants, func(i, j int) bool { return variants[i].ID < variants[j].ID })
+	for _, variant := range variants {
+		add(models.ProductImageVariant, variant.ID, variant.WriteDate, variant.ID, variant.DisplayName)
+		for _, extra := range variantExtras {
+			if extra.Variant != nil && extra.Variant.ID == variant.ID {
+				add(models.ProductImageExtra, extra.ID, extra.WriteDate, variant.ID, altOr(extra.Name, variant.DisplayName))
+			}
+		}
+	}
+	// Extra media of variants without an own image still belong in the gallery
+	for _, extra := range variantExtras {
+		if extra.Variant != nil && !containsRecord(variants, extra.Variant.ID) {
+			add(models.ProductImageExtra, extra.ID, extra.WriteDate, extra.Variant.ID, altOr(extra.Name, extra.Variant.Name))
+		}
+	}
+
+	return gallery, nil
+}
+
+// searchGallery reads the records matching criteria, treating no match as empty
+func (s *ProductService) searchGallery(ctx context.Context, model string, criteria *go_odoo.Criteria, fields []string, result interface{}) error {
+	options := s.odooClient.NewOptions().FetchFields(append([]string{"id"}, fields...)...)
+	err := s.odooClient.SearchRead(ctx, model, criteria, options, result)
+	if err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return fmt.Errorf("failed to fetch %s images: %w", model, err)
+	}
+	return nil
+}
+
+func sortBySequence(records []odoo.OdooProductImage) {
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Sequence != records[j].Sequence {
+			return records[i].Sequence < records[j].Sequence
+		}
+		return records[i].ID < records[j].ID
+	})
+}
+
+func containsRecord(records []imageOwner, id int64) bool {
+	for _, record := range records {
+		if record.ID == id {
+			return true
+		}
+	}
+	return false
+}
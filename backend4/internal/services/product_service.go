@@ -1,144 +1,281 @@
 package services
 
 import (
+	"context"
 	"ecommerce/internal/models"
+	"ecommerce/pkg/cache"
 	"ecommerce/pkg/odoo"
 	"encoding/base64"
 	"fmt"
+	"log"
 	"strconv"
 	"time"
 
-	"github.com/patrickmn/go-cache"
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// Field sets for the product loaders. Images are large base64 blobs, so only
+// the loaders that serve them ask for them.
+var (
+	productFields = []string{"name", "description", "list_price", "default_code", "active", "categ_id", "public_categ_ids"}
+	variantFields = []string{"product_tmpl_id", "display_name", "lst_price", "qty_available", "default_code", "active"}
+
+	// ImageSizes are the widths Odoo keeps each product image at, smallest first
+	ImageSizes = []int{128, 256, 512, 1024, 1920}
 )
 
 type ProductService struct {
 	odooClient odoo.OdooClient
-	imageCache *cache.Cache
+	catalog    *cache.Tiered  // Templates, the product list and images
+	stock      *cache.Tiered  // Variant price and stock, which change more often
+	lastKnown  *gocache.Cache // Last successful Odoo answers, served while Odoo is unavailable
+
+	products *odoo.Loader                    // Product details, without images
+	images   map[string]map[int]*odoo.Loader // One per image kind and size
+	variants *odoo.Loader                    // Price and stock of variants, for carts
 }
 
-func NewProductService(odooClient odoo.OdooClient) *ProductService {
+func NewProductService(odooClient odoo.OdooClient, catalog, stock *cache.Tiered) *ProductService {
+	loaderConfig := odoo.LoaderConfig{}
+	images := make(map[string]map[int]*odoo.Loader, len(imageModels))
+	for kind, model := range imageModels {
+		images[kind] = make(map[int]*odoo.Loader, len(ImageSizes))
+		for _, size := range ImageSizes {
+			images[kind][size] = odoo.NewLoader(odooClient, model, []string{imageField(kind, size)}, loaderConfig)
+		}
+	}
+
 	return &ProductService{
 		odooClient: odooClient,
-		imageCache: cache.New(5*time.Minute, 10*time.Minute),
+		catalog:    catalog,
+		stock:      stock,
+		lastKnown:  gocache.New(24*time.Hour, time.Hour),
+		products:   odoo.NewLoader(odooClient, "product.template", productFields, loaderConfig),
+		images:     images,
+		variants:   odoo.NewLoader(odooClient, "product.product", variantFields, loaderConfig),
+	}
+}
+
+// fallback returns the last known answer for key when err means Odoo is
+// unreachable or shielded by its circuit breaker. Other errors pass through.
+func (s *ProductService) fallback(key string, err error) (interface{}, bool) {
+	if !odoo.IsUnavailable(err) {
+		return nil, false
+	}
+	value, ok := s.lastKnown.Get(key)
+	if ok {
+		log.Printf("Odoo unavailable, serving last known %s: %v", key, err)
+	}
+	return value, ok
+}
+
+func (s *ProductService) GetProducts(ctx context.Context) ([]models.Product, error) {
+	var products []models.Product
+	err := s.catalog.Get(ctx, "products", &products, func(ctx context.Context) (interface{}, error) {
+		return s.loadProducts(ctx)
+	})
+	if err != nil {
+		if products, ok := s.fallback("products", err); ok {
+			return products.([]models.Product), nil
+		}
+		return nil, err
 	}
+	return products, nil
 }
 
-func (s *ProductService) GetProducts() ([]models.Product, error) {
+func (s *ProductService) loadProducts(ctx context.Context) ([]models.Product, error) {
 	var odooProducts []odoo.OdooProductTemplate
 	criteria := s.odooClient.NewCriteria().Add("sale_ok", "=", true)
-	options := s.odooClient.NewOptions().FetchFields(
-		"name", "description", "list_price", "default_code", "active",
-	)
+	options := s.odooClient.NewOptions().FetchFields(productFields...)
 
-	err := s.odooClient.SearchRead("product.template", criteria, options, &odooProducts)
+	err := s.odooClient.SearchRead(ctx, "product.template", criteria, options, &odooProducts)
 
 	if err != nil {
 		return nil, err
 	}
-	println("ProductService GetProducts: ", odooProducts) // Debug print
 	var products []models.Product
 	for _, op := range odooProducts {
 		products = append(products, models.Product{
-			OdooID:    op.ID,
-			Name:      op.Name,
-			BasePrice: op.ListPrice,
-			Active:    true,
+			OdooID:            op.ID,
+			Name:              op.Name,
+			BasePrice:         op.ListPrice,
+			Active:            true,
+			CategoryID:        categoryID(op.Category),
+			PublicCategoryIDs: op.PublicCategoryIDs,
 		})
 	}
+	s.lastKnown.Set("products", products, gocache.DefaultExpiration)
 	return products, nil
 }
 
-func (s *ProductService) GetProduct(id string) (*models.Product, error) {
-	// Implement single product fetching from Odoo
-	// returns Image too! use when you need the image too
-	var odooProducts []odoo.OdooProductTemplate
-	println("Prod Serv -------------- GetProduct - prductID: ", id) // Debug print
-	criteria := s.odooClient.NewCriteria().Add("id", "=", id)
-	options := s.odooClient.NewOptions().FetchFields(
-		"name", "description", "list_price", "default_code", "active",
-		"image_1920", "image_1024", "image_128",
-	)
-
-	err := s.odooClient.SearchRead("product.template", criteria, options, &odooProducts)
+// GetProduct returns a product with its images and gallery. Concurrent
+// requests for the same product share one Odoo read, and the result is cached
+// on two tiers. A gallery that cannot be loaded is left out.
+func (s *ProductService) GetProduct(ctx context.Context, id string) (*models.Product, error) {
+	odooID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid product ID: %w", err)
+	}
 
+	var product models.Product
+	err = s.catalog.Get(ctx, productKey(odooID), &product, func(ctx context.Context) (interface{}, error) {
+		return s.loadProduct(ctx, odooID)
+	})
 	if err != nil {
-		return nil, err
+		cached, ok := s.fallback(productKey(odooID), err)
+		if !ok {
+			return nil, err
+		}
+		product = *cached.(*models.Product)
 	}
 
-	// check if we actually got a product
-	if len(odooProducts) == 0 {
-		return nil, fmt.Errorf("error fetching product (ps) from Odoo: %w", err)
+	if product.Gallery, err = s.GetGallery(ctx, odooID); err != nil {
+		log.Printf("Failed to load gallery of product %d: %v", odooID, err)
 	}
-	odooProduct := odooProducts[0]
-
-	return &models.Product{
-		OdooID:    odooProduct.ID,
-		Name:      odooProduct.Name,
-		BasePrice: odooProduct.ListPrice,
-		Active:    true,
-		Image128:  odooProduct.Image128,
-		Image1024: odooProduct.Image1024,
-		Image1920: odooProduct.Image1920,
-	}, nil
+	return &product, nil
 }
 
-func (s *ProductService) GetProductImage(productID string) ([]byte, error) {
-
-	if cachedImage, exists := s.imageCache.Get(productID); exists {
-		return cachedImage.([]byte), nil
+func (s *ProductService) loadProduct(ctx context.Context, odooID int64) (*models.Product, error) {
+	var odooProduct odoo.OdooProductTemplate
+	if err := s.products.Load(ctx, odooID, &odooProduct); err != nil {
+		return nil, fmt.Errorf("error fetching product (ps) from Odoo: %w", err)
 	}
-	if productID == "" {
-		return nil, fmt.Errorf("product ID cannot be empty")
+
+	product := &models.Product{
+		OdooID:      odooProduct.ID,
+		Name:        odooProduct.Name,
+		Description: odooProduct.Description,
+		BasePrice:   odooProduct.ListPrice,
+		SKU:         odooProduct.DefaultCode,
+		Active:      true,
+		CategoryID:  categoryID(odooProduct.Category),
+
+		PublicCategoryIDs: odooProduct.PublicCategoryIDs,
 	}
+	s.lastKnown.Set(productKey(odooID), product, gocache.DefaultExpiration)
+	return product, nil
+}
 
-	// pass the product ID as an integer
-	idInt, err := strconv.ParseInt(productID, 10, 64)
+// GetVariant returns the price and stock of one product variant, without
+// images. Carts call it on every change, so concurrent calls are batched.
+func (s *ProductService) GetVariant(ctx context.Context, variantID uint) (*models.ProductVariant, error) {
+	var variant models.ProductVariant
+	err := s.stock.Get(ctx, variantKey(int64(variantID)), &variant, func(ctx context.Context) (interface{}, error) {
+		return s.loadVariant(ctx, variantID)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("invalid product ID: %w", err)
+		if variant, ok := s.fallback(variantKey(int64(variantID)), err); ok {
+			return variant.(*models.ProductVariant), nil
+		}
+		return nil, err
 	}
+	return &variant, nil
+}
 
-	var products []odoo.OdooProductTemplate
-	criteria := s.odooClient.NewCriteria().Add("id", "=", idInt)
-	options := s.odooClient.NewOptions().FetchFields(
-		"image_1920", "image_1024", "image_128",
-	)
+func (s *ProductService) loadVariant(ctx context.Context, variantID uint) (*models.ProductVariant, error) {
+	var odooVariant odoo.OdooProductVariant
+	if err := s.variants.Load(ctx, int64(variantID), &odooVariant); err != nil {
+		return nil, fmt.Errorf("error fetching variant %d from Odoo: %w", variantID, err)
+	}
 
-	// Fetch the product with image
-	err = s.odooClient.SearchRead(
-		"product.template",
-		criteria,
-		options,
-		&products,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch product image: %w", err)
+	variant := &models.ProductVariant{
+		ID:        variantID,
+		OdooID:    odooVariant.ID,
+		ProductID: uint(odooVariant.Template.ID),
+		Name:      odooVariant.Name,
+		Price:     odooVariant.Price,
+		Stock:     odooVariant.QtyAvailable,
+		SKU:       odooVariant.DefaultCode,
+		Active:    odooVariant.Active,
+	}
+	s.lastKnown.Set(variantKey(int64(variantID)), variant, gocache.DefaultExpiration)
+	return variant, nil
+}
+
+// GetImageSource returns a product image as Odoo stores it at one of
+// ImageSizes, in its original format. ErrNotFound means there is no image.
+func (s *ProductService) GetImageSource(ctx context.Context, ref ImageRef, size int) ([]byte, error) {
+	loader, ok := s.images[ref.Kind][size]
+	if !ok {
+		return nil, fmt.Errorf("odoo has no %dpx %s image", size, ref.Kind)
 	}
 
-	if len(products) == 0 {
-		return nil, fmt.Errorf("GetProductImage: product not found: %s", productID)
+	key := imageKey(ref, size)
+	var image []byte
+	err := s.catalog.Get(ctx, key, &image, func(ctx context.Context) (interface{}, error) {
+		return s.loadImageSource(ctx, loader, ref, size)
+	})
+	if err != nil {
+		if image, ok := s.fallback(key, err); ok {
+			return image.([]byte), nil
+		}
+		return nil, err
 	}
+	return image, nil
+}
 
-	if areAllEmpty(products[0].Image1920, products[0].Image1024, products[0].Image128) {
-		return nil, fmt.Errorf("empty images for product: %s", productID)
+func (s *ProductService) loadImageSource(ctx context.Context, loader *odoo.Loader, ref ImageRef, size int) ([]byte, error) {
+	var record map[string]interface{}
+	if err := loader.Load(ctx, ref.ID, &record); err != nil {
+		return nil, fmt.Errorf("failed to fetch product image: %w", err)
 	}
 
-	// Odoo typically stores images as base64 strings
-	// Decode the base64 string back to bytes
-	imageBytes, err := base64.StdEncoding.DecodeString(products[0].Image1920)
+	// Odoo stores images as base64 strings
+	encoded, _ := record[imageField(ref.Kind, size)].(string)
+	if encoded == "" {
+		return nil, fmt.Errorf("%s %d has no image: %w", imageModels[ref.Kind], ref.ID, odoo.ErrNotFound)
+	}
+	image, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image data: %w", err)
 	}
 
-	s.imageCache.Set(productID, imageBytes, cache.DefaultExpiration)
-
-	return imageBytes, nil
+	s.lastKnown.Set(imageKey(ref, size), image, gocache.DefaultExpiration)
+	return image, nil
 }
 
-func areAllEmpty(fields ...string) bool {
-	for _, field := range fields {
-		if field != "" {
-			return false
+// InvalidateProducts drops cached data of changed templates and variants on
+// every replica. A changed template also invalidates the product list.
+func (s *ProductService) InvalidateProducts(ctx context.Context, templateIDs, variantIDs []int64) error {
+	if len(templateIDs) > 0 {
+		keys := []string{"products"}
+		for _, id := range templateIDs {
+			keys = append(keys, productKey(id), galleryKey(id))
+			for _, size := range ImageSizes {
+				keys = append(keys, imageKey(ImageRef{Kind: models.ProductImageTemplate, ID: id}, size))
+			}
+		}
+		if err := s.catalog.Invalidate(ctx, keys...); err != nil {
+			return fmt.Errorf("failed to invalidate products: %w", err)
 		}
 	}
-	return true
+
+	if len(variantIDs) > 0 {
+		keys := make([]string, len(variantIDs))
+		for i, id := range variantIDs {
+			keys[i] = variantKey(id)
+		}
+		if err := s.stock.Invalidate(ctx, keys...); err != nil {
+			return fmt.Errorf("failed to invalidate variants: %w", err)
+		}
+	}
+	return nil
+}
+
+// categoryID is the Odoo ID of a product's internal category, 0 for none
+func categoryID(category *odoo.Many2One) int64 {
+	if category == nil {
+		return 0
+	}
+	return category.ID
+}
+
+func productKey(id int64) string { return fmt.Sprintf("product:%d", id) }
+func galleryKey(id int64) string { return fmt.Sprintf("gallery:%d", id) }
+func variantKey(id int64) string { return fmt.Sprintf("variant:%d", id) }
+
+// imageKey leaves out the version: the image endpoint checks it against the
+// gallery, and invalidation only knows the record an image belongs to
+func imageKey(ref ImageRef, size int) string {
+	return fmt.Sprintf("image:%s:%d:%d", ref.Kind, ref.ID, size)
 }
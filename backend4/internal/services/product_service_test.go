@@ -1,8 +1,10 @@
 package services_test
 
 import (
+	"context"
 	"ecommerce/internal/services"
 	"ecommerce/internal/testutils/mocks"
+	"ecommerce/pkg/cache"
 	"errors"
 	"testing"
 
@@ -10,12 +12,22 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
+// newProductService builds a service with process-local caches
+func newProductService(t *testing.T, client *mocks.MockOdooClient) *services.ProductService {
+	catalog, err := cache.NewTiered(cache.Config{Name: "catalog"}, nil)
+	require.NoError(t, err)
+	stock, err := cache.NewTiered(cache.Config{Name: "stock"}, nil)
+	require.NoError(t, err)
+	return services.NewProductService(client, catalog, stock)
+}
+
 func TestGetProducts(t *testing.T) {
 	t.Run("successful fetch", func(t *testing.T) {
 		mockClient := new(mocks.MockOdooClient)
-		service := services.NewProductService(mockClient)
+		service := newProductService(t, mockClient)
 
 		criteria := go_odoo.NewCriteria()
 		options := go_odoo.NewOptions()
@@ -28,7 +40,7 @@ func TestGetProducts(t *testing.T) {
 			mock.Anything,
 			mock.AnythingOfType("*[]odoo.OdooProductTemplate")).Return(nil)
 
-		products, err := service.GetProducts()
+		products, err := service.GetProducts(context.Background())
 		assert.NoError(t, err)
 		assert.Len(t, products, 2)
 		assert.Equal(t, int64(1), products[0].OdooID)
@@ -38,7 +50,7 @@ func TestGetProducts(t *testing.T) {
 
 	t.Run("fetch error", func(t *testing.T) {
 		mockClient := new(mocks.MockOdooClient)
-		service := services.NewProductService(mockClient)
+		service := newProductService(t, mockClient)
 
 		criteria := go_odoo.NewCriteria()
 		options := go_odoo.NewOptions()
@@ -52,7 +64,7 @@ func TestGetProducts(t *testing.T) {
 			mock.Anything,
 			mock.AnythingOfType("*[]odoo.OdooProductTemplate")).Return(expectedError)
 
-		products, err := service.GetProducts()
+		products, err := service.GetProducts(context.Background())
 		assert.Error(t, err)
 		assert.Equal(t, expectedError, err)
 		assert.Nil(t, products)
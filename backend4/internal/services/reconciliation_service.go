@@ -0,0 +1,580 @@
+package services
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/pkg/odoo"
+	"ecommerce/pkg/queue"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Column names of the Adyen settlement detail report we rely on
+const (
+	sdrPspReference          = "Psp Reference"
+	sdrMerchantReference     = "Merchant Reference"
+	sdrPaymentMethod         = "Payment Method"
+	sdrCreationDate          = "Creation Date"
+	sdrType                  = "Type"
+	sdrModificationReference = "Modification Reference"
+	sdrGrossCurrency         = "Gross Currency"
+	sdrGrossDebit            = "Gross Debit (GC)"
+	sdrGrossCredit           = "Gross Credit (GC)"
+	sdrNetDebit              = "Net Debit (NC)"
+	sdrNetCredit             = "Net Credit (NC)"
+	sdrCommission            = "Commission (NC)"
+	sdrBatchNumber           = "Batch Number"
+)
+
+const sdrDateLayout = "2006-01-02 15:04:05"
+
+type ReconciliationService struct {
+	db              *gorm.DB
+	odooClient      odoo.OdooClient
+	queueClient     queue.Publisher
+	amountTolerance float64
+	journalID       int64
+}
+
+func NewReconciliationService(db *gorm.DB, odooClient odoo.OdooClient, queueClient queue.Publisher, amountTolerance float64, journalID int64) *ReconciliationService {
+	if amountTolerance <= 0 {
+		amountTolerance = 0.01
+	}
+	return &ReconciliationService{
+		db:              db,
+		odooClient:      odooClient,
+		queueClient:     queueClient,
+		amountTolerance: amountTolerance,
+		journalID:       journalID,
+	}
+}
+
+// ParseSettlementReport reads an Adyen settlement detail report CSV.
+// Columns are located by header name so reports with extra columns still parse.
+func ParseSettlementReport(r io.Reader) ([]models.SettlementRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for _, required := range []string{sdrPspReference, sdrMerchantReference, sdrType, sdrGrossCurrency} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("settlement report is missing column %q", required)
+		}
+	}
+
+	var records []models.SettlementRecord
+	line := 1
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, fmt.Errorf("failed to read report line %d: %w", line, err)
+		}
+
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+		amount := func(name string) (float64, error) {
+			v := field(name)
+			if v == "" {
+				return 0, nil
+			}
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return 0, fmt.Errorf("line %d: invalid %s %q", line, name, v)
+			}
+			return f, nil
+		}
+
+		if field(sdrType) == "" {
+			continue
+		}
+
+		grossDebit, err := amount(sdrGrossDebit)
+		if err != nil {
+			return nil, err
+		}
+		grossCredit, err := amount(sdrGrossCredit)
+		if err != nil {
+			return nil, err
+		}
+		netDebit, err := amount(sdrNetDebit)
+		if err != nil {
+			return nil, err
+		}
+		netCredit, err := amount(sdrNetCredit)
+		if err != nil {
+			return nil, err
+		}
+		commission, err := amount(sdrCommission)
+		if err != nil {
+			return nil, err
+		}
+
+		var bookedAt time.Time
+		if v := field(sdrCreationDate); v != "" {
+			bookedAt, err = time.Parse(sdrDateLayout, v)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid %s %q", line, sdrCreationDate, v)
+			}
+		}
+
+		records = append(records, models.SettlementRecord{
+			PspReference:          field(sdrPspReference),
+			MerchantReference:     field(sdrMerchantReference),
+			ModificationReference: field(sdrModificationReference),
+			Type:                  field(sdrType),
+			PaymentMethod:         field(sdrPaymentMethod),
+			Currency:              field(sdrGrossCurrency),
+			GrossAmount:           grossCredit - grossDebit,
+			NetAmount:             netCredit - netDebit,
+			Commission:            commission,
+			BookedAt:              bookedAt,
+			BatchNumber:           field(sdrBatchNumber),
+		})
+	}
+
+	return records, nil
+}
+
+// ClassifySettlement decides whether a settlement row agrees with the matched order.
+// It returns the discrepancy kind, or an empty string when the row reconciles.
+// priorCaptures is the number of captures already settled for the same order.
+func ClassifySettlement(record *models.SettlementRecord, order *models.Order, priorCaptures int, tolerance float64) string {
+	switch record.Type {
+	case models.SettlementTypeChargeback, models.SettlementTypeSecondChargeback:
+		return models.DiscrepancyUnexpectedChargeback
+	}
+
+	if order == nil {
+		return models.DiscrepancyMissingOrder
+	}
+
+	if record.Type == models.SettlementTypeSettled {
+		if priorCaptures > 0 {
+			return models.DiscrepancyDuplicateCapture
+		}
+		if math.Abs(record.GrossAmount-order.Total) > tolerance {
+			return models.DiscrepancyAmountMismatch
+		}
+	}
+
+	return ""
+}
+
+// isReconcilable reports whether a record type concerns a customer payment.
+// Fees, payouts and balance transfers are settled against the merchant account only.
+func isReconcilable(recordType string) bool {
+	switch recordType {
+	case models.SettlementTypeSettled,
+		models.SettlementTypeRefunded,
+		models.SettlementTypeChargeback,
+		models.SettlementTypeSecondChargeback,
+		models.SettlementTypeChargebackReversed:
+		return true
+	}
+	return false
+}
+
+// IngestReport parses a settlement report and reconciles every row against our orders
+func (s *ReconciliationService) IngestReport(ctx context.Context, reportName string, r io.Reader) (*models.ReconciliationSummary, error) {
+	records, err := ParseSettlementReport(r)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &models.ReconciliationSummary{ReportName: reportName, Rows: len(records)}
+	for i := range records {
+		record := &records[i]
+		record.ReportName = reportName
+
+		var existing int64
+		err := s.db.WithContext(ctx).Model(&models.SettlementRecord{}).
+			Where("psp_reference = ? AND modification_reference = ? AND type = ?",
+				record.PspReference, record.ModificationReference, record.Type).
+			Count(&existing).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to check settlement record: %w", err)
+		}
+		if existing > 0 {
+			summary.Skipped++
+			continue
+		}
+
+		if err := s.reconcileRecord(ctx, record); err != nil {
+			return nil, err
+		}
+
+		switch record.Status {
+		case models.SettlementStatusMatched:
+			summary.Matched++
+		case models.SettlementStatusPosted:
+			summary.Matched++
+			summary.Posted++
+		case models.SettlementStatusIgnored:
+			summary.Ignored++
+		case models.SettlementStatusDiscrepancy:
+			summary.Discrepancies++
+		}
+	}
+
+	return summary, nil
+}
+
+func (s *ReconciliationService) reconcileRecord(ctx context.Context, record *models.SettlementRecord) error {
+	if !isReconcilable(record.Type) {
+		record.Status = models.SettlementStatusIgnored
+		if err := s.db.WithContext(ctx).Create(record).Error; err != nil {
+			return fmt.Errorf("failed to save settlement record: %w", err)
+		}
+		return nil
+	}
+
+	order, err := s.findOrder(ctx, record)
+	if err != nil {
+		return err
+	}
+
+	var priorCaptures int64
+	if order != nil {
+		record.OrderID = &order.ID
+		if record.Type == models.SettlementTypeSettled {
+			err := s.db.WithContext(ctx).Model(&models.SettlementRecord{}).
+				Where("order_id = ? AND type = ?", order.ID, models.SettlementTypeSettled).
+				Count(&priorCaptures).Error
+			if err != nil {
+				return fmt.Errorf("failed to count captures: %w", err)
+			}
+		}
+	}
+
+	kind := ClassifySettlement(record, order, int(priorCaptures), s.amountTolerance)
+	if kind == "" {
+		record.Status = models.SettlementStatusMatched
+	} else {
+		record.Status = models.SettlementStatusDiscrepancy
+	}
+
+	if err := s.db.WithContext(ctx).Create(record).Error; err != nil {
+		return fmt.Errorf("failed to save settlement record: %w", err)
+	}
+
+	if kind != "" {
+		return s.raiseDiscrepancy(ctx, kind, record, order)
+	}
+
+	if record.Type == models.SettlementTypeRefunded {
+		s.publishRefunded(ctx, record, order)
+	}
+
+	// Captures of invoiced orders are registered against the invoice
+	if record.Type == models.SettlementTypeSettled && invoiceOwnsPayment(order) {
+		return nil
+	}
+
+	// Only money movements that agree with the order are booked in Odoo
+	return s.post(ctx, record, order)
+}
+
+// RetryUnposted books the matched rows whose Odoo payment failed before,
+// returning how many were posted
+func (s *ReconciliationService) RetryUnposted(ctx context.Context) (int, error) {
+	var records []models.SettlementRecord
+	err := s.db.WithContext(ctx).
+		Joins("JOIN orders ON orders.id = settlement_records.order_id").
+		Where("settlement_records.status = ? AND settlement_records.odoo_payment_id IS NULL", models.SettlementStatusMatched).
+		Where("settlement_records.type <> ? OR COALESCE(orders.invoice_status, '') = ''", models.SettlementTypeSettled).
+		Find(&records).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch unposted settlements: %w", err)
+	}
+
+	posted := 0
+	for i := range records {
+		record := &records[i]
+		var order models.Order
+		if err := s.db.WithContext(ctx).First(&order, *record.OrderID).Error; err != nil {
+			return posted, fmt.Errorf("failed to fetch order: %w", err)
+		}
+		if err := s.post(ctx, record, &order); err != nil {
+			return posted, err
+		}
+		if record.Status == models.SettlementStatusPosted {
+			posted++
+		}
+	}
+	return posted, nil
+}
+
+// invoiceOwnsPayment tells whether invoicing registers the order's capture
+// against its invoice. Once it has started, posted or failed alike, booking
+// the capture here as well would pay the order twice.
+func invoiceOwnsPayment(order *models.Order) bool {
+	return order.InvoiceStatus != ""
+}
+
+// post books a matched row as an Odoo payment. A failure is kept on the row
+// for RetryUnposted.
+func (s *ReconciliationService) post(ctx context.Context, record *models.SettlementRecord, order *models.Order) error {
+	paymentID, err := s.postOdooPayment(ctx, record, order)
+	if err != nil {
+		log.Printf("Failed to post settlement %s to Odoo: %v", record.PspReference, err)
+		record.PostError = err.Error()
+	} else {
+		record.OdooPaymentID = &paymentID
+		record.Status = models.SettlementStatusPosted
+		record.PostError = ""
+	}
+	if err := s.db.WithContext(ctx).Save(record).Error; err != nil {
+		return fmt.Errorf("failed to update settlement record: %w", err)
+	}
+	return nil
+}
+
+// publishRefunded tells the customer about a refund Adyen settled. Rows are
+// ingested once, so each refund is announced once.
+func (s *ReconciliationService) publishRefunded(ctx context.Context, record *models.SettlementRecord, order *models.Order) {
+	var payload models.Order
+	if err := s.db.WithContext(ctx).Preload("Items").First(&payload, order.ID).Error; err != nil {
+		log.Printf("Failed to load order %d for refund event: %v", order.ID, err)
+		return
+	}
+
+	msg := queue.Message{
+		ID:      fmt.Sprintf("order.refunded:%d", record.ID),
+		Type:    "order.refunded",
+		Payload: payload,
+	}
+	if err := s.queueClient.Publish(ctx, "notifications", msg); err != nil {
+		log.Printf("Failed to publish refund notification for order %d: %v", order.ID, err)
+	}
+}
+
+// findOrder matches a settlement row by merchant reference first, then by PSP reference
+func (s *ReconciliationService) findOrder(ctx context.Context, record *models.SettlementRecord) (*models.Order, error) {
+	var order models.Order
+	err := s.db.WithContext(ctx).
+		Where("payment_reference = ? AND payment_reference <> ''", record.MerchantReference).
+		Or("payment_id = ? AND payment_id <> ''", record.PspReference).
+		First(&order).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find order for settlement: %w", err)
+	}
+	return &order, nil
+}
+
+func (s *ReconciliationService) raiseDiscrepancy(ctx context.Context, kind string, record *models.SettlementRecord, order *models.Order) error {
+	discrepancy := &models.PaymentDiscrepancy{
+		Kind:               kind,
+		Status:             models.DiscrepancyStatusOpen,
+		SettlementRecordID: record.ID,
+		OrderID:            record.OrderID,
+		PspReference:       record.PspReference,
+		MerchantReference:  record.MerchantReference,
+		Currency:           record.Currency,
+		Actual:             record.GrossAmount,
+	}
+	if order != nil {
+		discrepancy.Expected = order.Total
+	}
+
+	switch kind {
+	case models.DiscrepancyAmountMismatch:
+		discrepancy.Details = fmt.Sprintf("settled %.2f %s but order total is %.2f",
+			record.GrossAmount, record.Currency, order.Total)
+	case models.DiscrepancyMissingOrder:
+		discrepancy.Details = fmt.Sprintf("no order for merchant reference %q", record.MerchantReference)
+	case models.DiscrepancyDuplicateCapture:
+		discrepancy.Details = fmt.Sprintf("order %d already has a settled capture", order.ID)
+	case models.DiscrepancyUnexpectedChargeback:
+		discrepancy.Details = fmt.Sprintf("%s of %.2f %s", record.Type, record.GrossAmount, record.Currency)
+	}
+
+	if err := s.db.WithContext(ctx).Create(discrepancy).Error; err != nil {
+		return fmt.Errorf("failed to save discrepancy: %w", err)
+	}
+	return nil
+}
+
+// postOdooPayment books a reconciled settlement as a posted account.payment
+func (s *ReconciliationService) postOdooPayment(ctx context.Context, record *models.SettlementRecord, order *models.Order) (int64, error) {
+	paymentType := "inbound"
+	if record.GrossAmount < 0 {
+		paymentType = "outbound"
+	}
+
+	partnerID, err := s.partner(ctx, order)
+	if err != nil {
+		return 0, err
+	}
+
+	values := map[string]interface{}{
+		"payment_type": paymentType,
+		"partner_type": "customer",
+		"partner_id":   partnerID,
+		"amount":       math.Abs(record.GrossAmount),
+		"date":         record.BookedAt.Format("2006-01-02"),
+		"ref":          fmt.Sprintf("Adyen %s %s", record.Type, record.PspReference),
+	}
+	if s.journalID > 0 {
+		values["journal_id"] = s.journalID
+	}
+
+	ids, err := s.odooClient.Create(ctx, "account.payment", []interface{}{values}, s.odooClient.NewOptions())
+	if err != nil {
+		return 0, fmt.Errorf("failed to create account.payment: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, fmt.Errorf("odoo returned no account.payment id")
+	}
+
+	if err := s.odooClient.ExecuteKw(ctx, "action_post", "account.payment", []interface{}{ids}, nil, nil); err != nil {
+		return ids[0], fmt.Errorf("failed to post account.payment %d: %w", ids[0], err)
+	}
+
+	return ids[0], nil
+}
+
+// partner returns the Odoo customer of an order, from its sale order
+func (s *ReconciliationService) partner(ctx context.Context, order *models.Order) (int64, error) {
+	if order.OdooID == nil {
+		return 0, fmt.Errorf("order %d has no Odoo sale order", order.ID)
+	}
+	var sales []odoo.OdooSaleOrder
+	options := s.odooClient.NewOptions().FetchFields("id", "partner_id")
+	if err := s.odooClient.Read(ctx, "sale.order", []int64{*order.OdooID}, options, &sales); err != nil {
+		return 0, fmt.Errorf("failed to fetch sale order %d: %w", *order.OdooID, err)
+	}
+	if len(sales) == 0 || sales[0].Partner.ID == 0 {
+		return 0, fmt.Errorf("sale order %d has no customer in Odoo", *order.OdooID)
+	}
+	return sales[0].Partner.ID, nil
+}
+
+// IngestDirectory reconciles every CSV report in dir and moves it to dir/processed
+func (s *ReconciliationService) IngestDirectory(ctx context.Context, dir string) ([]models.ReconciliationSummary, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settlement directory: %w", err)
+	}
+
+	processedDir := filepath.Join(dir, "processed")
+	if err := os.MkdirAll(processedDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create processed directory: %w", err)
+	}
+
+	var summaries []models.ReconciliationSummary
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".csv") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		summary, err := s.ingestFile(ctx, path)
+		if err != nil {
+			return summaries, fmt.Errorf("failed to ingest %s: %w", entry.Name(), err)
+		}
+		summaries = append(summaries, *summary)
+
+		if err := os.Rename(path, filepath.Join(processedDir, entry.Name())); err != nil {
+			return summaries, fmt.Errorf("failed to move %s: %w", entry.Name(), err)
+		}
+	}
+
+	return summaries, nil
+}
+
+func (s *ReconciliationService) ingestFile(ctx context.Context, path string) (*models.ReconciliationSummary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return s.IngestReport(ctx, filepath.Base(path), f)
+}
+
+// ListDiscrepancies returns discrepancies, newest first, optionally filtered by status and kind
+func (s *ReconciliationService) ListDiscrepancies(ctx context.Context, status, kind string, page, limit int) ([]models.PaymentDiscrepancy, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.PaymentDiscrepancy{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count discrepancies: %w", err)
+	}
+
+	var discrepancies []models.PaymentDiscrepancy
+	err := query.Order("created_at DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&discrepancies).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list discrepancies: %w", err)
+	}
+
+	return discrepancies, total, nil
+}
+
+// ResolveDiscrepancy closes an open discrepancy with a note on how it was handled
+func (s *ReconciliationService) ResolveDiscrepancy(ctx context.Context, id uint, resolution string) (*models.PaymentDiscrepancy, error) {
+	var discrepancy models.PaymentDiscrepancy
+	if err := s.db.WithContext(ctx).First(&discrepancy, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("discrepancy not found")
+		}
+		return nil, fmt.Errorf("failed to fetch discrepancy: %w", err)
+	}
+
+	now := time.Now()
+	discrepancy.Status = models.DiscrepancyStatusResolved
+	discrepancy.Resolution = resolution
+	discrepancy.ResolvedAt = &now
+	if err := s.db.WithContext(ctx).Save(&discrepancy).Error; err != nil {
+		return nil, fmt.Errorf("failed to resolve discrepancy: %w", err)
+	}
+
+	return &discrepancy, nil
+}
@@ -0,0 +1,214 @@
+package services_test
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"ecommerce/internal/testutils/mocks"
+	"ecommerce/pkg/odoo"
+	"ecommerce/pkg/queue"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const settlementReport = `Company Account,Merchant Account,Psp Reference,Merchant Reference,Payment Method,Creation Date,TimeZone,Type,Modification Reference,Gross Currency,Gross Debit (GC),Gross Credit (GC),Exchange Rate,Net Currency,Net Debit (NC),Net Credit (NC),Commission (NC),Batch Number
+Shop,ShopECOM,8815000000000001,checkout-1,visa,2024-03-01 10:15:00,CET,Settled,8815000000000001,EUR,,99.99,1,EUR,,97.49,2.50,42
+Shop,ShopECOM,8815000000000002,checkout-2,mc,2024-03-01 11:00:00,CET,Refunded,8825000000000002,EUR,25.00,,1,EUR,25.00,,,42
+Shop,ShopECOM,,,,2024-03-02 00:00:00,CET,MerchantPayout,,EUR,500.00,,1,EUR,500.00,,,42
+`
+
+func TestParseSettlementReport(t *testing.T) {
+	t.Run("parses rows by header name", func(t *testing.T) {
+		records, err := services.ParseSettlementReport(strings.NewReader(settlementReport))
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+
+		assert.Equal(t, "8815000000000001", records[0].PspReference)
+		assert.Equal(t, "checkout-1", records[0].MerchantReference)
+		assert.Equal(t, models.SettlementTypeSettled, records[0].Type)
+		assert.InDelta(t, 99.99, records[0].GrossAmount, 0.001)
+		assert.InDelta(t, 97.49, records[0].NetAmount, 0.001)
+		assert.Equal(t, 2024, records[0].BookedAt.Year())
+
+		assert.InDelta(t, -25.00, records[1].GrossAmount, 0.001)
+		assert.Equal(t, "MerchantPayout", records[2].Type)
+	})
+
+	t.Run("missing required column", func(t *testing.T) {
+		_, err := services.ParseSettlementReport(strings.NewReader("Psp Reference,Type\n1,Settled\n"))
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid amount", func(t *testing.T) {
+		report := "Psp Reference,Merchant Reference,Type,Gross Currency,Gross Credit (GC)\n1,ref,Settled,EUR,abc\n"
+		_, err := services.ParseSettlementReport(strings.NewReader(report))
+		assert.Error(t, err)
+	})
+}
+
+func TestClassifySettlement(t *testing.T) {
+	order := &models.Order{ID: 7, Total: 99.99}
+	settled := &models.SettlementRecord{Type: models.SettlementTypeSettled, GrossAmount: 99.99}
+
+	tests := []struct {
+		name          string
+		record        *models.SettlementRecord
+		order         *models.Order
+		priorCaptures int
+		want          string
+	}{
+		{"matching capture", settled, order, 0, ""},
+		{"missing order", settled, nil, 0, models.DiscrepancyMissingOrder},
+		{"duplicate capture", settled, order, 1, models.DiscrepancyDuplicateCapture},
+		{
+			"amount mismatch",
+			&models.SettlementRecord{Type: models.SettlementTypeSettled, GrossAmount: 89.99},
+			order, 0, models.DiscrepancyAmountMismatch,
+		},
+		{
+			"chargeback",
+			&models.SettlementRecord{Type: models.SettlementTypeChargeback, GrossAmount: -99.99},
+			order, 1, models.DiscrepancyUnexpectedChargeback,
+		},
+		{
+			"refund",
+			&models.SettlementRecord{Type: models.SettlementTypeRefunded, GrossAmount: -20},
+			order, 1, "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := services.ClassifySettlement(tt.record, tt.order, tt.priorCaptures, 0.01)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func newReconciliationService(t *testing.T) (*services.ReconciliationService, sqlmock.Sqlmock, *mocks.MockOdooClient, *mocks.MockPublisher) {
+	db, sqlMock := mocks.NewDB(t)
+	odooClient := new(mocks.MockOdooClient)
+	odooClient.On("NewOptions").Return(nil).Maybe()
+	publisher := new(mocks.MockPublisher)
+	t.Cleanup(func() {
+		odooClient.AssertExpectations(t)
+		publisher.AssertExpectations(t)
+	})
+	return services.NewReconciliationService(db, odooClient, publisher, 0.01, 0), sqlMock, odooClient, publisher
+}
+
+// expectMatchedRow expects a new report row to match order 7 and be saved
+func expectMatchedRow(sqlMock sqlmock.Sqlmock, order *sqlmock.Rows, settled bool) {
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "settlement_records"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "orders" WHERE (payment_reference = $1`)).
+		WillReturnRows(order)
+	if settled {
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "settlement_records" WHERE order_id = $1 AND type = $2`)).
+			WithArgs(7, models.SettlementTypeSettled).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	}
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "settlement_records"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	sqlMock.ExpectCommit()
+}
+
+func expectRecordSaved(sqlMock sqlmock.Sqlmock) {
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(regexp.QuoteMeta(`UPDATE "settlement_records" SET`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectCommit()
+}
+
+func expectPayment(odooClient *mocks.MockOdooClient, paymentType string, amount float64) {
+	odooClient.On("Read", "sale.order", []int64{5}, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			*args.Get(3).(*[]odoo.OdooSaleOrder) = []odoo.OdooSaleOrder{{ID: 5, Partner: odoo.Many2One{ID: 42}}}
+		}).Return(nil)
+	odooClient.On("Create", "account.payment", mock.MatchedBy(func(values []interface{}) bool {
+		payment := values[0].(map[string]interface{})
+		return payment["partner_id"] == int64(42) && payment["payment_type"] == paymentType && payment["amount"] == amount
+	}), mock.Anything).Return([]int64{11}, nil)
+	odooClient.On("ExecuteKw", "action_post", "account.payment", []interface{}{[]int64{11}}, mock.Anything, mock.Anything).Return(nil)
+}
+
+func TestIngestReport(t *testing.T) {
+	ctx := context.Background()
+	const header = "Psp Reference,Merchant Reference,Creation Date,Type,Modification Reference,Gross Currency,Gross Debit (GC),Gross Credit (GC)\n"
+	const settled = header + "8815000000000001,checkout-1,2024-03-01 10:15:00,Settled,8815000000000001,EUR,,99\n"
+	const refunded = header + "8815000000000001,checkout-1,2024-03-05 09:00:00,Refunded,8825000000000002,EUR,25,\n"
+
+	for _, invoiceStatus := range []string{models.InvoiceStatusPosted, models.InvoiceStatusPaid, models.InvoiceStatusFailed} {
+		t.Run("capture of an order invoicing owns is left to it: "+invoiceStatus, func(t *testing.T) {
+			service, sqlMock, odooClient, _ := newReconciliationService(t)
+			expectMatchedRow(sqlMock, orderRow("", invoiceStatus), true)
+
+			summary, err := service.IngestReport(ctx, "report.csv", strings.NewReader(settled))
+			require.NoError(t, err)
+			assert.Equal(t, 1, summary.Matched)
+			assert.Zero(t, summary.Posted)
+			odooClient.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+
+	t.Run("capture is booked to the sale order's customer", func(t *testing.T) {
+		service, sqlMock, odooClient, _ := newReconciliationService(t)
+		expectMatchedRow(sqlMock, orderRow("", ""), true)
+		expectPayment(odooClient, "inbound", 99.0)
+		expectRecordSaved(sqlMock)
+
+		summary, err := service.IngestReport(ctx, "report.csv", strings.NewReader(settled))
+		require.NoError(t, err)
+		assert.Equal(t, 1, summary.Posted)
+	})
+
+	t.Run("refund notifies the customer", func(t *testing.T) {
+		service, sqlMock, odooClient, publisher := newReconciliationService(t)
+		expectMatchedRow(sqlMock, orderRow("", models.InvoiceStatusPaid), false)
+		expectOrder(sqlMock, orderRow("", models.InvoiceStatusPaid))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "order_items"`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}))
+		publisher.On("Publish", "notifications", mock.MatchedBy(func(msg queue.Message) bool {
+			return msg.Type == "order.refunded" && msg.ID == "order.refunded:3"
+		})).Return(nil)
+		expectPayment(odooClient, "outbound", 25.0)
+		expectRecordSaved(sqlMock)
+
+		summary, err := service.IngestReport(ctx, "report.csv", strings.NewReader(refunded))
+		require.NoError(t, err)
+		assert.Equal(t, 1, summary.Posted)
+	})
+
+	t.Run("failed booking is kept for the retry", func(t *testing.T) {
+		service, sqlMock, odooClient, _ := newReconciliationService(t)
+		expectMatchedRow(sqlMock, orderRow("", ""), true)
+		odooClient.On("Read", "sale.order", []int64{5}, mock.Anything, mock.Anything).Return(errors.New("odoo is down")).Once()
+		expectRecordSaved(sqlMock)
+
+		summary, err := service.IngestReport(ctx, "report.csv", strings.NewReader(settled))
+		require.NoError(t, err)
+		assert.Equal(t, 1, summary.Matched)
+		assert.Zero(t, summary.Posted)
+
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT "settlement_records"."id"`)).
+			WithArgs(models.SettlementStatusMatched, models.SettlementTypeSettled).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "type", "gross_amount", "order_id", "status", "booked_at"}).
+				AddRow(3, models.SettlementTypeSettled, 99.0, 7, models.SettlementStatusMatched, time.Now()))
+		expectOrder(sqlMock, orderRow("", ""))
+		expectPayment(odooClient, "inbound", 99.0)
+		expectRecordSaved(sqlMock)
+
+		posted, err := service.RetryUnposted(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, posted)
+	})
+}
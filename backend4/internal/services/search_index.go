@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/pkg/odoo"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// searchBatchSize bounds the number of templates read from Odoo at once
+const searchBatchSize = 200
+
+// searchTemplate is the part of a product.template the search index holds
+type searchTemplate struct {
+	ID                int64          `xmlrpc:"id"`
+	Name              string         `xmlrpc:"name"`
+	Description       string         `xmlrpc:"description_sale"`
+	DefaultCode       string         `xmlrpc:"default_code"`
+	ListPrice         float64        `xmlrpc:"list_price"`
+	QtyAvailable      float64        `xmlrpc:"qty_available"`
+	Category          *odoo.Many2One `xmlrpc:"categ_id"`
+	PublicCategoryIDs []int64        `xmlrpc:"public_categ_ids"`
+}
+
+type searchVariant struct {
+	Template    odoo.Many2One `xmlrpc:"product_tmpl_id"`
+	DefaultCode string        `xmlrpc:"default_code"`
+}
+
+type searchAttributeLine struct {
+	Template  odoo.Many2One `xmlrpc:"product_tmpl_id"`
+	Attribute odoo.Many2One `xmlrpc:"attribute_id"`
+	ValueIDs  []int64       `xmlrpc:"value_ids"`
+}
+
+// Reindex rebuilds the search index from every saleable template in Odoo
+// and drops products that are gone
+func (s *SearchService) Reindex(ctx context.Context) error {
+	ids, err := s.odooClient.Search(ctx, "product.template", s.odooClient.NewCriteria().Add("sale_ok", "=", true), nil)
+	if err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return fmt.Errorf("failed to list products to index: %w", err)
+	}
+	if err := s.indexTemplates(ctx, ids); err != nil {
+		return err
+	}
+
+	stale := s.db.WithContext(ctx)
+	if len(ids) > 0 {
+		stale = stale.Where("template_id NOT IN ?", ids)
+	} else {
+		stale = stale.Where("1 = 1")
+	}
+	if err := stale.Delete(&models.ProductSearchDocument{}).Error; err != nil {
+		return fmt.Errorf("failed to remove deleted products from search: %w", err)
+	}
+	if err := s.db.WithContext(ctx).
+		Where("template_id NOT IN (?)", s.db.Model(&models.ProductSearchDocument{}).Select("template_id")).
+		Delete(&models.ProductSearchFacet{}).Error; err != nil {
+		return fmt.Errorf("failed to remove deleted products from search: %w", err)
+	}
+	return nil
+}
+
+// IndexProducts updates the search entries of changed templates and of the
+// templates of changed variants. Templates that are archived, deleted or no
+// longer sold leave the index.
+func (s *SearchService) IndexProducts(ctx context.Context, templateIDs, variantIDs []int64) error {
+	if len(variantIDs) > 0 {
+		// Read, unlike search_read, also returns archived variants
+		var variants []searchVariant
+		options := s.odooClient.NewOptions().FetchFields("product_tmpl_id")
+		if err := s.odooClient.Read(ctx, "product.product", variantIDs, options, &variants); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+			return fmt.Errorf("failed to fetch variant templates: %w", err)
+		}
+		for _, variant := range variants {
+			templateIDs = append(templateIDs, variant.Template.ID)
+		}
+	}
+	return s.indexTemplates(ctx, uniqueIDs(templateIDs))
+}
+
+func (s *SearchService) indexTemplates(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var categories []models.Category
+	if err := s.db.WithContext(ctx).Find(&categories).Error; err != nil {
+		return fmt.Errorf("failed to fetch categories: %w", err)
+	}
+	categoriesByKind := map[string]map[int64]models.Category{
+		models.CategoryKindPublic:   {},
+		models.CategoryKindInternal: {},
+	}
+	for _, category := range categories {
+		if byID, ok := categoriesByKind[category.Kind]; ok {
+			byID[category.OdooID] = category
+		}
+	}
+
+	for start := 0; start < len(ids); start += searchBatchSize {
+		end := start + searchBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		if err := s.indexBatch(ctx, ids[start:end], categoriesByKind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SearchService) indexBatch(ctx context.Context, ids []int64, categories map[string]map[int64]models.Category) error {
+	var templates []searchTemplate
+	criteria := s.odooClient.NewCriteria().
+		Add("id", "in", ids).
+		Add("sale_ok", "=", true)
+	options := s.odooClient.NewOptions().FetchFields(
+		"id", "name", "description_sale", "default_code", "list_price",
+		"qty_available", "categ_id", "public_categ_ids",
+	)
+	if err := s.odooClient.SearchRead(ctx, "product.template", criteria, options, &templates); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return fmt.Errorf("failed to fetch products to index: %w", err)
+	}
+
+	found := make([]int64, len(templates))
+	for i, template := range templates {
+		found[i] = template.ID
+	}
+
+	skus := make(map[int64][]string)
+	facets := make(map[int64][]models.ProductSearchFacet)
+	if len(found) > 0 {
+		var variants []searchVariant
+		criteria := s.odooClient.NewCriteria().Add("product_tmpl_id", "in", found)
+		options := s.odooClient.NewOptions().FetchFields("product_tmpl_id", "default_code")
+		if err := s.odooClient.SearchRead(ctx, "product.product", criteria, options, &variants); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+			return fmt.Errorf("failed to fetch variants to index: %w", err)
+		}
+		for _, variant := range variants {
+			if variant.DefaultCode != "" {
+				skus[variant.Template.ID] = append(skus[variant.Template.ID], variant.DefaultCode)
+			}
+		}
+
+		if err := s.attributeFacets(ctx, found, facets); err != nil {
+			return err
+		}
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("template_id IN ?", ids).Delete(&models.ProductSearchFacet{}).Error; err != nil {
+			return fmt.Errorf("failed to clear search facets: %w", err)
+		}
+
+		for _, template := range templates {
+			templateFacets := facets[template.ID]
+			var categoryNames []string
+			for _, filed := range []struct {
+				kind, facet string
+				ids         []int64
+			}{
+				{models.CategoryKindPublic, models.SearchFacetPublicCategory, template.PublicCategoryIDs},
+				{models.CategoryKindInternal, models.SearchFacetInternalCategory, []int64{categoryID(template.Category)}},
+			} {
+				for _, id := range categoryAncestors(categories[filed.kind], filed.ids) {
+					templateFacets = append(templateFacets, models.ProductSearchFacet{TemplateID: template.ID, Facet: filed.facet, ValueID: id})
+					categoryNames = append(categoryNames, categories[filed.kind][id].Name)
+				}
+			}
+
+			codes := append([]string{template.DefaultCode}, skus[template.ID]...)
+			codeText := strings.TrimSpace(strings.Join(uniqueStrings(codes), " "))
+			categoryText := strings.Join(uniqueStrings(categoryNames), " ")
+			searchText := strings.ToLower(strings.Join([]string{template.Name, codeText, categoryText}, " "))
+
+			// Codes are indexed without stemming, whatever the language
+			err := tx.Exec(`
+				INSERT INTO product_search_documents (template_id, name, search_text, price, in_stock, document, updated_at)
+				VALUES (?, ?, ?, ?, ?,
+					setweight(to_tsvector(?::regconfig, ?), 'A') ||
+					setweight(to_tsvector('simple', ?), 'B') ||
+					setweight(to_tsvector(?::regconfig, ?), 'C') ||
+					setweight(to_tsvector(?::regconfig, ?), 'D'),
+					now())
+				ON CONFLICT (template_id) DO UPDATE SET
+					name = EXCLUDED.name,
+					search_text = EXCLUDED.search_text,
+					price = EXCLUDED.price,
+					in_stock = EXCLUDED.in_stock,
+					document = EXCLUDED.document,
+					updated_at = EXCLUDED.updated_at`,
+				template.ID, template.Name, searchText, template.ListPrice, template.QtyAvailable > 0,
+				s.language, template.Name,
+				codeText,
+				s.language, categoryText,
+				s.language, template.Description,
+			).Error
+			if err != nil {
+				return fmt.Errorf("failed to index product %d: %w", template.ID, err)
+			}
+
+			if len(templateFacets) > 0 {
+				if err := tx.Create(&templateFacets).Error; err != nil {
+					return fmt.Errorf("failed to index facets of product %d: %w", template.ID, err)
+				}
+			}
+		}
+
+		if removed := missingIDs(ids, found); len(removed) > 0 {
+			if err := tx.Where("template_id IN ?", removed).Delete(&models.ProductSearchDocument{}).Error; err != nil {
+				return fmt.Errorf("failed to remove products from search: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// attributeFacets files templates under the attribute values they come in
+func (s *SearchService) attributeFacets(ctx context.Context, templateIDs []int64, facets map[int64][]models.ProductSearchFacet) error {
+	var lines []searchAttributeLine
+	criteria := s.odooClient.NewCriteria().Add("product_tmpl_id", "in", templateIDs)
+	options := s.odooClient.NewOptions().FetchFields("product_tmpl_id", "attribute_id", "value_ids")
+	if err := s.odooClient.SearchRead(ctx, "product.template.attribute.line", criteria, options, &lines); err != nil {
+		if errors.Is(err, odoo.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to fetch product attributes: %w", err)
+	}
+
+	var valueIDs []int64
+	for _, line := range lines {
+		valueIDs = append(valueIDs, line.ValueIDs...)
+	}
+	if len(valueIDs) == 0 {
+		return nil
+	}
+	var values []struct {
+		ID   int64  `xmlrpc:"id"`
+		Name string `xmlrpc:"name"`
+	}
+	options = s.odooClient.NewOptions().FetchFields("id", "name")
+	if err := s.odooClient.Read(ctx, "product.attribute.value", uniqueIDs(valueIDs), options, &values); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return fmt.Errorf("failed to fetch attribute values: %w", err)
+	}
+	names := make(map[int64]string, len(values))
+	for _, value := range values {
+		names[value.ID] = value.Name
+	}
+
+	for _, line := range lines {
+		for _, id := range line.ValueIDs {
+			facets[line.Template.ID] = append(facets[line.Template.ID], models.ProductSearchFacet{
+				TemplateID: line.Template.ID,
+				Facet:      models.SearchFacetAttribute,
+				ValueID:    id,
+				Attribute:  line.Attribute.Name,
+				Label:      names[id],
+			})
+		}
+	}
+	return nil
+}
+
+// categoryAncestors returns the Odoo IDs of the given categories and of all
+// their ancestors, each once. Categories that are not synced are skipped.
+func categoryAncestors(categories map[int64]models.Category, ids []int64) []int64 {
+	seen := make(map[int64]bool)
+	var result []int64
+	for _, id := range ids {
+		category, ok := categories[id]
+		if !ok {
+			continue
+		}
+		for _, part := range strings.Split(strings.Trim(category.Path, "/"), "/") {
+			ancestor, err := strconv.ParseInt(part, 10, 64)
+			if err != nil {
+				continue
+			}
+			if _, synced := categories[ancestor]; synced && !seen[ancestor] {
+				seen[ancestor] = true
+				result = append(result, ancestor)
+			}
+		}
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	unique := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// missingIDs returns the IDs in want that are not in have
+func missingIDs(want, have []int64) []int64 {
+	present := make(map[int64]bool, len(have))
+	for _, id := range have {
+		present[id] = true
+	}
+	var missing []int64
+	for _, id := range want {
+		if !present[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
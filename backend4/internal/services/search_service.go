@@ -0,0 +1,450 @@
+package services
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/pkg/odoo"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// Sort orders of search results
+const (
+	SearchSortRelevance = "relevance"
+	SearchSortPriceAsc  = "price_asc"
+	SearchSortPriceDesc = "price_desc"
+	SearchSortName      = "name"
+)
+
+var searchOrders = map[string]string{
+	SearchSortRelevance: "rank DESC, name, template_id",
+	SearchSortPriceAsc:  "price, name, template_id",
+	SearchSortPriceDesc: "price DESC, name, template_id",
+	SearchSortName:      "name, template_id",
+}
+
+var ErrSearchSort = errors.New("unknown sort order")
+
+// SearchRequest is a product search with its filters
+type SearchRequest struct {
+	Query             string
+	CategoryKind      string // Defaults to the website tree
+	Category          string // Category slug; products below it match too
+	MinPrice          *float64
+	MaxPrice          *float64
+	AttributeValueIDs []int64 // Values of one attribute are alternatives, attributes must all match
+	InStock           *bool
+	Sort              string // Relevance when there is a query, name otherwise
+	Page              int    // From 1
+	Limit             int
+}
+
+// SearchService searches the catalog through an index in Postgres: a
+// weighted tsvector for ranked full-text matches, and trigram similarity over
+// the same text when a misspelled query matches nothing. OdooSync keeps the
+// index current through Reindex and IndexProducts.
+type SearchService struct {
+	db              *gorm.DB
+	odooClient      odoo.OdooClient
+	categoryService *CategoryService
+
+	language      string    // Postgres text search configuration, such as "english"
+	minSimilarity float64   // Word similarity a fuzzy match needs, from 0 to 1
+	priceBounds   []float64 // Upper bounds of the price facet buckets, ascending
+}
+
+func NewSearchService(db *gorm.DB, odooClient odoo.OdooClient, categoryService *CategoryService, language string, minSimilarity float64, priceBounds []float64) *SearchService {
+	if language == "" {
+		language = "simple"
+	}
+	if minSimilarity <= 0 {
+		minSimilarity = 0.4
+	}
+	if len(priceBounds) == 0 {
+		priceBounds = []float64{25, 50, 100, 250, 500}
+	}
+	sort.Float64s(priceBounds)
+
+	return &SearchService{
+		db:              db,
+		odooClient:      odooClient,
+		categoryService: categoryService,
+		language:        language,
+		minSimilarity:   minSimilarity,
+		priceBounds:     priceBounds,
+	}
+}
+
+// searchQuery is the SQL selecting the matching products, with a rank column
+type searchQuery struct {
+	sql  string
+	args []interface{}
+}
+
+// Search returns one page of matching products and facet counts over all of
+// them. Without a query every indexed product matches the filters.
+func (s *SearchService) Search(ctx context.Context, req SearchRequest) (*models.SearchResult, error) {
+	req.Query = strings.TrimSpace(req.Query)
+	if req.Sort == "" {
+		req.Sort = SearchSortName
+		if req.Query != "" {
+			req.Sort = SearchSortRelevance
+		}
+	}
+	order, ok := searchOrders[req.Sort]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrSearchSort, req.Sort)
+	}
+	if req.CategoryKind == "" {
+		req.CategoryKind = models.CategoryKindPublic
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Limit < 1 || req.Limit > 100 {
+		req.Limit = 24
+	}
+
+	var filters []string
+	var filterArgs []interface{}
+	if req.Category != "" {
+		category, err := s.categoryService.BySlug(ctx, req.CategoryKind, req.Category)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, "EXISTS (SELECT 1 FROM product_search_facets f WHERE f.template_id = d.template_id AND f.facet = ? AND f.value_id = ?)")
+		filterArgs = append(filterArgs, categoryFacet(req.CategoryKind), category.OdooID)
+	}
+	if req.MinPrice != nil {
+		filters = append(filters, "d.price >= ?")
+		filterArgs = append(filterArgs, *req.MinPrice)
+	}
+	if req.MaxPrice != nil {
+		filters = append(filters, "d.price <= ?")
+		filterArgs = append(filterArgs, *req.MaxPrice)
+	}
+	if req.InStock != nil {
+		filters = append(filters, "d.in_stock = ?")
+		filterArgs = append(filterArgs, *req.InStock)
+	}
+	if len(req.AttributeValueIDs) > 0 {
+		groups, err := s.attributeGroups(ctx, req.AttributeValueIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, ids := range groups {
+			filters = append(filters, "EXISTS (SELECT 1 FROM product_search_facets f WHERE f.template_id = d.template_id AND f.facet = ? AND f.value_id IN ?)")
+			filterArgs = append(filterArgs, models.SearchFacetAttribute, ids)
+		}
+	}
+
+	result := &models.SearchResult{Query: req.Query, Page: req.Page, Limit: req.Limit}
+	// One transaction, so the similarity threshold of a fuzzy search applies
+	// to all of its queries and to nothing else on the connection
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := s.matchQuery(req.Query, false, filters, filterArgs)
+		total, err := s.count(tx, query)
+		if err != nil {
+			return err
+		}
+		if total == 0 && req.Query != "" {
+			// The <% operator compares against this threshold, which lets the
+			// trigram index on search_text find the candidates
+			err := tx.Exec("SELECT set_config('pg_trgm.word_similarity_threshold', ?, true)",
+				strconv.FormatFloat(s.minSimilarity, 'f', -1, 64)).Error
+			if err != nil {
+				return fmt.Errorf("failed to set similarity threshold: %w", err)
+			}
+			query = s.matchQuery(req.Query, true, filters, filterArgs)
+			if total, err = s.count(tx, query); err != nil {
+				return err
+			}
+			result.Fuzzy = true
+		}
+		result.Total = total
+
+		var rows []struct {
+			TemplateID int64
+			Name       string
+			Price      float64
+			InStock    bool
+			Rank       float64
+		}
+		err = tx.Raw("SELECT * FROM ("+query.sql+") m ORDER BY "+order+" LIMIT ? OFFSET ?",
+			append(query.args, req.Limit, (req.Page-1)*req.Limit)...).
+			Scan(&rows).Error
+		if err != nil {
+			return fmt.Errorf("failed to search products: %w", err)
+		}
+		result.Items = make([]models.SearchHit, len(rows))
+		for i, row := range rows {
+			result.Items[i] = models.SearchHit{
+				OdooID:   row.TemplateID,
+				Name:     row.Name,
+				Price:    row.Price,
+				InStock:  row.InStock,
+				Score:    row.Rank,
+				ImageURL: fmt.Sprintf("/api/products/%d/image", row.TemplateID),
+			}
+		}
+
+		result.Facets, err = s.facets(tx, query, req.CategoryKind)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// matchQuery selects the indexed products matching text and filters. Exact
+// matching goes through the tsvector; fuzzy matching compares trigrams of
+// the query with the words of each product, against the threshold Search
+// sets for the transaction.
+func (s *SearchService) matchQuery(text string, fuzzy bool, filters []string, filterArgs []interface{}) searchQuery {
+	rank := "0::float8"
+	var where []string
+	var args []interface{}
+	switch {
+	case text == "":
+	case fuzzy:
+		rank = "word_similarity(?, d.search_text)::float8"
+		where = append(where, "? <% d.search_text")
+		args = append(args, strings.ToLower(text), strings.ToLower(text))
+	default:
+		rank = "ts_rank_cd(d.document, websearch_to_tsquery(?::regconfig, ?))::float8"
+		where = append(where, "d.document @@ websearch_to_tsquery(?::regconfig, ?)")
+		args = append(args, s.language, text, s.language, text)
+	}
+	where = append(where, filters...)
+	args = append(args, filterArgs...)
+	if len(where) == 0 {
+		where = []string{"TRUE"}
+	}
+
+	return searchQuery{
+		sql:  "SELECT d.template_id, d.name, d.price, d.in_stock, " + rank + " AS rank FROM product_search_documents d WHERE " + strings.Join(where, " AND "),
+		args: args,
+	}
+}
+
+func (s *SearchService) count(db *gorm.DB, query searchQuery) (int64, error) {
+	var total int64
+	if err := db.Raw("SELECT count(*) FROM ("+query.sql+") m", query.args...).Scan(&total).Error; err != nil {
+		return 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+	return total, nil
+}
+
+// facets counts the matching products per category, price bucket, attribute
+// value and availability
+func (s *SearchService) facets(db *gorm.DB, query searchQuery, kind string) (models.SearchFacets, error) {
+	facets := models.SearchFacets{
+		Categories: []models.CategoryFacet{},
+		Attributes: []models.AttributeFacet{},
+	}
+	matched := "(" + query.sql + ") m"
+
+	var categoryCounts []struct {
+		Slug  string
+		Name  string
+		Level int
+		Count int64
+	}
+	err := db.Raw(`SELECT c.slug, c.name, c.level, count(*) AS count FROM `+matched+`
+		JOIN product_search_facets f ON f.template_id = m.template_id AND f.facet = ?
+		JOIN categories c ON c.kind = ? AND c.odoo_id = f.value_id
+		GROUP BY c.slug, c.name, c.level, c.path
+		ORDER BY c.path`,
+		append(query.args, categoryFacet(kind), kind)...).Scan(&categoryCounts).Error
+	if err != nil {
+		return facets, fmt.Errorf("failed to count categories: %w", err)
+	}
+	for _, row := range categoryCounts {
+		facets.Categories = append(facets.Categories, models.CategoryFacet(row))
+	}
+
+	var priceCounts []struct {
+		Bucket int
+		Count  int64
+	}
+	err = db.Raw("SELECT width_bucket(m.price::float8, "+floatArray(s.priceBounds)+") AS bucket, count(*) AS count FROM "+matched+" GROUP BY bucket",
+		query.args...).Scan(&priceCounts).Error
+	if err != nil {
+		return facets, fmt.Errorf("failed to count prices: %w", err)
+	}
+	buckets := PriceBuckets(s.priceBounds)
+	for _, row := range priceCounts {
+		if row.Bucket >= 0 && row.Bucket < len(buckets) {
+			buckets[row.Bucket].Count = row.Count
+		}
+	}
+	facets.Prices = buckets
+
+	var attributeCounts []struct {
+		Attribute string
+		ValueID   int64
+		Label     string
+		Count     int64
+	}
+	err = db.Raw(`SELECT f.attribute, f.value_id, f.label, count(*) AS count FROM `+matched+`
+		JOIN product_search_facets f ON f.template_id = m.template_id AND f.facet = ?
+		GROUP BY f.attribute, f.value_id, f.label
+		ORDER BY f.attribute, f.label`,
+		append(query.args, models.SearchFacetAttribute)...).Scan(&attributeCounts).Error
+	if err != nil {
+		return facets, fmt.Errorf("failed to count attributes: %w", err)
+	}
+	for _, row := range attributeCounts {
+		if n := len(facets.Attributes); n == 0 || facets.Attributes[n-1].Name != row.Attribute {
+			facets.Attributes = append(facets.Attributes, models.AttributeFacet{Name: row.Attribute})
+		}
+		last := &facets.Attributes[len(facets.Attributes)-1]
+		last.Values = append(last.Values, models.AttributeValueFacet{ID: row.ValueID, Name: row.Label, Count: row.Count})
+	}
+
+	var stockCounts []struct {
+		InStock bool
+		Count   int64
+	}
+	err = db.Raw("SELECT m.in_stock, count(*) AS count FROM "+matched+" GROUP BY m.in_stock", query.args...).Scan(&stockCounts).Error
+	if err != nil {
+		return facets, fmt.Errorf("failed to count availability: %w", err)
+	}
+	for _, row := range stockCounts {
+		if row.InStock {
+			facets.InStock = row.Count
+		} else {
+			facets.OutOfStock = row.Count
+		}
+	}
+	return facets, nil
+}
+
+// attributeGroups groups attribute value IDs by their attribute
+func (s *SearchService) attributeGroups(ctx context.Context, valueIDs []int64) (map[string][]int64, error) {
+	var rows []struct {
+		Attribute string
+		ValueID   int64
+	}
+	err := s.db.WithContext(ctx).Model(&models.ProductSearchFacet{}).
+		Distinct("attribute", "value_id").
+		Where("facet = ? AND value_id IN ?", models.SearchFacetAttribute, valueIDs).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch attribute values: %w", err)
+	}
+
+	groups := make(map[string][]int64)
+	for _, row := range rows {
+		groups[row.Attribute] = append(groups[row.Attribute], row.ValueID)
+	}
+	if len(groups) == 0 {
+		// Values no product has still filter everything out
+		groups[""] = valueIDs
+	}
+	return groups, nil
+}
+
+// Suggest completes a partly typed search with product names, best matches
+// first, and website categories whose name has a word starting with it
+func (s *SearchService) Suggest(ctx context.Context, prefix string, limit int) (*models.Suggestions, error) {
+	if limit < 1 || limit > 20 {
+		limit = 8
+	}
+	suggestions := &models.Suggestions{
+		Products:   []models.ProductSuggestion{},
+		Categories: []models.Breadcrumb{},
+	}
+	tsquery := PrefixQuery(prefix)
+	if tsquery == "" {
+		return suggestions, nil
+	}
+
+	var products []struct {
+		TemplateID int64
+		Name       string
+	}
+	err := s.db.WithContext(ctx).Raw(`SELECT template_id, name FROM product_search_documents
+		WHERE document @@ to_tsquery(?::regconfig, ?)
+		ORDER BY ts_rank_cd(document, to_tsquery(?::regconfig, ?)) DESC, name
+		LIMIT ?`,
+		s.language, tsquery, s.language, tsquery, limit).Scan(&products).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest products: %w", err)
+	}
+	for _, product := range products {
+		suggestions.Products = append(suggestions.Products, models.ProductSuggestion{OdooID: product.TemplateID, Name: product.Name})
+	}
+
+	pattern := escapeLike(strings.TrimSpace(prefix)) + "%"
+	var categories []models.Category
+	err = s.db.WithContext(ctx).
+		Where("kind = ? AND (name ILIKE ? OR name ILIKE ?)", models.CategoryKindPublic, pattern, "% "+pattern).
+		Order("level, name").
+		Limit(limit).
+		Find(&categories).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest categories: %w", err)
+	}
+	for _, category := range categories {
+		suggestions.Categories = append(suggestions.Categories, models.Breadcrumb{ID: category.ID, Name: category.Name, Slug: category.Slug})
+	}
+	return suggestions, nil
+}
+
+// PrefixQuery turns typed text into a tsquery matching words that start with
+// each typed word: "office cha" becomes "office:* & cha:*". Only letters and
+// digits are kept, so user input cannot inject tsquery operators.
+func PrefixQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = strings.ToLower(word) + ":*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+// PriceBuckets returns the empty price facet buckets for ascending bounds:
+// below the first bound, between each pair and from the last one up
+func PriceBuckets(bounds []float64) []models.PriceFacet {
+	buckets := make([]models.PriceFacet, len(bounds)+1)
+	for i := range buckets {
+		if i > 0 {
+			buckets[i].Min = bounds[i-1]
+		}
+		if i < len(bounds) {
+			max := bounds[i]
+			buckets[i].Max = &max
+		}
+	}
+	return buckets
+}
+
+func categoryFacet(kind string) string {
+	if kind == models.CategoryKindInternal {
+		return models.SearchFacetInternalCategory
+	}
+	return models.SearchFacetPublicCategory
+}
+
+// floatArray renders bounds as a Postgres array literal for width_bucket
+func floatArray(bounds []float64) string {
+	parts := make([]string, len(bounds))
+	for i, bound := range bounds {
+		parts[i] = strconv.FormatFloat(bound, 'f', -1, 64)
+	}
+	return "ARRAY[" + strings.Join(parts, ",") + "]::float8[]"
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,186 @@
+package services_test
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"ecommerce/internal/testutils/mocks"
+	"ecommerce/pkg/odoo"
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixQuery(t *testing.T) {
+	assert.Equal(t, "office:* & cha:*", services.PrefixQuery("Office cha"))
+	assert.Equal(t, "a:* & b:* & c:*", services.PrefixQuery("a & b | !c:*"))
+	assert.Equal(t, "größe:*", services.PrefixQuery(" Größe "))
+	assert.Equal(t, "", services.PrefixQuery("  ()  "))
+}
+
+func TestPriceBuckets(t *testing.T) {
+	buckets := services.PriceBuckets([]float64{25, 100})
+	require.Len(t, buckets, 3)
+
+	assert.Equal(t, 0.0, buckets[0].Min)
+	require.NotNil(t, buckets[0].Max)
+	assert.Equal(t, 25.0, *buckets[0].Max)
+	assert.Equal(t, 25.0, buckets[1].Min)
+	assert.Equal(t, 100.0, *buckets[1].Max)
+	assert.Equal(t, 100.0, buckets[2].Min)
+	assert.Nil(t, buckets[2].Max)
+}
+
+func newSearchService(t *testing.T) (*services.SearchService, sqlmock.Sqlmock, *mocks.MockOdooClient) {
+	db, sqlMock := mocks.NewDB(t)
+	odooClient := new(mocks.MockOdooClient)
+	odooClient.On("NewCriteria").Return(nil).Maybe()
+	odooClient.On("NewOptions").Return(nil).Maybe()
+	t.Cleanup(func() { odooClient.AssertExpectations(t) })
+	service := services.NewSearchService(db, odooClient, services.NewCategoryService(db), "english", 0.4, []float64{25, 100})
+	return service, sqlMock, odooClient
+}
+
+// expectFacets expects the four facet counts over the matched products
+func expectFacets(sqlMock sqlmock.Sqlmock) {
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`JOIN categories c`)).
+		WillReturnRows(sqlmock.NewRows([]string{"slug", "name", "level", "count"}).
+			AddRow("furniture", "Furniture", 0, 2).
+			AddRow("desks", "Desks", 1, 1))
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT width_bucket(m.price::float8, ARRAY[25,100]::float8[])`)).
+		WillReturnRows(sqlmock.NewRows([]string{"bucket", "count"}).AddRow(1, 1).AddRow(2, 1))
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT f.attribute, f.value_id, f.label`)).
+		WillReturnRows(sqlmock.NewRows([]string{"attribute", "value_id", "label", "count"}).
+			AddRow("Color", 5, "Black", 1).
+			AddRow("Color", 6, "Oak", 1).
+			AddRow("Size", 9, "Large", 2))
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT m.in_stock, count(*)`)).
+		WillReturnRows(sqlmock.NewRows([]string{"in_stock", "count"}).AddRow(true, 2))
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	hits := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"template_id", "name", "price", "in_stock", "rank"}).
+			AddRow(1, "Oak Desk", 120.0, true, 0.8).
+			AddRow(2, "Desk Lamp", 30.0, true, 0.5)
+	}
+
+	t.Run("ranked full-text matches with facets", func(t *testing.T) {
+		service, sqlMock, _ := newSearchService(t)
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM (SELECT d.template_id, d.name, d.price, d.in_stock, ts_rank_cd(`)).
+			WithArgs("english", "desk", "english", "desk", true).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`ORDER BY rank DESC, name, template_id LIMIT $6 OFFSET $7`)).
+			WithArgs("english", "desk", "english", "desk", true, 24, 0).
+			WillReturnRows(hits())
+		expectFacets(sqlMock)
+		sqlMock.ExpectCommit()
+
+		inStock := true
+		result, err := service.Search(ctx, services.SearchRequest{Query: " desk ", InStock: &inStock})
+		require.NoError(t, err)
+		assert.False(t, result.Fuzzy)
+		assert.Equal(t, int64(2), result.Total)
+		require.Len(t, result.Items, 2)
+		assert.Equal(t, int64(1), result.Items[0].OdooID)
+		assert.Equal(t, "/api/products/1/image", result.Items[0].ImageURL)
+
+		facets := result.Facets
+		require.Len(t, facets.Categories, 2)
+		assert.Equal(t, "desks", facets.Categories[1].Slug)
+		require.Len(t, facets.Prices, 3)
+		assert.Equal(t, []int64{0, 1, 1}, []int64{facets.Prices[0].Count, facets.Prices[1].Count, facets.Prices[2].Count})
+		require.Len(t, facets.Attributes, 2)
+		assert.Equal(t, "Color", facets.Attributes[0].Name)
+		assert.Len(t, facets.Attributes[0].Values, 2)
+		assert.Equal(t, "Large", facets.Attributes[1].Values[0].Name)
+		assert.Equal(t, int64(2), facets.InStock)
+		assert.Zero(t, facets.OutOfStock)
+	})
+
+	t.Run("misspelled query falls back to the trigram index", func(t *testing.T) {
+		service, sqlMock, _ := newSearchService(t)
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM`)).
+			WithArgs("english", "Dsek", "english", "Dsek").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		sqlMock.ExpectExec(regexp.QuoteMeta(`SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)`)).
+			WithArgs("0.4").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`word_similarity($1, d.search_text)::float8 AS rank FROM product_search_documents d WHERE $2 <% d.search_text)`)).
+			WithArgs("dsek", "dsek").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`ORDER BY price, name, template_id LIMIT $3 OFFSET $4`)).
+			WithArgs("dsek", "dsek", 10, 10).
+			WillReturnRows(hits())
+		expectFacets(sqlMock)
+		sqlMock.ExpectCommit()
+
+		result, err := service.Search(ctx, services.SearchRequest{Query: "Dsek", Sort: services.SearchSortPriceAsc, Page: 2, Limit: 10})
+		require.NoError(t, err)
+		assert.True(t, result.Fuzzy)
+		assert.Equal(t, int64(2), result.Total)
+		assert.Len(t, result.Items, 2)
+	})
+
+	t.Run("unknown sort order", func(t *testing.T) {
+		service, _, _ := newSearchService(t)
+		_, err := service.Search(ctx, services.SearchRequest{Sort: "popularity"})
+		assert.ErrorIs(t, err, services.ErrSearchSort)
+	})
+}
+
+func TestIndexProducts(t *testing.T) {
+	service, sqlMock, odooClient := newSearchService(t)
+
+	// fill hands records to the service's own record types through JSON
+	fill := func(records interface{}) func(mock.Arguments) {
+		return func(args mock.Arguments) {
+			data, _ := json.Marshal(records)
+			json.Unmarshal(data, args.Get(3))
+		}
+	}
+	odooClient.On("Read", "product.product", []int64{21}, mock.Anything, mock.Anything).
+		Run(fill([]map[string]interface{}{{"Template": odoo.Many2One{ID: 2}}})).Return(nil)
+	// Template 2 is no longer sold
+	odooClient.On("SearchRead", "product.template", mock.Anything, mock.Anything, mock.Anything).
+		Run(fill([]map[string]interface{}{{
+			"ID": 1, "Name": "Desk", "Description": "Oak desk", "DefaultCode": "D-1",
+			"ListPrice": 120.0, "QtyAvailable": 3, "PublicCategoryIDs": []int64{3},
+		}})).Return(nil)
+	odooClient.On("SearchRead", "product.product", mock.Anything, mock.Anything, mock.Anything).
+		Run(fill([]map[string]interface{}{
+			{"Template": odoo.Many2One{ID: 1}, "DefaultCode": "D-1"},
+			{"Template": odoo.Many2One{ID: 1}, "DefaultCode": "D-1-OAK"},
+		})).Return(nil)
+	odooClient.On("SearchRead", "product.template.attribute.line", mock.Anything, mock.Anything, mock.Anything).
+		Return(odoo.ErrNotFound)
+
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "categories"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "odoo_id", "name", "path"}).
+			AddRow(1, models.CategoryKindPublic, 3, "Desks", "/3/"))
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "product_search_facets" WHERE template_id IN ($1,$2)`)).
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	sqlMock.ExpectExec(regexp.QuoteMeta(`INSERT INTO product_search_documents`)).
+		WithArgs(1, "Desk", "desk d-1 d-1-oak desks", 120.0, true,
+			"english", "Desk", "D-1 D-1-OAK", "english", "Desks", "english", "Oak desk").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "product_search_facets"`)).
+		WithArgs(1, models.SearchFacetPublicCategory, 3, "", "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "product_search_documents" WHERE template_id IN ($1)`)).
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectCommit()
+
+	require.NoError(t, service.IndexProducts(context.Background(), []int64{1}, []int64{21}))
+}
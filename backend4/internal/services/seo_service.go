@@ -0,0 +1,304 @@
+package services
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/pkg/odoo"
+	"ecommerce/pkg/slug"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Storefront paths of product and category pages
+const (
+	productPagePath  = "/product/"
+	categoryPagePath = "/category/"
+)
+
+// metaDescriptionLength is the length of description search engines show
+const metaDescriptionLength = 160
+
+// Optional product.template fields from Odoo's website modules
+var seoFields = []string{"seo_name", "website_meta_title", "website_meta_description", "website_meta_keywords", "is_published"}
+
+var ErrPageNotFound = errors.New("page not found")
+
+// seoTemplate is the part of a product.template its page is built from
+type seoTemplate struct {
+	ID              int64     `xmlrpc:"id"`
+	Name            string    `xmlrpc:"name"`
+	Description     string    `xmlrpc:"description_sale"`
+	WriteDate       time.Time `xmlrpc:"write_date"`
+	SEOName         string    `xmlrpc:"seo_name"`
+	MetaTitle       string    `xmlrpc:"website_meta_title"`
+	MetaDescription string    `xmlrpc:"website_meta_description"`
+	MetaKeywords    string    `xmlrpc:"website_meta_keywords"`
+	Published       bool      `xmlrpc:"is_published"`
+}
+
+// SEOService gives products stable slugs and search engine metadata, and
+// writes the sitemaps. Pages are kept current by OdooSync like the search
+// index. A product whose slug changes keeps answering at its old slug with a
+// redirect.
+type SEOService struct {
+	db         *gorm.DB
+	odooClient odoo.OdooClient
+
+	siteURL        string // Storefront, where pages are
+	sitemapBaseURL string // Where this API serves the sitemaps
+	sitemapSize    int    // URLs per sitemap file
+
+	fieldsMu  sync.Mutex
+	available map[string]bool // Which of seoFields this Odoo has
+}
+
+func NewSEOService(db *gorm.DB, odooClient odoo.OdooClient, siteURL, sitemapBaseURL string, sitemapSize int) *SEOService {
+	if sitemapSize <= 0 || sitemapSize > 50000 {
+		// The sitemap protocol's limit
+		sitemapSize = 50000
+	}
+	return &SEOService{
+		db:             db,
+		odooClient:     odooClient,
+		siteURL:        strings.TrimRight(siteURL, "/"),
+		sitemapBaseURL: strings.TrimRight(sitemapBaseURL, "/"),
+		sitemapSize:    sitemapSize,
+	}
+}
+
+// ProductPage returns the page of a product template
+func (s *SEOService) ProductPage(ctx context.Context, templateID int64) (*models.ProductPage, error) {
+	var page models.ProductPage
+	err := s.db.WithContext(ctx).First(&page, "template_id = ?", templateID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("product %d: %w", templateID, ErrPageNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch product page: %w", err)
+	}
+	page.CanonicalURL = s.siteURL + productPagePath + page.Slug
+	return &page, nil
+}
+
+// ResolveProductSlug returns the template with slug, or with slug as a former
+// slug, and the slug the template has now
+func (s *SEOService) ResolveProductSlug(ctx context.Context, productSlug string) (int64, string, error) {
+	var page models.ProductPage
+	err := s.db.WithContext(ctx).First(&page, "slug = ?", productSlug).Error
+	if err == nil {
+		return page.TemplateID, page.Slug, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, "", fmt.Errorf("failed to fetch product page: %w", err)
+	}
+
+	var redirect models.SlugRedirect
+	err = s.db.WithContext(ctx).First(&redirect, "kind = ? AND slug = ?", models.SlugKindProduct, productSlug).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, "", fmt.Errorf("product %q: %w", productSlug, ErrPageNotFound)
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to fetch slug redirect: %w", err)
+	}
+	current, err := s.ProductPage(ctx, redirect.OdooID)
+	if err != nil {
+		return 0, "", err
+	}
+	return current.TemplateID, current.Slug, nil
+}
+
+// Reindex builds the pages of every saleable template and drops the pages of
+// templates that are gone
+func (s *SEOService) Reindex(ctx context.Context) error {
+	ids, err := s.odooClient.Search(ctx, "product.template", s.odooClient.NewCriteria().Add("sale_ok", "=", true), nil)
+	if err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return fmt.Errorf("failed to list product pages: %w", err)
+	}
+	for start := 0; start < len(ids); start += searchBatchSize {
+		end := start + searchBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		if err := s.indexBatch(ctx, ids[start:end]); err != nil {
+			return err
+		}
+	}
+
+	stale := s.db.WithContext(ctx)
+	if len(ids) > 0 {
+		stale = stale.Where("template_id NOT IN ?", ids)
+	} else {
+		stale = stale.Where("1 = 1")
+	}
+	if err := stale.Delete(&models.ProductPage{}).Error; err != nil {
+		return fmt.Errorf("failed to remove product pages: %w", err)
+	}
+	return nil
+}
+
+// IndexProducts updates the pages of changed templates. Variant changes do
+// not show on product pages.
+func (s *SEOService) IndexProducts(ctx context.Context, templateIDs, variantIDs []int64) error {
+	ids := uniqueIDs(templateIDs)
+	for start := 0; start < len(ids); start += searchBatchSize {
+		end := start + searchBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		if err := s.indexBatch(ctx, ids[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SEOService) indexBatch(ctx context.Context, ids []int64) error {
+	available, err := s.availableFields(ctx)
+	if err != nil {
+		return err
+	}
+	fields := []string{"id", "name", "description_sale", "write_date"}
+	for _, field := range seoFields {
+		if available[field] {
+			fields = append(fields, field)
+		}
+	}
+
+	var templates []seoTemplate
+	criteria := s.odooClient.NewCriteria().
+		Add("id", "in", ids).
+		Add("sale_ok", "=", true)
+	options := s.odooClient.NewOptions().FetchFields(fields...)
+	if err := s.odooClient.SearchRead(ctx, "product.template", criteria, options, &templates); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return fmt.Errorf("failed to fetch product pages: %w", err)
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing []models.ProductPage
+		if err := tx.Where("template_id IN ?", ids).Find(&existing).Error; err != nil {
+			return fmt.Errorf("failed to load product pages: %w", err)
+		}
+		pages := make(map[int64]models.ProductPage, len(existing))
+		for _, page := range existing {
+			pages[page.TemplateID] = page
+		}
+
+		found := make([]int64, 0, len(templates))
+		for _, template := range templates {
+			found = append(found, template.ID)
+			page := pages[template.ID]
+			page.TemplateID = template.ID
+			page.MetaTitle = firstNonEmpty(template.MetaTitle, template.Name)
+			page.MetaDescription = firstNonEmpty(template.MetaDescription, MetaDescription(template.Description))
+			page.MetaKeywords = template.MetaKeywords
+			page.Published = template.Published || !available["is_published"]
+			page.LastModified = template.WriteDate
+
+			// seo_name is the URL name set on the website, which wins over the name
+			source := firstNonEmpty(template.SEOName, template.Name)
+			if page.Slug == "" || page.SlugSource != source {
+				newSlug, err := uniqueProductSlug(tx, template.ID, source)
+				if err != nil {
+					return err
+				}
+				if page.Slug != "" && page.Slug != newSlug {
+					redirect := models.SlugRedirect{Kind: models.SlugKindProduct, Slug: page.Slug, OdooID: template.ID}
+					err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&redirect).Error
+					if err != nil {
+						return fmt.Errorf("failed to keep old slug of product %d: %w", template.ID, err)
+					}
+				}
+				page.Slug, page.SlugSource = newSlug, source
+				// A slug in use is no longer a redirect
+				if err := tx.Where("kind = ? AND slug = ?", models.SlugKindProduct, newSlug).Delete(&models.SlugRedirect{}).Error; err != nil {
+					return fmt.Errorf("failed to clear slug redirect: %w", err)
+				}
+			}
+
+			if err := tx.Save(&page).Error; err != nil {
+				return fmt.Errorf("failed to save page of product %d: %w", template.ID, err)
+			}
+		}
+
+		if removed := missingIDs(ids, found); len(removed) > 0 {
+			if err := tx.Where("template_id IN ?", removed).Delete(&models.ProductPage{}).Error; err != nil {
+				return fmt.Errorf("failed to remove product pages: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// uniqueProductSlug makes a slug from name, suffixed with the template ID
+// when another product already has it
+func uniqueProductSlug(tx *gorm.DB, templateID int64, name string) (string, error) {
+	candidate := slug.Make(name)
+	if candidate == "" {
+		candidate = "product"
+	}
+
+	var taken int64
+	err := tx.Model(&models.ProductPage{}).
+		Where("slug = ? AND template_id <> ?", candidate, templateID).
+		Count(&taken).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to check product slug: %w", err)
+	}
+	if taken > 0 {
+		candidate += "-" + strconv.FormatInt(templateID, 10)
+	}
+	return candidate, nil
+}
+
+// availableFields asks Odoo once which website fields product.template has;
+// they depend on the installed modules
+func (s *SEOService) availableFields(ctx context.Context) (map[string]bool, error) {
+	s.fieldsMu.Lock()
+	defer s.fieldsMu.Unlock()
+	if s.available != nil {
+		return s.available, nil
+	}
+
+	fields, err := s.odooClient.FieldsGet(ctx, "product.template", seoFields...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe product fields: %w", err)
+	}
+	available := make(map[string]bool, len(seoFields))
+	for _, field := range seoFields {
+		_, available[field] = fields[field]
+	}
+	s.available = available
+	return available, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// MetaDescription makes a meta description from a product description for
+// products without one in Odoo. Long descriptions are cut at a word and end
+// in an ellipsis.
+func MetaDescription(description string) string {
+	text := strings.Join(strings.Fields(description), " ")
+	if utf8.RuneCountInString(text) <= metaDescriptionLength {
+		return text
+	}
+	cut := string([]rune(text)[:metaDescriptionLength-1])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
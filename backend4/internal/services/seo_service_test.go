@@ -0,0 +1,115 @@
+package services_test
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"ecommerce/internal/testutils/mocks"
+	"ecommerce/pkg/odoo"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetaDescription(t *testing.T) {
+	assert.Equal(t, "Solid oak desk.", services.MetaDescription("  Solid oak\n\ndesk. "))
+
+	long := strings.Repeat("Ergonomic chair, ", 20)
+	description := services.MetaDescription(long)
+	assert.LessOrEqual(t, utf8.RuneCountInString(description), 160)
+	assert.True(t, strings.HasSuffix(description, "chair…"), description)
+}
+
+func newSEOService(t *testing.T) (*services.SEOService, sqlmock.Sqlmock, *mocks.MockOdooClient) {
+	db, sqlMock := mocks.NewDB(t)
+	odooClient := new(mocks.MockOdooClient)
+	odooClient.On("NewCriteria").Return(nil).Maybe()
+	odooClient.On("NewOptions").Return(nil).Maybe()
+	t.Cleanup(func() { odooClient.AssertExpectations(t) })
+	return services.NewSEOService(db, odooClient, "https://shop.example.com", "https://api.example.com", 0), sqlMock, odooClient
+}
+
+func TestIndexProductPages(t *testing.T) {
+	service, sqlMock, odooClient := newSEOService(t)
+	odooClient.On("FieldsGet", "product.template", mock.Anything).
+		Return(map[string]odoo.Field{"is_published": {Type: "boolean"}}, nil)
+	odooClient.On("SearchRead", "product.template", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			data, _ := json.Marshal([]map[string]interface{}{{"ID": 1, "Name": "Standing Desk", "Published": true}})
+			json.Unmarshal(data, args.Get(3))
+		}).
+		Return(nil)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "product_pages" WHERE template_id IN ($1)`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"template_id", "slug", "slug_source"}).AddRow(1, "desk", "Desk"))
+	// Another product already is a standing desk
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "product_pages" WHERE slug = $1 AND template_id <> $2`)).
+		WithArgs("standing-desk", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	sqlMock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "slug_redirects" ("kind","slug","odoo_id","created_at") VALUES ($1,$2,$3,$4) ON CONFLICT`)).
+		WithArgs(models.SlugKindProduct, "desk", 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "slug_redirects" WHERE kind = $1 AND slug = $2`)).
+		WithArgs(models.SlugKindProduct, "standing-desk-1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	sqlMock.ExpectExec(regexp.QuoteMeta(`UPDATE "product_pages" SET "slug"=$1,"slug_source"=$2,"meta_title"=$3`)).
+		WithArgs("standing-desk-1", "Standing Desk", "Standing Desk", "", "", true, sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectCommit()
+
+	require.NoError(t, service.IndexProducts(context.Background(), []int64{1}, nil))
+}
+
+func TestResolveProductSlug(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("current slug", func(t *testing.T) {
+		service, sqlMock, _ := newSEOService(t)
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "product_pages" WHERE slug = $1`)).
+			WithArgs("standing-desk", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"template_id", "slug"}).AddRow(1, "standing-desk"))
+
+		id, current, err := service.ResolveProductSlug(ctx, "standing-desk")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), id)
+		assert.Equal(t, "standing-desk", current)
+	})
+
+	t.Run("former slug leads to the current one", func(t *testing.T) {
+		service, sqlMock, _ := newSEOService(t)
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "product_pages" WHERE slug = $1`)).
+			WithArgs("desk", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"template_id", "slug"}))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "slug_redirects" WHERE kind = $1 AND slug = $2`)).
+			WithArgs(models.SlugKindProduct, "desk", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"kind", "slug", "odoo_id"}).AddRow(models.SlugKindProduct, "desk", 1))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "product_pages" WHERE template_id = $1`)).
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"template_id", "slug"}).AddRow(1, "standing-desk-1"))
+
+		id, current, err := service.ResolveProductSlug(ctx, "desk")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), id)
+		assert.Equal(t, "standing-desk-1", current)
+	})
+
+	t.Run("unknown slug", func(t *testing.T) {
+		service, sqlMock, _ := newSEOService(t)
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "product_pages"`)).
+			WillReturnRows(sqlmock.NewRows([]string{"template_id", "slug"}))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "slug_redirects"`)).
+			WillReturnRows(sqlmock.NewRows([]string{"kind", "slug", "odoo_id"}))
+
+		_, _, err := service.ResolveProductSlug(ctx, "sofa")
+		assert.ErrorIs(t, err, services.ErrPageNotFound)
+	})
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"ecommerce/internal/models"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	sitemapHeader    = `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+	sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+)
+
+// sitemapChunk is one product sitemap file of the index
+type sitemapChunk struct {
+	Chunk   int
+	LastMod time.Time
+}
+
+// WriteSitemapIndex writes the sitemap index listing the product sitemaps and
+// the category sitemap. Each entry's lastmod is the latest change of the
+// pages it lists.
+func (s *SEOService) WriteSitemapIndex(ctx context.Context, w io.Writer) error {
+	var chunks []sitemapChunk
+	err := s.db.WithContext(ctx).Raw(`
+		SELECT (n - 1) / ? AS chunk, max(last_modified) AS last_mod
+		FROM (
+			SELECT last_modified, row_number() OVER (ORDER BY template_id) AS n
+			FROM product_pages WHERE published
+		) pages
+		GROUP BY chunk ORDER BY chunk`, s.sitemapSize).
+		Scan(&chunks).Error
+	if err != nil {
+		return fmt.Errorf("failed to list product sitemaps: %w", err)
+	}
+
+	var categoriesModified sql.NullTime
+	err = s.db.WithContext(ctx).Model(&models.Category{}).
+		Where("kind = ?", models.CategoryKindPublic).
+		Select("max(write_date)").
+		Scan(&categoriesModified).Error
+	if err != nil {
+		return fmt.Errorf("failed to date category sitemap: %w", err)
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "%s<sitemapindex xmlns=%q>\n", sitemapHeader, sitemapNamespace)
+	for _, chunk := range chunks {
+		loc := fmt.Sprintf("%s/sitemaps/products-%d.xml", s.sitemapBaseURL, chunk.Chunk+1)
+		writeSitemapEntry(out, "sitemap", loc, chunk.LastMod)
+	}
+	if categoriesModified.Valid {
+		writeSitemapEntry(out, "sitemap", s.sitemapBaseURL+"/sitemaps/categories.xml", categoriesModified.Time)
+	}
+	out.WriteString("</sitemapindex>\n")
+	return out.Flush()
+}
+
+// WriteProductSitemap streams page n, counted from 1, of the published
+// product pages. It fails with ErrPageNotFound, before writing anything, when
+// there is no such page.
+func (s *SEOService) WriteProductSitemap(ctx context.Context, w io.Writer, n int) error {
+	if n < 1 {
+		return fmt.Errorf("product sitemap %d: %w", n, ErrPageNotFound)
+	}
+	var published int64
+	if err := s.db.WithContext(ctx).Model(&models.ProductPage{}).Where("published").Count(&published).Error; err != nil {
+		return fmt.Errorf("failed to count product pages: %w", err)
+	}
+	if int64(n-1)*int64(s.sitemapSize) >= published {
+		return fmt.Errorf("product sitemap %d: %w", n, ErrPageNotFound)
+	}
+
+	rows, err := s.db.WithContext(ctx).Model(&models.ProductPage{}).
+		Select("slug, last_modified").
+		Where("published").
+		Order("template_id").
+		Offset((n - 1) * s.sitemapSize).
+		Limit(s.sitemapSize).
+		Rows()
+	if err != nil {
+		return fmt.Errorf("failed to fetch product pages: %w", err)
+	}
+	defer rows.Close()
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "%s<urlset xmlns=%q>\n", sitemapHeader, sitemapNamespace)
+	for rows.Next() {
+		var slug string
+		var lastModified time.Time
+		if err := rows.Scan(&slug, &lastModified); err != nil {
+			return fmt.Errorf("failed to read product page: %w", err)
+		}
+		writeSitemapEntry(out, "url", s.siteURL+productPagePath+slug, lastModified)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read product pages: %w", err)
+	}
+	out.WriteString("</urlset>\n")
+	return out.Flush()
+}
+
+// WriteCategorySitemap writes the sitemap of the website's categories
+func (s *SEOService) WriteCategorySitemap(ctx context.Context, w io.Writer) error {
+	var categories []models.Category
+	err := s.db.WithContext(ctx).
+		Select("slug, write_date").
+		Where("kind = ?", models.CategoryKindPublic).
+		Order("level, sequence, id").
+		Find(&categories).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch categories: %w", err)
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "%s<urlset xmlns=%q>\n", sitemapHeader, sitemapNamespace)
+	for _, category := range categories {
+		writeSitemapEntry(out, "url", s.siteURL+categoryPagePath+category.Slug, category.WriteDate)
+	}
+	out.WriteString("</urlset>\n")
+	return out.Flush()
+}
+
+// writeSitemapEntry writes a <url> or <sitemap> element. lastmod is left out
+// when the date is unknown.
+func writeSitemapEntry(w *bufio.Writer, element, loc string, lastModified time.Time) {
+	fmt.Fprintf(w, "  <%s><loc>", element)
+	xml.EscapeText(w, []byte(loc))
+	w.WriteString("</loc>")
+	if !lastModified.IsZero() {
+		fmt.Fprintf(w, "<lastmod>%s</lastmod>", lastModified.UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "</%s>\n", element)
+}
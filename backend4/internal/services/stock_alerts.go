@@ -0,0 +1,400 @@
+package services
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/pkg/odoo"
+	"ecommerce/pkg/queue"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Notification events about stock
+const (
+	EventStockRestocked = "stock.restocked"
+	EventStockLow       = "stock.low"
+)
+
+// maxRestockQuantity bounds how many units one shopper may wait for; the
+// first subscribers are served first, so more would crowd everyone out
+const maxRestockQuantity = 10
+
+var (
+	ErrVariantNotFound      = errors.New("variant not found")
+	ErrVariantInStock       = errors.New("variant is in stock")
+	ErrInvalidEmail         = errors.New("invalid email address")
+	ErrInvalidQuantity      = fmt.Errorf("quantity must be between 1 and %d", maxRestockQuantity)
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+)
+
+// ReorderRule is the minimum stock of a variant at a warehouse, from an Odoo
+// reordering rule
+type ReorderRule struct {
+	VariantID   int64
+	WarehouseID int64
+	MinQty      float64
+}
+
+// alertVariant is the name of a product.product in alerts
+type alertVariant struct {
+	ID          int64         `xmlrpc:"id"`
+	DisplayName string        `xmlrpc:"display_name"`
+	DefaultCode string        `xmlrpc:"default_code"`
+	Template    odoo.Many2One `xmlrpc:"product_tmpl_id"`
+}
+
+// StockAlerts tells shoppers when a variant they wait for is back in stock,
+// and operations when stock runs low. Both go out through the notifications
+// queue as the stock sync reports changes.
+type StockAlerts struct {
+	db           *gorm.DB
+	odooClient   odoo.OdooClient
+	queueClient  queue.Publisher
+	stockService *StockService
+	minStock     float64 // Threshold for variants without a reordering rule; 0 for none
+	alertEmail   string  // Where low-stock alerts go; empty for none
+}
+
+func NewStockAlerts(db *gorm.DB, odooClient odoo.OdooClient, queueClient queue.Publisher, stockService *StockService, minStock float64, alertEmail string) *StockAlerts {
+	return &StockAlerts{
+		db:           db,
+		odooClient:   odooClient,
+		queueClient:  queueClient,
+		stockService: stockService,
+		minStock:     minStock,
+		alertEmail:   alertEmail,
+	}
+}
+
+// Subscribe asks for an email to a signed-in shopper's address when a
+// variant that is out of stock comes back. Only the account's own address is
+// taken, so nobody can sign others up. Subscribing again to the same variant
+// returns the waiting subscription.
+func (a *StockAlerts) Subscribe(ctx context.Context, variantID int64, userID uint, email, locale string, quantity int) (*models.RestockSubscription, error) {
+	address, err := mail.ParseAddress(email)
+	if err != nil {
+		return nil, ErrInvalidEmail
+	}
+	email = strings.ToLower(address.Address)
+	if quantity == 0 {
+		quantity = 1
+	}
+	if quantity < 0 || quantity > maxRestockQuantity {
+		return nil, ErrInvalidQuantity
+	}
+
+	var variants []alertVariant
+	options := a.odooClient.NewOptions().FetchFields("id", "product_tmpl_id")
+	if err := a.odooClient.Read(ctx, "product.product", []int64{variantID}, options, &variants); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return nil, fmt.Errorf("failed to fetch variant: %w", err)
+	}
+	if len(variants) == 0 {
+		return nil, ErrVariantNotFound
+	}
+
+	availability, err := a.stockService.Availability(ctx, []int64{variantID}, "", float64(quantity))
+	if err != nil {
+		return nil, err
+	}
+	if len(availability) > 0 && availability[0].InStock {
+		return nil, ErrVariantInStock
+	}
+
+	var subscription models.RestockSubscription
+	err = a.db.WithContext(ctx).
+		Where("variant_id = ? AND email = ? AND status = ?", variantID, email, models.RestockPending).
+		First(&subscription).Error
+	if err == nil {
+		return &subscription, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to fetch subscription: %w", err)
+	}
+
+	subscription = models.RestockSubscription{
+		Token:      uuid.New().String(),
+		VariantID:  variantID,
+		TemplateID: variants[0].Template.ID,
+		UserID:     &userID,
+		Email:      email,
+		Locale:     locale,
+		Quantity:   quantity,
+		Status:     models.RestockPending,
+	}
+	if err := a.db.WithContext(ctx).Create(&subscription).Error; err != nil {
+		return nil, fmt.Errorf("failed to save subscription: %w", err)
+	}
+	return &subscription, nil
+}
+
+// Unsubscribe cancels a waiting subscription by its token
+func (a *StockAlerts) Unsubscribe(ctx context.Context, token string) error {
+	result := a.db.WithContext(ctx).Model(&models.RestockSubscription{}).
+		Where("token = ? AND status = ?", token, models.RestockPending).
+		Update("status", models.RestockCancelled)
+	if result.Error != nil {
+		return fmt.Errorf("failed to cancel subscription: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+// StockChanged is called by the stock sync. Variants that went from none
+// available to some notify their subscribers; variants that fell below their
+// threshold raise a low-stock alert.
+func (a *StockAlerts) StockChanged(ctx context.Context, changes []models.StockChange) error {
+	before := make(map[int64]float64)
+	after := make(map[int64]float64)
+	for _, change := range changes {
+		before[change.VariantID] += change.Before
+		after[change.VariantID] += change.After
+	}
+
+	var errs []error
+	for variantID, available := range after {
+		if before[variantID] <= 0 && available > 0 {
+			if err := a.notifyRestocked(ctx, variantID, available); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if a.alertEmail != "" {
+		if err := a.alertLowStock(ctx, changes); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// notifyRestocked notifies the subscribers of a variant that the available
+// units cover, earliest first. The rest wait for the next restock. Rows are
+// locked so that replicas syncing at once do not notify anyone twice, and
+// only subscriptions whose notification was queued are marked notified.
+func (a *StockAlerts) notifyRestocked(ctx context.Context, variantID int64, available float64) error {
+	// The emails go out even without the product's name
+	variants, err := a.alertVariants(ctx, []int64{variantID})
+	if err != nil {
+		log.Printf("Failed to fetch restocked variant %d: %v", variantID, err)
+	}
+	variant := variants[variantID]
+
+	// A failed publish leaves the rest waiting; what was queued is still
+	// marked, and the failure reported after
+	var publishErr error
+	err = a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var pending []models.RestockSubscription
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("variant_id = ? AND status = ?", variantID, models.RestockPending).
+			Order("created_at, id").
+			Find(&pending).Error
+		if err != nil {
+			return fmt.Errorf("failed to fetch restock subscriptions: %w", err)
+		}
+		served := AllotRestock(pending, available)
+		if len(served) == 0 {
+			return nil
+		}
+
+		var path string
+		var page models.ProductPage
+		if err := tx.Select("slug").First(&page, "template_id = ?", served[0].TemplateID).Error; err == nil {
+			path = productPagePath + page.Slug
+		}
+
+		var ids []uint
+		for _, subscription := range served {
+			msg := queue.Message{
+				ID:   fmt.Sprintf("%s:%d", EventStockRestocked, subscription.ID),
+				Type: EventStockRestocked,
+				Payload: models.RestockNotification{
+					SubscriptionID: subscription.ID,
+					Email:          subscription.Email,
+					Locale:         subscription.Locale,
+					VariantID:      variantID,
+					ProductID:      subscription.TemplateID,
+					Name:           variant.DisplayName,
+					Path:           path,
+					Quantity:       subscription.Quantity,
+				},
+			}
+			if err := a.queueClient.Publish(ctx, "notifications", msg); err != nil {
+				publishErr = fmt.Errorf("failed to publish restock notification %d: %w", subscription.ID, err)
+				break
+			}
+			ids = append(ids, subscription.ID)
+		}
+
+		if len(ids) > 0 {
+			err = tx.Model(&models.RestockSubscription{}).Where("id IN ?", ids).
+				Updates(map[string]interface{}{"status": models.RestockNotified, "notified_at": time.Now()}).Error
+			if err != nil {
+				return fmt.Errorf("failed to mark restock subscriptions notified: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return publishErr
+}
+
+// AllotRestock returns the subscriptions, in the order they were made, whose
+// wanted quantities the available units cover. The last one served may get
+// fewer than it asked for. Quantities count up to maxRestockQuantity.
+func AllotRestock(pending []models.RestockSubscription, available float64) []models.RestockSubscription {
+	var served []models.RestockSubscription
+	for _, subscription := range pending {
+		if available <= 0 {
+			break
+		}
+		served = append(served, subscription)
+		available -= float64(min(max(subscription.Quantity, 1), maxRestockQuantity))
+	}
+	return served
+}
+
+// alertLowStock raises one alert for the variants in changes that fell below
+// their threshold
+func (a *StockAlerts) alertLowStock(ctx context.Context, changes []models.StockChange) error {
+	variantIDs := make([]int64, 0, len(changes))
+	for _, change := range changes {
+		variantIDs = append(variantIDs, change.VariantID)
+	}
+	variantIDs = uniqueIDs(variantIDs)
+
+	var orderpoints []odoo.OdooOrderpoint
+	criteria := a.odooClient.NewCriteria().Add("product_id", "in", variantIDs)
+	options := a.odooClient.NewOptions().FetchFields("id", "product_id", "warehouse_id", "product_min_qty")
+	if err := a.odooClient.SearchRead(ctx, "stock.warehouse.orderpoint", criteria, options, &orderpoints); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return fmt.Errorf("failed to fetch reordering rules from Odoo: %w", err)
+	}
+	rules := make([]ReorderRule, 0, len(orderpoints))
+	for _, orderpoint := range orderpoints {
+		rule := ReorderRule{VariantID: orderpoint.Product.ID, MinQty: orderpoint.MinQty}
+		if orderpoint.Warehouse != nil {
+			rule.WarehouseID = orderpoint.Warehouse.ID
+		}
+		rules = append(rules, rule)
+	}
+
+	items := LowStock(changes, rules, a.minStock)
+	if len(items) == 0 {
+		return nil
+	}
+
+	lowIDs := make([]int64, len(items))
+	for i, item := range items {
+		lowIDs[i] = item.VariantID
+	}
+	variants, err := a.alertVariants(ctx, lowIDs)
+	if err != nil {
+		return err
+	}
+	var warehouses []models.Warehouse
+	if err := a.db.WithContext(ctx).Find(&warehouses).Error; err != nil {
+		return fmt.Errorf("failed to fetch warehouses: %w", err)
+	}
+	warehouseNames := make(map[int64]string, len(warehouses))
+	for _, warehouse := range warehouses {
+		warehouseNames[warehouse.OdooID] = warehouse.Name
+	}
+	for i := range items {
+		variant := variants[items[i].VariantID]
+		items[i].Name = variant.DisplayName
+		items[i].SKU = variant.DefaultCode
+		items[i].Warehouse = warehouseNames[items[i].WarehouseID]
+	}
+
+	msg := queue.Message{
+		Type:    EventStockLow,
+		Payload: models.LowStockAlert{Email: a.alertEmail, Items: items, RaisedAt: time.Now()},
+	}
+	if err := a.queueClient.Publish(ctx, "notifications", msg); err != nil {
+		return fmt.Errorf("failed to publish low-stock alert: %w", err)
+	}
+	return nil
+}
+
+// LowStock returns the variants whose stock fell below their threshold in
+// changes. A variant with reordering rules is held to their minimums at
+// their warehouses, or over all warehouses for a rule without one; any other
+// variant is held to minStock over all warehouses.
+func LowStock(changes []models.StockChange, rules []ReorderRule, minStock float64) []models.LowStockItem {
+	type key struct{ variant, warehouse int64 }
+	before := make(map[key]float64)
+	after := make(map[key]float64)
+	templates := make(map[int64]int64)
+	var variantIDs []int64
+	for _, change := range changes {
+		if _, ok := templates[change.VariantID]; !ok {
+			variantIDs = append(variantIDs, change.VariantID)
+		}
+		templates[change.VariantID] = change.TemplateID
+		for _, k := range []key{{change.VariantID, change.WarehouseID}, {change.VariantID, 0}} {
+			before[k] += change.Before
+			after[k] += change.After
+			if change.WarehouseID == 0 {
+				break // Stock outside warehouses counts once, in the total
+			}
+		}
+	}
+
+	var items []models.LowStockItem
+	fell := func(k key, threshold float64) {
+		if before[k] >= threshold && after[k] < threshold {
+			items = append(items, models.LowStockItem{
+				VariantID:   k.variant,
+				TemplateID:  templates[k.variant],
+				WarehouseID: k.warehouse,
+				Available:   after[k],
+				Threshold:   threshold,
+			})
+		}
+	}
+
+	ruled := make(map[int64]bool)
+	for _, rule := range rules {
+		if _, ok := templates[rule.VariantID]; !ok {
+			continue
+		}
+		ruled[rule.VariantID] = true
+		fell(key{rule.VariantID, rule.WarehouseID}, rule.MinQty)
+	}
+	if minStock > 0 {
+		for _, variantID := range variantIDs {
+			if !ruled[variantID] {
+				fell(key{variantID, 0}, minStock)
+			}
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Available < items[j].Available
+	})
+	return items
+}
+
+func (a *StockAlerts) alertVariants(ctx context.Context, variantIDs []int64) (map[int64]alertVariant, error) {
+	var records []alertVariant
+	options := a.odooClient.NewOptions().FetchFields("id", "display_name", "default_code", "product_tmpl_id")
+	if err := a.odooClient.Read(ctx, "product.product", variantIDs, options, &records); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return nil, fmt.Errorf("failed to fetch variants from Odoo: %w", err)
+	}
+	variants := make(map[int64]alertVariant, len(records))
+	for _, record := range records {
+		variants[record.ID] = record
+	}
+	return variants, nil
+}
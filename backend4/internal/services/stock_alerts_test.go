@@ -0,0 +1,122 @@
+package services_test
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"ecommerce/internal/testutils/mocks"
+	"ecommerce/pkg/queue"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllotRestock(t *testing.T) {
+	pending := []models.RestockSubscription{
+		{ID: 1, Quantity: 2},
+		{ID: 2, Quantity: 1},
+		{ID: 3, Quantity: 1},
+	}
+
+	t.Run("first come, first served", func(t *testing.T) {
+		served := services.AllotRestock(pending, 3)
+		require.Len(t, served, 2)
+		assert.Equal(t, uint(1), served[0].ID)
+		assert.Equal(t, uint(2), served[1].ID)
+	})
+
+	t.Run("the last one served may get fewer", func(t *testing.T) {
+		served := services.AllotRestock(pending, 1)
+		require.Len(t, served, 1)
+		assert.Equal(t, uint(1), served[0].ID)
+	})
+
+	t.Run("nothing available", func(t *testing.T) {
+		assert.Empty(t, services.AllotRestock(pending, 0))
+	})
+
+	t.Run("quantities are capped", func(t *testing.T) {
+		greedy := []models.RestockSubscription{{ID: 1, Quantity: 500}, {ID: 2, Quantity: 1}}
+		assert.Len(t, services.AllotRestock(greedy, 11), 2)
+	})
+}
+
+func newStockAlerts(t *testing.T) (*services.StockAlerts, sqlmock.Sqlmock, *mocks.MockOdooClient, *mocks.MockPublisher) {
+	db, sqlMock := mocks.NewDB(t)
+	odooClient := new(mocks.MockOdooClient)
+	odooClient.On("NewOptions").Return(nil).Maybe()
+	publisher := new(mocks.MockPublisher)
+	t.Cleanup(func() {
+		odooClient.AssertExpectations(t)
+		publisher.AssertExpectations(t)
+	})
+	return services.NewStockAlerts(db, odooClient, publisher, nil, 0, ""), sqlMock, odooClient, publisher
+}
+
+func TestSubscribeCapsQuantity(t *testing.T) {
+	alerts, _, _, _ := newStockAlerts(t)
+	_, err := alerts.Subscribe(context.Background(), 21, 7, "shopper@example.com", "", 11)
+	assert.ErrorIs(t, err, services.ErrInvalidQuantity)
+}
+
+func TestRestockMarksOnlyQueuedNotifications(t *testing.T) {
+	alerts, sqlMock, odooClient, publisher := newStockAlerts(t)
+	odooClient.On("Read", "product.product", []int64{21}, mock.Anything, mock.Anything).Return(nil)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "restock_subscriptions" WHERE variant_id = $1 AND status = $2 ORDER BY created_at, id FOR UPDATE SKIP LOCKED`)).
+		WithArgs(21, models.RestockPending).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "variant_id", "template_id", "email", "quantity", "status"}).
+			AddRow(1, 21, 2, "first@example.com", 1, models.RestockPending).
+			AddRow(2, 21, 2, "second@example.com", 1, models.RestockPending))
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT "slug" FROM "product_pages"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"slug"}).AddRow("walnut-desk"))
+	publisher.On("Publish", "notifications", mock.MatchedBy(func(msg queue.Message) bool {
+		return msg.ID == "stock.restocked:1"
+	})).Return(nil)
+	publisher.On("Publish", "notifications", mock.MatchedBy(func(msg queue.Message) bool {
+		return msg.ID == "stock.restocked:2"
+	})).Return(errors.New("queue is down"))
+	sqlMock.ExpectExec(regexp.QuoteMeta(`UPDATE "restock_subscriptions" SET "notified_at"=$1,"status"=$2,"updated_at"=$3 WHERE id IN ($4)`)).
+		WithArgs(sqlmock.AnyArg(), models.RestockNotified, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectCommit()
+
+	err := alerts.StockChanged(context.Background(), []models.StockChange{{VariantID: 21, TemplateID: 2, Before: 0, After: 2}})
+	assert.Error(t, err, "the second subscription is still waiting")
+}
+
+func TestLowStock(t *testing.T) {
+	changes := []models.StockChange{
+		{VariantID: 10, TemplateID: 1, WarehouseID: 1, Before: 8, After: 3},
+		{VariantID: 10, TemplateID: 1, WarehouseID: 2, Before: 6, After: 6},
+		{VariantID: 11, TemplateID: 1, WarehouseID: 1, Before: 6, After: 4},
+		{VariantID: 12, TemplateID: 2, WarehouseID: 1, Before: 2, After: 1},
+	}
+
+	t.Run("reordering rules per warehouse", func(t *testing.T) {
+		items := services.LowStock(changes, []services.ReorderRule{
+			{VariantID: 10, WarehouseID: 1, MinQty: 5},
+			{VariantID: 10, WarehouseID: 2, MinQty: 5},
+		}, 0)
+		require.Len(t, items, 1)
+		assert.Equal(t, models.LowStockItem{VariantID: 10, TemplateID: 1, WarehouseID: 1, Available: 3, Threshold: 5}, items[0])
+	})
+
+	t.Run("minimum stock over all warehouses", func(t *testing.T) {
+		items := services.LowStock(changes, nil, 5)
+		require.Len(t, items, 1, "variant 10 still has 9 overall, variant 12 was low already")
+		assert.Equal(t, int64(11), items[0].VariantID)
+		assert.Zero(t, items[0].WarehouseID)
+	})
+
+	t.Run("rules take precedence over minimum stock", func(t *testing.T) {
+		items := services.LowStock(changes, []services.ReorderRule{{VariantID: 11, WarehouseID: 1, MinQty: 2}}, 5)
+		assert.Empty(t, items)
+	})
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/pkg/redis"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StockHolds reserves variant quantities in Redis while a checkout is in progress,
+// so shoppers cannot cart stock that is already being paid for. Each variant keeps
+// its holds in a sorted set scored by expiry, so holds never released still lapse.
+type StockHolds struct {
+	redisClient *redis.Client
+}
+
+func NewStockHolds(redisClient *redis.Client) *StockHolds {
+	return &StockHolds{
+		redisClient: redisClient,
+	}
+}
+
+func stockHoldKey(checkoutID string) string {
+	return fmt.Sprintf("stock_hold:%s", checkoutID)
+}
+
+func stockHoldsKey(variantID uint) string {
+	return fmt.Sprintf("stock_holds:%d", variantID)
+}
+
+// stockHoldMember is the entry of a checkout in a variant's holds
+func stockHoldMember(checkoutID string, quantity int) string {
+	return fmt.Sprintf("%s:%d", checkoutID, quantity)
+}
+
+// Place holds the quantities of every cart item for the given checkout until
+// it is released or ttl passes. Bundles hold their components, the stock
+// they ship from. Nothing stays held when placing fails.
+func (h *StockHolds) Place(ctx context.Context, checkoutID string, items []models.CartItem, ttl time.Duration) error {
+	quantities := make(map[uint]int, len(items))
+	for _, item := range items {
+		if len(item.Components) == 0 {
+			quantities[item.VariantID] += item.Quantity
+			continue
+		}
+		for _, component := range item.Components {
+			quantities[component.VariantID] += int(math.Ceil(float64(item.Quantity) * component.Quantity))
+		}
+	}
+	held := make([]models.CartItem, 0, len(quantities))
+	for variantID, quantity := range quantities {
+		held = append(held, models.CartItem{VariantID: variantID, Quantity: quantity})
+	}
+
+	if err := h.redisClient.Set(ctx, stockHoldKey(checkoutID), held, ttl); err != nil {
+		return fmt.Errorf("failed to save stock hold: %w", err)
+	}
+
+	expiresAt := float64(time.Now().Add(ttl).Unix())
+	for i, item := range held {
+		key := stockHoldsKey(item.VariantID)
+		err := h.redisClient.ZAdd(ctx, key, expiresAt, stockHoldMember(checkoutID, item.Quantity))
+		if err == nil {
+			// Sets of variants no longer held go once their last hold lapses
+			err = h.redisClient.Expire(ctx, key, ttl)
+		}
+		if err != nil {
+			h.remove(ctx, checkoutID, held[:i+1])
+			return fmt.Errorf("failed to hold stock for variant %d: %w", item.VariantID, err)
+		}
+	}
+
+	return nil
+}
+
+// Release returns the held quantities of a checkout. Releasing twice is a no-op.
+func (h *StockHolds) Release(ctx context.Context, checkoutID string) error {
+	var items []models.CartItem
+	if err := h.redisClient.Get(ctx, stockHoldKey(checkoutID), &items); err != nil {
+		return fmt.Errorf("failed to get stock hold: %w", err)
+	}
+	return h.remove(ctx, checkoutID, items)
+}
+
+// Held returns the quantity of a variant currently held by open checkouts,
+// in bundles included
+func (h *StockHolds) Held(ctx context.Context, variantID uint) (float64, error) {
+	members, err := h.redisClient.ZMembersAbove(ctx, stockHoldsKey(variantID), float64(time.Now().Unix()))
+	if err != nil {
+		return 0, err
+	}
+	var held float64
+	for _, member := range members {
+		quantity, err := strconv.Atoi(member[strings.LastIndex(member, ":")+1:])
+		if err != nil {
+			continue
+		}
+		held += float64(quantity)
+	}
+	return held, nil
+}
+
+// remove drops the holds of a checkout on items, then the checkout's record of
+// them. Holds that cannot be dropped lapse on their own.
+func (h *StockHolds) remove(ctx context.Context, checkoutID string, items []models.CartItem) error {
+	var failed error
+	for _, item := range items {
+		if err := h.redisClient.ZRem(ctx, stockHoldsKey(item.VariantID), stockHoldMember(checkoutID, item.Quantity)); err != nil && failed == nil {
+			failed = fmt.Errorf("failed to release stock for variant %d: %w", item.VariantID, err)
+		}
+	}
+	if err := h.redisClient.Delete(ctx, stockHoldKey(checkoutID)); err != nil {
+		return err
+	}
+	return failed
+}
@@ -0,0 +1,92 @@
+package services_test
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"ecommerce/internal/testutils/mocks"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStockHolds(t *testing.T) {
+	ctx := context.Background()
+	items := []models.CartItem{
+		{ProductID: 1, VariantID: 10, Quantity: 2},
+		{ProductID: 1, VariantID: 11, Quantity: 1},
+	}
+
+	held := func(t *testing.T, holds *services.StockHolds, variantID uint) float64 {
+		quantity, err := holds.Held(ctx, variantID)
+		require.NoError(t, err)
+		return quantity
+	}
+
+	t.Run("checkouts hold until released", func(t *testing.T) {
+		client, _ := mocks.NewRedis(t)
+		holds := services.NewStockHolds(client)
+
+		require.NoError(t, holds.Place(ctx, "a", items, time.Hour))
+		require.NoError(t, holds.Place(ctx, "b", items[:1], time.Hour))
+		assert.Equal(t, 4.0, held(t, holds, 10))
+		assert.Equal(t, 1.0, held(t, holds, 11))
+
+		require.NoError(t, holds.Release(ctx, "a"))
+		assert.Equal(t, 2.0, held(t, holds, 10))
+		assert.Zero(t, held(t, holds, 11))
+
+		// Releasing twice returns nothing more
+		require.NoError(t, holds.Release(ctx, "a"))
+		assert.Equal(t, 2.0, held(t, holds, 10))
+	})
+
+	t.Run("holds lapse without a release", func(t *testing.T) {
+		client, server := mocks.NewRedis(t)
+		holds := services.NewStockHolds(client)
+
+		require.NoError(t, holds.Place(ctx, "a", items, time.Hour))
+		// The checkout's record of its holds expired before the sweeper came
+		server.Del("stock_hold:a")
+		require.NoError(t, holds.Release(ctx, "a"))
+		assert.Equal(t, 2.0, held(t, holds, 10))
+
+		_, err := server.ZAdd("stock_holds:10", float64(time.Now().Add(-time.Minute).Unix()), "old:5")
+		require.NoError(t, err)
+		assert.Equal(t, 2.0, held(t, holds, 10))
+		members, err := server.ZMembers("stock_holds:10")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a:2"}, members)
+	})
+
+	t.Run("bundles hold their components", func(t *testing.T) {
+		client, _ := mocks.NewRedis(t)
+		holds := services.NewStockHolds(client)
+		bundle := models.CartItem{ProductID: 3, VariantID: 30, Quantity: 2, Components: []models.CartComponent{
+			{VariantID: 10, Quantity: 1},
+			{VariantID: 20, Quantity: 0.5},
+		}}
+
+		require.NoError(t, holds.Place(ctx, "a", append([]models.CartItem{bundle}, items...), time.Hour))
+		assert.Equal(t, 4.0, held(t, holds, 10))
+		assert.Equal(t, 1.0, held(t, holds, 20))
+		assert.Zero(t, held(t, holds, 30))
+
+		require.NoError(t, holds.Release(ctx, "a"))
+		assert.Zero(t, held(t, holds, 10))
+		assert.Zero(t, held(t, holds, 20))
+	})
+
+	t.Run("a failed placement holds nothing", func(t *testing.T) {
+		client, server := mocks.NewRedis(t)
+		holds := services.NewStockHolds(client)
+
+		// Variant 11's holds cannot be written
+		require.NoError(t, server.Set("stock_holds:11", "corrupt"))
+		assert.Error(t, holds.Place(ctx, "a", items, time.Hour))
+		assert.Zero(t, held(t, holds, 10))
+		assert.False(t, server.Exists("stock_hold:a"))
+	})
+}
@@ -0,0 +1,449 @@
+package services
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WarehouseOption is a warehouse that can fulfil an order, with its stock of
+// the ordered variants
+type WarehouseOption struct {
+	Warehouse models.Warehouse
+	Available map[int64]float64 // By Odoo variant ID
+}
+
+// StockService reports stock per warehouse from the levels the sync mirrors
+// from Odoo, and picks the warehouse orders ship from. Which destinations a
+// warehouse ships to is configured by warehouse code; warehouses without a
+// configured list ship anywhere.
+type StockService struct {
+	db         *gorm.DB
+	stockHolds *StockHolds
+	shipsTo    map[string]map[string]bool // Warehouse code to upper-cased country codes
+}
+
+func NewStockService(db *gorm.DB, stockHolds *StockHolds, shipsTo map[string][]string) *StockService {
+	destinations := make(map[string]map[string]bool, len(shipsTo))
+	for code, countries := range shipsTo {
+		destinations[code] = make(map[string]bool, len(countries))
+		for _, country := range countries {
+			destinations[code][strings.ToUpper(strings.TrimSpace(country))] = true
+		}
+	}
+	return &StockService{db: db, stockHolds: stockHolds, shipsTo: destinations}
+}
+
+// Availability reports the stock of variants per warehouse. With a country
+// only warehouses shipping there count. The earliest ship date is that of
+// the fastest warehouse having quantity in stock, or for made-to-order
+// variants short of it, that of the fastest warehouse once they are made.
+func (s *StockService) Availability(ctx context.Context, variantIDs []int64, country string, quantity float64) ([]models.Availability, error) {
+	if quantity <= 0 {
+		quantity = 1
+	}
+	options, err := s.warehouseOptions(ctx, variantIDs, country)
+	if err != nil {
+		return nil, err
+	}
+
+	madeToOrder, err := s.madeToOrder(ctx, variantIDs)
+	if err != nil {
+		return nil, err
+	}
+	committed, err := s.committed(ctx, variantIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	availability := make([]models.Availability, 0, len(variantIDs))
+	for _, variantID := range variantIDs {
+		entry := models.Availability{VariantID: variantID, Warehouses: []models.WarehouseAvailability{}}
+		for _, option := range options {
+			available := option.Available[variantID]
+			if available <= 0 {
+				continue
+			}
+			warehouse := models.WarehouseAvailability{
+				WarehouseID: option.Warehouse.OdooID,
+				Code:        option.Warehouse.Code,
+				Name:        option.Warehouse.Name,
+				Quantity:    available,
+				LeadDays:    option.Warehouse.LeadDays,
+				ShipDate:    today.AddDate(0, 0, option.Warehouse.LeadDays),
+			}
+			entry.Warehouses = append(entry.Warehouses, warehouse)
+			entry.Quantity += available
+			if available >= quantity && (entry.EarliestShipDate == nil || warehouse.ShipDate.Before(*entry.EarliestShipDate)) {
+				shipDate := warehouse.ShipDate
+				entry.EarliestShipDate = &shipDate
+			}
+		}
+
+		// Committed units are not tied to a warehouse, so they only lower the total
+		entry.Quantity -= committed[variantID]
+		if entry.Quantity < 0 {
+			entry.Quantity = 0
+		}
+		entry.InStock = entry.Quantity >= quantity
+		if !entry.InStock {
+			entry.EarliestShipDate = nil
+			if mto, ok := madeToOrder[variantID]; ok {
+				entry.MadeToOrder = true
+				entry.ProductionDays = ProductionDays(mto.product, mto.components, mto.componentStock, quantity)
+				if len(options) > 0 {
+					shipDate := today.AddDate(0, 0, entry.ProductionDays+options[0].Warehouse.LeadDays)
+					entry.EarliestShipDate = &shipDate
+				}
+			}
+		}
+		availability = append(availability, entry)
+	}
+	return availability, nil
+}
+
+// ProductAvailability reports the availability of every variant of a
+// product template that has stock records, is made to order or is a kit
+func (s *StockService) ProductAvailability(ctx context.Context, templateID int64, country string, quantity float64) ([]models.Availability, error) {
+	var variantIDs []int64
+	err := s.db.WithContext(ctx).Raw(
+		"SELECT variant_id FROM stock_levels WHERE template_id = ? "+
+			"UNION SELECT variant_id FROM made_to_orders WHERE template_id = ? "+
+			"UNION SELECT variant_id FROM kits WHERE template_id = ? ORDER BY variant_id",
+		templateID, templateID, templateID,
+	).Scan(&variantIDs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch product variants: %w", err)
+	}
+	return s.Availability(ctx, variantIDs, country, quantity)
+}
+
+// MadeToOrder reports whether a variant can be sold without stock
+func (s *StockService) MadeToOrder(ctx context.Context, variantID int64) (bool, error) {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.MadeToOrder{}).Where("variant_id = ?", variantID).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to fetch made-to-order product: %w", err)
+	}
+	return count > 0, nil
+}
+
+// EstimateShipDate is when an order for items shipping to country is
+// expected to ship: once its slowest item can. Items that cannot ship at all
+// are left out; nil when none can.
+func (s *StockService) EstimateShipDate(ctx context.Context, items []models.CartItem, country string) (*time.Time, error) {
+	demand := make(map[int64]float64, len(items))
+	for _, item := range items {
+		if item.VariantID != 0 {
+			demand[int64(item.VariantID)] += float64(item.Quantity)
+		}
+	}
+
+	var estimate *time.Time
+	for variantID, quantity := range demand {
+		availability, err := s.Availability(ctx, []int64{variantID}, country, quantity)
+		if err != nil {
+			return nil, err
+		}
+		shipDate := availability[0].EarliestShipDate
+		if shipDate != nil && (estimate == nil || shipDate.After(*estimate)) {
+			estimate = shipDate
+		}
+	}
+	return estimate, nil
+}
+
+// KitAvailable is how many kits the stock of their components makes up
+func KitAvailable(components []models.KitComponent, stock map[int64]float64) float64 {
+	if len(components) == 0 {
+		return 0
+	}
+	kits := math.Inf(1)
+	for _, component := range components {
+		if component.Quantity <= 0 {
+			continue
+		}
+		kits = math.Min(kits, math.Floor(stock[component.ComponentID]/component.Quantity))
+	}
+	if math.IsInf(kits, 1) || kits < 0 {
+		return 0
+	}
+	return kits
+}
+
+// ProductionDays is how long quantity of a made-to-order variant takes to
+// make or buy: a manufactured one is made once components short of stock
+// arrive, the slowest of them deciding
+func ProductionDays(product models.MadeToOrder, components []models.BomComponent, componentStock map[int64]float64, quantity float64) int {
+	if !product.Manufactured {
+		return product.ReplenishDays
+	}
+	waiting := 0
+	for _, component := range components {
+		if componentStock[component.ComponentID] < component.Quantity*quantity {
+			waiting = max(waiting, component.ReplenishDays)
+		}
+	}
+	return product.ProduceDays + waiting
+}
+
+// madeToOrderProduct is a made-to-order variant with what it is made from
+type madeToOrderProduct struct {
+	product        models.MadeToOrder
+	components     []models.BomComponent
+	componentStock map[int64]float64
+}
+
+// madeToOrder loads those of the variants that are made to order, by ID
+func (s *StockService) madeToOrder(ctx context.Context, variantIDs []int64) (map[int64]madeToOrderProduct, error) {
+	products := make(map[int64]madeToOrderProduct)
+	if len(variantIDs) == 0 {
+		return products, nil
+	}
+	var records []models.MadeToOrder
+	if err := s.db.WithContext(ctx).Where("variant_id IN ?", variantIDs).Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch made-to-order products: %w", err)
+	}
+	if len(records) == 0 {
+		return products, nil
+	}
+
+	ids := make([]int64, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.VariantID)
+	}
+	var components []models.BomComponent
+	if err := s.db.WithContext(ctx).Where("variant_id IN ?", ids).Find(&components).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch bill of materials: %w", err)
+	}
+
+	var stock []struct {
+		VariantID int64
+		Available float64
+	}
+	if len(components) > 0 {
+		err := s.db.WithContext(ctx).Model(&models.StockLevel{}).
+			Select("variant_id, sum(quantity - reserved) AS available").
+			Where("variant_id IN (?)", s.db.Model(&models.BomComponent{}).Select("component_id").Where("variant_id IN ?", ids)).
+			Group("variant_id").
+			Scan(&stock).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch component stock: %w", err)
+		}
+	}
+	componentStock := make(map[int64]float64, len(stock))
+	for _, level := range stock {
+		componentStock[level.VariantID] = level.Available
+	}
+
+	for _, record := range records {
+		products[record.VariantID] = madeToOrderProduct{product: record, componentStock: componentStock}
+	}
+	for _, component := range components {
+		product := products[component.VariantID]
+		product.components = append(product.components, component)
+		products[component.VariantID] = product
+	}
+	return products, nil
+}
+
+// committed sums, by variant, the units Odoo counts as free that the shop
+// has promised: those held by open checkouts and those allocated to
+// backorders not released yet
+func (s *StockService) committed(ctx context.Context, variantIDs []int64) (map[int64]float64, error) {
+	committed, err := s.allocated(ctx, variantIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, variantID := range variantIDs {
+		held, err := s.stockHolds.Held(ctx, uint(variantID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch stock holds: %w", err)
+		}
+		committed[variantID] += held
+	}
+	return committed, nil
+}
+
+// allocated sums, by variant, the received units allocated to backorders of
+// orders not released yet. Odoo still counts them as free stock until it
+// reserves the order's deliveries.
+func (s *StockService) allocated(ctx context.Context, variantIDs []int64) (map[int64]float64, error) {
+	allocated := make(map[int64]float64)
+	if len(variantIDs) == 0 {
+		return allocated, nil
+	}
+	var rows []struct {
+		VariantID int64
+		Allocated float64
+	}
+	err := s.db.WithContext(ctx).Model(&models.Backorder{}).
+		Select("variant_id, sum(allocated) AS allocated").
+		Where("variant_id IN ? AND status IN ? AND allocated > 0", variantIDs, []string{models.BackorderWaiting, models.BackorderAllocated}).
+		Group("variant_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch allocated backorders: %w", err)
+	}
+	for _, row := range rows {
+		allocated[row.VariantID] = row.Allocated
+	}
+	return allocated, nil
+}
+
+// ChooseWarehouse picks the warehouse an order for items shipping to country
+// is fulfilled from, nil when no synced warehouse ships there
+func (s *StockService) ChooseWarehouse(ctx context.Context, items []models.CartItem, country string) (*models.Warehouse, error) {
+	demand := make(map[int64]float64, len(items))
+	variantIDs := make([]int64, 0, len(items))
+	for _, item := range items {
+		if item.VariantID == 0 {
+			continue
+		}
+		if _, ok := demand[int64(item.VariantID)]; !ok {
+			variantIDs = append(variantIDs, int64(item.VariantID))
+		}
+		demand[int64(item.VariantID)] += float64(item.Quantity)
+	}
+
+	options, err := s.warehouseOptions(ctx, variantIDs, country)
+	if err != nil {
+		return nil, err
+	}
+	return SelectWarehouse(options, demand), nil
+}
+
+// SelectWarehouse picks the option to fulfil demand from: the fastest that
+// has everything in stock, or else the one that can ship the most units now.
+// Ties go to the warehouse listed first in Odoo.
+func SelectWarehouse(options []WarehouseOption, demand map[int64]float64) *models.Warehouse {
+	var best *WarehouseOption
+	var bestCovered float64
+	bestComplete := false
+	for i := range options {
+		option := &options[i]
+		covered, complete := 0.0, true
+		for variantID, quantity := range demand {
+			available := option.Available[variantID]
+			if available < quantity {
+				complete = false
+			}
+			covered += min(available, quantity)
+		}
+
+		better := best == nil
+		switch {
+		case better:
+		case complete != bestComplete:
+			better = complete
+		case !complete && covered != bestCovered:
+			better = covered > bestCovered
+		case option.Warehouse.LeadDays != best.Warehouse.LeadDays:
+			better = option.Warehouse.LeadDays < best.Warehouse.LeadDays
+		default:
+			better = option.Warehouse.Sequence < best.Warehouse.Sequence ||
+				(option.Warehouse.Sequence == best.Warehouse.Sequence && option.Warehouse.OdooID < best.Warehouse.OdooID)
+		}
+		if better {
+			best, bestCovered, bestComplete = option, covered, complete
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	warehouse := best.Warehouse
+	return &warehouse
+}
+
+// warehouseOptions lists the warehouses shipping to country, or all of them
+// without one, with their unreserved stock of the variants. Kits have the
+// stock their components make up at the warehouse, once the components'
+// committed units are taken from the first warehouses holding them.
+func (s *StockService) warehouseOptions(ctx context.Context, variantIDs []int64, country string) ([]WarehouseOption, error) {
+	var warehouses []models.Warehouse
+	if err := s.db.WithContext(ctx).Order("sequence, odoo_id").Find(&warehouses).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch warehouses: %w", err)
+	}
+
+	var components []models.KitComponent
+	if len(variantIDs) > 0 {
+		if err := s.db.WithContext(ctx).Where("kit_id IN ?", variantIDs).Find(&components).Error; err != nil {
+			return nil, fmt.Errorf("failed to fetch kit components: %w", err)
+		}
+	}
+	kits := make(map[int64][]models.KitComponent)
+	stockIDs := append([]int64(nil), variantIDs...)
+	var componentIDs []int64
+	seen := make(map[int64]bool, len(components))
+	for _, component := range components {
+		kits[component.KitID] = append(kits[component.KitID], component)
+		stockIDs = append(stockIDs, component.ComponentID)
+		if !seen[component.ComponentID] {
+			seen[component.ComponentID] = true
+			componentIDs = append(componentIDs, component.ComponentID)
+		}
+	}
+
+	var levels []struct {
+		WarehouseID int64
+		VariantID   int64
+		Available   float64
+	}
+	if len(stockIDs) > 0 {
+		err := s.db.WithContext(ctx).Model(&models.StockLevel{}).
+			Select("warehouse_id, variant_id, sum(quantity - reserved) AS available").
+			Where("variant_id IN ? AND warehouse_id <> 0", stockIDs).
+			Group("warehouse_id, variant_id").
+			Scan(&levels).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch stock levels: %w", err)
+		}
+	}
+	stock := make(map[int64]map[int64]float64, len(warehouses))
+	for _, level := range levels {
+		if stock[level.WarehouseID] == nil {
+			stock[level.WarehouseID] = make(map[int64]float64)
+		}
+		stock[level.WarehouseID][level.VariantID] = level.Available
+	}
+	if len(kits) > 0 {
+		committed, err := s.committed(ctx, componentIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, warehouse := range warehouses {
+			available, ok := stock[warehouse.OdooID]
+			if !ok {
+				continue
+			}
+			free := make(map[int64]float64, len(componentIDs))
+			for _, componentID := range componentIDs {
+				taken := math.Min(math.Max(available[componentID], 0), committed[componentID])
+				free[componentID] = available[componentID] - taken
+				committed[componentID] -= taken
+			}
+			for kitID, kitComponents := range kits {
+				available[kitID] = KitAvailable(kitComponents, free)
+			}
+		}
+	}
+
+	country = strings.ToUpper(strings.TrimSpace(country))
+	options := make([]WarehouseOption, 0, len(warehouses))
+	for _, warehouse := range warehouses {
+		if destinations, ok := s.shipsTo[warehouse.Code]; ok && country != "" && !destinations[country] {
+			continue
+		}
+		options = append(options, WarehouseOption{Warehouse: warehouse, Available: stock[warehouse.OdooID]})
+	}
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].Warehouse.LeadDays < options[j].Warehouse.LeadDays
+	})
+	return options, nil
+}
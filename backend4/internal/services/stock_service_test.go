@@ -0,0 +1,132 @@
+package services_test
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"ecommerce/internal/testutils/mocks"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectWarehouse(t *testing.T) {
+	central := models.Warehouse{OdooID: 1, Code: "WH", LeadDays: 2, Sequence: 1}
+	express := models.Warehouse{OdooID: 2, Code: "EXP", LeadDays: 0, Sequence: 2}
+	outlet := models.Warehouse{OdooID: 3, Code: "OUT", LeadDays: 5, Sequence: 3}
+	demand := map[int64]float64{10: 2, 11: 1}
+
+	t.Run("fastest with everything in stock", func(t *testing.T) {
+		chosen := services.SelectWarehouse([]services.WarehouseOption{
+			{Warehouse: outlet, Available: map[int64]float64{10: 5, 11: 5}},
+			{Warehouse: central, Available: map[int64]float64{10: 2, 11: 1}},
+			{Warehouse: express, Available: map[int64]float64{10: 1, 11: 1}},
+		}, demand)
+		require.NotNil(t, chosen)
+		assert.Equal(t, "WH", chosen.Code)
+	})
+
+	t.Run("most units when none has everything", func(t *testing.T) {
+		chosen := services.SelectWarehouse([]services.WarehouseOption{
+			{Warehouse: express, Available: map[int64]float64{10: 1}},
+			{Warehouse: outlet, Available: map[int64]float64{10: 2}},
+		}, demand)
+		require.NotNil(t, chosen)
+		assert.Equal(t, "OUT", chosen.Code)
+	})
+
+	t.Run("ties go to the first warehouse in Odoo", func(t *testing.T) {
+		same := express
+		same.OdooID, same.Code, same.Sequence = 4, "EXP2", 1
+		chosen := services.SelectWarehouse([]services.WarehouseOption{
+			{Warehouse: express, Available: map[int64]float64{10: 2, 11: 1}},
+			{Warehouse: same, Available: map[int64]float64{10: 2, 11: 1}},
+		}, demand)
+		require.NotNil(t, chosen)
+		assert.Equal(t, "EXP2", chosen.Code)
+	})
+
+	t.Run("no warehouse", func(t *testing.T) {
+		assert.Nil(t, services.SelectWarehouse(nil, demand))
+	})
+}
+
+func TestProductionDays(t *testing.T) {
+	desk := models.MadeToOrder{VariantID: 10, Manufactured: true, ProduceDays: 3}
+	components := []models.BomComponent{
+		{VariantID: 10, ComponentID: 20, Quantity: 4, ReplenishDays: 7},
+		{VariantID: 10, ComponentID: 21, Quantity: 1, ReplenishDays: 14},
+	}
+
+	t.Run("components in stock", func(t *testing.T) {
+		days := services.ProductionDays(desk, components, map[int64]float64{20: 8, 21: 2}, 2)
+		assert.Equal(t, 3, days)
+	})
+
+	t.Run("waits for the slowest short component", func(t *testing.T) {
+		days := services.ProductionDays(desk, components, map[int64]float64{20: 8, 21: 1}, 2)
+		assert.Equal(t, 17, days)
+		days = services.ProductionDays(desk, components, map[int64]float64{20: 4, 21: 2}, 2)
+		assert.Equal(t, 10, days)
+	})
+
+	t.Run("bought instead of made", func(t *testing.T) {
+		lamp := models.MadeToOrder{VariantID: 11, ReplenishDays: 5}
+		assert.Equal(t, 5, services.ProductionDays(lamp, nil, nil, 1))
+	})
+}
+
+func TestKitAvailable(t *testing.T) {
+	components := []models.KitComponent{
+		{KitID: 30, ComponentID: 20, Quantity: 2},
+		{KitID: 30, ComponentID: 21, Quantity: 1},
+	}
+
+	assert.Equal(t, 2.0, services.KitAvailable(components, map[int64]float64{20: 5, 21: 4}))
+	assert.Equal(t, 1.0, services.KitAvailable(components, map[int64]float64{20: 7, 21: 1.5}))
+	assert.Zero(t, services.KitAvailable(components, map[int64]float64{20: 5}))
+	assert.Zero(t, services.KitAvailable(components, map[int64]float64{20: -2, 21: 4}))
+	assert.Zero(t, services.KitAvailable(nil, map[int64]float64{20: 5}))
+}
+
+func TestAvailability(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("held components are not in kits", func(t *testing.T) {
+		db, sqlMock := mocks.NewDB(t)
+		redisClient, _ := mocks.NewRedis(t)
+		holds := services.NewStockHolds(redisClient)
+		stockService := services.NewStockService(db, holds, nil)
+		// A checkout holds one kit of two units of component 20
+		kit := models.CartItem{VariantID: 30, Quantity: 1, Components: []models.CartComponent{{VariantID: 20, Quantity: 2}}}
+		require.NoError(t, holds.Place(ctx, "a", []models.CartItem{kit}, time.Hour))
+
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "warehouses"`)).
+			WillReturnRows(sqlmock.NewRows([]string{"odoo_id", "code", "sequence"}).AddRow(1, "WH", 1).AddRow(2, "OUT", 2))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "kit_components" WHERE kit_id IN ($1)`)).
+			WithArgs(30).
+			WillReturnRows(sqlmock.NewRows([]string{"kit_id", "component_id", "quantity"}).AddRow(30, 20, 2))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT warehouse_id, variant_id, sum(quantity - reserved) AS available FROM "stock_levels"`)).
+			WillReturnRows(sqlmock.NewRows([]string{"warehouse_id", "variant_id", "available"}).AddRow(1, 20, 2).AddRow(2, 20, 5))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT variant_id, sum(allocated) AS allocated FROM "backorders"`)).
+			WithArgs(20, models.BackorderWaiting, models.BackorderAllocated).
+			WillReturnRows(sqlmock.NewRows([]string{"variant_id", "allocated"}))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "made_to_orders"`)).
+			WillReturnRows(sqlmock.NewRows([]string{"variant_id"}))
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT variant_id, sum(allocated) AS allocated FROM "backorders"`)).
+			WithArgs(30, models.BackorderWaiting, models.BackorderAllocated).
+			WillReturnRows(sqlmock.NewRows([]string{"variant_id", "allocated"}))
+
+		availability, err := stockService.Availability(ctx, []int64{30}, "", 1)
+		require.NoError(t, err)
+		require.Len(t, availability, 1)
+		// The held units come out of the first warehouse
+		require.Len(t, availability[0].Warehouses, 1)
+		assert.Equal(t, int64(2), availability[0].Warehouses[0].WarehouseID)
+		assert.Equal(t, 2.0, availability[0].Quantity)
+	})
+}
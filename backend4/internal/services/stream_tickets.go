@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"ecommerce/pkg/redis"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// streamTicketTTL is how long a ticket waits for its stream to open
+const streamTicketTTL = 30 * time.Second
+
+var ErrInvalidTicket = errors.New("invalid or expired stream ticket")
+
+// StreamTicket is what a ticket stands in for: the signed-in user and when
+// their token expires
+type StreamTicket struct {
+	UserID    uint      `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// StreamTickets trades bearer tokens for tickets that open one stream.
+// Browsers cannot set headers on an EventSource, and a ticket in the URL, unlike
+// the token, is worthless once used or after a few seconds, whoever logs it.
+type StreamTickets struct {
+	redis *redis.Client
+}
+
+func NewStreamTickets(redisClient *redis.Client) *StreamTickets {
+	return &StreamTickets{redis: redisClient}
+}
+
+// Issue returns a new ticket for a signed-in user
+func (t *StreamTickets) Issue(ctx context.Context, userID uint, expiresAt time.Time) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to make stream ticket: %w", err)
+	}
+	ticket := hex.EncodeToString(random)
+	if err := t.redis.Set(ctx, streamTicketKey(ticket), StreamTicket{UserID: userID, ExpiresAt: expiresAt}, streamTicketTTL); err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// Redeem uses up a ticket. ErrInvalidTicket means it is unknown, used or
+// expired.
+func (t *StreamTickets) Redeem(ctx context.Context, ticket string) (*StreamTicket, error) {
+	var redeemed StreamTicket
+	found, err := t.redis.Take(ctx, streamTicketKey(ticket), &redeemed)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrInvalidTicket
+	}
+	return &redeemed, nil
+}
+
+func streamTicketKey(ticket string) string { return "stream-ticket:" + ticket }
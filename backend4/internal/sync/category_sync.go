@@ -0,0 +1,163 @@
+package sync
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/pkg/odoo"
+	"ecommerce/pkg/slug"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// categoryModels maps each category tree to the Odoo model holding it
+var categoryModels = map[string]string{
+	models.CategoryKindPublic:   "product.public.category",
+	models.CategoryKindInternal: "product.category",
+}
+
+// SyncCategories mirrors both Odoo category trees into the local database.
+// Categories are few, so each sync reads the whole tree and removes local
+// categories Odoo no longer has.
+func (s *OdooSync) SyncCategories(ctx context.Context) error {
+	// product.public.category needs website_sale, so the core tree goes first
+	for _, kind := range []string{models.CategoryKindInternal, models.CategoryKindPublic} {
+		if err := s.syncCategoryTree(ctx, kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *OdooSync) syncCategoryTree(ctx context.Context, kind string) error {
+	fields := []string{"id", "name", "parent_id", "parent_path", "write_date"}
+	if kind == models.CategoryKindPublic {
+		fields = append(fields, "sequence")
+	}
+	options := s.odooClient.NewOptions().FetchFields(fields...)
+
+	var records []odoo.OdooCategory
+	err := s.odooClient.SearchRead(ctx, categoryModels[kind], s.odooClient.NewCriteria(), options, &records)
+	if err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return fmt.Errorf("failed to fetch %s categories from Odoo: %w", kind, err)
+	}
+
+	// Parents first, so their local IDs are known when children are saved
+	sort.Slice(records, func(i, j int) bool {
+		li, lj := categoryLevel(records[i].ParentPath), categoryLevel(records[j].ParentPath)
+		if li != lj {
+			return li < lj
+		}
+		return records[i].ID < records[j].ID
+	})
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing []models.Category
+		if err := tx.Where("kind = ?", kind).Find(&existing).Error; err != nil {
+			return fmt.Errorf("failed to load %s categories: %w", kind, err)
+		}
+		byOdooID := make(map[int64]models.Category, len(existing))
+		for _, category := range existing {
+			byOdooID[category.OdooID] = category
+		}
+
+		slugs := assignCategorySlugs(records, byOdooID)
+		localIDs := make(map[int64]uint, len(records))
+		odooIDs := make([]int64, 0, len(records))
+		newSlugs := make([]string, 0, len(records))
+		for _, record := range records {
+			category := byOdooID[record.ID]
+			if category.Slug != "" && category.Slug != slugs[record.ID] {
+				// Old links to a renamed category redirect to its new slug
+				redirect := models.SlugRedirect{Kind: kind, Slug: category.Slug, OdooID: record.ID}
+				if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&redirect).Error; err != nil {
+					return fmt.Errorf("failed to keep old slug of category %q: %w", record.Name, err)
+				}
+			}
+			category.Kind = kind
+			category.OdooID = record.ID
+			category.Name = record.Name
+			category.Slug = slugs[record.ID]
+			category.Path = record.ParentPath
+			category.Level = categoryLevel(record.ParentPath)
+			category.Sequence = record.Sequence
+			category.WriteDate = record.WriteDate
+			category.ParentID = nil
+			if record.Parent != nil {
+				if parentID, ok := localIDs[record.Parent.ID]; ok {
+					category.ParentID = &parentID
+				}
+			}
+
+			if err := tx.Save(&category).Error; err != nil {
+				return fmt.Errorf("failed to save category %q: %w", record.Name, err)
+			}
+			localIDs[record.ID] = category.ID
+			odooIDs = append(odooIDs, record.ID)
+			newSlugs = append(newSlugs, category.Slug)
+		}
+
+		// A slug in use again is no longer a redirect
+		if len(newSlugs) > 0 {
+			if err := tx.Where("kind = ? AND slug IN ?", kind, newSlugs).Delete(&models.SlugRedirect{}).Error; err != nil {
+				return fmt.Errorf("failed to clear %s slug redirects: %w", kind, err)
+			}
+		}
+
+		removed := tx.Where("kind = ?", kind)
+		if len(odooIDs) > 0 {
+			removed = removed.Where("odoo_id NOT IN ?", odooIDs)
+		}
+		if err := removed.Delete(&models.Category{}).Error; err != nil {
+			return fmt.Errorf("failed to remove deleted %s categories: %w", kind, err)
+		}
+		return nil
+	})
+}
+
+// assignCategorySlugs gives every category a slug unique within its tree.
+// Unrenamed categories keep the slug they have, so their URLs stay put. A new
+// slug that is taken is prefixed with the parent's, then suffixed with the
+// Odoo ID. records must be sorted parents first.
+func assignCategorySlugs(records []odoo.OdooCategory, existing map[int64]models.Category) map[int64]string {
+	slugs := make(map[int64]string, len(records))
+	taken := make(map[string]bool, len(records))
+	for _, record := range records {
+		if category, ok := existing[record.ID]; ok && category.Name == record.Name && category.Slug != "" && !taken[category.Slug] {
+			slugs[record.ID] = category.Slug
+			taken[category.Slug] = true
+		}
+	}
+
+	for _, record := range records {
+		if _, ok := slugs[record.ID]; ok {
+			continue
+		}
+		candidate := slug.Make(record.Name)
+		if candidate == "" {
+			candidate = "category"
+		}
+		if taken[candidate] && record.Parent != nil && slugs[record.Parent.ID] != "" {
+			candidate = slugs[record.Parent.ID] + "-" + candidate
+		}
+		if taken[candidate] {
+			candidate += "-" + strconv.FormatInt(record.ID, 10)
+		}
+		slugs[record.ID] = candidate
+		taken[candidate] = true
+	}
+	return slugs
+}
+
+// categoryLevel is the depth of a category given its parent_path, 0 for roots
+func categoryLevel(parentPath string) int {
+	if parentPath == "" {
+		return 0
+	}
+	return strings.Count(strings.Trim(parentPath, "/"), "/")
+}
@@ -0,0 +1,48 @@
+package sync
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"ecommerce/pkg/queue"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// HandleInventoryEvent consumes the "inventory" queue, where changes Odoo
+// pushes arrive within seconds. Cached copies of the changed products are
+// evicted on every replica, then their stock levels and index entries are
+// refreshed without waiting for the next sync.
+func (s *OdooSync) HandleInventoryEvent(msg queue.Message) error {
+	if msg.Type != services.EventProductChanged && msg.Type != services.EventStockChanged {
+		return nil
+	}
+
+	raw, err := json.Marshal(msg.Payload)
+	if err != nil {
+		return nil
+	}
+	var change models.ProductChange
+	if err := json.Unmarshal(raw, &change); err != nil {
+		log.Printf("Dropping malformed %s event: %v", msg.Type, err)
+		return nil
+	}
+
+	ctx := context.Background()
+	if err := s.productCache.InvalidateProducts(ctx, change.TemplateIDs, change.VariantIDs); err != nil {
+		return err
+	}
+	if len(change.VariantIDs) > 0 {
+		if err := s.refreshStock(ctx, change.VariantIDs); err != nil {
+			return err
+		}
+		s.announceStock(ctx, change.TemplateIDs, change.VariantIDs)
+	}
+	for _, index := range s.indexes {
+		if err := index.IndexProducts(ctx, change.TemplateIDs, change.VariantIDs); err != nil {
+			return fmt.Errorf("failed to update product index: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package sync
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/pkg/odoo"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// SyncKits mirrors the variants Odoo sells as kits, those with a phantom
+// bill of materials, with their components. Components that are kits
+// themselves are kept as they are; Odoo explodes them when delivering.
+func (s *OdooSync) SyncKits(ctx context.Context) error {
+	records, err := s.fetchBoms(ctx, "phantom", nil)
+	if err != nil {
+		return err
+	}
+
+	templates := make(map[int64]int64)
+	if len(records) > 0 {
+		var templateIDs []int64
+		seen := make(map[int64]bool)
+		for _, bom := range records {
+			if !seen[bom.Template.ID] {
+				seen[bom.Template.ID] = true
+				templateIDs = append(templateIDs, bom.Template.ID)
+			}
+		}
+		var variants []odoo.OdooVariantName
+		criteria := s.odooClient.NewCriteria().Add("active", "=", true).Add("product_tmpl_id", "in", templateIDs)
+		options := s.odooClient.NewOptions().FetchFields("id", "product_tmpl_id")
+		if err := s.odooClient.SearchRead(ctx, "product.product", criteria, options, &variants); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+			return fmt.Errorf("failed to fetch kit products from Odoo: %w", err)
+		}
+		for _, variant := range variants {
+			templates[variant.ID] = variant.Template.ID
+		}
+	}
+
+	boms := chooseBoms(records, templates)
+	lines, err := s.bomLines(ctx, boms)
+	if err != nil {
+		return err
+	}
+
+	var componentIDs []int64
+	seen := make(map[int64]bool)
+	for _, bomLines := range lines {
+		for _, line := range bomLines {
+			if !seen[line.Product.ID] {
+				seen[line.Product.ID] = true
+				componentIDs = append(componentIDs, line.Product.ID)
+			}
+		}
+	}
+	names := make(map[int64]odoo.OdooVariantName, len(componentIDs))
+	if len(componentIDs) > 0 {
+		var components []odoo.OdooVariantName
+		options := s.odooClient.NewOptions().FetchFields("id", "display_name", "default_code", "product_tmpl_id")
+		if err := s.odooClient.Read(ctx, "product.product", componentIDs, options, &components); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+			return fmt.Errorf("failed to fetch kit components from Odoo: %w", err)
+		}
+		for _, component := range components {
+			names[component.ID] = component
+		}
+	}
+
+	kits := make([]models.Kit, 0, len(boms))
+	var components []models.KitComponent
+	for variantID, bom := range boms {
+		perKit := bom.Quantity
+		if perKit <= 0 {
+			perKit = 1
+		}
+		needed := make(map[int64]float64)
+		for _, line := range lines[bom.ID] {
+			needed[line.Product.ID] += line.Quantity / perKit
+		}
+		if len(needed) == 0 {
+			continue
+		}
+		kits = append(kits, models.Kit{VariantID: variantID, TemplateID: templates[variantID]})
+		for componentID, quantity := range needed {
+			name := names[componentID]
+			components = append(components, models.KitComponent{
+				KitID:       variantID,
+				ComponentID: componentID,
+				TemplateID:  name.Template.ID,
+				Name:        name.DisplayName,
+				SKU:         name.DefaultCode,
+				Quantity:    quantity,
+			})
+		}
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.KitComponent{}).Error; err != nil {
+			return fmt.Errorf("failed to clear kit components: %w", err)
+		}
+		if err := tx.Where("1 = 1").Delete(&models.Kit{}).Error; err != nil {
+			return fmt.Errorf("failed to clear kits: %w", err)
+		}
+		if len(kits) > 0 {
+			if err := tx.Omit("Components").CreateInBatches(kits, 500).Error; err != nil {
+				return fmt.Errorf("failed to save kits: %w", err)
+			}
+		}
+		if len(components) > 0 {
+			if err := tx.CreateInBatches(components, 500).Error; err != nil {
+				return fmt.Errorf("failed to save kit components: %w", err)
+			}
+		}
+		return nil
+	})
+}
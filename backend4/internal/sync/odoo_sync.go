@@ -1,41 +1,107 @@
 package sync
 
 import (
+	"context"
 	"ecommerce/internal/models"
+	"errors"
 	"fmt"
+	gosync "sync"
 	"time"
 
 	"ecommerce/pkg/odoo"
+	"ecommerce/pkg/queue"
 
 	"gorm.io/gorm"
 )
 
+// ProductCache drops cached copies of products that changed in Odoo
+type ProductCache interface {
+	InvalidateProducts(ctx context.Context, templateIDs, variantIDs []int64) error
+}
+
+// ProductIndex is data derived from Odoo products, like the search index and
+// product pages, that the sync keeps current
+type ProductIndex interface {
+	Reindex(ctx context.Context) error
+	IndexProducts(ctx context.Context, templateIDs, variantIDs []int64) error
+}
+
+// StockWatcher acts on stock that moved in a sync, like restock and
+// low-stock alerts
+type StockWatcher interface {
+	StockChanged(ctx context.Context, changes []models.StockChange) error
+}
+
 type OdooSync struct {
-	db         *gorm.DB
-	odooClient *odoo.Client
+	db           *gorm.DB
+	odooClient   odoo.OdooClient
+	queueClient  queue.Publisher
+	productCache ProductCache
+	stockWatcher StockWatcher
+	indexes      []ProductIndex
+
+	productsSyncedAt time.Time // Start of the last product sync whose changes reached the cache and the mirror
+	stockSyncedAt    time.Time // Start of the last successful stock sync
+
+	fieldsMu   gosync.Mutex
+	moveFields map[string]bool // Quantity fields stock.move has, asked once
 }
 
-func NewOdooSync(db *gorm.DB, odooClient *odoo.Client) *OdooSync {
+func NewOdooSync(db *gorm.DB, odooClient odoo.OdooClient, queueClient queue.Publisher, productCache ProductCache, stockWatcher StockWatcher, indexes ...ProductIndex) *OdooSync {
 	return &OdooSync{
-		db:         db,
-		odooClient: odooClient,
+		db:           db,
+		odooClient:   odooClient,
+		queueClient:  queueClient,
+		productCache: productCache,
+		stockWatcher: stockWatcher,
+		indexes:      indexes,
 	}
 }
 
-// SyncProducts synchronizes products between Odoo and local database
-func (s *OdooSync) SyncProducts() error {
+// SyncProducts synchronizes products between Odoo and local database. The
+// first run rebuilds the product indexes; after it only variants changed
+// since the previous sync are fetched, and those, along with variants whose
+// stock moved, are evicted from the product cache and re-indexed.
+func (s *OdooSync) SyncProducts(ctx context.Context) error {
+	startedAt := time.Now()
+
 	// Create criteria and options for Odoo API
 	criteria := s.odooClient.NewCriteria().Add("active", "=", true)
+	if !s.productsSyncedAt.IsZero() {
+		criteria.Add("write_date", ">=", odoo.FormatDateTime(s.productsSyncedAt))
+	}
 	options := s.odooClient.NewOptions().
-		FetchFields("id", "name", "description", "list_price", "qty_available", "default_code")
+		FetchFields("id", "name", "description", "list_price", "qty_available", "default_code", "product_tmpl_id")
 
 	var products []interface{}
-	if err := s.odooClient.SearchRead("product.product", criteria, options, &products); err != nil {
+	if err := s.odooClient.SearchRead(ctx, "product.product", criteria, options, &products); err != nil && !errors.Is(err, odoo.ErrNotFound) {
 		return fmt.Errorf("failed to fetch products from Odoo: %w", err)
 	}
 
+	if s.productsSyncedAt.IsZero() {
+		for _, index := range s.indexes {
+			if err := index.Reindex(ctx); err != nil {
+				return fmt.Errorf("failed to rebuild product index: %w", err)
+			}
+		}
+	} else {
+		templateIDs, variantIDs, err := s.changedProducts(ctx, products)
+		if err != nil {
+			return err
+		}
+		if len(templateIDs) > 0 || len(variantIDs) > 0 {
+			if err := s.productCache.InvalidateProducts(ctx, templateIDs, variantIDs); err != nil {
+				return err
+			}
+			for _, index := range s.indexes {
+				if err := index.IndexProducts(ctx, templateIDs, variantIDs); err != nil {
+					return fmt.Errorf("failed to update product index: %w", err)
+				}
+			}
+		}
+	}
 	// Begin transaction
-	tx := s.db.Begin()
+	tx := s.db.WithContext(ctx).Begin()
 	for _, p := range products {
 		productMap := p.(map[string]interface{})
 		product := models.FromOdooProduct(productMap)
@@ -50,14 +116,71 @@ func (s *OdooSync) SyncProducts() error {
 			return fmt.Errorf("failed to upsert product: %w", result.Error)
 		}
 	}
-	return tx.Commit().Error
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to save products: %w", err)
+	}
+
+	// Only now are the changes safe to skip next time; until then they are
+	// fetched again, and evicting and indexing them twice does no harm
+	s.productsSyncedAt = startedAt
+	return nil
+}
+
+// changedProducts collects the changed variants, their templates, templates
+// edited directly or through their extra images and every variant with stock
+// moves since the last sync
+func (s *OdooSync) changedProducts(ctx context.Context, products []interface{}) ([]int64, []int64, error) {
+	since := odoo.FormatDateTime(s.productsSyncedAt)
+	var templateIDs, variantIDs []int64
+	for _, p := range products {
+		productMap := p.(map[string]interface{})
+		if id, ok := productMap["id"].(int64); ok {
+			variantIDs = append(variantIDs, id)
+		}
+		// Many2one fields arrive as [id, name]
+		if template, ok := productMap["product_tmpl_id"].([]interface{}); ok && len(template) > 0 {
+			if id, ok := template[0].(int64); ok {
+				templateIDs = append(templateIDs, id)
+			}
+		}
+	}
+
+	// Template fields such as the list price do not touch the variants
+	changedTemplates, err := s.odooClient.Search(ctx, "product.template", s.odooClient.NewCriteria().Add("write_date", ">=", since), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch template changes from Odoo: %w", err)
+	}
+	templateIDs = append(templateIDs, changedTemplates...)
+
+	// Extra images of website_sale are records of their own
+	for _, field := range []string{"product_template_image_ids.write_date", "product_variant_ids.product_variant_image_ids.write_date"} {
+		changedGalleries, err := s.odooClient.Search(ctx, "product.template", s.odooClient.NewCriteria().Add(field, ">=", since), nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch image changes from Odoo: %w", err)
+		}
+		templateIDs = append(templateIDs, changedGalleries...)
+	}
+
+	var quants []struct {
+		Product odoo.Many2One `xmlrpc:"product_id"`
+	}
+	criteria := s.odooClient.NewCriteria().Add("write_date", ">=", since)
+	options := s.odooClient.NewOptions().FetchFields("product_id")
+	if err := s.odooClient.SearchRead(ctx, "stock.quant", criteria, options, &quants); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return nil, nil, fmt.Errorf("failed to fetch stock changes from Odoo: %w", err)
+	}
+	for _, quant := range quants {
+		variantIDs = append(variantIDs, quant.Product.ID)
+	}
+
+	return templateIDs, variantIDs, nil
 }
 
 // SyncOrders synchronizes orders from local database to Odoo
-func (s *OdooSync) SyncOrders() error {
+func (s *OdooSync) SyncOrders(ctx context.Context) error {
 	// Get unsynchronized orders
 	var orders []models.Order
-	if err := s.db.Where("odoo_id IS NULL").Find(&orders).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("odoo_id IS NULL").Find(&orders).Error; err != nil {
 		return fmt.Errorf("failed to fetch unsynchronized orders: %w", err)
 	}
 
@@ -73,7 +196,7 @@ func (s *OdooSync) SyncOrders() error {
 		}
 
 		options := s.odooClient.NewOptions()
-		odooOrderIDs, err := s.odooClient.Create("sale.order", orderData, options)
+		odooOrderIDs, err := s.odooClient.Create(ctx, "sale.order", orderData, options)
 		if err != nil {
 			return fmt.Errorf("failed to create order in Odoo: %w", err)
 		}
@@ -91,7 +214,7 @@ func (s *OdooSync) SyncOrders() error {
 				},
 			}
 
-			_, err := s.odooClient.Create("sale.order.line", lineData, options)
+			_, err := s.odooClient.Create(ctx, "sale.order.line", lineData, options)
 			if err != nil {
 				return fmt.Errorf("failed to create order line in Odoo: %w", err)
 			}
@@ -0,0 +1,394 @@
+package sync
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/pkg/odoo"
+	"ecommerce/pkg/queue"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SyncMadeToOrder mirrors which variants Odoo manufactures or buys for each
+// order, those on a route with a manufacture or make-to-order rule, with the
+// bill of materials and lead times their ship dates are estimated from
+func (s *OdooSync) SyncMadeToOrder(ctx context.Context) error {
+	var rules []odoo.OdooStockRule
+	options := s.odooClient.NewOptions().FetchFields("id", "route_id", "action", "procure_method")
+	if err := s.odooClient.SearchRead(ctx, "stock.rule", s.odooClient.NewCriteria(), options, &rules); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return fmt.Errorf("failed to fetch stock rules from Odoo: %w", err)
+	}
+	var routeIDs []int64
+	for _, rule := range rules {
+		if rule.Route != nil && (rule.Action == "manufacture" || rule.ProcureMethod == "make_to_order") {
+			routeIDs = append(routeIDs, rule.Route.ID)
+		}
+	}
+
+	variants := make(map[int64]odoo.OdooMadeToOrderVariant)
+	if len(routeIDs) > 0 {
+		// Routes are set on the product or inherited from its category
+		for _, field := range []string{"route_ids", "categ_id.total_route_ids"} {
+			var records []odoo.OdooMadeToOrderVariant
+			criteria := s.odooClient.NewCriteria().Add("active", "=", true).Add(field, "in", routeIDs)
+			options := s.odooClient.NewOptions().FetchFields("id", "product_tmpl_id", "produce_delay")
+			if err := s.odooClient.SearchRead(ctx, "product.product", criteria, options, &records); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+				return fmt.Errorf("failed to fetch made-to-order products from Odoo: %w", err)
+			}
+			for _, record := range records {
+				variants[record.ID] = record
+			}
+		}
+	}
+
+	boms, lines, err := s.billsOfMaterials(ctx, variants)
+	if err != nil {
+		return err
+	}
+
+	// Lead times of the variants bought rather than made, and of components
+	parts := make(map[int64]odoo.OdooMadeToOrderVariant, len(variants))
+	for id, variant := range variants {
+		parts[id] = variant
+	}
+	var componentIDs []int64
+	for _, bomLines := range lines {
+		for _, line := range bomLines {
+			if _, ok := parts[line.Product.ID]; !ok {
+				componentIDs = append(componentIDs, line.Product.ID)
+			}
+		}
+	}
+	if len(componentIDs) > 0 {
+		var components []odoo.OdooMadeToOrderVariant
+		options := s.odooClient.NewOptions().FetchFields("id", "product_tmpl_id", "produce_delay")
+		if err := s.odooClient.Read(ctx, "product.product", componentIDs, options, &components); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+			return fmt.Errorf("failed to fetch components from Odoo: %w", err)
+		}
+		for _, component := range components {
+			parts[component.ID] = component
+		}
+	}
+	replenish, err := s.replenishDays(ctx, parts)
+	if err != nil {
+		return err
+	}
+
+	products := make([]models.MadeToOrder, 0, len(variants))
+	var components []models.BomComponent
+	for id, variant := range variants {
+		product := models.MadeToOrder{
+			VariantID:     id,
+			TemplateID:    variant.Template.ID,
+			ReplenishDays: replenish[id],
+		}
+		if bom, ok := boms[id]; ok {
+			product.Manufactured = true
+			product.ProduceDays = int(math.Ceil(variant.ProduceDelay))
+			perUnit := bom.Quantity
+			if perUnit <= 0 {
+				perUnit = 1
+			}
+			needed := make(map[int64]float64)
+			for _, line := range lines[bom.ID] {
+				needed[line.Product.ID] += line.Quantity / perUnit
+			}
+			for componentID, quantity := range needed {
+				components = append(components, models.BomComponent{
+					VariantID:     id,
+					ComponentID:   componentID,
+					Quantity:      quantity,
+					ReplenishDays: replenish[componentID],
+				})
+			}
+		}
+		products = append(products, product)
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.BomComponent{}).Error; err != nil {
+			return fmt.Errorf("failed to clear bill of materials: %w", err)
+		}
+		if err := tx.Where("1 = 1").Delete(&models.MadeToOrder{}).Error; err != nil {
+			return fmt.Errorf("failed to clear made-to-order products: %w", err)
+		}
+		if len(products) > 0 {
+			if err := tx.CreateInBatches(products, 500).Error; err != nil {
+				return fmt.Errorf("failed to save made-to-order products: %w", err)
+			}
+		}
+		if len(components) > 0 {
+			if err := tx.CreateInBatches(components, 500).Error; err != nil {
+				return fmt.Errorf("failed to save bill of materials: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// billsOfMaterials returns the bill each variant is manufactured from, by
+// variant, and the lines of those bills, by bill
+func (s *OdooSync) billsOfMaterials(ctx context.Context, variants map[int64]odoo.OdooMadeToOrderVariant) (map[int64]odoo.OdooBom, map[int64][]odoo.OdooBomLine, error) {
+	if len(variants) == 0 {
+		return nil, nil, nil
+	}
+	templates := make(map[int64]int64, len(variants))
+	var templateIDs []int64
+	seen := make(map[int64]bool)
+	for id, variant := range variants {
+		templates[id] = variant.Template.ID
+		if !seen[variant.Template.ID] {
+			seen[variant.Template.ID] = true
+			templateIDs = append(templateIDs, variant.Template.ID)
+		}
+	}
+
+	records, err := s.fetchBoms(ctx, "normal", templateIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	boms := chooseBoms(records, templates)
+	lines, err := s.bomLines(ctx, boms)
+	if err != nil {
+		return nil, nil, err
+	}
+	return boms, lines, nil
+}
+
+// fetchBoms fetches the bills of materials of a type, "normal" or "phantom"
+// for kits, for the templates or, without templates, for all products
+func (s *OdooSync) fetchBoms(ctx context.Context, bomType string, templateIDs []int64) ([]odoo.OdooBom, error) {
+	var records []odoo.OdooBom
+	criteria := s.odooClient.NewCriteria().Add("type", "=", bomType)
+	if templateIDs != nil {
+		criteria.Add("product_tmpl_id", "in", templateIDs)
+	}
+	options := s.odooClient.NewOptions().FetchFields("id", "product_tmpl_id", "product_id", "product_qty", "type", "sequence")
+	if err := s.odooClient.SearchRead(ctx, "mrp.bom", criteria, options, &records); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return nil, fmt.Errorf("failed to fetch bills of materials from Odoo: %w", err)
+	}
+	return records, nil
+}
+
+// chooseBoms picks the bill that applies to each variant, given the
+// variants' templates. A bill for the variant itself beats one for its
+// template; among those the first in Odoo wins.
+func chooseBoms(records []odoo.OdooBom, templates map[int64]int64) map[int64]odoo.OdooBom {
+	boms := make(map[int64]odoo.OdooBom)
+	for id, templateID := range templates {
+		var chosen *odoo.OdooBom
+		for i := range records {
+			bom := &records[i]
+			if bom.Template.ID != templateID || (bom.Variant != nil && bom.Variant.ID != id) {
+				continue
+			}
+			if chosen == nil || (bom.Variant != nil) != (chosen.Variant != nil) {
+				if chosen == nil || bom.Variant != nil {
+					chosen = bom
+				}
+				continue
+			}
+			if bom.Sequence < chosen.Sequence || (bom.Sequence == chosen.Sequence && bom.ID < chosen.ID) {
+				chosen = bom
+			}
+		}
+		if chosen != nil {
+			boms[id] = *chosen
+		}
+	}
+	return boms
+}
+
+// bomLines fetches the lines of bills of materials, by bill
+func (s *OdooSync) bomLines(ctx context.Context, boms map[int64]odoo.OdooBom) (map[int64][]odoo.OdooBomLine, error) {
+	lines := make(map[int64][]odoo.OdooBomLine)
+	if len(boms) == 0 {
+		return lines, nil
+	}
+	bomIDs := make([]int64, 0, len(boms))
+	seen := make(map[int64]bool, len(boms))
+	for _, bom := range boms {
+		if !seen[bom.ID] {
+			seen[bom.ID] = true
+			bomIDs = append(bomIDs, bom.ID)
+		}
+	}
+	var records []odoo.OdooBomLine
+	criteria := s.odooClient.NewCriteria().Add("bom_id", "in", bomIDs)
+	options := s.odooClient.NewOptions().FetchFields("id", "bom_id", "product_id", "product_qty")
+	if err := s.odooClient.SearchRead(ctx, "mrp.bom.line", criteria, options, &records); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return nil, fmt.Errorf("failed to fetch bill of materials lines from Odoo: %w", err)
+	}
+	for _, line := range records {
+		lines[line.Bom.ID] = append(lines[line.Bom.ID], line)
+	}
+	return lines, nil
+}
+
+// replenishDays is how long getting each variant takes when it is out of
+// stock: the fastest vendor's delay, or else its manufacturing lead time
+func (s *OdooSync) replenishDays(ctx context.Context, variants map[int64]odoo.OdooMadeToOrderVariant) (map[int64]int, error) {
+	days := make(map[int64]int, len(variants))
+	if len(variants) == 0 {
+		return days, nil
+	}
+	var templateIDs []int64
+	for _, variant := range variants {
+		templateIDs = append(templateIDs, variant.Template.ID)
+	}
+
+	var sellers []odoo.OdooSupplierInfo
+	criteria := s.odooClient.NewCriteria().Add("product_tmpl_id", "in", templateIDs)
+	options := s.odooClient.NewOptions().FetchFields("id", "product_tmpl_id", "product_id", "delay")
+	if err := s.odooClient.SearchRead(ctx, "product.supplierinfo", criteria, options, &sellers); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return nil, fmt.Errorf("failed to fetch vendors from Odoo: %w", err)
+	}
+
+	for id, variant := range variants {
+		fastest := -1
+		for _, seller := range sellers {
+			if seller.Template == nil || seller.Template.ID != variant.Template.ID || (seller.Variant != nil && seller.Variant.ID != id) {
+				continue
+			}
+			if fastest < 0 || seller.Delay < fastest {
+				fastest = seller.Delay
+			}
+		}
+		if fastest < 0 {
+			fastest = int(math.Ceil(variant.ProduceDelay))
+		}
+		days[id] = fastest
+	}
+	return days, nil
+}
+
+// SyncProductions pulls the manufacturing orders Odoo opened for our sale
+// orders, so customers can follow made-to-order items being made
+func (s *OdooSync) SyncProductions(ctx context.Context) error {
+	var orders []models.Order
+	err := s.db.WithContext(ctx).Where("odoo_id IS NOT NULL AND fulfillment_status NOT IN ?",
+		[]string{models.FulfillmentShipped, models.FulfillmentCancelled}).
+		Find(&orders).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch unfulfilled orders: %w", err)
+	}
+
+	for start := 0; start < len(orders); start += pickingBatchSize {
+		end := min(start+pickingBatchSize, len(orders))
+		if err := s.syncProductionBatch(ctx, orders[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *OdooSync) syncProductionBatch(ctx context.Context, orders []models.Order) error {
+	ordersByOdooID := make(map[int64]*models.Order, len(orders))
+	saleIDs := make([]int64, 0, len(orders))
+	for i := range orders {
+		ordersByOdooID[*orders[i].OdooID] = &orders[i]
+		saleIDs = append(saleIDs, *orders[i].OdooID)
+	}
+
+	var sales []odoo.OdooSaleProductions
+	options := s.odooClient.NewOptions().FetchFields("id", "mrp_production_ids")
+	if err := s.odooClient.Read(ctx, "sale.order", saleIDs, options, &sales); err != nil {
+		if errors.Is(err, odoo.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to fetch manufacturing orders of sale orders: %w", err)
+	}
+	orderOfProduction := make(map[int64]*models.Order)
+	var productionIDs []int64
+	for _, sale := range sales {
+		for _, id := range sale.ProductionIDs {
+			orderOfProduction[id] = ordersByOdooID[sale.ID]
+			productionIDs = append(productionIDs, id)
+		}
+	}
+	if len(productionIDs) == 0 {
+		return nil
+	}
+
+	var productions []odoo.OdooProduction
+	options = s.odooClient.NewOptions().FetchFields(
+		"id", "name", "state", "product_id", "product_qty", "qty_producing",
+		"date_planned_finished", "components_availability_state",
+	)
+	if err := s.odooClient.Read(ctx, "mrp.production", productionIDs, options, &productions); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return fmt.Errorf("failed to fetch manufacturing orders from Odoo: %w", err)
+	}
+
+	changed := make(map[uint]*models.Order)
+	for _, production := range productions {
+		order := orderOfProduction[production.ID]
+		if order == nil {
+			continue
+		}
+		moved, err := s.upsertProduction(ctx, order.ID, production)
+		if err != nil {
+			return err
+		}
+		if moved {
+			changed[order.ID] = order
+		}
+	}
+
+	for _, order := range changed {
+		if err := s.updateFulfillment(ctx, order); err != nil {
+			return err
+		}
+		s.publishProduction(ctx, order)
+	}
+	return nil
+}
+
+// upsertProduction stores a manufacturing order and reports whether its
+// state or progress moved
+func (s *OdooSync) upsertProduction(ctx context.Context, orderID uint, production odoo.OdooProduction) (bool, error) {
+	var record models.ManufacturingOrder
+	err := s.db.WithContext(ctx).Where("odoo_production_id = ?", production.ID).First(&record).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, fmt.Errorf("failed to fetch manufacturing order: %w", err)
+	}
+
+	moved := record.ID == 0 || record.State != production.State || record.QuantityProduced != production.QtyProducing
+
+	record.OrderID = orderID
+	record.OdooProductionID = production.ID
+	record.Reference = production.Name
+	record.Product = production.Product.Name
+	record.State = production.State
+	record.Quantity = production.Quantity
+	record.QuantityProduced = production.QtyProducing
+	record.ComponentsState = production.ComponentsState
+	record.PlannedFinish = production.DatePlannedFinished
+
+	if err := s.db.WithContext(ctx).Save(&record).Error; err != nil {
+		return false, fmt.Errorf("failed to save manufacturing order: %w", err)
+	}
+	return moved, nil
+}
+
+// publishProduction announces the progress of an order's made-to-order
+// items to the customer's live order status
+func (s *OdooSync) publishProduction(ctx context.Context, order *models.Order) {
+	// Reconnecting streams catch up on orders changed since they left
+	order.UpdatedAt = time.Now()
+	if err := s.db.WithContext(ctx).Model(&models.Order{}).Where("id = ?", order.ID).UpdateColumn("updated_at", order.UpdatedAt).Error; err != nil {
+		log.Printf("Failed to touch order %d: %v", order.ID, err)
+	}
+	if err := s.db.WithContext(ctx).Where("order_id = ?", order.ID).Order("id").Find(&order.ManufacturingOrders).Error; err != nil {
+		log.Printf("Failed to load manufacturing orders of order %d: %v", order.ID, err)
+		return
+	}
+	msg := queue.Message{Type: "order.production", Payload: order}
+	if err := s.queueClient.Publish(ctx, "orders", msg); err != nil {
+		log.Printf("Failed to publish production event for order %d: %v", order.ID, err)
+	}
+}
@@ -0,0 +1,190 @@
+package sync
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"ecommerce/pkg/odoo"
+	"ecommerce/pkg/queue"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// receiptLookback is how far back completed receipts are looked for. Each is
+// allocated once, so it only bounds how long a sync may be down.
+const receiptLookback = 7 * 24 * time.Hour
+
+// SyncReceipts allocates the stock of completed incoming pickings, purchase
+// order receipts included, to the orders waiting for it, oldest first. Odoo
+// is then asked to reserve the deliveries of orders that have everything.
+func (s *OdooSync) SyncReceipts(ctx context.Context) error {
+	var pickings []odoo.OdooPicking
+	criteria := s.odooClient.NewCriteria().
+		Add("picking_type_code", "=", "incoming").
+		Add("state", "=", "done").
+		Add("date_done", ">=", odoo.FormatDateTime(time.Now().Add(-receiptLookback)))
+	options := s.odooClient.NewOptions().FetchFields("id", "name")
+	if err := s.odooClient.SearchRead(ctx, "stock.picking", criteria, options, &pickings); err != nil {
+		if errors.Is(err, odoo.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to fetch receipts from Odoo: %w", err)
+	}
+	if len(pickings) == 0 {
+		return nil
+	}
+
+	pickingIDs := make([]int64, 0, len(pickings))
+	for _, picking := range pickings {
+		pickingIDs = append(pickingIDs, picking.ID)
+	}
+	var processed []int64
+	err := s.db.WithContext(ctx).Model(&models.StockReceipt{}).Where("odoo_picking_id IN ?", pickingIDs).Pluck("odoo_picking_id", &processed).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch allocated receipts: %w", err)
+	}
+	done := make(map[int64]bool, len(processed))
+	for _, id := range processed {
+		done[id] = true
+	}
+	var receipts []models.StockReceipt
+	var newIDs []int64
+	for _, picking := range pickings {
+		if !done[picking.ID] {
+			receipts = append(receipts, models.StockReceipt{OdooPickingID: picking.ID, Reference: picking.Name})
+			newIDs = append(newIDs, picking.ID)
+		}
+	}
+	if len(receipts) == 0 {
+		return nil
+	}
+
+	quantityField, err := s.moveQuantityField(ctx)
+	if err != nil {
+		return err
+	}
+	var moves []odoo.OdooStockMove
+	criteria = s.odooClient.NewCriteria().Add("picking_id", "in", newIDs).Add("state", "=", "done")
+	options = s.odooClient.NewOptions().FetchFields("id", "picking_id", "product_id", quantityField)
+	if err := s.odooClient.SearchRead(ctx, "stock.move", criteria, options, &moves); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return fmt.Errorf("failed to fetch received moves from Odoo: %w", err)
+	}
+	received := make(map[int64]float64)
+	for _, move := range moves {
+		received[move.Product.ID] += move.Moved()
+	}
+
+	touched := make(map[uint]bool)
+	now := time.Now()
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for variantID, quantity := range received {
+			var waiting []models.Backorder
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("variant_id = ? AND status = ?", variantID, models.BackorderWaiting).
+				Order("created_at, id").
+				Find(&waiting).Error
+			if err != nil {
+				return fmt.Errorf("failed to fetch waiting backorders: %w", err)
+			}
+			before := make([]float64, len(waiting))
+			for i := range waiting {
+				before[i] = waiting[i].Allocated
+			}
+			services.AllocateBackorders(waiting, quantity, now)
+			for i := range waiting {
+				if waiting[i].Allocated == before[i] {
+					continue
+				}
+				if err := tx.Save(&waiting[i]).Error; err != nil {
+					return fmt.Errorf("failed to allocate backorder: %w", err)
+				}
+				touched[waiting[i].OrderID] = true
+			}
+		}
+		// Receipts are recorded with their allocation, so none is counted twice
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&receipts).Error; err != nil {
+			return fmt.Errorf("failed to record receipts: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for orderID := range touched {
+		if err := s.releaseOrder(ctx, orderID); err != nil {
+			log.Printf("Failed to release allocated order %d: %v", orderID, err)
+		}
+	}
+	return nil
+}
+
+// moveQuantityField asks Odoo once which field holds the quantity a
+// stock.move moved: Odoo 17 renamed quantity_done to quantity
+func (s *OdooSync) moveQuantityField(ctx context.Context) (string, error) {
+	s.fieldsMu.Lock()
+	defer s.fieldsMu.Unlock()
+	if s.moveFields == nil {
+		fields, err := s.odooClient.FieldsGet(ctx, "stock.move", "quantity_done", "quantity")
+		if err != nil {
+			return "", fmt.Errorf("failed to describe stock move fields: %w", err)
+		}
+		s.moveFields = make(map[string]bool, len(fields))
+		for field := range fields {
+			s.moveFields[field] = true
+		}
+	}
+	if s.moveFields["quantity_done"] {
+		return "quantity_done", nil
+	}
+	return "quantity", nil
+}
+
+// releaseOrder asks Odoo to reserve the deliveries of an order once none of
+// its backorders waits any more, and announces the allocation. Its
+// backorders are then released, so their units stop being held back from
+// the shop's availability.
+func (s *OdooSync) releaseOrder(ctx context.Context, orderID uint) error {
+	var order models.Order
+	if err := s.db.WithContext(ctx).Preload("Backorders").Preload("Shipments").First(&order, orderID).Error; err != nil {
+		return fmt.Errorf("failed to fetch order: %w", err)
+	}
+	for _, backorder := range order.Backorders {
+		if backorder.Status == models.BackorderWaiting {
+			return nil
+		}
+	}
+
+	var pickingIDs []int64
+	for _, shipment := range order.Shipments {
+		if shipment.State == "confirmed" || shipment.State == "waiting" {
+			pickingIDs = append(pickingIDs, shipment.OdooPickingID)
+		}
+	}
+	if len(pickingIDs) > 0 {
+		if err := s.odooClient.ExecuteKw(ctx, "action_assign", "stock.picking", []interface{}{pickingIDs}, nil, nil); err != nil {
+			return fmt.Errorf("failed to reserve deliveries in Odoo: %w", err)
+		}
+	}
+	err := s.db.WithContext(ctx).Model(&models.Backorder{}).
+		Where("order_id = ? AND status = ?", order.ID, models.BackorderAllocated).
+		Update("status", models.BackorderReleased).Error
+	if err != nil {
+		return fmt.Errorf("failed to release backorders: %w", err)
+	}
+
+	// Reconnecting streams catch up on orders changed since they left
+	order.UpdatedAt = time.Now()
+	if err := s.db.WithContext(ctx).Model(&models.Order{}).Where("id = ?", order.ID).UpdateColumn("updated_at", order.UpdatedAt).Error; err != nil {
+		log.Printf("Failed to touch order %d: %v", order.ID, err)
+	}
+	if err := s.queueClient.Publish(ctx, "orders", queue.Message{Type: "order.allocated", Payload: order}); err != nil {
+		log.Printf("Failed to publish allocation of order %d: %v", order.ID, err)
+	}
+	return nil
+}
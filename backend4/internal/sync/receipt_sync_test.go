@@ -0,0 +1,97 @@
+package sync_test
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/internal/sync"
+	"ecommerce/internal/testutils/mocks"
+	"ecommerce/pkg/odoo"
+	"ecommerce/pkg/queue"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	go_odoo "github.com/skilld-labs/go-odoo"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// syncReceipt runs a receipt sync of picking 41, which received 3 units of
+// variant 10 as stock.move reports them in field, for order 7 waiting on them
+func syncReceipt(t *testing.T, odooSync *sync.OdooSync, sqlMock sqlmock.Sqlmock, odooClient *mocks.MockOdooClient, field string) {
+	odooClient.On("SearchRead", "stock.picking", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			*args.Get(3).(*[]odoo.OdooPicking) = []odoo.OdooPicking{{ID: 41, Name: "WH/IN/00041"}}
+		}).Return(nil).Once()
+	fetchesQuantity := mock.MatchedBy(func(options *go_odoo.Options) bool {
+		fields := (*options)["fields"].([]string)
+		return fields[len(fields)-1] == field
+	})
+	odooClient.On("SearchRead", "stock.move", mock.Anything, fetchesQuantity, mock.Anything).
+		Run(func(args mock.Arguments) {
+			move := odoo.OdooStockMove{ID: 1, Product: odoo.Many2One{ID: 10}}
+			if field == "quantity" {
+				move.Quantity = 3
+			} else {
+				move.QuantityDone = 3
+			}
+			*args.Get(3).(*[]odoo.OdooStockMove) = []odoo.OdooStockMove{move}
+		}).Return(nil).Once()
+
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT "odoo_picking_id" FROM "stock_receipts"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"odoo_picking_id"}))
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "backorders" WHERE variant_id = $1 AND status = $2`)).
+		WithArgs(10, models.BackorderWaiting).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "variant_id", "quantity", "allocated", "status"}).
+			AddRow(3, 7, 10, 3, 0, models.BackorderWaiting))
+	sqlMock.ExpectExec(regexp.QuoteMeta(`UPDATE "backorders" SET`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "stock_receipts"`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectCommit()
+
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "orders" WHERE "orders"."id" = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "backorders" WHERE "backorders"."order_id" = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "status"}).AddRow(3, 7, models.BackorderAllocated))
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "shipments" WHERE "shipments"."order_id" = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}))
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(regexp.QuoteMeta(`UPDATE "backorders" SET "status"=$1`)).
+		WithArgs(models.BackorderReleased, sqlmock.AnyArg(), 7, models.BackorderAllocated).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectCommit()
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(regexp.QuoteMeta(`UPDATE "orders" SET "updated_at"=$1`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectCommit()
+
+	require.NoError(t, odooSync.SyncReceipts(context.Background()))
+}
+
+func TestSyncReceipts(t *testing.T) {
+	for _, field := range []string{"quantity_done", "quantity"} {
+		t.Run("received units read from "+field, func(t *testing.T) {
+			db, sqlMock := mocks.NewDB(t)
+			odooClient := new(mocks.MockOdooClient)
+			odooClient.On("NewCriteria").Return(nil)
+			odooClient.On("NewOptions").Return(nil)
+			// Asked once, however many syncs run
+			odooClient.On("FieldsGet", "stock.move", []string{"quantity_done", "quantity"}).
+				Return(map[string]odoo.Field{field: {Type: "float"}}, nil).Once()
+			publisher := new(mocks.MockPublisher)
+			publisher.On("Publish", "orders", mock.MatchedBy(func(msg queue.Message) bool {
+				return msg.Type == "order.allocated"
+			})).Return(nil).Twice()
+			t.Cleanup(func() {
+				odooClient.AssertExpectations(t)
+				publisher.AssertExpectations(t)
+			})
+
+			odooSync := sync.NewOdooSync(db, odooClient, publisher, nil, nil)
+			syncReceipt(t, odooSync, sqlMock, odooClient, field)
+			syncReceipt(t, odooSync, sqlMock, odooClient, field)
+		})
+	}
+}
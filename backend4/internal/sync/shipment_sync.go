@@ -0,0 +1,213 @@
+package sync
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"ecommerce/pkg/odoo"
+	"ecommerce/pkg/queue"
+	"errors"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// pickingBatchSize bounds the number of sale orders per stock.picking query
+const pickingBatchSize = 200
+
+// SyncShipments pulls outgoing deliveries for our sale orders from Odoo and
+// updates order fulfillment. Every package that became done emits order.shipped.
+func (s *OdooSync) SyncShipments(ctx context.Context) error {
+	var orders []models.Order
+	err := s.db.Where("odoo_id IS NOT NULL AND fulfillment_status NOT IN ?",
+		[]string{models.FulfillmentShipped, models.FulfillmentCancelled}).
+		Find(&orders).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch unfulfilled orders: %w", err)
+	}
+
+	for start := 0; start < len(orders); start += pickingBatchSize {
+		end := start + pickingBatchSize
+		if end > len(orders) {
+			end = len(orders)
+		}
+		if err := s.syncShipmentBatch(ctx, orders[start:end]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *OdooSync) syncShipmentBatch(ctx context.Context, orders []models.Order) error {
+	ordersByOdooID := make(map[int64]*models.Order, len(orders))
+	saleIDs := make([]int64, 0, len(orders))
+	for i := range orders {
+		ordersByOdooID[*orders[i].OdooID] = &orders[i]
+		saleIDs = append(saleIDs, *orders[i].OdooID)
+	}
+
+	criteria := s.odooClient.NewCriteria().
+		Add("sale_id", "in", saleIDs).
+		Add("picking_type_code", "=", "outgoing")
+	options := s.odooClient.NewOptions().FetchFields(
+		"id", "name", "state", "sale_id", "carrier_id",
+		"carrier_tracking_ref", "carrier_tracking_url", "date_done",
+	)
+
+	var pickings []odoo.OdooPicking
+	if err := s.odooClient.SearchRead(ctx, "stock.picking", criteria, options, &pickings); err != nil {
+		if errors.Is(err, odoo.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to fetch pickings from Odoo: %w", err)
+	}
+
+	touched := make(map[uint]*models.Order)
+	var shipped []models.Shipment
+	for _, picking := range pickings {
+		if picking.SaleID == nil {
+			continue
+		}
+		order, ok := ordersByOdooID[picking.SaleID.ID]
+		if !ok {
+			continue
+		}
+
+		shipment, newlyShipped, err := s.upsertShipment(order.ID, picking)
+		if err != nil {
+			return err
+		}
+		touched[order.ID] = order
+		if newlyShipped {
+			shipped = append(shipped, *shipment)
+		}
+	}
+
+	for _, order := range touched {
+		if err := s.updateFulfillment(ctx, order); err != nil {
+			return err
+		}
+	}
+
+	for _, shipment := range shipped {
+		s.publishShipped(touched[shipment.OrderID], shipment)
+	}
+
+	return nil
+}
+
+// upsertShipment stores the picking and reports whether it just reached done
+func (s *OdooSync) upsertShipment(orderID uint, picking odoo.OdooPicking) (*models.Shipment, bool, error) {
+	var shipment models.Shipment
+	err := s.db.Where("odoo_picking_id = ?", picking.ID).First(&shipment).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, fmt.Errorf("failed to fetch shipment: %w", err)
+	}
+
+	wasDone := shipment.State == "done"
+
+	shipment.OrderID = orderID
+	shipment.OdooPickingID = picking.ID
+	shipment.Reference = picking.Name
+	shipment.State = picking.State
+	shipment.TrackingNumber = picking.CarrierTrackingRef
+	shipment.TrackingURL = picking.CarrierTrackingURL
+	if picking.CarrierID != nil {
+		shipment.Carrier = picking.CarrierID.Name
+	}
+	if picking.DateDone != nil {
+		shipment.ShippedAt = picking.DateDone
+	}
+
+	if err := s.db.Save(&shipment).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to save shipment: %w", err)
+	}
+
+	return &shipment, !wasDone && shipment.State == "done", nil
+}
+
+// updateFulfillment derives the order fulfillment status from its shipments
+func (s *OdooSync) updateFulfillment(ctx context.Context, order *models.Order) error {
+	var shipments []models.Shipment
+	if err := s.db.WithContext(ctx).Where("order_id = ?", order.ID).Order("shipped_at").Find(&shipments).Error; err != nil {
+		return fmt.Errorf("failed to fetch shipments: %w", err)
+	}
+
+	previous := order.FulfillmentStatus
+	var done, cancelled int
+	for _, shipment := range shipments {
+		switch shipment.State {
+		case "done":
+			done++
+			if shipment.TrackingNumber != "" {
+				order.TrackingNumber = shipment.TrackingNumber
+				order.TrackingURL = shipment.TrackingURL
+			}
+		case "cancel":
+			cancelled++
+		}
+	}
+
+	// Made-to-order items hold the order until they are manufactured
+	var producing int64
+	err := s.db.WithContext(ctx).Model(&models.ManufacturingOrder{}).
+		Where("order_id = ? AND state NOT IN ?", order.ID, []string{"done", "cancel"}).
+		Count(&producing).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch manufacturing orders: %w", err)
+	}
+
+	open := len(shipments) - done - cancelled
+	switch {
+	case done == 0 && producing > 0:
+		order.FulfillmentStatus = models.FulfillmentInProduction
+	case len(shipments) == 0:
+		order.FulfillmentStatus = models.FulfillmentPending
+	case cancelled == len(shipments):
+		order.FulfillmentStatus = models.FulfillmentCancelled
+	case open == 0:
+		order.FulfillmentStatus = models.FulfillmentShipped
+	case done > 0:
+		order.FulfillmentStatus = models.FulfillmentPartiallyShipped
+	default:
+		order.FulfillmentStatus = models.FulfillmentPending
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(order).Updates(map[string]interface{}{
+			"fulfillment_status": order.FulfillmentStatus,
+			"tracking_number":    order.TrackingNumber,
+			"tracking_url":       order.TrackingURL,
+		}).Error
+		if err != nil || order.FulfillmentStatus == previous {
+			return err
+		}
+		return services.RecordOrderStatus(tx, order.ID, order.FulfillmentStatus, models.StatusSourceFulfillment, "")
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update order fulfillment: %w", err)
+	}
+	// Only now, so the update above does not save the shipments again
+	order.Shipments = shipments
+	return nil
+}
+
+// publishShipped announces one shipped package. The message ID is derived from
+// the shipment so a re-run of the sync cannot notify the customer twice.
+func (s *OdooSync) publishShipped(order *models.Order, shipment models.Shipment) {
+	ctx := context.Background()
+	msg := queue.Message{
+		ID:      fmt.Sprintf("order.shipped:%d", shipment.ID),
+		Type:    "order.shipped",
+		Payload: order,
+	}
+
+	if err := s.queueClient.Publish(ctx, "orders", msg); err != nil {
+		log.Printf("Failed to publish order shipped event for order %d: %v", order.ID, err)
+	}
+	if err := s.queueClient.Publish(ctx, "notifications", msg); err != nil {
+		log.Printf("Failed to publish shipping notification for order %d: %v", order.ID, err)
+	}
+}
@@ -0,0 +1,112 @@
+package sync_test
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/internal/sync"
+	"ecommerce/internal/testutils/mocks"
+	"ecommerce/pkg/odoo"
+	"ecommerce/pkg/queue"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var shipmentColumns = []string{"id", "order_id", "odoo_picking_id", "reference", "state", "tracking_number", "tracking_url", "shipped_at"}
+
+// syncShipments runs a shipment sync of pending order 7, whose sale order 5
+// has pickings, expecting its fulfillment to become status
+func syncShipments(t *testing.T, publisher *mocks.MockPublisher, pickings []odoo.OdooPicking, producing int, status, tracking string) {
+	db, sqlMock := mocks.NewDB(t)
+	odooClient := new(mocks.MockOdooClient)
+	odooClient.On("NewCriteria").Return(nil)
+	odooClient.On("NewOptions").Return(nil)
+	odooClient.On("SearchRead", "stock.picking", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			*args.Get(3).(*[]odoo.OdooPicking) = pickings
+		}).Return(nil)
+	t.Cleanup(func() {
+		odooClient.AssertExpectations(t)
+		publisher.AssertExpectations(t)
+	})
+
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "orders" WHERE odoo_id IS NOT NULL AND fulfillment_status NOT IN ($1,$2)`)).
+		WithArgs(models.FulfillmentShipped, models.FulfillmentCancelled).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "odoo_id", "fulfillment_status", "customer_email"}).
+			AddRow(7, 5, models.FulfillmentPending, "shopper@example.com"))
+
+	saved := sqlmock.NewRows(shipmentColumns)
+	for i, picking := range pickings {
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "shipments" WHERE odoo_picking_id = $1`)).
+			WithArgs(picking.ID, 1).
+			WillReturnRows(sqlmock.NewRows(shipmentColumns))
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "shipments"`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(i + 1))
+		sqlMock.ExpectCommit()
+		saved.AddRow(i+1, 7, picking.ID, picking.Name, picking.State, picking.CarrierTrackingRef, picking.CarrierTrackingURL, picking.DateDone)
+	}
+
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "shipments" WHERE order_id = $1 ORDER BY shipped_at`)).
+		WithArgs(7).
+		WillReturnRows(saved)
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "manufacturing_orders"`)).
+		WithArgs(7, "done", "cancel").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(producing))
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(regexp.QuoteMeta(`UPDATE "orders" SET "fulfillment_status"=$1,"tracking_number"=$2,"tracking_url"=$3`)).
+		WithArgs(status, tracking, sqlmock.AnyArg(), sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if status != models.FulfillmentPending {
+		sqlMock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "order_status_events"`)).
+			WithArgs(7, status, models.StatusSourceFulfillment, "", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	}
+	sqlMock.ExpectCommit()
+
+	odooSync := sync.NewOdooSync(db, odooClient, publisher, nil, nil)
+	require.NoError(t, odooSync.SyncShipments(context.Background()))
+}
+
+func TestSyncShipments(t *testing.T) {
+	shippedAt := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	done := odoo.OdooPicking{
+		ID: 31, Name: "WH/OUT/00031", State: "done", SaleID: &odoo.Many2One{ID: 5},
+		CarrierTrackingRef: "TRACK31", CarrierTrackingURL: "https://carrier.test/TRACK31", DateDone: &shippedAt,
+	}
+	ready := odoo.OdooPicking{ID: 32, Name: "WH/OUT/00032", State: "assigned", SaleID: &odoo.Many2One{ID: 5}}
+	waiting := odoo.OdooPicking{ID: 33, Name: "WH/OUT/00033", State: "waiting", SaleID: &odoo.Many2One{ID: 5}}
+
+	// expectShipped expects one order.shipped event for the done picking
+	expectShipped := func(publisher *mocks.MockPublisher) {
+		shipped := mock.MatchedBy(func(msg queue.Message) bool {
+			return msg.Type == "order.shipped" && msg.ID == "order.shipped:1"
+		})
+		publisher.On("Publish", "orders", shipped).Return(nil).Once()
+		publisher.On("Publish", "notifications", shipped).Return(nil).Once()
+	}
+
+	t.Run("one of two packages shipped", func(t *testing.T) {
+		publisher := new(mocks.MockPublisher)
+		expectShipped(publisher)
+		syncShipments(t, publisher, []odoo.OdooPicking{done, ready}, 0, models.FulfillmentPartiallyShipped, "TRACK31")
+	})
+
+	t.Run("every package shipped", func(t *testing.T) {
+		publisher := new(mocks.MockPublisher)
+		expectShipped(publisher)
+		syncShipments(t, publisher, []odoo.OdooPicking{done}, 0, models.FulfillmentShipped, "TRACK31")
+	})
+
+	t.Run("made-to-order items in production", func(t *testing.T) {
+		syncShipments(t, new(mocks.MockPublisher), []odoo.OdooPicking{waiting}, 1, models.FulfillmentInProduction, "")
+	})
+
+	t.Run("nothing shipped yet", func(t *testing.T) {
+		syncShipments(t, new(mocks.MockPublisher), []odoo.OdooPicking{ready}, 0, models.FulfillmentPending, "")
+	})
+}
@@ -0,0 +1,268 @@
+package sync
+
+import (
+	"context"
+	"ecommerce/internal/models"
+	"ecommerce/internal/services"
+	"ecommerce/pkg/odoo"
+	"ecommerce/pkg/queue"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SyncWarehouses mirrors Odoo's warehouses with the lead time of their
+// delivery routes, and removes warehouses that were archived or deleted
+func (s *OdooSync) SyncWarehouses(ctx context.Context) error {
+	var warehouses []odoo.OdooWarehouse
+	options := s.odooClient.NewOptions().FetchFields("id", "name", "code", "sequence", "lot_stock_id", "delivery_route_id")
+	err := s.odooClient.SearchRead(ctx, "stock.warehouse", s.odooClient.NewCriteria(), options, &warehouses)
+	if err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return fmt.Errorf("failed to fetch warehouses from Odoo: %w", err)
+	}
+
+	var routeIDs []int64
+	for _, warehouse := range warehouses {
+		if warehouse.DeliveryRoute != nil {
+			routeIDs = append(routeIDs, warehouse.DeliveryRoute.ID)
+		}
+	}
+	leadDays := make(map[int64]int, len(routeIDs))
+	if len(routeIDs) > 0 {
+		// Each step of a multi-step delivery adds its own delay
+		var rules []odoo.OdooStockRule
+		criteria := s.odooClient.NewCriteria().Add("route_id", "in", routeIDs)
+		options := s.odooClient.NewOptions().FetchFields("id", "route_id", "delay")
+		if err := s.odooClient.SearchRead(ctx, "stock.rule", criteria, options, &rules); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+			return fmt.Errorf("failed to fetch delivery rules from Odoo: %w", err)
+		}
+		for _, rule := range rules {
+			if rule.Route != nil {
+				leadDays[rule.Route.ID] += rule.Delay
+			}
+		}
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		odooIDs := make([]int64, 0, len(warehouses))
+		for _, record := range warehouses {
+			var warehouse models.Warehouse
+			if err := tx.Where("odoo_id = ?", record.ID).FirstOrInit(&warehouse).Error; err != nil {
+				return fmt.Errorf("failed to load warehouse %s: %w", record.Code, err)
+			}
+			warehouse.OdooID = record.ID
+			warehouse.Name = record.Name
+			warehouse.Code = record.Code
+			warehouse.Sequence = record.Sequence
+			warehouse.LocationID = 0
+			if record.StockLocation != nil {
+				warehouse.LocationID = record.StockLocation.ID
+			}
+			warehouse.LeadDays = 0
+			if record.DeliveryRoute != nil {
+				warehouse.LeadDays = leadDays[record.DeliveryRoute.ID]
+			}
+			if err := tx.Save(&warehouse).Error; err != nil {
+				return fmt.Errorf("failed to save warehouse %s: %w", record.Code, err)
+			}
+			odooIDs = append(odooIDs, record.ID)
+		}
+
+		removed := tx.Where("1 = 1")
+		if len(odooIDs) > 0 {
+			removed = tx.Where("odoo_id NOT IN ?", odooIDs)
+		}
+		if err := removed.Delete(&models.Warehouse{}).Error; err != nil {
+			return fmt.Errorf("failed to remove deleted warehouses: %w", err)
+		}
+		return nil
+	})
+}
+
+// SyncStock mirrors the stock of every variant per internal location from
+// Odoo's quants. The first run copies all of it; later runs re-read only the
+// variants with quants written since the previous sync. Quants Odoo deletes
+// are emptied first, so that write is seen too.
+func (s *OdooSync) SyncStock(ctx context.Context) error {
+	startedAt := time.Now()
+	if s.stockSyncedAt.IsZero() {
+		if err := s.refreshStock(ctx, nil); err != nil {
+			return err
+		}
+		s.stockSyncedAt = startedAt
+		return nil
+	}
+
+	var changed []odoo.OdooQuant
+	criteria := s.odooClient.NewCriteria().Add("write_date", ">=", odoo.FormatDateTime(s.stockSyncedAt))
+	options := s.odooClient.NewOptions().FetchFields("product_id", "product_tmpl_id")
+	if err := s.odooClient.SearchRead(ctx, "stock.quant", criteria, options, &changed); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return fmt.Errorf("failed to fetch stock changes from Odoo: %w", err)
+	}
+	if len(changed) > 0 {
+		variantIDs := make([]int64, len(changed))
+		templateIDs := make([]int64, len(changed))
+		for i, quant := range changed {
+			variantIDs[i] = quant.Product.ID
+			templateIDs[i] = quant.Template.ID
+		}
+		if err := s.refreshStock(ctx, variantIDs); err != nil {
+			return err
+		}
+		s.announceStock(ctx, templateIDs, variantIDs)
+	}
+	s.stockSyncedAt = startedAt
+	return nil
+}
+
+// refreshStock replaces the stock levels of variants, or of all variants
+// when variantIDs is nil, with those in Odoo
+func (s *OdooSync) refreshStock(ctx context.Context, variantIDs []int64) error {
+	criteria := s.odooClient.NewCriteria().Add("location_id.usage", "=", "internal")
+	if variantIDs != nil {
+		criteria.Add("product_id", "in", variantIDs)
+	}
+	var quants []odoo.OdooQuant
+	options := s.odooClient.NewOptions().FetchFields(
+		"id", "product_id", "product_tmpl_id", "location_id", "warehouse_id", "quantity", "reserved_quantity",
+	)
+	if err := s.odooClient.SearchRead(ctx, "stock.quant", criteria, options, &quants); err != nil && !errors.Is(err, odoo.ErrNotFound) {
+		return fmt.Errorf("failed to fetch stock from Odoo: %w", err)
+	}
+	levels := stockLevels(quants)
+
+	var previous []models.StockLevel
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		stale := tx.Where("1 = 1")
+		if variantIDs != nil {
+			stale = tx.Where("variant_id IN ?", variantIDs)
+		}
+		if err := stale.Session(&gorm.Session{}).Find(&previous).Error; err != nil {
+			return fmt.Errorf("failed to load stock levels: %w", err)
+		}
+		if err := stale.Delete(&models.StockLevel{}).Error; err != nil {
+			return fmt.Errorf("failed to clear stock levels: %w", err)
+		}
+		if len(levels) == 0 {
+			return nil
+		}
+		if err := tx.CreateInBatches(levels, 500).Error; err != nil {
+			return fmt.Errorf("failed to save stock levels: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The levels are saved either way; a failed alert is not retried
+	if changes := stockChanges(previous, levels); len(changes) > 0 && s.stockWatcher != nil {
+		if err := s.stockWatcher.StockChanged(ctx, changes); err != nil {
+			log.Printf("Failed to act on stock changes: %v", err)
+		}
+	}
+	return nil
+}
+
+// stockChanges compares stock per variant and warehouse, on hand less
+// reserved, before and after a refresh. Every warehouse of a variant whose
+// stock moved anywhere is included, so totals can be taken over them.
+func stockChanges(previous, levels []models.StockLevel) []models.StockChange {
+	type key struct{ variant, warehouse int64 }
+	indexes := make(map[key]int)
+	var changes []models.StockChange
+	entry := func(level models.StockLevel) *models.StockChange {
+		k := key{level.VariantID, level.WarehouseID}
+		i, ok := indexes[k]
+		if !ok {
+			i = len(changes)
+			indexes[k] = i
+			changes = append(changes, models.StockChange{
+				VariantID:   level.VariantID,
+				TemplateID:  level.TemplateID,
+				WarehouseID: level.WarehouseID,
+			})
+		}
+		return &changes[i]
+	}
+	for _, level := range previous {
+		entry(level).Before += level.Quantity - level.Reserved
+	}
+	for _, level := range levels {
+		entry(level).After += level.Quantity - level.Reserved
+	}
+
+	moved := make(map[int64]bool)
+	for _, change := range changes {
+		if change.Before != change.After {
+			moved[change.VariantID] = true
+		}
+	}
+	var result []models.StockChange
+	for _, change := range changes {
+		if moved[change.VariantID] {
+			result = append(result, change)
+		}
+	}
+	return result
+}
+
+// announceStock tells live subscribers that the stock of variants changed.
+// Products whose stock is announced are completed from the stock levels, as
+// not every change names them.
+func (s *OdooSync) announceStock(ctx context.Context, templateIDs, variantIDs []int64) {
+	var stocked []int64
+	err := s.db.WithContext(ctx).Model(&models.StockLevel{}).
+		Where("variant_id IN ?", variantIDs).
+		Distinct().Pluck("template_id", &stocked).Error
+	if err != nil {
+		log.Printf("Failed to look up products of changed stock: %v", err)
+	}
+	seen := make(map[int64]bool, len(templateIDs)+len(stocked))
+	var products []int64
+	for _, id := range append(stocked, templateIDs...) {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			products = append(products, id)
+		}
+	}
+
+	msg := queue.Message{
+		Type:    services.EventStockUpdated,
+		Payload: models.ProductChange{TemplateIDs: products, VariantIDs: variantIDs},
+	}
+	if err := s.queueClient.Publish(ctx, "inventory", msg); err != nil {
+		log.Printf("Failed to publish stock update: %v", err)
+	}
+}
+
+// stockLevels sums quants per variant and location; lots, packages and
+// owners are not told apart
+func stockLevels(quants []odoo.OdooQuant) []models.StockLevel {
+	type key struct{ variant, location int64 }
+	indexes := make(map[key]int, len(quants))
+	var levels []models.StockLevel
+	for _, quant := range quants {
+		k := key{quant.Product.ID, quant.Location.ID}
+		i, ok := indexes[k]
+		if !ok {
+			i = len(levels)
+			indexes[k] = i
+			level := models.StockLevel{
+				VariantID:  quant.Product.ID,
+				LocationID: quant.Location.ID,
+				TemplateID: quant.Template.ID,
+			}
+			if quant.Warehouse != nil {
+				level.WarehouseID = quant.Warehouse.ID
+			}
+			levels = append(levels, level)
+		}
+		levels[i].Quantity += quant.Quantity
+		levels[i].Reserved += quant.ReservedQuantity
+	}
+	return levels
+}
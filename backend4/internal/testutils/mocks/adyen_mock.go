@@ -0,0 +1,20 @@
+package mocks
+
+import (
+	"ecommerce/pkg/adyen"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockCapturer is a mock implementation of adyen.Capturer
+type MockCapturer struct {
+	mock.Mock
+}
+
+var _ adyen.Capturer = (*MockCapturer)(nil)
+
+// Capture mocks the Capture method
+func (m *MockCapturer) Capture(pspReference string, amount float64, currency, reference string) error {
+	args := m.Called(pspReference, amount, currency, reference)
+	return args.Error(0)
+}
@@ -1,6 +1,7 @@
 package mocks
 
 import (
+	"context"
 	"ecommerce/pkg/odoo"
 
 	go_odoo "github.com/skilld-labs/go-odoo"
@@ -27,7 +28,7 @@ type MockOptions struct {
 var _ odoo.OdooClient = (*MockOdooClient)(nil)
 
 // Create mocks the Create method
-func (m *MockOdooClient) Create(model string, data []interface{}, options *go_odoo.Options) ([]int64, error) {
+func (m *MockOdooClient) Create(ctx context.Context, model string, data []interface{}, options *go_odoo.Options) ([]int64, error) {
 	args := m.Called(model, data, options)
 	return args.Get(0).([]int64), args.Error(1)
 }
@@ -50,7 +51,7 @@ func (m *MockOdooClient) NewOptions() *go_odoo.Options {
 }
 
 // SearchRead mocks the SearchRead method
-func (m *MockOdooClient) SearchRead(model string, criteria *go_odoo.Criteria, options *go_odoo.Options, result interface{}) error {
+func (m *MockOdooClient) SearchRead(ctx context.Context, model string, criteria *go_odoo.Criteria, options *go_odoo.Options, result interface{}) error {
 	args := m.Called(model, criteria, options, result)
 	err := args.Error(0)
 	if err != nil {
@@ -80,11 +81,65 @@ func (m *MockOdooClient) SearchRead(model string, criteria *go_odoo.Criteria, op
 }
 
 // Read mocks the Read method
-func (m *MockOdooClient) Read(model string, ids []int64, options *go_odoo.Options, result interface{}) error {
+func (m *MockOdooClient) Read(ctx context.Context, model string, ids []int64, options *go_odoo.Options, result interface{}) error {
 	args := m.Called(model, ids, options, result)
 	return args.Error(0)
 }
 
+// Search mocks the Search method
+func (m *MockOdooClient) Search(ctx context.Context, model string, criteria *go_odoo.Criteria, options *go_odoo.Options) ([]int64, error) {
+	args := m.Called(model, criteria, options)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+// Write mocks the Write method
+func (m *MockOdooClient) Write(ctx context.Context, model string, ids []int64, values map[string]interface{}) error {
+	args := m.Called(model, ids, values)
+	return args.Error(0)
+}
+
+// Unlink mocks the Unlink method
+func (m *MockOdooClient) Unlink(ctx context.Context, model string, ids []int64) error {
+	args := m.Called(model, ids)
+	return args.Error(0)
+}
+
+// SearchCount mocks the SearchCount method
+func (m *MockOdooClient) SearchCount(ctx context.Context, model string, criteria *go_odoo.Criteria) (int64, error) {
+	args := m.Called(model, criteria)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// FieldsGet mocks the FieldsGet method
+func (m *MockOdooClient) FieldsGet(ctx context.Context, model string, fields ...string) (map[string]odoo.Field, error) {
+	args := m.Called(model, fields)
+	return args.Get(0).(map[string]odoo.Field), args.Error(1)
+}
+
+// NameSearch mocks the NameSearch method
+func (m *MockOdooClient) NameSearch(ctx context.Context, model, name string, criteria *go_odoo.Criteria, limit int) ([]odoo.Many2One, error) {
+	args := m.Called(model, name, criteria, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]odoo.Many2One), args.Error(1)
+}
+
+// ExecuteKw mocks the ExecuteKw method
+func (m *MockOdooClient) ExecuteKw(ctx context.Context, method, model string, args []interface{}, options *go_odoo.Options, result interface{}) error {
+	called := m.Called(method, model, args, options, result)
+	return called.Error(0)
+}
+
+// RenderReportPDF mocks the RenderReportPDF method
+func (m *MockOdooClient) RenderReportPDF(ctx context.Context, reportName string, ids []int64) ([]byte, error) {
+	args := m.Called(reportName, ids)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]byte), args.Error(1)
+}
+
 func (m *MockCriteria) Add(field string, operator string, value interface{}) *MockCriteria {
 	args := m.Called(field, operator, value)
 	return args.Get(0).(*MockCriteria)
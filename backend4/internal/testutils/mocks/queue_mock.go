@@ -0,0 +1,21 @@
+package mocks
+
+import (
+	"context"
+	"ecommerce/pkg/queue"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// MockPublisher is a mock implementation of queue.Publisher
+type MockPublisher struct {
+	mock.Mock
+}
+
+var _ queue.Publisher = (*MockPublisher)(nil)
+
+// Publish mocks the Publish method
+func (m *MockPublisher) Publish(ctx context.Context, queueName string, msg queue.Message) error {
+	args := m.Called(queueName, msg)
+	return args.Error(0)
+}
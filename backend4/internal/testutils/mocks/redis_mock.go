@@ -0,0 +1,17 @@
+package mocks
+
+import (
+	"ecommerce/pkg/redis"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// NewRedis starts an in-memory Redis for the test and connects a client to it
+func NewRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client, err := redis.NewClient(redis.Config{Host: server.Host(), Port: server.Port()})
+	require.NoError(t, err)
+	return client, server
+}
@@ -3,23 +3,38 @@ package adyen
 import (
 	"context"
 	"fmt"
+	"math"
 
 	"github.com/adyen/adyen-go-api-library/v5/src/adyen"
 	"github.com/adyen/adyen-go-api-library/v5/src/checkout"
 	"github.com/adyen/adyen-go-api-library/v5/src/common"
+	"github.com/adyen/adyen-go-api-library/v5/src/payments"
 )
 
 type Client struct {
 	checkout *checkout.Checkout
+	payments *payments.Payments
 	config   *Config
 }
 
+// Capturer captures authorised payments
+type Capturer interface {
+	Capture(pspReference string, amount float64, currency, reference string) error
+}
+
+// Ensure Client implements Capturer
+var _ Capturer = (*Client)(nil)
+
 type Config struct {
 	ApiKey      string
 	Environment string
 	MerchantID  string
 	ClientKey   string
 	ReturnURL   string
+
+	// Merchant account set to capture manually in the Customer Area. Its
+	// payments are only authorised until Capture is called.
+	ManualCaptureMerchantID string
 }
 
 func NewClient(cfg *Config) (*Client, error) {
@@ -30,6 +45,7 @@ func NewClient(cfg *Config) (*Client, error) {
 	})
 	return &Client{
 		checkout: client.Checkout,
+		payments: client.Payments,
 		config:   cfg,
 	}, nil
 }
@@ -131,3 +147,66 @@ func (c *Client) HandleWebhook(notification map[string]interface{}) error {
 func (c *Client) ReturnCheckout() *checkout.Checkout {
 	return c.checkout
 }
+
+// GetPaymentLink fetches the current state of a payment link
+func (c *Client) GetPaymentLink(linkID string) (*checkout.PaymentLinkResource, error) {
+	ctx := context.Background()
+	link, httpResp, err := c.checkout.GetPaymentLink(linkID, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment link: %w\nhttp response: %v",
+			err, httpResp,
+		)
+	}
+
+	return &link, nil
+}
+
+// ExpirePaymentLink cancels a payment link so the shopper can no longer pay it
+func (c *Client) ExpirePaymentLink(linkID string) error {
+	ctx := context.Background()
+	request := &checkout.UpdatePaymentLinkRequest{
+		Status: "expired",
+	}
+
+	_, httpResp, err := c.checkout.UpdatePaymentLink(linkID, request, ctx)
+	if err != nil {
+		return fmt.Errorf("failed to expire payment link: %w\nhttp response: %v",
+			err, httpResp,
+		)
+	}
+
+	return nil
+}
+
+// ManualCaptureAccount is the merchant account for payments to authorise
+// only, empty when none is configured
+func (c *Client) ManualCaptureAccount() string {
+	return c.config.ManualCaptureMerchantID
+}
+
+// Capture captures an authorised payment of the manual capture account.
+// Adyen reports the outcome with a CAPTURE notification.
+func (c *Client) Capture(pspReference string, amount float64, currency, reference string) error {
+	request := &payments.ModificationRequest{
+		MerchantAccount:   c.config.ManualCaptureMerchantID,
+		OriginalReference: pspReference,
+		ModificationAmount: &payments.Amount{
+			Currency: currency,
+			Value:    int64(math.Round(amount * 100)), // Convert to cents
+		},
+		Reference: reference,
+	}
+
+	ctx := context.Background()
+	result, httpResp, err := c.payments.Capture(request, ctx)
+	if err != nil {
+		return fmt.Errorf("failed to capture payment: %w\nhttp response: %v",
+			err, httpResp,
+		)
+	}
+	if result.Response != "[capture-received]" {
+		return fmt.Errorf("capture of payment %s not received: %s", pspReference, result.Response)
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"golang.org/x/sync/singleflight"
+)
+
+// Remote is the shared tier, implemented by *redis.Client. Get must leave
+// dest untouched when the key does not exist.
+type Remote interface {
+	Get(ctx context.Context, key string, dest interface{}) error
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	Delete(ctx context.Context, key string) error
+	Publish(ctx context.Context, channel string, value interface{}) error
+	Subscribe(ctx context.Context, channel string, handle func(payload []byte)) error
+}
+
+type Config struct {
+	Name      string        // Prefix for Redis keys and the invalidation channel
+	LocalSize int           // Entries kept in process
+	FreshFor  time.Duration // Age up to which entries are served as is
+	StaleFor  time.Duration // Further age up to which entries are served while refreshed in the background
+}
+
+// LoadFunc fetches the value for a key from the source of truth
+type LoadFunc func(ctx context.Context) (interface{}, error)
+
+// Tiered is a read-through cache with an in-process LRU in front of Redis.
+// Entries younger than FreshFor are served directly; older ones are served
+// once more while a single background refresh replaces them. Misses on
+// the same key share one load across goroutines. Invalidations are
+// broadcast over Redis so every replica drops its local copy.
+type Tiered struct {
+	config  Config
+	local   *lru.Cache[string, entry]
+	remote  Remote
+	loads   singleflight.Group
+	channel string
+
+	refreshMu  sync.Mutex
+	refreshing map[string]bool
+}
+
+// entry is what both tiers store. Values stay encoded so callers never share
+// a decoded object.
+type entry struct {
+	Value     json.RawMessage `json:"value"`
+	FetchedAt time.Time       `json:"fetched_at"`
+}
+
+func (e entry) age() time.Duration {
+	return time.Since(e.FetchedAt)
+}
+
+// NewTiered builds a cache; remote may be nil for a process-local cache
+func NewTiered(config Config, remote Remote) (*Tiered, error) {
+	if config.LocalSize == 0 {
+		config.LocalSize = 1000
+	}
+	if config.FreshFor == 0 {
+		config.FreshFor = time.Minute
+	}
+
+	local, err := lru.New[string, entry](config.LocalSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s cache: %w", config.Name, err)
+	}
+	return &Tiered{
+		config:     config,
+		local:      local,
+		remote:     remote,
+		channel:    fmt.Sprintf("cache:%s:invalidate", config.Name),
+		refreshing: make(map[string]bool),
+	}, nil
+}
+
+// Listen drops local entries invalidated by other replicas until ctx is done
+func (t *Tiered) Listen(ctx context.Context) error {
+	if t.remote == nil {
+		return nil
+	}
+	return t.remote.Subscribe(ctx, t.channel, func(payload []byte) {
+		var keys []string
+		if err := json.Unmarshal(payload, &keys); err != nil {
+			log.Printf("Invalid %s cache invalidation: %v", t.config.Name, err)
+			return
+		}
+		for _, key := range keys {
+			t.local.Remove(key)
+		}
+	})
+}
+
+// Get decodes the cached value for key into dest, calling load on a miss
+func (t *Tiered) Get(ctx context.Context, key string, dest interface{}, load LoadFunc) error {
+	e, ok := t.lookup(ctx, key)
+	if ok {
+		switch age := e.age(); {
+		case age < t.config.FreshFor:
+			return json.Unmarshal(e.Value, dest)
+		case age < t.config.FreshFor+t.config.StaleFor:
+			t.refresh(key, load)
+			return json.Unmarshal(e.Value, dest)
+		}
+	}
+
+	result, err, _ := t.loads.Do(key, func() (interface{}, error) {
+		return t.fill(ctx, key, load)
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(result.(entry).Value, dest)
+}
+
+// Invalidate drops keys from both tiers on every replica
+func (t *Tiered) Invalidate(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	for _, key := range keys {
+		t.local.Remove(key)
+	}
+	if t.remote == nil {
+		return nil
+	}
+	for _, key := range keys {
+		if err := t.remote.Delete(ctx, t.remoteKey(key)); err != nil {
+			return err
+		}
+	}
+	return t.remote.Publish(ctx, t.channel, keys)
+}
+
+// lookup finds key in process, then in Redis
+func (t *Tiered) lookup(ctx context.Context, key string) (entry, bool) {
+	if e, ok := t.local.Get(key); ok {
+		return e, true
+	}
+	if t.remote == nil {
+		return entry{}, false
+	}
+
+	var e entry
+	if err := t.remote.Get(ctx, t.remoteKey(key), &e); err != nil {
+		// Redis being down only costs us the shared tier
+		log.Printf("Failed to read %s cache: %v", t.config.Name, err)
+		return entry{}, false
+	}
+	if e.FetchedAt.IsZero() {
+		return entry{}, false
+	}
+	t.local.Add(key, e)
+	return e, true
+}
+
+// fill loads key and stores it in both tiers
+func (t *Tiered) fill(ctx context.Context, key string, load LoadFunc) (entry, error) {
+	value, err := load(ctx)
+	if err != nil {
+		return entry{}, err
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return entry{}, fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+
+	e := entry{Value: encoded, FetchedAt: time.Now()}
+	t.local.Add(key, e)
+	if t.remote != nil {
+		if err := t.remote.Set(ctx, t.remoteKey(key), e, t.config.FreshFor+t.config.StaleFor); err != nil {
+			log.Printf("Failed to write %s cache: %v", t.config.Name, err)
+		}
+	}
+	return e, nil
+}
+
+// refresh reloads a stale key in the background, once per key at a time.
+// A failed refresh keeps the stale entry until it expires.
+func (t *Tiered) refresh(key string, load LoadFunc) {
+	t.refreshMu.Lock()
+	if t.refreshing[key] {
+		t.refreshMu.Unlock()
+		return
+	}
+	t.refreshing[key] = true
+	t.refreshMu.Unlock()
+
+	go func() {
+		defer func() {
+			t.refreshMu.Lock()
+			delete(t.refreshing, key)
+			t.refreshMu.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if _, err, _ := t.loads.Do(key, func() (interface{}, error) {
+			return t.fill(ctx, key, load)
+		}); err != nil {
+			log.Printf("Failed to refresh %s cache entry %s: %v", t.config.Name, key, err)
+		}
+	}()
+}
+
+func (t *Tiered) remoteKey(key string) string {
+	return fmt.Sprintf("cache:%s:%s", t.config.Name, key)
+}
@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryRemote stands in for Redis, shared by several replicas in a test
+type memoryRemote struct {
+	mu          sync.Mutex
+	values      map[string][]byte
+	subscribers map[string][]func([]byte)
+}
+
+func newMemoryRemote() *memoryRemote {
+	return &memoryRemote{values: make(map[string][]byte), subscribers: make(map[string][]func([]byte))}
+}
+
+func (r *memoryRemote) Get(ctx context.Context, key string, dest interface{}) error {
+	r.mu.Lock()
+	value, ok := r.values[key]
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(value, dest)
+}
+
+func (r *memoryRemote) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.values[key] = encoded
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *memoryRemote) Delete(ctx context.Context, key string) error {
+	r.mu.Lock()
+	delete(r.values, key)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *memoryRemote) Publish(ctx context.Context, channel string, value interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	handlers := r.subscribers[channel]
+	r.mu.Unlock()
+	for _, handle := range handlers {
+		handle(encoded)
+	}
+	return nil
+}
+
+func (r *memoryRemote) Subscribe(ctx context.Context, channel string, handle func([]byte)) error {
+	r.mu.Lock()
+	r.subscribers[channel] = append(r.subscribers[channel], handle)
+	r.mu.Unlock()
+	return nil
+}
+
+// counter is a LoadFunc that returns how often it was called
+type counter struct {
+	calls atomic.Int32
+	delay time.Duration
+}
+
+func (c *counter) load(ctx context.Context) (interface{}, error) {
+	time.Sleep(c.delay)
+	return c.calls.Add(1), nil
+}
+
+func newTestCache(t *testing.T, remote Remote, freshFor, staleFor time.Duration) *Tiered {
+	tiered, err := NewTiered(Config{Name: "test", FreshFor: freshFor, StaleFor: staleFor}, remote)
+	require.NoError(t, err)
+	require.NoError(t, tiered.Listen(context.Background()))
+	return tiered
+}
+
+func TestConcurrentMissesShareOneLoad(t *testing.T) {
+	tiered := newTestCache(t, newMemoryRemote(), time.Minute, 0)
+	source := &counter{delay: 20 * time.Millisecond}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var value int32
+			require.NoError(t, tiered.Get(context.Background(), "product:1", &value, source.load))
+			assert.Equal(t, int32(1), value)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), source.calls.Load())
+}
+
+func TestReplicasShareTheRemoteTier(t *testing.T) {
+	remote := newMemoryRemote()
+	first := newTestCache(t, remote, time.Minute, 0)
+	second := newTestCache(t, remote, time.Minute, 0)
+	source := &counter{}
+
+	var value int32
+	require.NoError(t, first.Get(context.Background(), "product:1", &value, source.load))
+	require.NoError(t, second.Get(context.Background(), "product:1", &value, source.load))
+	assert.Equal(t, int32(1), source.calls.Load(), "the second replica reads the copy in redis")
+}
+
+func TestStaleEntriesAreServedWhileRefreshing(t *testing.T) {
+	tiered := newTestCache(t, nil, 20*time.Millisecond, time.Minute)
+	source := &counter{}
+	ctx := context.Background()
+
+	var value int32
+	require.NoError(t, tiered.Get(ctx, "variant:1", &value, source.load))
+	time.Sleep(30 * time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, tiered.Get(ctx, "variant:1", &value, source.load))
+		assert.Equal(t, int32(1), value, "the stale value is answered without waiting")
+	}
+
+	require.Eventually(t, func() bool {
+		require.NoError(t, tiered.Get(ctx, "variant:1", &value, source.load))
+		return value == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(2), source.calls.Load(), "one background refresh for all stale reads")
+}
+
+func TestInvalidateReachesEveryReplica(t *testing.T) {
+	remote := newMemoryRemote()
+	first := newTestCache(t, remote, time.Minute, 0)
+	second := newTestCache(t, remote, time.Minute, 0)
+	source := &counter{}
+	ctx := context.Background()
+
+	var value int32
+	require.NoError(t, first.Get(ctx, "product:1", &value, source.load))
+	require.NoError(t, second.Get(ctx, "product:1", &value, source.load))
+
+	require.NoError(t, first.Invalidate(ctx, "product:1"))
+
+	require.NoError(t, second.Get(ctx, "product:1", &value, source.load))
+	assert.Equal(t, int32(2), value, "the second replica dropped its local copy")
+	require.NoError(t, first.Get(ctx, "product:1", &value, source.load))
+	assert.Equal(t, int32(2), value, "the reload is shared through redis")
+}
@@ -0,0 +1,137 @@
+package odoo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrAuthentication is returned when Odoo rejects the configured credentials
+var ErrAuthentication = errors.New("odoo authentication failed")
+
+// Fault code Odoo's XML-RPC dispatcher uses for odoo.exceptions.AccessDenied
+const faultAccessDenied = 3
+
+// AuthStatus reports the state of the client's Odoo login for health checks
+type AuthStatus struct {
+	Authenticated bool       `json:"authenticated"`
+	Method        string     `json:"method"` // "password" or "api_key"
+	UID           int64      `json:"uid,omitempty"`
+	LastSuccess   *time.Time `json:"last_success,omitempty"`
+	LastFailure   *time.Time `json:"last_failure,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	Reauths       int        `json:"reauthentications"`
+}
+
+// authState holds the uid and what happened on the latest login attempts
+type authState struct {
+	mu     sync.RWMutex
+	uid    int64
+	status AuthStatus
+}
+
+// secret is what Odoo expects in the password slot of RPC calls. An API key
+// replaces the password there, next to the normal login.
+func (c *Client) secret() string {
+	if c.config.APIKey != "" {
+		return c.config.APIKey
+	}
+	return c.config.Password
+}
+
+func (c *Client) authMethod() string {
+	if c.config.APIKey != "" {
+		return "api_key"
+	}
+	return "password"
+}
+
+func (c *Client) currentUID() int64 {
+	c.auth.mu.RLock()
+	defer c.auth.mu.RUnlock()
+	return c.auth.uid
+}
+
+// AuthStatus returns the current authentication state
+func (c *Client) AuthStatus() AuthStatus {
+	c.auth.mu.RLock()
+	defer c.auth.mu.RUnlock()
+	status := c.auth.status
+	status.Method = c.authMethod()
+	return status
+}
+
+// authenticate logs in through the common service and stores the uid
+func (c *Client) authenticate(ctx context.Context) (int64, error) {
+	var uid int64
+	err := c.call(ctx, "common", "authenticate", []interface{}{
+		c.config.Database,
+		c.config.Username,
+		c.secret(),
+		map[string]interface{}{},
+	}, &uid)
+	if err == nil && uid == 0 {
+		err = fmt.Errorf("%w: invalid credentials for %s", ErrAuthentication, c.config.Username)
+	}
+
+	now := time.Now()
+	c.auth.mu.Lock()
+	defer c.auth.mu.Unlock()
+	if err != nil {
+		c.auth.status.Authenticated = false
+		c.auth.status.LastFailure = &now
+		c.auth.status.LastError = err.Error()
+		return 0, err
+	}
+
+	c.auth.uid = uid
+	c.auth.status.Authenticated = true
+	c.auth.status.UID = uid
+	c.auth.status.LastSuccess = &now
+	c.auth.status.LastError = ""
+	return uid, nil
+}
+
+// reauthenticate logs in again after Odoo rejected staleUID. Concurrent callers
+// share one login, and callers that lost the race reuse the fresh uid.
+func (c *Client) reauthenticate(ctx context.Context, staleUID int64) (int64, error) {
+	if uid := c.currentUID(); uid != 0 && uid != staleUID {
+		return uid, nil
+	}
+
+	result, err, _ := c.authGroup.Do("authenticate", func() (interface{}, error) {
+		c.auth.mu.Lock()
+		c.auth.status.Reauths++
+		c.auth.mu.Unlock()
+
+		// Detach from the caller so one cancelled request cannot fail the login for all
+		loginCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.config.CallTimeout)
+		defer cancel()
+		return c.authenticate(loginCtx)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
+
+// isAuthFailure reports whether err means our login is no longer valid, as
+// opposed to a permission error on a record, which re-authenticating cannot fix.
+func isAuthFailure(err error) bool {
+	var fault *Error
+	if !errors.As(err, &fault) {
+		return false
+	}
+	if fault.Code == faultAccessDenied {
+		return true
+	}
+	switch fault.Name {
+	case "odoo.exceptions.AccessDenied", "odoo.http.SessionExpiredException":
+		return true
+	}
+	message := strings.ToLower(fault.Message)
+	return strings.Contains(message, "access denied") || strings.Contains(message, "session expired")
+}
@@ -0,0 +1,104 @@
+package odoo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// restartedOdoo rejects execute_kw calls made with an old uid until the client
+// has logged in again, like an Odoo whose database was re-created.
+type restartedOdoo struct {
+	currentUID int64
+	logins     atomic.Int32
+	calls      atomic.Int32
+}
+
+func (o *restartedOdoo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request jsonrpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reply := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+	switch request.Params.Method {
+	case "authenticate":
+		o.logins.Add(1)
+		if request.Params.Args[2] == "key-123" {
+			reply["result"] = o.currentUID
+		} else {
+			reply["result"] = false
+		}
+	case "execute_kw":
+		o.calls.Add(1)
+		if int64(request.Params.Args[1].(float64)) != o.currentUID {
+			reply["error"] = map[string]interface{}{
+				"code":    200,
+				"message": "Odoo Server Error",
+				"data":    map[string]interface{}{"name": "odoo.exceptions.AccessDenied", "message": "Access Denied"},
+			}
+		} else {
+			reply["result"] = int64(5)
+		}
+	}
+	json.NewEncoder(w).Encode(reply)
+}
+
+func TestReauthenticatesOnceForConcurrentCalls(t *testing.T) {
+	odoo := &restartedOdoo{currentUID: 7}
+	server := httptest.NewServer(odoo)
+	defer server.Close()
+
+	client := newTestClient(t, ProtocolJSONRPC, server.URL)
+	client.config.APIKey = "key-123"
+	client.config.Password = "old-password"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			count, err := client.SearchCount(context.Background(), "res.partner", nil)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(5), count)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), odoo.logins.Load())
+	status := client.AuthStatus()
+	assert.True(t, status.Authenticated)
+	assert.Equal(t, "api_key", status.Method)
+	assert.Equal(t, int64(7), status.UID)
+	assert.Equal(t, 1, status.Reauths)
+}
+
+func TestReportsRejectedCredentials(t *testing.T) {
+	odoo := &restartedOdoo{currentUID: 7}
+	server := httptest.NewServer(odoo)
+	defer server.Close()
+
+	client := newTestClient(t, ProtocolJSONRPC, server.URL)
+	client.config.APIKey = "revoked-key"
+
+	_, err := client.SearchCount(context.Background(), "res.partner", nil)
+	require.ErrorIs(t, err, ErrAuthentication)
+
+	status := client.AuthStatus()
+	assert.False(t, status.Authenticated)
+	assert.NotNil(t, status.LastFailure)
+	assert.Contains(t, status.LastError, "invalid credentials")
+}
+
+func TestAccessErrorDoesNotReauthenticate(t *testing.T) {
+	assert.False(t, isAuthFailure(&Error{Code: 4, Name: "odoo.exceptions.AccessError", Message: "not allowed"}))
+	assert.True(t, isAuthFailure(&Error{Code: faultAccessDenied, Message: "Access Denied"}))
+}
@@ -0,0 +1,115 @@
+package odoo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// BusNotification is a message an Odoo server sent on the bus, such as one
+// sent from an automated action with env['bus.bus']._sendone(channel, type, payload)
+type BusNotification struct {
+	ID      int64           `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// PollBus returns the bus notifications on channels after the one with ID
+// last, without waiting for new ones. It uses the websocket fallback route of
+// Odoo 16 and later, in the web session that reports use.
+func (c *Client) PollBus(ctx context.Context, channels []string, last int64) ([]BusNotification, error) {
+	var notifications []BusNotification
+	err := c.protect(ctx, OpRead, func(ctx context.Context) error {
+		var err error
+		notifications, err = c.pollBus(ctx, channels, last)
+		return err
+	})
+	return notifications, err
+}
+
+func (c *Client) pollBus(ctx context.Context, channels []string, last int64) ([]BusNotification, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		web, err := c.webSession(ctx, attempt > 0)
+		if err != nil {
+			return nil, err
+		}
+
+		// Odoo expects the first poll of a session to say so, and treats a
+		// later poll without the marker as an expired session
+		c.webMu.Lock()
+		firstPoll := c.busSession != web
+		c.busSession = web
+		c.webMu.Unlock()
+
+		payload, err := json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "call",
+			"params": map[string]interface{}{
+				"channels":      channels,
+				"last":          last,
+				"is_first_poll": firstPoll,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.URL+"/websocket/peek_notifications", bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := web.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to poll odoo bus: %w", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read odoo bus: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("odoo bus: %w", &statusError{code: resp.StatusCode})
+		}
+
+		var result struct {
+			Result *struct {
+				Notifications []struct {
+					ID      int64 `json:"id"`
+					Message struct {
+						Type    string          `json:"type"`
+						Payload json.RawMessage `json:"payload"`
+					} `json:"message"`
+				} `json:"notifications"`
+			} `json:"result"`
+			Error *struct {
+				Message string `json:"message"`
+				Data    struct {
+					Name string `json:"name"`
+				} `json:"data"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("failed to decode odoo bus: %w", err)
+		}
+		if result.Error != nil {
+			if result.Error.Data.Name == "odoo.http.SessionExpiredException" {
+				continue
+			}
+			return nil, fmt.Errorf("odoo bus: %s", result.Error.Message)
+		}
+		if result.Result == nil {
+			return nil, nil
+		}
+
+		notifications := make([]BusNotification, len(result.Result.Notifications))
+		for i, n := range result.Result.Notifications {
+			notifications[i] = BusNotification{ID: n.ID, Type: n.Message.Type, Payload: n.Message.Payload}
+		}
+		return notifications, nil
+	}
+
+	return nil, fmt.Errorf("odoo bus: odoo session was rejected")
+}
@@ -1,22 +1,30 @@
 package odoo
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
-	"github.com/kolo/xmlrpc"
 	"github.com/skilld-labs/go-odoo"
+	"golang.org/x/sync/singleflight"
 )
 
 type Client struct {
-	*odoo.Client
-	config       Config
-	commonClient *xmlrpc.Client
-	objectClient *xmlrpc.Client
-	uid          int
-	transport    *http.Transport
+	config     Config
+	transport  *http.Transport
+	httpClient *http.Client
+	rpc        transport
+
+	auth      authState
+	authGroup singleflight.Group
+	guards    map[string]*guard // Breaker and bulkhead per operation class
+
+	webMu      sync.Mutex
+	webClient  *http.Client // Session-authenticated client for web controllers
+	busSession *http.Client // Web session the bus was last polled in
 }
 
 type Config struct {
@@ -24,42 +32,71 @@ type Config struct {
 	Database      string
 	Username      string
 	Password      string
+	APIKey        string // Used instead of Password for RPC calls when set
 	MaxRetries    int
 	RetryInterval time.Duration
+	CallTimeout   time.Duration // Deadline for a call whose context has none
+	Protocol      string        // "xmlrpc" (default) or "jsonrpc"
+	Resilience    ResilienceConfig
 }
 
 type Product struct {
-	ID          int64       `xmlrpc:"id"`
-	Name        string      `xmlrpc:"name"`
-	Description interface{} `xmlrpc:"description"` // Handle potential null/string
-	ListPrice   float64     `xmlrpc:"list_price"`
-	DefaultCode interface{} `xmlrpc:"default_code"` // Handle potential null/string
-	Active      interface{} `xmlrpc:"active"`
+	ID          int64   `xmlrpc:"id"`
+	Name        string  `xmlrpc:"name"`
+	Description string  `xmlrpc:"description"`
+	ListPrice   float64 `xmlrpc:"list_price"`
+	DefaultCode string  `xmlrpc:"default_code"`
+	Active      bool    `xmlrpc:"active"`
 }
 
 type OdooProductTemplate struct {
-	ID          int64       `xmlrpc:"id"`
-	Name        string      `xmlrpc:"name"`
-	Description interface{} `xmlrpc:"description"` // Handle potential null/string
-	ListPrice   float64     `xmlrpc:"list_price"`
-	DefaultCode interface{} `xmlrpc:"default_code"` // Handle potential null/string
-	Active      interface{} `xmlrpc:"active"`       // Handle potential string/bool
+	ID          int64   `xmlrpc:"id"`
+	Name        string  `xmlrpc:"name"`
+	Description string  `xmlrpc:"description"`
+	ListPrice   float64 `xmlrpc:"list_price"`
+	DefaultCode string  `xmlrpc:"default_code"`
+	Active      bool    `xmlrpc:"active"`
+
+	Category          *Many2One `xmlrpc:"categ_id"`
+	PublicCategoryIDs []int64   `xmlrpc:"public_categ_ids"` // website_sale
 
 	Image1920 string `xmlrpc:"image_1920"`
 	Image1024 string `xmlrpc:"image_1024"`
 	Image128  string `xmlrpc:"image_128"`
 }
+
+// OdooProductVariant is a product.product, the sellable variant of a template
+type OdooProductVariant struct {
+	ID           int64    `xmlrpc:"id"`
+	Template     Many2One `xmlrpc:"product_tmpl_id"`
+	Name         string   `xmlrpc:"display_name"`
+	Price        float64  `xmlrpc:"lst_price"`
+	QtyAvailable float64  `xmlrpc:"qty_available"`
+	DefaultCode  string   `xmlrpc:"default_code"`
+	Active       bool     `xmlrpc:"active"`
+}
 type ProductList struct {
 	Items []Product
 }
 
+// ErrNotFound is returned by SearchRead and Read when no record matches
+var ErrNotFound = odoo.ErrNotFound
+
 // OdooClient defines the interface for Odoo operations
 type OdooClient interface {
-	Create(model string, data []interface{}, options *odoo.Options) ([]int64, error)
+	Create(ctx context.Context, model string, values []interface{}, options *odoo.Options) ([]int64, error)
 	NewCriteria() *odoo.Criteria
 	NewOptions() *odoo.Options
-	SearchRead(model string, criteria *odoo.Criteria, options *odoo.Options, result interface{}) error
-	Read(model string, ids []int64, options *odoo.Options, result interface{}) error
+	SearchRead(ctx context.Context, model string, criteria *odoo.Criteria, options *odoo.Options, result interface{}) error
+	Read(ctx context.Context, model string, ids []int64, options *odoo.Options, result interface{}) error
+	Search(ctx context.Context, model string, criteria *odoo.Criteria, options *odoo.Options) ([]int64, error)
+	Write(ctx context.Context, model string, ids []int64, values map[string]interface{}) error
+	Unlink(ctx context.Context, model string, ids []int64) error
+	SearchCount(ctx context.Context, model string, criteria *odoo.Criteria) (int64, error)
+	NameSearch(ctx context.Context, model, name string, criteria *odoo.Criteria, limit int) ([]Many2One, error)
+	FieldsGet(ctx context.Context, model string, fields ...string) (map[string]Field, error)
+	ExecuteKw(ctx context.Context, method, model string, args []interface{}, options *odoo.Options, result interface{}) error
+	RenderReportPDF(ctx context.Context, reportName string, ids []int64) ([]byte, error)
 }
 
 // Ensure Client implements OdooClient
@@ -72,6 +109,10 @@ func NewClient(config Config) (*Client, error) {
 	if config.RetryInterval == 0 {
 		config.RetryInterval = 5 * time.Second
 	}
+	if config.CallTimeout == 0 {
+		config.CallTimeout = 30 * time.Second
+	}
+	config.Resilience.setDefaults()
 
 	var client *Client
 	var err error
@@ -80,8 +121,9 @@ func NewClient(config Config) (*Client, error) {
 		log.Printf("Attempting to connect to Odoo (attempt %d/%d)", i+1, config.MaxRetries)
 
 		// Try to create a test connection
-		resp, err := http.Get(config.URL)
-		if err != nil {
+		resp, getErr := http.Get(config.URL)
+		if getErr != nil {
+			err = getErr
 			log.Printf("Failed to connect to Odoo: %v", err)
 			time.Sleep(config.RetryInterval)
 			continue
@@ -108,63 +150,35 @@ func NewClient(config Config) (*Client, error) {
 }
 
 func initClient(config Config) (*Client, error) {
-	// Create common client for authentication
-	commonClient, err := xmlrpc.NewClient(fmt.Sprintf("%s/xmlrpc/2/common", config.URL), &http.Transport{
-		ResponseHeaderTimeout: 60 * time.Second,
-		DisableKeepAlives:     false,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create common client: %w", err)
+	// One pooled transport for every call; deadlines come from the call context
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     90 * time.Second,
 	}
 
-	// Create object client for method calls
-	objectClient, err := xmlrpc.NewClient(fmt.Sprintf("%s/xmlrpc/2/object", config.URL), &http.Transport{
-		ResponseHeaderTimeout: 60 * time.Second,
-		DisableKeepAlives:     false,
-	})
+	httpClient := &http.Client{Transport: transport}
+	rpc, err := newTransport(config.Protocol, config.URL, httpClient)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create object client: %w", err)
-	}
-
-	baseConfig := &odoo.ClientConfig{
-		Admin:    config.Username,
-		Password: config.Password,
-		Database: config.Database,
-		URL:      config.URL,
-	}
-
-	// Initialize base odoo client first
-	baseClient, err := odoo.NewClient(baseConfig)
-	if err != nil {
-		return nil, fmt.Errorf("new odoo client creation failed: %w", err)
+		return nil, err
 	}
 
 	client := &Client{
-		Client:       baseClient, // Set the base client
-		config:       config,
-		commonClient: commonClient,
-		objectClient: objectClient,
+		config:     config,
+		transport:  transport,
+		httpClient: httpClient,
+		rpc:        rpc,
+		guards:     newGuards(config.Resilience),
 	}
 
 	// Authenticate and get user ID
-	var result int
-	err = commonClient.Call("authenticate", []interface{}{
-		config.Database,
-		config.Username,
-		config.Password,
-		map[string]interface{}{},
-	}, &result)
+	ctx, cancel := context.WithTimeout(context.Background(), config.CallTimeout)
+	defer cancel()
 
-	if err != nil {
+	if _, err := client.authenticate(ctx); err != nil {
 		return nil, fmt.Errorf("authentication failed: %w", err)
 	}
 
-	if result == 0 {
-		return nil, fmt.Errorf("authentication failed: invalid credentials")
-	}
-
-	client.uid = result
-
 	return client, nil
 }
 
@@ -173,21 +187,150 @@ func (c *Client) Close() error {
 	if c.transport != nil {
 		c.transport.CloseIdleConnections()
 	}
-	c.commonClient = nil
-	c.objectClient = nil
-	c.transport = nil
 	return nil
 }
 
-func (c *Client) SearchRead(model string, criteria *odoo.Criteria, options *odoo.Options, result interface{}) error {
-	return c.Client.SearchRead(model, criteria, options, result)
+// SearchRead returns the records matching criteria, decoded into result
+// (a pointer to a slice of record structs). ErrNotFound means no match.
+func (c *Client) SearchRead(ctx context.Context, model string, criteria *odoo.Criteria, options *odoo.Options, result interface{}) error {
+	var records []interface{}
+	if err := c.execute(ctx, model, "search_read", []interface{}{domain(criteria)}, kwargs(options), &records); err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return ErrNotFound
+	}
+	return decode(records, result)
+}
+
+// Read returns the records with the given IDs. ErrNotFound means none exist.
+func (c *Client) Read(ctx context.Context, model string, ids []int64, options *odoo.Options, result interface{}) error {
+	var records []interface{}
+	if err := c.execute(ctx, model, "read", []interface{}{ids}, kwargs(options), &records); err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return ErrNotFound
+	}
+	return decode(records, result)
 }
 
-func (c *Client) Read(model string, data []int64, options *odoo.Options, result interface{}) error {
-	return c.Client.Read(model, data, options, result)
+// Search returns the IDs of the records matching criteria
+func (c *Client) Search(ctx context.Context, model string, criteria *odoo.Criteria, options *odoo.Options) ([]int64, error) {
+	var ids []int64
+	if err := c.execute(ctx, model, "search", []interface{}{domain(criteria)}, kwargs(options), &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// SearchCount returns the number of records matching criteria
+func (c *Client) SearchCount(ctx context.Context, model string, criteria *odoo.Criteria) (int64, error) {
+	var count int64
+	if err := c.execute(ctx, model, "search_count", []interface{}{domain(criteria)}, nil, &count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Create creates one record per element of values and returns their IDs
+func (c *Client) Create(ctx context.Context, model string, values []interface{}, options *odoo.Options) ([]int64, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	var result interface{}
+	if err := c.execute(ctx, model, "create", []interface{}{values}, kwargs(options), &result); err != nil {
+		return nil, err
+	}
+
+	// Odoo returns a list for batch creates and a bare ID for a single record
+	if id, ok := result.(int64); ok {
+		return []int64{id}, nil
+	}
+	var ids []int64
+	if err := decode(result, &ids); err != nil {
+		return nil, fmt.Errorf("%s.create: %w", model, err)
+	}
+	return ids, nil
+}
+
+// Write updates the given records with values
+func (c *Client) Write(ctx context.Context, model string, ids []int64, values map[string]interface{}) error {
+	return c.execute(ctx, model, "write", []interface{}{ids, values}, nil, nil)
+}
+
+// Unlink deletes the given records
+func (c *Client) Unlink(ctx context.Context, model string, ids []int64) error {
+	return c.execute(ctx, model, "unlink", []interface{}{ids}, nil, nil)
+}
+
+// NameSearch returns up to limit records whose display name matches name
+func (c *Client) NameSearch(ctx context.Context, model, name string, criteria *odoo.Criteria, limit int) ([]Many2One, error) {
+	params := map[string]interface{}{
+		"name": name,
+		"args": domain(criteria),
+	}
+	if limit > 0 {
+		params["limit"] = limit
+	}
+
+	var results []Many2One
+	if err := c.execute(ctx, model, "name_search", nil, params, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Field describes a model field as returned by fields_get
+type Field struct {
+	Type      string     `xmlrpc:"type"`
+	String    string     `xmlrpc:"string"`
+	Help      string     `xmlrpc:"help"`
+	Required  bool       `xmlrpc:"required"`
+	Readonly  bool       `xmlrpc:"readonly"`
+	Relation  string     `xmlrpc:"relation"`
+	Selection [][]string `xmlrpc:"selection"`
+}
+
+// FieldsGet describes the fields of a model, keyed by field name
+func (c *Client) FieldsGet(ctx context.Context, model string, fields ...string) (map[string]Field, error) {
+	params := map[string]interface{}{
+		"attributes": []string{"type", "string", "help", "required", "readonly", "relation", "selection"},
+	}
+	if len(fields) > 0 {
+		params["allfields"] = fields
+	}
+
+	var result map[string]Field
+	if err := c.execute(ctx, model, "fields_get", nil, params, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ExecuteKw calls any public model method. The decoded return value is stored
+// in result, which may be nil when it is not needed.
+func (c *Client) ExecuteKw(ctx context.Context, method, model string, args []interface{}, options *odoo.Options, result interface{}) error {
+	return c.execute(ctx, model, method, args, kwargs(options), result)
+}
+
+// domain turns criteria into an Odoo search domain; nil matches every record
+func domain(criteria *odoo.Criteria) []interface{} {
+	if criteria == nil {
+		return []interface{}{}
+	}
+	return []interface{}(*criteria)
+}
+
+func kwargs(options *odoo.Options) map[string]interface{} {
+	if options == nil {
+		return nil
+	}
+	return map[string]interface{}(*options)
 }
 
-func (c Client) NewCriteria() *odoo.Criteria {
+func (c *Client) NewCriteria() *odoo.Criteria {
 	return odoo.NewCriteria()
 }
 
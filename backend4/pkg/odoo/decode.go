@@ -0,0 +1,226 @@
+package odoo
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Odoo serialises dates and datetimes as strings, datetimes in UTC
+const (
+	dateTimeLayout = "2006-01-02 15:04:05"
+	dateLayout     = "2006-01-02"
+)
+
+// FormatDateTime renders t the way Odoo expects datetimes in domains and values
+func FormatDateTime(t time.Time) string {
+	return t.UTC().Format(dateTimeLayout)
+}
+
+// Many2One is the (id, display name) pair Odoo returns for many2one fields
+// and name_search results.
+type Many2One struct {
+	ID   int64
+	Name string
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	many2OneType = reflect.TypeOf(Many2One{})
+)
+
+// decode copies a generic XML-RPC value into dst, which must be a non-nil pointer.
+// Structs are matched on their xmlrpc tags. Odoo's false for empty fields
+// becomes the zero value, so records need no interface{} fields.
+func decode(src interface{}, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("odoo: decode target must be a non-nil pointer, got %T", dst)
+	}
+	return decodeValue(src, v.Elem(), "")
+}
+
+func decodeValue(src interface{}, dst reflect.Value, path string) error {
+	if dst.Kind() == reflect.Interface && dst.NumMethod() == 0 {
+		if src != nil {
+			dst.Set(reflect.ValueOf(src))
+		} else {
+			dst.Set(reflect.Zero(dst.Type()))
+		}
+		return nil
+	}
+
+	// Odoo sends false for every empty field that is not a boolean
+	if b, ok := src.(bool); src == nil || (ok && !b && dst.Kind() != reflect.Bool) {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	if dst.Kind() == reflect.Ptr {
+		elem := reflect.New(dst.Type().Elem())
+		if err := decodeValue(src, elem.Elem(), path); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+	}
+
+	switch dst.Type() {
+	case timeType:
+		return decodeTime(src, dst, path)
+	case many2OneType:
+		return decodeMany2One(src, dst, path)
+	}
+
+	switch dst.Kind() {
+	case reflect.Bool:
+		if b, ok := src.(bool); ok {
+			dst.SetBool(b)
+			return nil
+		}
+	case reflect.String:
+		switch s := src.(type) {
+		case string:
+			dst.SetString(s)
+			return nil
+		case int64:
+			dst.SetString(strconv.FormatInt(s, 10))
+			return nil
+		case float64:
+			dst.SetString(strconv.FormatFloat(s, 'f', -1, 64))
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := toFloat(src); ok && n == float64(int64(n)) {
+			dst.SetInt(int64(n))
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, ok := toFloat(src); ok && n >= 0 && n == float64(uint64(n)) {
+			dst.SetUint(uint64(n))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, ok := toFloat(src); ok {
+			dst.SetFloat(n)
+			return nil
+		}
+	case reflect.Slice:
+		if items, ok := src.([]interface{}); ok {
+			slice := reflect.MakeSlice(dst.Type(), len(items), len(items))
+			for i, item := range items {
+				if err := decodeValue(item, slice.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+			dst.Set(slice)
+			return nil
+		}
+	case reflect.Map:
+		if fields, ok := src.(map[string]interface{}); ok && dst.Type().Key().Kind() == reflect.String {
+			m := reflect.MakeMapWithSize(dst.Type(), len(fields))
+			for key, value := range fields {
+				elem := reflect.New(dst.Type().Elem()).Elem()
+				if err := decodeValue(value, elem, joinPath(path, key)); err != nil {
+					return err
+				}
+				m.SetMapIndex(reflect.ValueOf(key).Convert(dst.Type().Key()), elem)
+			}
+			dst.Set(m)
+			return nil
+		}
+	case reflect.Struct:
+		if fields, ok := src.(map[string]interface{}); ok {
+			return decodeStruct(fields, dst, path)
+		}
+	}
+
+	return fmt.Errorf("odoo: cannot decode %T into %s at %q", src, dst.Type(), path)
+}
+
+func decodeStruct(fields map[string]interface{}, dst reflect.Value, path string) error {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("xmlrpc"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		value, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if err := decodeValue(value, dst.Field(i), joinPath(path, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeTime(src interface{}, dst reflect.Value, path string) error {
+	switch v := src.(type) {
+	case time.Time:
+		dst.Set(reflect.ValueOf(v))
+		return nil
+	case string:
+		for _, layout := range []string{dateTimeLayout, dateLayout, time.RFC3339} {
+			if t, err := time.ParseInLocation(layout, v, time.UTC); err == nil {
+				dst.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return fmt.Errorf("odoo: invalid date %q at %q", v, path)
+	}
+	return fmt.Errorf("odoo: cannot decode %T into time at %q", src, path)
+}
+
+// decodeMany2One accepts [id, name] pairs as well as bare IDs
+func decodeMany2One(src interface{}, dst reflect.Value, path string) error {
+	var m2o Many2One
+	switch v := src.(type) {
+	case []interface{}:
+		if len(v) != 2 {
+			return fmt.Errorf("odoo: many2one at %q has %d elements", path, len(v))
+		}
+		id, ok := toFloat(v[0])
+		if !ok {
+			return fmt.Errorf("odoo: many2one at %q has no id", path)
+		}
+		m2o.ID = int64(id)
+		m2o.Name, _ = v[1].(string)
+	default:
+		id, ok := toFloat(src)
+		if !ok {
+			return fmt.Errorf("odoo: cannot decode %T into many2one at %q", src, path)
+		}
+		m2o.ID = int64(id)
+	}
+	dst.Set(reflect.ValueOf(m2o))
+	return nil
+}
+
+func toFloat(src interface{}) (float64, bool) {
+	switch n := src.(type) {
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,58 @@
+package odoo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeRecords(t *testing.T) {
+	raw := []interface{}{
+		map[string]interface{}{
+			"id":                   int64(7),
+			"name":                 "WH/OUT/00007",
+			"state":                "done",
+			"sale_id":              []interface{}{int64(42), "S00042"},
+			"carrier_id":           false,
+			"carrier_tracking_ref": false,
+			"date_done":            "2024-03-05 14:30:00",
+		},
+	}
+
+	var pickings []OdooPicking
+	require.NoError(t, decode(raw, &pickings))
+	require.Len(t, pickings, 1)
+
+	picking := pickings[0]
+	assert.Equal(t, int64(7), picking.ID)
+	assert.Equal(t, &Many2One{ID: 42, Name: "S00042"}, picking.SaleID)
+	assert.Nil(t, picking.CarrierID)
+	assert.Empty(t, picking.CarrierTrackingRef)
+	require.NotNil(t, picking.DateDone)
+	assert.Equal(t, time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC), *picking.DateDone)
+}
+
+func TestDecodeFalseAndBooleans(t *testing.T) {
+	var product OdooProductTemplate
+	err := decode(map[string]interface{}{
+		"description":  false,
+		"default_code": "SKU-1",
+		"active":       false,
+		"list_price":   int64(12),
+	}, &product)
+	require.NoError(t, err)
+
+	assert.Empty(t, product.Description)
+	assert.Equal(t, "SKU-1", product.DefaultCode)
+	assert.False(t, product.Active)
+	assert.Equal(t, 12.0, product.ListPrice)
+}
+
+func TestDecodeTypeMismatch(t *testing.T) {
+	var order OdooSaleOrder
+	err := decode(map[string]interface{}{"amount_total": "not a number"}, &order)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "amount_total")
+}
@@ -0,0 +1,178 @@
+package odoo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/skilld-labs/go-odoo"
+)
+
+// LoaderConfig tunes how long a Loader collects IDs before reading them
+type LoaderConfig struct {
+	Wait     time.Duration // Window in which requested IDs are gathered into one read
+	MaxBatch int           // IDs per read; a full batch is sent without waiting
+}
+
+func (c *LoaderConfig) setDefaults() {
+	if c.Wait == 0 {
+		c.Wait = 5 * time.Millisecond
+	}
+	if c.MaxBatch == 0 {
+		c.MaxBatch = 100
+	}
+}
+
+// Loader reads records of one model with one fixed field set. Concurrent
+// loads of the same ID share a single fetch, and the IDs requested within
+// a short window go to Odoo as one read call, so a popular record costs one
+// round trip per window rather than one per request. Use a separate Loader
+// per field set so binary fields like images are only read where needed.
+type Loader struct {
+	client OdooClient
+	model  string
+	fields []string
+	config LoaderConfig
+
+	mu      sync.Mutex
+	pending *loaderBatch
+}
+
+// loaderBatch is one read call in the making
+type loaderBatch struct {
+	ids     []int64
+	waiting map[int64]bool
+	done    chan struct{}
+	records map[int64]interface{}
+	err     error
+}
+
+func NewLoader(client OdooClient, model string, fields []string, config LoaderConfig) *Loader {
+	config.setDefaults()
+	if len(fields) > 0 && !containsField(fields, "id") {
+		fields = append([]string{"id"}, fields...)
+	}
+	return &Loader{client: client, model: model, fields: fields, config: config}
+}
+
+// Load reads the record with the given ID into dst, a pointer to a record
+// struct. It returns ErrNotFound when the record does not exist.
+func (l *Loader) Load(ctx context.Context, id int64, dst interface{}) error {
+	batch := l.enqueue(id)
+
+	select {
+	case <-batch.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if batch.err != nil {
+		return batch.err
+	}
+	record, ok := batch.records[id]
+	if !ok {
+		return fmt.Errorf("%s %d: %w", l.model, id, ErrNotFound)
+	}
+	return decode(record, dst)
+}
+
+// LoadMany reads several records into dst, a pointer to a slice of record
+// structs, in the order Odoo returns them. Missing IDs are skipped.
+func (l *Loader) LoadMany(ctx context.Context, ids []int64, dst interface{}) error {
+	batches := make([]*loaderBatch, len(ids))
+	for i, id := range ids {
+		batches[i] = l.enqueue(id)
+	}
+
+	records := make([]interface{}, 0, len(ids))
+	for i, batch := range batches {
+		select {
+		case <-batch.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if batch.err != nil {
+			return batch.err
+		}
+		if record, ok := batch.records[ids[i]]; ok {
+			records = append(records, record)
+		}
+	}
+	return decode(records, dst)
+}
+
+// enqueue adds id to the open batch, starting a new one when needed
+func (l *Loader) enqueue(id int64) *loaderBatch {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.pending == nil {
+		l.pending = &loaderBatch{waiting: make(map[int64]bool), done: make(chan struct{})}
+		batch := l.pending
+		time.AfterFunc(l.config.Wait, func() { l.dispatch(batch) })
+	}
+
+	batch := l.pending
+	if !batch.waiting[id] {
+		batch.waiting[id] = true
+		batch.ids = append(batch.ids, id)
+	}
+	if len(batch.ids) >= l.config.MaxBatch {
+		l.pending = nil
+		go l.fetch(batch)
+	}
+	return batch
+}
+
+// dispatch reads the batch when its window closes, unless it filled up and
+// was sent already
+func (l *Loader) dispatch(batch *loaderBatch) {
+	l.mu.Lock()
+	if l.pending != batch {
+		l.mu.Unlock()
+		return
+	}
+	l.pending = nil
+	l.mu.Unlock()
+
+	l.fetch(batch)
+}
+
+// fetch reads every ID of a batch that no longer accepts new IDs
+func (l *Loader) fetch(batch *loaderBatch) {
+	// The read serves every waiting caller, so no single caller may cancel it.
+	// The client's call timeout bounds it instead.
+	var records []interface{}
+	err := l.client.Read(context.Background(), l.model, batch.ids, l.options(), &records)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		batch.err = err
+	} else {
+		batch.records = make(map[int64]interface{}, len(records))
+		for _, record := range records {
+			fields, _ := record.(map[string]interface{})
+			if id, ok := toFloat(fields["id"]); ok {
+				batch.records[int64(id)] = record
+			}
+		}
+	}
+	close(batch.done)
+}
+
+func (l *Loader) options() *odoo.Options {
+	options := l.client.NewOptions()
+	if len(l.fields) > 0 {
+		options = options.FetchFields(l.fields...)
+	}
+	return options
+}
+
+func containsField(fields []string, name string) bool {
+	for _, field := range fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
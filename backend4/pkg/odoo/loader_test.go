@@ -0,0 +1,111 @@
+package odoo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readRecorder answers read calls with one record per existing ID and keeps
+// the ID lists and field lists it was asked for.
+type readRecorder struct {
+	mu     sync.Mutex
+	reads  [][]int64
+	fields [][]string
+}
+
+func (o *readRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ID     int64 `json:"id"`
+		Params struct {
+			Args []json.RawMessage `json:"args"`
+		} `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ids [][]int64
+	var kwargs struct {
+		Fields []string `json:"fields"`
+	}
+	json.Unmarshal(request.Params.Args[5], &ids)
+	if len(request.Params.Args) > 6 {
+		json.Unmarshal(request.Params.Args[6], &kwargs)
+	}
+
+	o.mu.Lock()
+	o.reads = append(o.reads, ids[0])
+	o.fields = append(o.fields, kwargs.Fields)
+	o.mu.Unlock()
+
+	records := []interface{}{}
+	for _, id := range ids[0] {
+		if id < 100 {
+			records = append(records, map[string]interface{}{"id": id, "display_name": "Variant", "lst_price": 10.5, "product_tmpl_id": []interface{}{7, "Shirt"}})
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": request.ID, "result": records})
+}
+
+func TestLoaderBatchesAndCoalescesConcurrentLoads(t *testing.T) {
+	odoo := &readRecorder{}
+	server := httptest.NewServer(odoo)
+	defer server.Close()
+
+	client := newTestClient(t, ProtocolJSONRPC, server.URL)
+	loader := NewLoader(client, "product.product", []string{"display_name", "lst_price"}, LoaderConfig{Wait: 20 * time.Millisecond})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			var variant OdooProductVariant
+			require.NoError(t, loader.Load(context.Background(), id, &variant))
+			assert.Equal(t, id, variant.ID)
+			assert.Equal(t, Many2One{ID: 7, Name: "Shirt"}, variant.Template)
+		}(int64(i%3 + 1))
+	}
+	wg.Wait()
+
+	require.Len(t, odoo.reads, 1, "thirty loads of three records take one read")
+	assert.ElementsMatch(t, []int64{1, 2, 3}, odoo.reads[0])
+	assert.Equal(t, []string{"id", "display_name", "lst_price"}, odoo.fields[0])
+}
+
+func TestLoaderSplitsFullBatches(t *testing.T) {
+	odoo := &readRecorder{}
+	server := httptest.NewServer(odoo)
+	defer server.Close()
+
+	client := newTestClient(t, ProtocolJSONRPC, server.URL)
+	loader := NewLoader(client, "product.product", nil, LoaderConfig{Wait: time.Second, MaxBatch: 2})
+
+	var variants []OdooProductVariant
+	start := time.Now()
+	require.NoError(t, loader.LoadMany(context.Background(), []int64{1, 2, 3, 4}, &variants))
+	assert.Len(t, variants, 4)
+	assert.Less(t, time.Since(start), time.Second, "full batches are sent without waiting")
+	assert.Len(t, odoo.reads, 2)
+}
+
+func TestLoaderReportsMissingRecords(t *testing.T) {
+	server := httptest.NewServer(&readRecorder{})
+	defer server.Close()
+
+	client := newTestClient(t, ProtocolJSONRPC, server.URL)
+	loader := NewLoader(client, "product.product", nil, LoaderConfig{})
+
+	var variant OdooProductVariant
+	err := loader.Load(context.Background(), 404, &variant)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,39 @@
+package odoo
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	breakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "odoo_circuit_breaker_state",
+		Help: "Circuit breaker state per operation class: 0 closed, 1 open, 2 half-open.",
+	}, []string{"class"})
+
+	breakerTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "odoo_circuit_breaker_transitions_total",
+		Help: "Circuit breaker state changes per operation class and new state.",
+	}, []string{"class", "state"})
+
+	callsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "odoo_calls_total",
+		Help: "Odoo calls per operation class and outcome.",
+	}, []string{"class", "outcome"})
+
+	retriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "odoo_call_retries_total",
+		Help: "Retried Odoo read calls per operation class.",
+	}, []string{"class"})
+
+	inFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "odoo_calls_in_flight",
+		Help: "Odoo calls currently holding a bulkhead slot.",
+	}, []string{"class"})
+
+	callDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "odoo_call_duration_seconds",
+		Help:    "Duration of Odoo calls per operation class.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"class"})
+)
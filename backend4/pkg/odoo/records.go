@@ -0,0 +1,180 @@
+package odoo
+
+import (
+	"time"
+)
+
+// OdooPicking is an Odoo stock.picking (transfer).
+// Carrier fields come from the delivery module.
+type OdooPicking struct {
+	ID                 int64      `xmlrpc:"id"`
+	Name               string     `xmlrpc:"name"`
+	State              string     `xmlrpc:"state"`
+	SaleID             *Many2One  `xmlrpc:"sale_id"`
+	CarrierID          *Many2One  `xmlrpc:"carrier_id"`
+	CarrierTrackingRef string     `xmlrpc:"carrier_tracking_ref"`
+	CarrierTrackingURL string     `xmlrpc:"carrier_tracking_url"`
+	DateDone           *time.Time `xmlrpc:"date_done"`
+}
+
+// OdooSaleOrder is an Odoo sale.order
+type OdooSaleOrder struct {
+	ID          int64    `xmlrpc:"id"`
+	Name        string   `xmlrpc:"name"`
+	State       string   `xmlrpc:"state"`
+	Partner     Many2One `xmlrpc:"partner_id"`
+	AmountTotal float64  `xmlrpc:"amount_total"`
+	InvoiceIDs  []int64  `xmlrpc:"invoice_ids"`
+}
+
+// OdooInvoice is an Odoo account.move of type invoice or credit note
+type OdooInvoice struct {
+	ID           int64      `xmlrpc:"id"`
+	Name         string     `xmlrpc:"name"`
+	State        string     `xmlrpc:"state"`         // draft, posted, cancel
+	MoveType     string     `xmlrpc:"move_type"`     // out_invoice, out_refund, ...
+	PaymentState string     `xmlrpc:"payment_state"` // not_paid, partial, paid, ...
+	AmountTotal  float64    `xmlrpc:"amount_total"`
+	InvoiceDate  *time.Time `xmlrpc:"invoice_date"`
+}
+
+// OdooProductImage is an extra product image from website_sale's product.image,
+// attached to a template or to a single variant
+type OdooProductImage struct {
+	ID        int64     `xmlrpc:"id"`
+	Name      string    `xmlrpc:"name"`
+	Sequence  int       `xmlrpc:"sequence"`
+	Template  *Many2One `xmlrpc:"product_tmpl_id"`
+	Variant   *Many2One `xmlrpc:"product_variant_id"`
+	WriteDate time.Time `xmlrpc:"write_date"`
+}
+
+// OdooCategory is a product.category or, with website_sale, a
+// product.public.category. Only public categories have a sequence.
+type OdooCategory struct {
+	ID         int64     `xmlrpc:"id"`
+	Name       string    `xmlrpc:"name"`
+	Parent     *Many2One `xmlrpc:"parent_id"`
+	ParentPath string    `xmlrpc:"parent_path"`
+	Sequence   int       `xmlrpc:"sequence"`
+	WriteDate  time.Time `xmlrpc:"write_date"`
+}
+
+// OdooWarehouse is an Odoo stock.warehouse
+type OdooWarehouse struct {
+	ID            int64     `xmlrpc:"id"`
+	Name          string    `xmlrpc:"name"`
+	Code          string    `xmlrpc:"code"`
+	Sequence      int       `xmlrpc:"sequence"`
+	StockLocation *Many2One `xmlrpc:"lot_stock_id"`
+	DeliveryRoute *Many2One `xmlrpc:"delivery_route_id"`
+}
+
+// OdooStockRule is a step of an Odoo stock.route. Delay is in days.
+type OdooStockRule struct {
+	ID            int64     `xmlrpc:"id"`
+	Route         *Many2One `xmlrpc:"route_id"`
+	Delay         int       `xmlrpc:"delay"`
+	Action        string    `xmlrpc:"action"`         // pull, push, buy, manufacture...
+	ProcureMethod string    `xmlrpc:"procure_method"` // make_to_stock, make_to_order, mts_else_mto
+}
+
+// OdooQuant is an Odoo stock.quant, the quantity of a product at a location
+// for one lot, package and owner
+type OdooQuant struct {
+	ID               int64     `xmlrpc:"id"`
+	Product          Many2One  `xmlrpc:"product_id"`
+	Template         Many2One  `xmlrpc:"product_tmpl_id"`
+	Location         Many2One  `xmlrpc:"location_id"`
+	Warehouse        *Many2One `xmlrpc:"warehouse_id"`
+	Quantity         float64   `xmlrpc:"quantity"`
+	ReservedQuantity float64   `xmlrpc:"reserved_quantity"`
+}
+
+// OdooOrderpoint is an Odoo stock.warehouse.orderpoint, a reordering rule
+// that replenishes a product once it falls below product_min_qty
+type OdooOrderpoint struct {
+	ID        int64     `xmlrpc:"id"`
+	Product   Many2One  `xmlrpc:"product_id"`
+	Warehouse *Many2One `xmlrpc:"warehouse_id"`
+	MinQty    float64   `xmlrpc:"product_min_qty"`
+}
+
+// OdooMadeToOrderVariant is an Odoo product.product with what decides whether
+// it is made or bought for each order. ProduceDelay is in days.
+type OdooMadeToOrderVariant struct {
+	ID           int64    `xmlrpc:"id"`
+	Template     Many2One `xmlrpc:"product_tmpl_id"`
+	RouteIDs     []int64  `xmlrpc:"route_ids"`
+	ProduceDelay float64  `xmlrpc:"produce_delay"`
+}
+
+// OdooBom is an Odoo mrp.bom. Variant is set for a bill of materials of one
+// variant; without it the bill covers every variant of the template.
+type OdooBom struct {
+	ID       int64     `xmlrpc:"id"`
+	Template Many2One  `xmlrpc:"product_tmpl_id"`
+	Variant  *Many2One `xmlrpc:"product_id"`
+	Quantity float64   `xmlrpc:"product_qty"`
+	Type     string    `xmlrpc:"type"` // normal, or phantom for kits
+	Sequence int       `xmlrpc:"sequence"`
+}
+
+// OdooBomLine is a component of an Odoo mrp.bom
+type OdooBomLine struct {
+	ID       int64    `xmlrpc:"id"`
+	Bom      Many2One `xmlrpc:"bom_id"`
+	Product  Many2One `xmlrpc:"product_id"`
+	Quantity float64  `xmlrpc:"product_qty"`
+}
+
+// OdooSupplierInfo is an Odoo product.supplierinfo, a vendor's price and
+// delivery lead time in days for a product
+type OdooSupplierInfo struct {
+	ID       int64     `xmlrpc:"id"`
+	Template *Many2One `xmlrpc:"product_tmpl_id"`
+	Variant  *Many2One `xmlrpc:"product_id"`
+	Delay    int       `xmlrpc:"delay"`
+}
+
+// OdooProduction is an Odoo mrp.production, a manufacturing order
+type OdooProduction struct {
+	ID                  int64      `xmlrpc:"id"`
+	Name                string     `xmlrpc:"name"`
+	State               string     `xmlrpc:"state"` // draft, confirmed, progress, to_close, done, cancel
+	Product             Many2One   `xmlrpc:"product_id"`
+	Quantity            float64    `xmlrpc:"product_qty"`
+	QtyProducing        float64    `xmlrpc:"qty_producing"`
+	DatePlannedFinished *time.Time `xmlrpc:"date_planned_finished"`
+	ComponentsState     string     `xmlrpc:"components_availability_state"` // available, expected, late
+}
+
+// OdooSaleProductions is the manufacturing orders of an Odoo sale.order
+type OdooSaleProductions struct {
+	ID            int64   `xmlrpc:"id"`
+	ProductionIDs []int64 `xmlrpc:"mrp_production_ids"`
+}
+
+// OdooStockMove is an Odoo stock.move, a quantity of a product moved by a
+// picking
+type OdooStockMove struct {
+	ID           int64     `xmlrpc:"id"`
+	Picking      *Many2One `xmlrpc:"picking_id"`
+	Product      Many2One  `xmlrpc:"product_id"`
+	QuantityDone float64   `xmlrpc:"quantity_done"` // Before Odoo 17
+	Quantity     float64   `xmlrpc:"quantity"`      // Odoo 17 on
+}
+
+// Moved returns the quantity a move moved, whichever field it was read from
+func (m OdooStockMove) Moved() float64 {
+	return m.QuantityDone + m.Quantity
+}
+
+// OdooVariantName is the name and internal reference of an Odoo
+// product.product
+type OdooVariantName struct {
+	ID          int64    `xmlrpc:"id"`
+	DisplayName string   `xmlrpc:"display_name"`
+	DefaultCode string   `xmlrpc:"default_code"`
+	Template    Many2One `xmlrpc:"product_tmpl_id"`
+}
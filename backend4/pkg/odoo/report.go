@@ -0,0 +1,135 @@
+package odoo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"time"
+)
+
+// RenderReportPDF renders a QWeb report such as account.report_invoice as PDF.
+// Odoo removed the XML-RPC report service in version 14, so this goes through
+// the web controllers with a session cookie, logging in again when it expires.
+// Rendering is slow and CPU heavy on the Odoo side, so reports have their own
+// breaker and a small bulkhead.
+func (c *Client) RenderReportPDF(ctx context.Context, reportName string, ids []int64) ([]byte, error) {
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no records to render")
+	}
+
+	var pdf []byte
+	err := c.protect(ctx, OpReport, func(ctx context.Context) error {
+		var err error
+		pdf, err = c.renderReportPDF(ctx, reportName, ids)
+		return err
+	})
+	return pdf, err
+}
+
+func (c *Client) renderReportPDF(ctx context.Context, reportName string, ids []int64) ([]byte, error) {
+	idList := make([]string, len(ids))
+	for i, id := range ids {
+		idList[i] = fmt.Sprint(id)
+	}
+	url := fmt.Sprintf("%s/report/pdf/%s/%s", c.config.URL, reportName, strings.Join(idList, ","))
+
+	for attempt := 0; attempt < 2; attempt++ {
+		web, err := c.webSession(ctx, attempt > 0)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := web.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to request report: %w", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read report: %w", err)
+		}
+
+		// An expired session is redirected to the login page instead of failing
+		if resp.StatusCode == http.StatusOK && strings.HasPrefix(resp.Header.Get("Content-Type"), "application/pdf") {
+			return body, nil
+		}
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusForbidden {
+			return nil, fmt.Errorf("report %s: %w", reportName, &statusError{code: resp.StatusCode})
+		}
+	}
+
+	return nil, fmt.Errorf("report %s: odoo session was rejected", reportName)
+}
+
+// webSession returns an HTTP client holding an authenticated Odoo web session
+func (c *Client) webSession(ctx context.Context, renew bool) (*http.Client, error) {
+	c.webMu.Lock()
+	defer c.webMu.Unlock()
+
+	if c.webClient != nil && !renew {
+		return c.webClient, nil
+	}
+	if c.config.Password == "" {
+		// Odoo only accepts API keys for RPC, not for web logins
+		return nil, fmt.Errorf("rendering reports requires the odoo password, an api key is not enough")
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	web := &http.Client{Jar: jar, Transport: c.transport, Timeout: 60 * time.Second}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"params": map[string]interface{}{
+			"db":       c.config.Database,
+			"login":    c.config.Username,
+			"password": c.config.Password,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.URL+"/web/session/authenticate", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := web.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open odoo web session: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Result *struct {
+			UID interface{} `json:"uid"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode odoo web session: %w", err)
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("odoo web login failed: %s", result.Error.Message)
+	}
+	if result.Result == nil || result.Result.UID == nil || result.Result.UID == false {
+		return nil, fmt.Errorf("odoo web login failed: invalid credentials")
+	}
+
+	c.webClient = web
+	return web, nil
+}
@@ -0,0 +1,321 @@
+package odoo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// Operation classes. Each class has its own circuit breaker and concurrency
+// limit, so a burst of catalog reads cannot starve order writes of Odoo workers.
+const (
+	OpRead   = "read"
+	OpWrite  = "write"
+	OpReport = "report"
+)
+
+var (
+	// ErrCircuitOpen is returned without calling Odoo while its breaker is open
+	ErrCircuitOpen = errors.New("odoo circuit breaker is open")
+	// ErrBulkheadFull is returned when no call slot freed up in time
+	ErrBulkheadFull = errors.New("too many concurrent odoo calls")
+)
+
+// readMethods are side-effect free and therefore safe to retry
+var readMethods = map[string]bool{
+	"search_read":  true,
+	"read":         true,
+	"search":       true,
+	"search_count": true,
+	"name_search":  true,
+	"fields_get":   true,
+	"read_group":   true,
+}
+
+// ResilienceConfig tunes breakers, bulkheads and retries. Zero values use defaults.
+type ResilienceConfig struct {
+	MaxConcurrentReads   int
+	MaxConcurrentWrites  int
+	MaxConcurrentReports int
+	BulkheadWait         time.Duration // How long a call may queue for a slot
+	ReadRetries          int           // Extra attempts for reads after a transient failure, negative disables
+	RetryBaseDelay       time.Duration // Backoff before the first retry, doubled per attempt
+	BreakerFailures      int           // Consecutive failures that open a breaker
+	BreakerOpenFor       time.Duration // How long an open breaker rejects calls before probing
+}
+
+func (c *ResilienceConfig) setDefaults() {
+	if c.MaxConcurrentReads == 0 {
+		c.MaxConcurrentReads = 8
+	}
+	if c.MaxConcurrentWrites == 0 {
+		c.MaxConcurrentWrites = 4
+	}
+	if c.MaxConcurrentReports == 0 {
+		c.MaxConcurrentReports = 2
+	}
+	if c.BulkheadWait == 0 {
+		c.BulkheadWait = 2 * time.Second
+	}
+	if c.ReadRetries == 0 {
+		c.ReadRetries = 2
+	}
+	if c.RetryBaseDelay == 0 {
+		c.RetryBaseDelay = 100 * time.Millisecond
+	}
+	if c.BreakerFailures == 0 {
+		c.BreakerFailures = 5
+	}
+	if c.BreakerOpenFor == 0 {
+		c.BreakerOpenFor = 30 * time.Second
+	}
+}
+
+// operationClass maps a model method to its operation class
+func operationClass(method string) string {
+	if readMethods[method] {
+		return OpRead
+	}
+	return OpWrite
+}
+
+// IsUnavailable reports whether err means Odoo could not be reached or is
+// being shielded, so callers should fall back to cached or mirrored data.
+// Faults raised by Odoo itself, such as validation errors, are not included.
+func IsUnavailable(err error) bool {
+	return errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrBulkheadFull) || isTransient(err)
+}
+
+// isTransient reports whether a failed call may succeed when repeated
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var fault *Error
+	if errors.As(err, &fault) {
+		return false
+	}
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.code >= 500 || status.code == 429
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr)
+}
+
+// statusError is a non-200 HTTP response from Odoo
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("odoo request failed with status %d", e.code)
+}
+
+// Breaker states, also the values of the odoo_circuit_breaker_state gauge
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// breaker opens after a run of consecutive failures, rejects calls while
+// open and then lets a single probe through to decide whether to close again.
+type breaker struct {
+	class     string
+	threshold int
+	openFor   time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(class string, threshold int, openFor time.Duration) *breaker {
+	b := &breaker{class: class, threshold: threshold, openFor: openFor}
+	breakerState.WithLabelValues(class).Set(float64(BreakerClosed))
+	return b
+}
+
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.openFor {
+			return ErrCircuitOpen
+		}
+		b.transition(BreakerHalfOpen)
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record feeds the outcome of an allowed call back into the breaker.
+// Only infrastructure failures count; Odoo faults mean Odoo is up. Calls the
+// caller cancelled say nothing either way and only free the probe slot.
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if err == nil || !isTransient(err) {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.transition(BreakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.transition(BreakerOpen)
+	}
+}
+
+func (b *breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *breaker) transition(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	breakerState.WithLabelValues(b.class).Set(float64(state))
+	breakerTransitions.WithLabelValues(b.class, state.String()).Inc()
+}
+
+// guard protects one operation class with a breaker and a bulkhead
+type guard struct {
+	class    string
+	breaker  *breaker
+	bulkhead *semaphore.Weighted
+	wait     time.Duration
+}
+
+func newGuard(class string, limit int, cfg ResilienceConfig) *guard {
+	return &guard{
+		class:    class,
+		breaker:  newBreaker(class, cfg.BreakerFailures, cfg.BreakerOpenFor),
+		bulkhead: semaphore.NewWeighted(int64(limit)),
+		wait:     cfg.BulkheadWait,
+	}
+}
+
+func (g *guard) do(ctx context.Context, fn func(context.Context) error) error {
+	if err := g.breaker.allow(); err != nil {
+		callsTotal.WithLabelValues(g.class, "circuit_open").Inc()
+		return err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, g.wait)
+	err := g.bulkhead.Acquire(waitCtx, 1)
+	cancel()
+	if err != nil {
+		// Releases the half-open probe slot without judging Odoo's health
+		g.breaker.mu.Lock()
+		g.breaker.probing = false
+		g.breaker.mu.Unlock()
+		callsTotal.WithLabelValues(g.class, "bulkhead_full").Inc()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return ErrBulkheadFull
+	}
+	defer g.bulkhead.Release(1)
+
+	inFlight.WithLabelValues(g.class).Inc()
+	start := time.Now()
+	err = fn(ctx)
+	callDuration.WithLabelValues(g.class).Observe(time.Since(start).Seconds())
+	inFlight.WithLabelValues(g.class).Dec()
+
+	g.breaker.record(err)
+	if err != nil {
+		callsTotal.WithLabelValues(g.class, "error").Inc()
+	} else {
+		callsTotal.WithLabelValues(g.class, "success").Inc()
+	}
+	return err
+}
+
+// protect runs fn under the guard of its class. Reads that fail transiently
+// are retried with exponential backoff and full jitter; writes never are,
+// because Odoo may have applied them before the connection failed.
+func (c *Client) protect(ctx context.Context, class string, fn func(context.Context) error) error {
+	g := c.guards[class]
+
+	attempts := 1
+	if class == OpRead {
+		attempts += c.config.Resilience.ReadRetries
+	}
+
+	delay := c.config.Resilience.RetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := g.do(ctx, fn)
+		if err == nil || attempt >= attempts || !isTransient(err) || ctx.Err() != nil {
+			return err
+		}
+
+		retriesTotal.WithLabelValues(class).Inc()
+		sleep := time.Duration(rand.Int63n(int64(delay) + 1))
+		select {
+		case <-time.After(sleep):
+		case <-ctx.Done():
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// BreakerStates returns the breaker state of every operation class
+func (c *Client) BreakerStates() map[string]string {
+	states := make(map[string]string, len(c.guards))
+	for class, g := range c.guards {
+		states[class] = g.breaker.State().String()
+	}
+	return states
+}
+
+func newGuards(cfg ResilienceConfig) map[string]*guard {
+	return map[string]*guard{
+		OpRead:   newGuard(OpRead, cfg.MaxConcurrentReads, cfg),
+		OpWrite:  newGuard(OpWrite, cfg.MaxConcurrentWrites, cfg),
+		OpReport: newGuard(OpReport, cfg.MaxConcurrentReports, cfg),
+	}
+}
@@ -0,0 +1,145 @@
+package odoo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyOdoo answers with 502 until healthy is set, counting every request
+type flakyOdoo struct {
+	healthy  atomic.Bool
+	requests atomic.Int32
+	release  chan struct{} // When set, requests block until it is closed
+}
+
+func (o *flakyOdoo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.requests.Add(1)
+	if o.release != nil {
+		<-o.release
+	}
+	if !o.healthy.Load() {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":3}`))
+}
+
+func newResilientTestClient(t *testing.T, url string, cfg ResilienceConfig) *Client {
+	client := newTestClient(t, ProtocolJSONRPC, url)
+	cfg.setDefaults()
+	client.config.Resilience = cfg
+	client.guards = newGuards(cfg)
+	return client
+}
+
+func TestReadsAreRetriedWritesAreNot(t *testing.T) {
+	odoo := &flakyOdoo{}
+	server := httptest.NewServer(odoo)
+	defer server.Close()
+
+	client := newResilientTestClient(t, server.URL, ResilienceConfig{ReadRetries: 2, RetryBaseDelay: time.Millisecond})
+
+	_, err := client.SearchCount(context.Background(), "product.template", nil)
+	require.Error(t, err)
+	assert.True(t, IsUnavailable(err))
+	assert.Equal(t, int32(3), odoo.requests.Load(), "a read is attempted once plus two retries")
+
+	odoo.requests.Store(0)
+	err = client.Write(context.Background(), "sale.order", []int64{1}, map[string]interface{}{"note": "x"})
+	require.Error(t, err)
+	assert.Equal(t, int32(1), odoo.requests.Load(), "a write must never be repeated")
+}
+
+func TestBreakerOpensAndRecoversThroughProbe(t *testing.T) {
+	odoo := &flakyOdoo{}
+	server := httptest.NewServer(odoo)
+	defer server.Close()
+
+	client := newResilientTestClient(t, server.URL, ResilienceConfig{
+		ReadRetries:     -1,
+		BreakerFailures: 3,
+		BreakerOpenFor:  50 * time.Millisecond,
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err := client.SearchCount(ctx, "product.template", nil)
+		require.Error(t, err)
+	}
+	assert.Equal(t, "open", client.BreakerStates()[OpRead])
+	assert.Equal(t, "closed", client.BreakerStates()[OpWrite], "breakers are per operation class")
+
+	_, err := client.SearchCount(ctx, "product.template", nil)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(3), odoo.requests.Load(), "an open breaker does not call odoo")
+
+	time.Sleep(60 * time.Millisecond)
+	odoo.healthy.Store(true)
+	count, err := client.SearchCount(ctx, "product.template", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+	assert.Equal(t, "closed", client.BreakerStates()[OpRead])
+}
+
+func TestCancelledCallsDoNotCloseBreaker(t *testing.T) {
+	b := newBreaker("test-cancel", 1, time.Millisecond)
+	require.NoError(t, b.allow())
+	b.record(&statusError{code: http.StatusBadGateway})
+	assert.Equal(t, BreakerOpen, b.State())
+
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, b.allow(), "the probe is let through once the breaker has been open long enough")
+	b.record(context.Canceled)
+	assert.Equal(t, BreakerHalfOpen, b.State(), "a cancelled probe proves nothing about odoo")
+	require.NoError(t, b.allow(), "the probe slot is free again")
+}
+
+func TestOdooFaultsDoNotOpenBreaker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":200,"message":"Odoo Server Error","data":{"name":"odoo.exceptions.ValidationError","message":"invalid"}}}`))
+	}))
+	defer server.Close()
+
+	client := newResilientTestClient(t, server.URL, ResilienceConfig{BreakerFailures: 1})
+	for i := 0; i < 3; i++ {
+		_, err := client.SearchCount(context.Background(), "product.template", nil)
+		require.Error(t, err)
+		assert.False(t, IsUnavailable(err))
+	}
+	assert.Equal(t, "closed", client.BreakerStates()[OpRead])
+}
+
+func TestBulkheadRejectsWhenFull(t *testing.T) {
+	odoo := &flakyOdoo{release: make(chan struct{})}
+	odoo.healthy.Store(true)
+	server := httptest.NewServer(odoo)
+	defer server.Close()
+
+	client := newResilientTestClient(t, server.URL, ResilienceConfig{
+		MaxConcurrentReads: 1,
+		BulkheadWait:       20 * time.Millisecond,
+	})
+
+	done := make(chan error)
+	go func() {
+		_, err := client.SearchCount(context.Background(), "product.template", nil)
+		done <- err
+	}()
+	require.Eventually(t, func() bool { return odoo.requests.Load() == 1 }, time.Second, time.Millisecond)
+
+	_, err := client.SearchCount(context.Background(), "product.template", nil)
+	assert.ErrorIs(t, err, ErrBulkheadFull)
+	assert.True(t, IsUnavailable(err))
+
+	close(odoo.release)
+	require.NoError(t, <-done)
+	assert.Equal(t, "closed", client.BreakerStates()[OpRead], "a full bulkhead says nothing about odoo's health")
+}
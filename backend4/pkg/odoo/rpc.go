@@ -0,0 +1,263 @@
+package odoo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/kolo/xmlrpc"
+)
+
+// Supported wire protocols
+const (
+	ProtocolXMLRPC  = "xmlrpc"
+	ProtocolJSONRPC = "jsonrpc"
+)
+
+// Error is a fault returned by Odoo, such as an access or validation error
+type Error struct {
+	Code    int
+	Name    string // Exception class, only sent over JSON-RPC
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("odoo fault %d: %s", e.Code, e.Message)
+}
+
+// transport carries one call to an Odoo RPC service and returns the result as
+// generic values: maps, slices, strings, bool, int64 and float64. Both
+// protocols produce the same shapes, so decode works on either.
+type transport interface {
+	call(ctx context.Context, service, method string, args []interface{}) (interface{}, error)
+}
+
+func newTransport(protocol, url string, httpClient *http.Client) (transport, error) {
+	switch protocol {
+	case ProtocolXMLRPC, "":
+		return &xmlrpcTransport{url: url, httpClient: httpClient}, nil
+	case ProtocolJSONRPC:
+		return &jsonrpcTransport{url: url, httpClient: httpClient}, nil
+	default:
+		return nil, fmt.Errorf("unknown odoo protocol %q", protocol)
+	}
+}
+
+// call performs one RPC request and decodes the result into result, which may
+// be nil. The request is bound to ctx; when ctx has no deadline the client's
+// CallTimeout applies.
+func (c *Client) call(ctx context.Context, service, method string, args []interface{}, result interface{}) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.CallTimeout)
+		defer cancel()
+	}
+
+	raw, err := c.rpc.call(ctx, service, method, args)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	return decode(raw, result)
+}
+
+// execute calls a model method through execute_kw, guarded by the breaker and
+// bulkhead of the method's operation class. When Odoo no longer accepts our
+// login, for example after a restart, a password change or a re-created
+// database, it logs in again and retries the call once.
+func (c *Client) execute(ctx context.Context, model, method string, args []interface{}, kwargs map[string]interface{}, result interface{}) error {
+	if args == nil {
+		args = []interface{}{}
+	}
+
+	// Retries and queueing for a bulkhead slot share the caller's deadline
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.CallTimeout)
+		defer cancel()
+	}
+
+	err := c.protect(ctx, operationClass(method), func(ctx context.Context) error {
+		uid := c.currentUID()
+		err := c.executeAs(ctx, uid, model, method, args, kwargs, result)
+		if err != nil && isAuthFailure(err) {
+			if uid, err = c.reauthenticate(ctx, uid); err == nil {
+				err = c.executeAs(ctx, uid, model, method, args, kwargs, result)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s.%s: %w", model, method, err)
+	}
+	return nil
+}
+
+func (c *Client) executeAs(ctx context.Context, uid int64, model, method string, args []interface{}, kwargs map[string]interface{}, result interface{}) error {
+	params := []interface{}{c.config.Database, uid, c.secret(), model, method, args}
+	if len(kwargs) > 0 {
+		params = append(params, kwargs)
+	}
+	return c.call(ctx, "object", "execute_kw", params, result)
+}
+
+// post sends one request body and returns the response body
+func post(ctx context.Context, httpClient *http.Client, url, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("odoo request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{code: resp.StatusCode}
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read odoo response: %w", err)
+	}
+	return data, nil
+}
+
+// xmlrpcTransport talks to /xmlrpc/2/<service>
+type xmlrpcTransport struct {
+	url        string
+	httpClient *http.Client
+}
+
+func (t *xmlrpcTransport) call(ctx context.Context, service, method string, args []interface{}) (interface{}, error) {
+	body, err := xmlrpc.EncodeMethodCall(method, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", method, err)
+	}
+
+	data, err := post(ctx, t.httpClient, fmt.Sprintf("%s/xmlrpc/2/%s", t.url, service), "text/xml", body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := xmlrpc.Response(data)
+	if err := response.Err(); err != nil {
+		var fault xmlrpc.FaultError
+		if errors.As(err, &fault) {
+			return nil, &Error{Code: fault.Code, Message: fault.String}
+		}
+		return nil, fmt.Errorf("failed to decode odoo %s fault: %w", method, err)
+	}
+
+	var raw interface{}
+	if err := response.Unmarshal(&raw); err != nil {
+		return nil, fmt.Errorf("failed to decode odoo %s response: %w", method, err)
+	}
+	return raw, nil
+}
+
+// jsonrpcTransport talks to /jsonrpc, which takes the same services and
+// methods as XML-RPC but carries binary fields and empty values more compactly.
+type jsonrpcTransport struct {
+	url        string
+	httpClient *http.Client
+	requestID  atomic.Int64
+}
+
+type jsonrpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	Method  string        `json:"method"`
+	Params  jsonrpcParams `json:"params"`
+	ID      int64         `json:"id"`
+}
+
+type jsonrpcParams struct {
+	Service string        `json:"service"`
+	Method  string        `json:"method"`
+	Args    []interface{} `json:"args"`
+}
+
+type jsonrpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			Name    string `json:"name"`
+			Message string `json:"message"`
+		} `json:"data"`
+	} `json:"error"`
+}
+
+func (t *jsonrpcTransport) call(ctx context.Context, service, method string, args []interface{}) (interface{}, error) {
+	body, err := json.Marshal(jsonrpcRequest{
+		JSONRPC: "2.0",
+		Method:  "call",
+		Params:  jsonrpcParams{Service: service, Method: method, Args: args},
+		ID:      t.requestID.Add(1),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", method, err)
+	}
+
+	data, err := post(ctx, t.httpClient, t.url+"/jsonrpc", "application/json", body)
+	if err != nil {
+		return nil, err
+	}
+
+	var response jsonrpcResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode odoo %s response: %w", method, err)
+	}
+	if response.Error != nil {
+		message := response.Error.Data.Message
+		if message == "" {
+			message = response.Error.Message
+		}
+		return nil, &Error{Code: response.Error.Code, Name: response.Error.Data.Name, Message: message}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(response.Result))
+	decoder.UseNumber()
+	var raw interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to decode odoo %s result: %w", method, err)
+	}
+	return normalizeJSON(raw), nil
+}
+
+// normalizeJSON turns JSON numbers into int64 or float64, matching what the
+// XML-RPC decoder returns for <int> and <double> values.
+func normalizeJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeJSON(v[i])
+		}
+		return v
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeJSON(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
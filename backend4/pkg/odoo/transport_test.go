@@ -0,0 +1,166 @@
+package odoo
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kolo/xmlrpc"
+	"github.com/skilld-labs/go-odoo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOdoo answers every execute_kw call with the same records over both
+// protocols and counts the response bytes it sent.
+type fakeOdoo struct {
+	xmlResponse  []byte
+	jsonResponse []byte
+	bytesSent    atomic.Int64
+}
+
+func newFakeOdoo(t testing.TB, records []interface{}) *httptest.Server {
+	call, err := xmlrpc.EncodeMethodCall("result", records)
+	require.NoError(t, err)
+
+	// Reuse the method call encoding for the response: the params are identical
+	xmlResponse := bytes.Replace(call, []byte("<methodCall><methodName>result</methodName>"), []byte("<methodResponse>"), 1)
+	xmlResponse = bytes.Replace(xmlResponse, []byte("</methodCall>"), []byte("</methodResponse>"), 1)
+
+	jsonResponse, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": records})
+	require.NoError(t, err)
+
+	fake := &fakeOdoo{xmlResponse: xmlResponse, jsonResponse: jsonResponse}
+	return httptest.NewServer(fake)
+}
+
+func (f *fakeOdoo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	io.Copy(io.Discard, r.Body)
+
+	var body []byte
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/xmlrpc/2/"):
+		w.Header().Set("Content-Type", "text/xml")
+		body = f.xmlResponse
+	case r.URL.Path == "/jsonrpc":
+		w.Header().Set("Content-Type", "application/json")
+		body = f.jsonResponse
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	f.bytesSent.Add(int64(len(body)))
+	w.Write(body)
+}
+
+func newTestClient(t testing.TB, protocol, url string) *Client {
+	httpClient := &http.Client{}
+	rpc, err := newTransport(protocol, url, httpClient)
+	require.NoError(t, err)
+	config := Config{URL: url, Database: "odoo", Username: "admin", Password: "admin", CallTimeout: 5 * time.Second}
+	config.Resilience.setDefaults()
+	client := &Client{
+		config:     config,
+		httpClient: httpClient,
+		rpc:        rpc,
+		guards:     newGuards(config.Resilience),
+	}
+	client.auth.uid = 2
+	return client
+}
+
+// productRecords builds n product.template rows with an image of imageSize bytes
+func productRecords(n, imageSize int) []interface{} {
+	image := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, imageSize/4))
+	records := make([]interface{}, n)
+	for i := range records {
+		var description interface{} = false
+		if i%2 == 0 {
+			description = fmt.Sprintf("Description of product %d", i)
+		}
+		records[i] = map[string]interface{}{
+			"id":           int64(i + 1),
+			"name":         fmt.Sprintf("Product %d", i+1),
+			"description":  description,
+			"list_price":   19.5 + float64(i),
+			"default_code": false,
+			"active":       true,
+			"image_1920":   image,
+			"image_1024":   false,
+			"image_128":    image[:64],
+		}
+	}
+	return records
+}
+
+func TestTransportsDecodeTheSameRecords(t *testing.T) {
+	server := newFakeOdoo(t, productRecords(3, 256))
+	defer server.Close()
+
+	var results [][]OdooProductTemplate
+	for _, protocol := range []string{ProtocolXMLRPC, ProtocolJSONRPC} {
+		client := newTestClient(t, protocol, server.URL)
+
+		var products []OdooProductTemplate
+		err := client.SearchRead(context.Background(), "product.template", odoo.NewCriteria(), odoo.NewOptions(), &products)
+		require.NoError(t, err, protocol)
+		results = append(results, products)
+	}
+
+	require.Len(t, results[0], 3)
+	assert.Equal(t, results[0], results[1])
+	assert.Equal(t, "Description of product 0", results[0][0].Description)
+	assert.Empty(t, results[0][1].Description)
+	assert.Empty(t, results[0][0].Image1024)
+	assert.True(t, results[0][0].Active)
+}
+
+func TestJSONRPCFault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":200,"message":"Odoo Server Error",` +
+			`"data":{"name":"odoo.exceptions.AccessError","message":"You are not allowed to access this document"}}}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, ProtocolJSONRPC, server.URL)
+	err := client.Unlink(context.Background(), "res.partner", []int64{1})
+
+	var fault *Error
+	require.ErrorAs(t, err, &fault)
+	assert.Equal(t, 200, fault.Code)
+	assert.Contains(t, fault.Message, "not allowed")
+}
+
+// BenchmarkSearchReadProducts reads 200 products with 64 KiB images over
+// each protocol; wire-bytes/op is the size of the response body.
+func BenchmarkSearchReadProducts(b *testing.B) {
+	records := productRecords(200, 64<<10)
+
+	for _, protocol := range []string{ProtocolXMLRPC, ProtocolJSONRPC} {
+		b.Run(protocol, func(b *testing.B) {
+			server := newFakeOdoo(b, records)
+			defer server.Close()
+			fake := server.Config.Handler.(*fakeOdoo)
+			client := newTestClient(b, protocol, server.URL)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var products []OdooProductTemplate
+				err := client.SearchRead(context.Background(), "product.template", odoo.NewCriteria(), odoo.NewOptions(), &products)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(fake.bytesSent.Load())/float64(b.N), "wire-bytes/op")
+		})
+	}
+}
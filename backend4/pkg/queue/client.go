@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/streadway/amqp"
 )
 
@@ -19,9 +20,16 @@ type Client struct {
 	mu           sync.RWMutex
 	closed       chan struct{}
 	consumers    map[string]ConsumerFunc
+	subscribers  []subscriber
 	reconnecting bool
 }
 
+// subscriber receives copies of the messages published with a routing key
+type subscriber struct {
+	routingKey string
+	handler    ConsumerFunc
+}
+
 type Config struct {
 	URL               string
 	ReconnectInterval time.Duration
@@ -29,10 +37,19 @@ type Config struct {
 }
 
 type Message struct {
+	ID      string // Unique per event, lets consumers drop redeliveries
 	Type    string
 	Payload interface{}
 }
 
+// Publisher publishes messages to a queue
+type Publisher interface {
+	Publish(ctx context.Context, queue string, msg Message) error
+}
+
+// Ensure Client implements Publisher
+var _ Publisher = (*Client)(nil)
+
 func NewClient(config Config) (*Client, error) {
 	if config.ReconnectInterval == 0 {
 		config.ReconnectInterval = 5 * time.Second
@@ -135,6 +152,11 @@ func (c *Client) connect() error {
 			log.Printf("Failed to restore consumer for queue %s: %v", queue, err)
 		}
 	}
+	for _, sub := range c.subscribers {
+		if err := c.startSubscriber(sub.routingKey, sub.handler); err != nil {
+			log.Printf("Failed to restore subscriber for %s: %v", sub.routingKey, err)
+		}
+	}
 
 	return nil
 }
@@ -227,6 +249,10 @@ func (c *Client) Publish(ctx context.Context, queue string, msg Message) error {
 	}
 	c.mu.RUnlock()
 
+	if msg.ID == "" {
+		msg.ID = uuid.New().String()
+	}
+
 	body, err := json.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
@@ -240,6 +266,7 @@ func (c *Client) Publish(ctx context.Context, queue string, msg Message) error {
 		true,        // mandatory
 		false,       // immediate
 		amqp.Publishing{
+			MessageId:    msg.ID,
 			DeliveryMode: amqp.Persistent,
 			ContentType:  "application/json",
 			Body:         body,
@@ -315,6 +342,73 @@ func (c *Client) Consume(queue string, handler ConsumerFunc) error {
 	return c.startConsumer(queue, handler)
 }
 
+// Subscribe delivers a copy of every message published for routingKey to
+// handler, besides the consumer of the queue of that name. Each client gets
+// its own queue, deleted when it disconnects, so every replica sees every
+// message. Failed messages are not redelivered: subscribers suit live
+// updates, not work that must be done.
+func (c *Client) Subscribe(routingKey string, handler ConsumerFunc) error {
+	c.mu.Lock()
+	c.subscribers = append(c.subscribers, subscriber{routingKey: routingKey, handler: handler})
+	c.mu.Unlock()
+
+	return c.startSubscriber(routingKey, handler)
+}
+
+func (c *Client) startSubscriber(routingKey string, handler ConsumerFunc) error {
+	q, err := c.channel.QueueDeclare(
+		"",    // name, chosen by the server
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare subscriber queue: %w", err)
+	}
+	if err := c.channel.QueueBind(q.Name, routingKey, "ecommerce", false, nil); err != nil {
+		return fmt.Errorf("failed to bind subscriber queue: %w", err)
+	}
+
+	msgs, err := c.channel.Consume(
+		q.Name, // queue
+		"",     // consumer
+		true,   // auto-ack
+		true,   // exclusive
+		false,  // no-local
+		false,  // no-wait
+		nil,    // args
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register subscriber: %w", err)
+	}
+
+	go func() {
+		for {
+			select {
+			case <-c.closed:
+				return
+			case delivery, ok := <-msgs:
+				if !ok {
+					return
+				}
+
+				var msg Message
+				if err := json.Unmarshal(delivery.Body, &msg); err != nil {
+					log.Printf("Failed to unmarshal message: %v", err)
+					continue
+				}
+				if err := handler(msg); err != nil {
+					log.Printf("Failed to handle %s message: %v", routingKey, err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
 func (c *Client) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
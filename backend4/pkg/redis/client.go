@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -67,6 +68,22 @@ func (c *Client) Get(ctx context.Context, key string, dest interface{}) error {
 	return nil
 }
 
+// Take reads key into dest and deletes it at once, so only one caller gets
+// it. It reports whether the key existed.
+func (c *Client) Take(ctx context.Context, key string, dest interface{}) (bool, error) {
+	bytes, err := c.client.GetDel(ctx, key).Bytes()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to take %s: %w", key, err)
+	}
+	if err := json.Unmarshal(bytes, dest); err != nil {
+		return false, fmt.Errorf("failed to unmarshal value: %w", err)
+	}
+	return true, nil
+}
+
 func (c *Client) Delete(ctx context.Context, key string) error {
 	result := c.client.Del(ctx, key)
 	if err := result.Err(); err != nil {
@@ -83,3 +100,109 @@ func (c *Client) SetSession(ctx context.Context, sessionID string, data interfac
 func (c *Client) GetSession(ctx context.Context, sessionID string, dest interface{}) error {
 	return c.Get(ctx, fmt.Sprintf("session:%s", sessionID), dest)
 }
+
+// Scan returns all keys matching pattern, iterating with SCAN so Redis is not blocked
+func (c *Client) Scan(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	iter := c.client.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan keys %s: %w", pattern, err)
+	}
+	return keys, nil
+}
+
+// SetNX stores value only if key does not exist yet and reports whether it was stored
+func (c *Client) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal value: %w", err)
+	}
+
+	ok, err := c.client.SetNX(ctx, key, bytes, expiration).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to set cache: %w", err)
+	}
+	return ok, nil
+}
+
+// ZAdd adds member to the sorted set at key with score, or moves it there
+func (c *Client) ZAdd(ctx context.Context, key string, score float64, member string) error {
+	if err := c.client.ZAdd(ctx, key, &redis.Z{Score: score, Member: member}).Err(); err != nil {
+		return fmt.Errorf("failed to add to %s: %w", key, err)
+	}
+	return nil
+}
+
+// ZRem removes members from the sorted set at key
+func (c *Client) ZRem(ctx context.Context, key string, members ...string) error {
+	values := make([]interface{}, len(members))
+	for i, member := range members {
+		values[i] = member
+	}
+	if err := c.client.ZRem(ctx, key, values...).Err(); err != nil {
+		return fmt.Errorf("failed to remove from %s: %w", key, err)
+	}
+	return nil
+}
+
+// ZMembersAbove drops the members of the sorted set at key scored at or
+// below min and returns the rest
+func (c *Client) ZMembersAbove(ctx context.Context, key string, min float64) ([]string, error) {
+	pipe := c.client.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatFloat(min, 'f', -1, 64))
+	members := pipe.ZRange(ctx, key, 0, -1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return members.Val(), nil
+}
+
+// Expire sets the time to live of key
+func (c *Client) Expire(ctx context.Context, key string, expiration time.Duration) error {
+	if err := c.client.Expire(ctx, key, expiration).Err(); err != nil {
+		return fmt.Errorf("failed to expire %s: %w", key, err)
+	}
+	return nil
+}
+
+// Publish sends value as JSON to every subscriber of channel
+func (c *Client) Publish(ctx context.Context, channel string, value interface{}) error {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	if err := c.client.Publish(ctx, channel, bytes).Err(); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", channel, err)
+	}
+	return nil
+}
+
+// Subscribe calls handle with the payload of every message published on
+// channel until ctx is done. The subscription reconnects on its own.
+func (c *Client) Subscribe(ctx context.Context, channel string, handle func(payload []byte)) error {
+	pubsub := c.client.Subscribe(ctx, channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return fmt.Errorf("failed to subscribe to %s: %w", channel, err)
+	}
+
+	go func() {
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				handle([]byte(msg.Payload))
+			}
+		}
+	}()
+	return nil
+}
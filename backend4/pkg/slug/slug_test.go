@@ -0,0 +1,20 @@
+package slug
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMake(t *testing.T) {
+	cases := map[string]string{
+		"Chaises & Fauteuils":   "chaises-fauteuils",
+		"  Tables (Extérieur) ": "tables-exterieur",
+		"Größe_XL":              "große-xl",
+		"Office / Desks 2024":   "office-desks-2024",
+		"---":                   "",
+	}
+	for name, want := range cases {
+		assert.Equal(t, want, Make(name), name)
+	}
+}